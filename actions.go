@@ -0,0 +1,323 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// handleKey feeds a key press through the active keymap.
+// Keys accumulate until they form a bound sequence; in text entry modes,
+// keys that aren't bound to anything are typed into the input line instead.
+func (m *model) handleKey(msg tea.KeyMsg) tea.Cmd {
+	// Any key dismisses a one-off message or an overlay
+	m.status = ""
+	if m.overlay != nil {
+		m.overlay = nil
+		m.pendingKeys = nil
+		return nil
+	}
+
+	m.pendingKeys = append(m.pendingKeys, msg.String())
+	a, found, partial := m.keys.resolve(m.mode, m.pendingKeys)
+
+	switch {
+	case found:
+		m.pendingKeys = nil
+		return m.runAction(a)
+	case partial:
+		return nil // Wait for the rest of the sequence
+	}
+
+	// Not a binding. If a sequence was in progress, abandon it and retry the last key alone
+	if len(m.pendingKeys) > 1 {
+		m.pendingKeys = nil
+		return m.handleKey(msg)
+	}
+	m.pendingKeys = nil
+
+	// Unbound keys in text entry modes edit the input line
+	switch m.mode {
+	case modeFilter:
+		if m.filterInput.handleKey(msg) {
+			// Refilter as the user types; the old cursor position may now point at a different object
+			m.state.filter = m.filterInput.Value()
+			m.applyFilter()
+			m.state.MoveTop()
+		}
+	case modePrompt:
+		if m.prompt != nil {
+			m.prompt.input.handleKey(msg)
+		}
+	}
+	return nil
+}
+
+// runAction performs a named action; every key binding ends up here
+func (m *model) runAction(a action) tea.Cmd {
+	// The permission grid reuses the movement and confirm actions for itself
+	if m.mode == modePerms && m.permGrid != nil {
+		if cmd, handled := m.handlePermGridAction(a); handled {
+			return cmd
+		}
+	}
+	if m.mode == modeMenu && m.menu != nil {
+		if cmd, handled := m.handleMenuAction(a); handled {
+			return cmd
+		}
+	}
+
+	// A commit's tree can be looked at but not changed
+	if m.tree != nil && m.mode == modeNormal && !readOnlyActions[a] {
+		m.status = "read-only: this is the tree of " + m.tree.rev
+		return nil
+	}
+
+	// In the treemap, movement goes to the neighbouring rectangle on screen
+	if m.treemapOn && m.mode == modeNormal {
+		switch a {
+		case actionMoveLeft:
+			m.moveTreemap(-1, 0)
+			return nil
+		case actionMoveDown:
+			m.moveTreemap(0, 1)
+			return nil
+		case actionMoveUp:
+			m.moveTreemap(0, -1)
+			return nil
+		case actionMoveRight:
+			m.moveTreemap(1, 0)
+			return nil
+		}
+	}
+
+	// In Miller columns, left and right go out of and into directories
+	if m.layout == layoutMiller && !m.treemapOn && m.mode == modeNormal {
+		switch a {
+		case actionMoveLeft:
+			return m.leaveDir()
+		case actionMoveRight:
+			return m.millerRight()
+		}
+	}
+
+	// In the tree, left and right collapse and expand directories
+	if m.treeShown() && m.mode == modeNormal {
+		switch a {
+		case actionMoveLeft:
+			return m.treeLeft()
+		case actionMoveRight:
+			m.treeRight()
+			return nil
+		}
+	}
+
+	// Number keys go straight to a tab
+	if i := slices.Index(tabActions, a); i >= 0 {
+		return m.switchTab(i)
+	}
+
+	switch a {
+	case actionMoveLeft:
+		m.state.MoveLeft(m.cols, len(m.objects))
+	case actionMoveDown:
+		m.state.MoveDown(m.rows, m.cols, len(m.objects))
+	case actionMoveUp:
+		m.state.MoveUp(m.rows, m.cols, len(m.objects))
+	case actionMoveRight:
+		m.state.MoveRight(m.cols)
+	case actionTop:
+		m.state.MoveTop()
+	case actionBottom:
+		m.state.MoveBottom(m.rows, m.cols, len(m.objects))
+	case actionOpen:
+		return m.handleSelection()
+	case actionOpenWith:
+		m.openWithMenu()
+	case actionTogglePreview:
+		m.togglePreview()
+	case actionGitStage:
+		return m.gitStage()
+	case actionGitUnstage:
+		return m.gitUnstage()
+	case actionGitDiscard:
+		m.gitDiscard()
+	case actionGitDiff:
+		m.toggleDiffPreview()
+	case actionGitLog:
+		return m.gitLog()
+	case actionDiskUsage:
+		m.toggleDu()
+	case actionRescanUsage:
+		m.rescanDu()
+	case actionFindDupes:
+		return m.findDupes()
+	case actionMarkDupes:
+		m.markDupes()
+	case actionResolveDupes:
+		m.resolveDupes()
+	case actionChecksums:
+		m.checksumMenu()
+	case actionLayout:
+		m.cycleLayout()
+	case actionColumnPrev:
+		m.focusColumn(-1)
+	case actionColumnNext:
+		m.focusColumn(1)
+	case actionColumnNarrow:
+		m.resizeColumn(-1)
+	case actionColumnWiden:
+		m.resizeColumn(1)
+	case actionColumnSort:
+		m.sortByColumn()
+	case actionColumns:
+		m.columnsMenu(0)
+	case actionToggleNode:
+		m.toggleNode()
+	case actionExpandAll:
+		m.promptExpandAll()
+	case actionTrashNode:
+		m.trashNode()
+	case actionNewTab:
+		return m.newTab()
+	case actionCloseTab:
+		return m.closeTab()
+	case actionNextTab:
+		return m.cycleTab(1)
+	case actionPrevTab:
+		return m.cycleTab(-1)
+	case actionCopy:
+		m.promptTransfer(false)
+	case actionMove:
+		m.promptTransfer(true)
+	case actionDualPane:
+		return m.toggleDualPane()
+	case actionSwitchPane:
+		return m.switchPane()
+	case actionSyncPane:
+		return m.syncPane()
+	case actionCompare:
+		m.compareMenu()
+	case actionSync:
+		m.syncMenu()
+	case actionCompress:
+		m.compressMenu()
+	case actionExtract:
+		return m.extractTargets()
+	case actionTreemap:
+		m.toggleTreemap()
+	case actionCycleSort:
+		m.cycleSort()
+	case actionGitBrowse:
+		m.promptBrowse()
+	case actionGitExtract:
+		m.promptExtract()
+	case actionParent:
+		if m.tree != nil && m.tree.atRoot(m.state.currentPath) {
+			m.leaveTree() // Above the commit's top is the disk again
+			return nil
+		}
+		if m.dupes != nil {
+			return m.findDupes() // Back to the directory that was searched
+		}
+		if m.verify != nil {
+			m.leaveVerify() // Back to the manifest
+			return nil
+		}
+		// Move to parent directory by trimming last path segment
+		segments := strings.Split(m.state.currentPath, "/")
+		m.state.currentPath = strings.Join(segments[:len(segments)-1], "/")
+		m.openCurrentPath()
+	case actionFollowLink:
+		m.followLink()
+	case actionInfo:
+		if idx := m.selectedIndex(); idx >= 0 && idx < len(m.objects) {
+			return gatherDetailsCmd(m.objects[idx].Path)
+		}
+	case actionGoto:
+		m.openPrompt("Go to", m.state.currentPath+string(filepath.Separator), (*model).gotoPath)
+	case actionFilter:
+		m.filterInput = newTextInput(m.state.filter)
+		m.mode = modeFilter
+	case actionFilterAccept:
+		m.mode = modeNormal
+	case actionFilterCancel:
+		m.state.filter = ""
+		m.applyFilter()
+		m.mode = modeNormal
+	case actionPromptSubmit:
+		return m.submitPrompt()
+	case actionPromptCancel:
+		m.closePrompt()
+	case actionToggleSelect:
+		m.toggleSelected()
+	case actionSelectAll:
+		m.toggleSelectAll()
+	case actionClearSelection:
+		m.clearSelection()
+	case actionChmod:
+		m.promptChmod()
+	case actionChmodRecursive:
+		m.promptChmodRecursive()
+	case actionChmodGrid:
+		m.openPermGrid()
+	case actionChown:
+		m.promptChown()
+	case actionChgrp:
+		m.promptChgrp()
+	case actionCreateFile:
+		m.promptCreate(false)
+	case actionCreateDir:
+		m.promptCreate(true)
+	case actionYank:
+		m.yank()
+	case actionLinkSymbolic:
+		return m.createLinks(linkSymbolic)
+	case actionLinkRelative:
+		return m.createLinks(linkSymbolicRelative)
+	case actionLinkHard:
+		return m.createLinks(linkHard)
+	case actionHelp:
+		m.openOverlay("Key bindings", m.keys.helpLines())
+	case actionQuit:
+		return tea.Quit
+	}
+	return nil
+}
+
+// gotoPath navigates to a typed path. Relative paths are resolved against the
+// current directory, "~" expands to the home directory, and a file path opens its parent.
+func (m *model) gotoPath(target string) tea.Cmd {
+	if target == "" {
+		return nil
+	}
+	target = m.absPath(target)
+
+	info, err := os.Stat(target)
+	if err != nil {
+		m.status = err.Error()
+		return nil
+	}
+	if !info.IsDir() {
+		target = filepath.Dir(target)
+	}
+
+	m.state.currentPath = target
+	m.openCurrentPath()
+	return nil
+}
+
+// absPath resolves a path typed by the user: "~" is the home directory, and relative paths
+// start from the current directory
+func (m model) absPath(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		path = filepath.Join(getHomeDir(), path[1:])
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(m.state.currentPath, path)
+	}
+	return filepath.Clean(path)
+}
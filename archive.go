@@ -0,0 +1,842 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Limits on what one archive may unpack to, so a zip bomb can't fill the disk
+const (
+	EXTRACT_MAX_BYTES   = 32 << 30  // Content of the files, once unpacked
+	EXTRACT_MAX_ENTRIES = 1_000_000 // Files, directories and links
+)
+
+// archiveFormat is a kind of archive cdx can create and extract
+type archiveFormat struct {
+	name    string   // As shown in menus
+	ext     string   // Extension given to new archives
+	aliases []string // Other extensions recognized when extracting
+}
+
+// archiveFormats are offered in this order
+var archiveFormats = []archiveFormat{
+	{name: "zip", ext: ".zip"},
+	{name: "tar", ext: ".tar"},
+	{name: "tar.gz", ext: ".tar.gz", aliases: []string{".tgz"}},
+	{name: "tar.zst", ext: ".tar.zst", aliases: []string{".tzst"}},
+}
+
+// archiveFormatOf recognizes an archive by its name, returning its format and the name without
+// the extension
+func archiveFormatOf(name string) (archiveFormat, string, bool) {
+	lower := strings.ToLower(name)
+	// Longest extensions first, so "x.tar.gz" isn't taken for a plain tar
+	for i := len(archiveFormats) - 1; i >= 0; i-- {
+		format := archiveFormats[i]
+		for _, ext := range append([]string{format.ext}, format.aliases...) {
+			if strings.HasSuffix(lower, ext) && len(name) > len(ext) {
+				return format, name[:len(name)-len(ext)], true
+			}
+		}
+	}
+	return archiveFormat{}, "", false
+}
+
+// errCancelled is what a background job's work fails with once the job is abandoned
+var errCancelled = errors.New("cancelled")
+
+// errTooLarge ends an extraction that goes over the job's limits
+var errTooLarge = errors.New("stopped: the archive unpacks to more than allowed")
+
+// archiveJob creates or extracts archives in the background
+type archiveJob struct {
+	verb string        // "compress" or "extract", for the top bar
+	done chan struct{} // Closed by stop to abandon the job
+	once sync.Once
+
+	maxBytes   int64 // What one archive may unpack to: EXTRACT_MAX_BYTES and EXTRACT_MAX_ENTRIES
+	maxEntries int
+
+	// Progress, read by the top bar while the job runs
+	processed atomic.Int64 // Bytes read so far
+	total     atomic.Int64 // Bytes to read
+}
+
+// archiveDoneMsg reports the outcome of an archive job
+type archiveDoneMsg struct {
+	job    *archiveJob
+	result opResultMsg
+}
+
+// stop abandons the job
+func (j *archiveJob) stop() {
+	j.once.Do(func() { close(j.done) })
+}
+
+// stopped reports whether the job was abandoned
+func (j *archiveJob) stopped() bool {
+	select {
+	case <-j.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// progressReader counts what is read through it as the job's progress, and fails once the job
+// is abandoned
+type progressReader struct {
+	job *archiveJob
+	r   io.Reader
+}
+
+func (p progressReader) Read(b []byte) (int, error) {
+	if p.job.stopped() {
+		return 0, errCancelled
+	}
+	n, err := p.r.Read(b)
+	p.job.processed.Add(int64(n))
+	return n, err
+}
+
+// startArchiveJob runs work in the background as the current archive job
+func (m *model) startArchiveJob(verb string, work func(job *archiveJob) opResultMsg) tea.Cmd {
+	job := &archiveJob{verb: verb, done: make(chan struct{}), maxBytes: EXTRACT_MAX_BYTES, maxEntries: EXTRACT_MAX_ENTRIES}
+	m.archiveJob = job
+
+	cmds := []tea.Cmd{func() tea.Msg {
+		return archiveDoneMsg{job: job, result: work(job)}
+	}}
+	if !m.spinning {
+		m.spinning = true
+		cmds = append(cmds, spinnerTick())
+	}
+	return tea.Batch(cmds...)
+}
+
+// cancelArchiveJob abandons the running job, reporting whether there was one
+func (m *model) cancelArchiveJob() bool {
+	if m.archiveJob == nil {
+		return false
+	}
+	m.archiveJob.stop()
+	if m.archiveJob.verb == "extract" {
+		m.status = "extraction cancelled; the archive being unpacked is taken back out"
+	} else {
+		m.status = "compression cancelled"
+	}
+	m.archiveJob = nil
+	return true
+}
+
+// showArchiveResult reports on the job still wanted like any other operation
+func (m *model) showArchiveResult(msg archiveDoneMsg) tea.Cmd {
+	if msg.job != m.archiveJob {
+		return nil // Cancelled
+	}
+	m.archiveJob = nil
+	return m.showOpResult(msg.result)
+}
+
+// archiveLabel shows how far the archive job is
+func (m model) archiveLabel() string {
+	if m.archiveJob == nil {
+		return ""
+	}
+	if total := m.archiveJob.total.Load(); total > 0 {
+		return fmt.Sprintf("⇅ %s %d%% ", m.archiveJob.verb, min(m.archiveJob.processed.Load()*100/total, 100))
+	}
+	return "⇅ " + m.archiveJob.verb + " "
+}
+
+// compressMenu asks for the format and name of an archive of the targets, then creates it in the
+// current directory. Paths in the archive are relative to the current directory.
+func (m *model) compressMenu() {
+	if m.cancelArchiveJob() {
+		return
+	}
+	targets := m.targets()
+	if len(targets) == 0 {
+		return
+	}
+
+	var items []string
+	for _, format := range archiveFormats {
+		items = append(items, format.name)
+	}
+	m.openMenu(fmt.Sprintf("Compress %d item(s) as", len(targets)), items, func(m *model, idx int) tea.Cmd {
+		format := archiveFormats[idx]
+
+		// Named after the only target, or after the directory they're in
+		name := filepath.Base(m.state.currentPath)
+		if len(targets) == 1 {
+			name = filepath.Base(targets[0].Path)
+		}
+		m.openPrompt("Archive name", name+format.ext, func(m *model, value string) tea.Cmd {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				return nil
+			}
+			path := value
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(m.state.currentPath, value)
+			}
+
+			create := func(m *model) tea.Cmd {
+				root := m.state.currentPath
+				return m.startArchiveJob("compress", func(job *archiveJob) opResultMsg {
+					result := job.create(path, format, root, targets)
+					if filepath.Dir(path) == root {
+						result.focus = filepath.Base(path)
+					}
+					return result
+				})
+			}
+			if _, err := os.Lstat(path); err != nil {
+				return create(m)
+			}
+			m.openMenu(filepath.Base(path)+" exists: replace it?", []string{"Keep it", "Replace"}, func(m *model, idx int) tea.Cmd {
+				if idx != 1 {
+					return nil
+				}
+				return create(m)
+			})
+			return nil
+		})
+		return nil
+	})
+}
+
+// create writes the targets and everything below them into a new archive. The archive is written
+// under a temporary name and only takes its real name once complete.
+func (j *archiveJob) create(path string, format archiveFormat, root string, targets []FileSystemObject) opResultMsg {
+	result := opResultMsg{verb: "compress into " + filepath.Base(path)}
+
+	// Measure first so the progress means something
+	for _, obj := range targets {
+		filepath.WalkDir(obj.Path, func(_ string, entry fs.DirEntry, err error) error {
+			if err == nil && entry.Type().IsRegular() {
+				if info, err := entry.Info(); err == nil {
+					j.total.Add(info.Size())
+				}
+			}
+			return nil
+		})
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.part")
+	if err != nil {
+		result.failures = append(result.failures, pathError{path: path, err: err})
+		return result
+	}
+	temp := f.Name()
+	f.Chmod(0o644) // Temporary files are private; the archive shouldn't be
+	fail := func(err error) opResultMsg {
+		f.Close()
+		os.Remove(temp)
+		result.done = 0
+		result.failures = append(result.failures, pathError{path: path, err: err})
+		return result
+	}
+
+	var writer archiveWriter
+	switch format.name {
+	case "zip":
+		writer = &zipWriter{job: j, w: zip.NewWriter(f)}
+	case "tar":
+		writer = &tarWriter{job: j, w: tar.NewWriter(f)}
+	case "tar.gz":
+		gz := gzip.NewWriter(f)
+		writer = &tarWriter{job: j, w: tar.NewWriter(gz), compressor: gz}
+	case "tar.zst":
+		zw, err := zstd.NewWriter(f)
+		if err != nil {
+			return fail(err)
+		}
+		writer = &tarWriter{job: j, w: tar.NewWriter(zw), compressor: zw}
+	}
+
+	for _, obj := range targets {
+		err := filepath.WalkDir(obj.Path, func(entryPath string, entry fs.DirEntry, err error) error {
+			if j.stopped() {
+				return errCancelled
+			}
+			if err != nil {
+				result.failures = append(result.failures, pathError{path: entryPath, err: err})
+				return nil
+			}
+			if entryPath == temp || entryPath == path {
+				return nil // Not the archive itself, nor the one it replaces
+			}
+			info, err := entry.Info()
+			if err == nil {
+				var rel string
+				rel, err = filepath.Rel(root, entryPath)
+				if err == nil {
+					err = writer.add(entryPath, filepath.ToSlash(rel), info)
+				}
+			}
+			var entryErr *archiveEntryError
+			switch {
+			case errors.As(err, &entryErr):
+				// Only this entry is lost; the archive itself is still sound
+				result.failures = append(result.failures, pathError{path: entryPath, err: entryErr.err})
+			case err != nil:
+				return err
+			default:
+				result.done++
+			}
+			return nil
+		})
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	if err := writer.close(); err != nil {
+		return fail(err)
+	}
+	if err := f.Close(); err != nil {
+		return fail(err)
+	}
+	if err := os.Rename(temp, path); err != nil {
+		return fail(err)
+	}
+	return result
+}
+
+// archiveWriter adds entries to an archive being created
+type archiveWriter interface {
+	add(path, name string, info fs.FileInfo) error
+	close() error
+}
+
+// archiveEntryError is a failure to read one file being archived, as opposed to a failure to write
+// the archive, which ends the job
+type archiveEntryError struct {
+	err error
+}
+
+func (e *archiveEntryError) Error() string {
+	return e.err.Error()
+}
+
+// tarWriter writes entries to a tar stream, possibly compressed
+type tarWriter struct {
+	job        *archiveJob
+	w          *tar.Writer
+	compressor io.WriteCloser // gzip or zstd under the tar stream, nil for a plain tar
+}
+
+// add writes the header of an entry, with its mode, time and link target, and a regular file's content
+func (t *tarWriter) add(path, name string, info fs.FileInfo) error {
+	link := ""
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return &archiveEntryError{err}
+		}
+		link = target
+	}
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return &archiveEntryError{err}
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+
+	if !info.Mode().IsRegular() {
+		return t.w.WriteHeader(header)
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return &archiveEntryError{err}
+	}
+	defer src.Close()
+	if err := t.w.WriteHeader(header); err != nil {
+		return err
+	}
+	// The size is in the header already: a file that changed meanwhile can't be stored as it is now
+	_, err = io.CopyN(t.w, progressReader{t.job, src}, header.Size)
+	return err
+}
+
+// close finishes the tar stream and its compression
+func (t *tarWriter) close() error {
+	if err := t.w.Close(); err != nil {
+		return err
+	}
+	if t.compressor != nil {
+		return t.compressor.Close()
+	}
+	return nil
+}
+
+// zipWriter writes entries to a zip file
+type zipWriter struct {
+	job *archiveJob
+	w   *zip.Writer
+}
+
+// add writes an entry with its mode and time. Symlinks are stored the Info-ZIP way, as an entry
+// with the link's mode whose content is the target. Zip has no room for other special files.
+func (z *zipWriter) add(path, name string, info fs.FileInfo) error {
+	mode := info.Mode()
+	if !mode.IsRegular() && !mode.IsDir() && mode&fs.ModeSymlink == 0 {
+		return &archiveEntryError{errors.New("zip can't store special files")}
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return &archiveEntryError{err}
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+
+	var content io.Reader
+	switch {
+	case mode&fs.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return &archiveEntryError{err}
+		}
+		content = strings.NewReader(target)
+	case mode.IsRegular():
+		src, err := os.Open(path)
+		if err != nil {
+			return &archiveEntryError{err}
+		}
+		defer src.Close()
+		header.Method = zip.Deflate
+		content = progressReader{z.job, src}
+	}
+
+	w, err := z.w.CreateHeader(header)
+	if err != nil || content == nil {
+		return err
+	}
+	_, err = io.Copy(w, content)
+	return err
+}
+
+// close writes the zip's central directory
+func (z *zipWriter) close() error {
+	return z.w.Close()
+}
+
+// extractConflict says what to do when the folder an archive unpacks into already exists
+type extractConflict int
+
+const (
+	conflictNewFolder extractConflict = iota // Unpack into "name 2" instead
+	conflictOverwrite                        // Merge, replacing files that exist
+	conflictKeep                             // Merge, leaving files that exist alone
+)
+
+// extractTargets unpacks every archive among the targets into a folder named after it, next to it.
+// When some of those folders exist, it asks what to do first.
+func (m *model) extractTargets() tea.Cmd {
+	if m.cancelArchiveJob() {
+		return nil
+	}
+	var archives []FileSystemObject
+	for _, obj := range m.targets() {
+		if _, _, ok := archiveFormatOf(obj.Name); ok && obj.Mode.IsRegular() {
+			archives = append(archives, obj)
+		}
+	}
+	if len(archives) == 0 {
+		m.status = "no zip or tar archive to extract"
+		return nil
+	}
+
+	existing := 0
+	for _, obj := range archives {
+		_, stem, _ := archiveFormatOf(filepath.Base(obj.Path))
+		if _, err := os.Lstat(filepath.Join(filepath.Dir(obj.Path), stem)); err == nil {
+			existing++
+		}
+	}
+	if existing == 0 {
+		return m.startExtract(archives, conflictNewFolder)
+	}
+
+	title := fmt.Sprintf("%d destination folder(s) exist", existing)
+	items := []string{"Cancel", "Extract into new folders", "Merge, replacing existing files", "Merge, keeping existing files"}
+	m.openMenu(title, items, func(m *model, idx int) tea.Cmd {
+		if idx == 0 {
+			return nil
+		}
+		return m.startExtract(archives, extractConflict(idx-1))
+	})
+	return nil
+}
+
+// startExtract unpacks the archives in the background
+func (m *model) startExtract(archives []FileSystemObject, conflict extractConflict) tea.Cmd {
+	return m.startArchiveJob("extract", func(job *archiveJob) opResultMsg {
+		result := opResultMsg{verb: "extract"}
+		for _, obj := range archives {
+			dest, done, failures := job.extractArchive(obj.Path, conflict)
+			result.done += done
+			result.failures = append(result.failures, failures...)
+			if len(archives) == 1 && filepath.Dir(obj.Path) == filepath.Dir(dest) {
+				result.focus = filepath.Base(dest)
+			}
+			if job.stopped() {
+				break
+			}
+		}
+		return result
+	})
+}
+
+// extractArchive unpacks an archive into a folder named after it, next to it. A folder made for
+// it is removed again if the job is cancelled or the archive is too large, along with everything
+// unpacked into it.
+func (j *archiveJob) extractArchive(archive string, conflict extractConflict) (string, int, []pathError) {
+	format, stem, _ := archiveFormatOf(filepath.Base(archive))
+	dest := filepath.Join(filepath.Dir(archive), stem)
+	if conflict == conflictNewFolder {
+		dest = uniqueName(dest)
+	}
+	made := firstMissing(filepath.Dir(dest), dest)
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return dest, 0, []pathError{{path: dest, err: err}}
+	}
+
+	done, failures := j.extract(archive, format, dest, conflict)
+	tooLarge := slices.ContainsFunc(failures, func(f pathError) bool { return errors.Is(f.err, errTooLarge) })
+	if (j.stopped() || tooLarge) && made != "" {
+		os.RemoveAll(made)
+		return dest, 0, failures
+	}
+	return dest, done, failures
+}
+
+// uniqueName returns path, or path with " 2", " 3"... appended when something already has that name
+func uniqueName(path string) string {
+	candidate := path
+	for n := 2; ; n++ {
+		if _, err := os.Lstat(candidate); errors.Is(err, fs.ErrNotExist) {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s %d", path, n)
+	}
+}
+
+// extractedDir is a directory whose mode and time are applied once everything inside is written,
+// since a read-only directory couldn't be filled and writing inside changes its time
+type extractedDir struct {
+	path   string
+	header *tar.Header
+}
+
+// extract unpacks one archive into dest, entry by entry: entries that can't be unpacked are
+// reported and the rest carries on
+func (j *archiveJob) extract(archive string, format archiveFormat, dest string, conflict extractConflict) (int, []pathError) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return 0, []pathError{{path: archive, err: err}}
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, []pathError{{path: archive, err: err}}
+	}
+
+	// Zip entries are read at random and counted as they're unpacked; a tar stream is counted
+	// as it's read
+	if format.name == "zip" {
+		zr, err := zip.NewReader(f, info.Size())
+		if err != nil {
+			return 0, []pathError{{path: archive, err: err}}
+		}
+		// The sizes a zip claims are checked up front; what it really unpacks to is checked as it goes
+		var size uint64
+		for _, entry := range zr.File {
+			size += entry.UncompressedSize64
+		}
+		if size > uint64(j.maxBytes) || len(zr.File) > j.maxEntries {
+			return 0, []pathError{{path: archive, err: fmt.Errorf("%w: %d entries, %s", errTooLarge, len(zr.File), formatSize(int64(min(size, 1<<62))))}}
+		}
+		j.total.Add(int64(size))
+		return j.extractEntries(archive, dest, conflict, func(yield func(*tar.Header, io.Reader) error) error {
+			for _, entry := range zr.File {
+				header := &tar.Header{
+					Name:     entry.Name,
+					Mode:     tarMode(entry.Mode()),
+					ModTime:  entry.Modified,
+					Typeflag: tar.TypeReg,
+				}
+				switch mode := entry.Mode(); {
+				case mode.IsDir() || strings.HasSuffix(entry.Name, "/"):
+					header.Typeflag = tar.TypeDir
+				case mode&fs.ModeSymlink != 0:
+					header.Typeflag = tar.TypeSymlink
+				case !mode.IsRegular():
+					header.Typeflag = tar.TypeFifo // Anything else is refused like a tar's special files
+				}
+
+				rc, err := entry.Open()
+				if err != nil {
+					return err
+				}
+				if header.Typeflag == tar.TypeSymlink {
+					target, err := io.ReadAll(io.LimitReader(rc, 4096))
+					header.Linkname = string(target)
+					if err != nil {
+						rc.Close()
+						return err
+					}
+				}
+				err = yield(header, progressReader{j, rc})
+				rc.Close()
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	j.total.Add(info.Size())
+	var stream io.Reader = progressReader{j, f}
+	switch format.name {
+	case "tar.gz":
+		gz, err := gzip.NewReader(stream)
+		if err != nil {
+			return 0, []pathError{{path: archive, err: err}}
+		}
+		defer gz.Close()
+		stream = gz
+	case "tar.zst":
+		zr, err := zstd.NewReader(stream)
+		if err != nil {
+			return 0, []pathError{{path: archive, err: err}}
+		}
+		defer zr.Close()
+		stream = zr
+	}
+	tr := tar.NewReader(stream)
+	return j.extractEntries(archive, dest, conflict, func(yield func(*tar.Header, io.Reader) error) error {
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := yield(header, tr); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// extractEntries writes the entries that each yields into dest. Failed entries are reported by
+// their name in the archive. An error from each (a corrupt archive, a cancelled job) ends the
+// extraction and is reported against the archive, and so does going over the job's limits.
+func (j *archiveJob) extractEntries(archive, dest string, conflict extractConflict, each func(yield func(*tar.Header, io.Reader) error) error) (int, []pathError) {
+	var done, entries int
+	var failures []pathError
+	var dirs []extractedDir
+	var made []string // Objects that weren't there before, taken back if the job is cancelled
+	budget := &cappedReader{left: j.maxBytes}
+
+	err := each(func(header *tar.Header, content io.Reader) error {
+		if entries++; entries > j.maxEntries {
+			return fmt.Errorf("%w: over %d entries", errTooLarge, j.maxEntries)
+		}
+		budget.r = content
+		content = budget
+
+		path, err := safeExtractPath(dest, header.Name)
+		if err == nil {
+			if missing := firstMissing(dest, path); missing != "" {
+				made = append(made, missing)
+			}
+			var wrote bool
+			wrote, err = writeEntry(dest, path, header, content, conflict)
+			if wrote {
+				done++
+			}
+			if wrote && header.Typeflag == tar.TypeDir {
+				dirs = append(dirs, extractedDir{path: path, header: header})
+			}
+		}
+		if errors.Is(err, errCancelled) || errors.Is(err, errTooLarge) {
+			return err
+		}
+		if err != nil {
+			failures = append(failures, pathError{path: filepath.Base(archive) + ": " + header.Name, err: err})
+		}
+		return nil
+	})
+	if err != nil {
+		failures = append(failures, pathError{path: archive, err: err})
+	}
+	if j.stopped() || errors.Is(err, errTooLarge) {
+		// Nothing half done stays behind. Files replaced in a merge are gone either way.
+		for i := len(made) - 1; i >= 0; i-- {
+			os.RemoveAll(made[i])
+		}
+		return 0, failures
+	}
+
+	// Deepest first, so setting a parent's time isn't undone by its children
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Chmod(dirs[i].path, extractMode(dirs[i].header)|0o700)
+		os.Chtimes(dirs[i].path, dirs[i].header.ModTime, dirs[i].header.ModTime)
+	}
+	return done, failures
+}
+
+// safeExtractPath maps an entry's name to where it goes inside dest. Names that would land outside
+// ("zip slip": absolute paths, ".." climbing out) are refused, and so are names going through a
+// symlink the archive itself created: links are extracted as they are, so nothing may be
+// written through them.
+func safeExtractPath(dest, name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || filepath.VolumeName(clean) != "" || strings.HasPrefix(name, "/") ||
+		clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", errors.New("refused: the path leads outside the destination")
+	}
+
+	path := dest
+	parts := strings.Split(clean, string(filepath.Separator))
+	for _, part := range parts[:len(parts)-1] {
+		path = filepath.Join(path, part)
+		if info, err := os.Lstat(path); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			return "", fmt.Errorf("refused: the path goes through the symlink %s", part)
+		}
+	}
+	return filepath.Join(dest, clean), nil
+}
+
+// writeEntry creates one entry at path, reporting whether it did. Existing files are replaced or
+// kept depending on conflict, never written through: a symlink in their place is replaced too.
+func writeEntry(dest, path string, header *tar.Header, content io.Reader, conflict extractConflict) (bool, error) {
+	if header.Typeflag == tar.TypeDir {
+		if info, err := os.Lstat(path); err == nil && info.IsDir() {
+			return true, nil // Merging into it
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return false, err
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if info.IsDir() {
+			return false, errors.New("a directory is in the way")
+		}
+		if conflict == conflictKeep {
+			return false, nil
+		}
+		if err := os.Remove(path); err != nil {
+			return false, err
+		}
+	}
+
+	mode := extractMode(header)
+	switch header.Typeflag {
+	case tar.TypeDir:
+		return created(os.Mkdir(path, 0o700)) // Its own mode comes once it's filled
+
+	case tar.TypeReg:
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return false, err
+		}
+		_, err = io.Copy(f, content)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+			return false, err
+		}
+		os.Chmod(path, mode)
+		os.Chtimes(path, header.ModTime, header.ModTime)
+		return true, nil
+
+	case tar.TypeSymlink:
+		return created(os.Symlink(header.Linkname, path))
+
+	case tar.TypeLink:
+		// Hard links may only point at what was extracted into dest
+		target, err := safeExtractPath(dest, header.Linkname)
+		if err != nil {
+			return false, err
+		}
+		return created(os.Link(target, path))
+	}
+	return false, errors.New("skipped: special files aren't extracted")
+}
+
+// extractMode is the mode an entry is given: its permissions, along with the setuid, setgid
+// and sticky bits
+func extractMode(header *tar.Header) fs.FileMode {
+	return header.FileInfo().Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+}
+
+// tarMode turns a zip entry's mode into a tar header's, for the permissions and special bits
+func tarMode(mode fs.FileMode) int64 {
+	bits := int64(mode.Perm())
+	for flag, bit := range map[fs.FileMode]int64{fs.ModeSetuid: 0o4000, fs.ModeSetgid: 0o2000, fs.ModeSticky: 0o1000} {
+		if mode&flag != 0 {
+			bits |= bit
+		}
+	}
+	return bits
+}
+
+// cappedReader reads the content of an archive's entries in turn, failing with errTooLarge once
+// more than left bytes were read from them all
+type cappedReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (c *cappedReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	if c.left -= int64(n); c.left < 0 {
+		return n, errTooLarge
+	}
+	return n, err
+}
+
+// firstMissing returns the outermost of path and the directories leading to it from below dir
+// that don't exist yet, which creating path creates; "" when path exists
+func firstMissing(dir, path string) string {
+	missing := ""
+	for p := path; p != dir && strings.HasPrefix(p, dir+string(filepath.Separator)); p = filepath.Dir(p) {
+		if _, err := os.Lstat(p); err == nil {
+			break
+		}
+		missing = p
+	}
+	return missing
+}
+
+// created is what writeEntry returns after the call creating the entry
+func created(err error) (bool, error) {
+	return err == nil, err
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// archiveTestTime is given to every object archived; even seconds survive zip's DOS times too
+var archiveTestTime = time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC)
+
+// newArchiveJob returns a job that isn't tied to a model, with the usual limits
+func newArchiveJob() *archiveJob {
+	return &archiveJob{done: make(chan struct{}), maxBytes: EXTRACT_MAX_BYTES, maxEntries: EXTRACT_MAX_ENTRIES}
+}
+
+// archiveTestTree creates a directory to archive: files with different modes, a nested directory
+// and a relative symlink, all modified at archiveTestTime
+func archiveTestTree(t *testing.T, dir string) string {
+	t.Helper()
+	root := filepath.Join(dir, "tree")
+	writeFile(t, root, "script.sh", "#!/bin/sh\necho hi\n", archiveTestTime)
+	writeFile(t, root, "private", "secret\n", archiveTestTime)
+	writeFile(t, root, "sub/nested.txt", "nested\n", archiveTestTime)
+	os.Chmod(filepath.Join(root, "script.sh"), 0o755)
+	os.Chmod(filepath.Join(root, "private"), 0o600)
+	if err := os.Symlink("sub/nested.txt", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []string{filepath.Join(root, "sub"), root} {
+		os.Chtimes(d, archiveTestTime, archiveTestTime)
+	}
+	return root
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	for _, format := range archiveFormats {
+		t.Run(format.name, func(t *testing.T) {
+			dir := tempDir(t)
+			root := archiveTestTree(t, dir)
+			target := FileSystemObject{Path: root}
+			target.load()
+
+			archive := filepath.Join(dir, "out"+format.ext)
+			result := newArchiveJob().create(archive, format, dir, []FileSystemObject{target})
+			if len(result.failures) > 0 {
+				t.Fatalf("create: %v", result.failures)
+			}
+			if result.done != 6 {
+				t.Errorf("%d entries archived, want 6", result.done)
+			}
+
+			dest, done, failures := newArchiveJob().extractArchive(archive, conflictNewFolder)
+			if len(failures) > 0 {
+				t.Fatalf("extract: %v", failures)
+			}
+			if dest != filepath.Join(dir, "out") || done != 6 {
+				t.Errorf("extracted %d entries into %s", done, dest)
+			}
+
+			out := filepath.Join(dest, "tree")
+			for rel, mode := range map[string]fs.FileMode{"script.sh": 0o755, "private": 0o600, "sub/nested.txt": 0o644} {
+				info, err := os.Lstat(filepath.Join(out, rel))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode().Perm() != mode {
+					t.Errorf("%s: mode %v, want %v", rel, info.Mode().Perm(), mode)
+				}
+				if !info.ModTime().Equal(archiveTestTime) {
+					t.Errorf("%s: modified %v, want %v", rel, info.ModTime(), archiveTestTime)
+				}
+			}
+			if got := readFile(t, filepath.Join(out, "script.sh")); got != "#!/bin/sh\necho hi\n" {
+				t.Errorf("content changed: %q", got)
+			}
+			if target, err := os.Readlink(filepath.Join(out, "link")); err != nil || target != "sub/nested.txt" {
+				t.Errorf("link: %q, %v", target, err)
+			}
+			if info, err := os.Stat(filepath.Join(out, "sub")); err != nil || !info.ModTime().Equal(archiveTestTime) {
+				t.Errorf("directory time not restored: %v", err)
+			}
+		})
+	}
+}
+
+// hostileEntry is an entry of a handmade archive
+type hostileEntry struct {
+	name, link string
+	typeflag   byte
+}
+
+// writeHostileTar writes a tar archive with the given entries, regular files holding "pwned"
+func writeHostileTar(t *testing.T, path string, entries []hostileEntry) {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Linkname: e.link, Typeflag: e.typeflag, Mode: 0o644, ModTime: archiveTestTime}
+		if e.typeflag == tar.TypeReg {
+			header.Size = 5
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if e.typeflag == tar.TypeReg {
+			tw.Write([]byte("pwned"))
+		}
+	}
+	tw.Close()
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractRefusesHostileEntries(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		entries []hostileEntry
+	}{
+		{"parent", []hostileEntry{{name: "../escaped", typeflag: tar.TypeReg}}},
+		{"nested parent", []hostileEntry{{name: "a/../../escaped", typeflag: tar.TypeReg}}},
+		{"absolute", []hostileEntry{{name: "/OUTSIDE/escaped", typeflag: tar.TypeReg}}},
+		{"through symlink", []hostileEntry{
+			{name: "link", link: "../outside", typeflag: tar.TypeSymlink},
+			{name: "link/escaped", typeflag: tar.TypeReg},
+		}},
+		{"hardlink out", []hostileEntry{{name: "hard", link: "../outside/victim", typeflag: tar.TypeLink}}},
+		{"hardlink absolute", []hostileEntry{{name: "hard", link: "/OUTSIDE/victim", typeflag: tar.TypeLink}}},
+		{"hardlink through symlink", []hostileEntry{
+			{name: "link", link: "../outside", typeflag: tar.TypeSymlink},
+			{name: "hard", link: "link/victim", typeflag: tar.TypeLink},
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := tempDir(t)
+			outside := filepath.Join(dir, "outside")
+			victim := writeFile(t, outside, "victim", "untouched", time.Time{})
+			entries := tc.entries
+			for i := range entries {
+				entries[i].name = strings.ReplaceAll(entries[i].name, "/OUTSIDE", outside)
+				entries[i].link = strings.ReplaceAll(entries[i].link, "/OUTSIDE", outside)
+			}
+
+			archive := filepath.Join(dir, "evil.tar")
+			writeHostileTar(t, archive, entries)
+			dest, _, failures := newArchiveJob().extractArchive(archive, conflictNewFolder)
+
+			if len(failures) == 0 || !strings.Contains(failures[len(failures)-1].err.Error(), "refused") {
+				t.Errorf("the entry wasn't refused: %v", failures)
+			}
+			assertMissing(t, filepath.Join(dir, "escaped"))
+			assertMissing(t, filepath.Join(outside, "escaped"))
+			assertMissing(t, filepath.Join(dest, "hard"))
+			if got := readFile(t, victim); got != "untouched" {
+				t.Errorf("the file outside was changed: %q", got)
+			}
+			if info, err := os.Stat(victim); err == nil {
+				if _, _, links, ok := fileInfoID(info); ok && links != 1 {
+					t.Errorf("the file outside got %d links", links)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractRefusesZipSlip(t *testing.T) {
+	dir := tempDir(t)
+	archive := filepath.Join(dir, "evil.zip")
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("../escaped")
+	w.Write([]byte("pwned"))
+	zw.Close()
+	os.WriteFile(archive, buf.Bytes(), 0o644)
+
+	_, done, failures := newArchiveJob().extractArchive(archive, conflictNewFolder)
+	if done != 0 || len(failures) != 1 {
+		t.Errorf("extracted %d, failures %v", done, failures)
+	}
+	assertMissing(t, filepath.Join(dir, "escaped"))
+}
+
+func TestExtractKeepsSpecialModeBits(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no setuid, setgid or sticky bits on Windows")
+	}
+	dir := tempDir(t)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, h := range []*tar.Header{
+		{Name: "shared/", Typeflag: tar.TypeDir, Mode: 0o1777},
+		{Name: "shared/tool", Typeflag: tar.TypeReg, Mode: 0o4755},
+	} {
+		tw.WriteHeader(h)
+	}
+	tw.Close()
+	os.WriteFile(filepath.Join(dir, "modes.tar"), buf.Bytes(), 0o644)
+
+	buf.Reset()
+	zw := zip.NewWriter(&buf)
+	header := &zip.FileHeader{Name: "group"}
+	header.SetMode(0o755 | fs.ModeSetgid)
+	zw.CreateHeader(header)
+	zw.Close()
+	os.WriteFile(filepath.Join(dir, "modes.zip"), buf.Bytes(), 0o644)
+
+	for _, archive := range []string{"modes.tar", "modes.zip"} {
+		if _, _, failures := newArchiveJob().extractArchive(filepath.Join(dir, archive), conflictKeep); len(failures) > 0 {
+			t.Fatal(failures)
+		}
+	}
+	for rel, want := range map[string]fs.FileMode{
+		"modes/shared":      fs.ModeDir | fs.ModeSticky | 0o777,
+		"modes/shared/tool": fs.ModeSetuid | 0o755,
+		"modes/group":       fs.ModeSetgid | 0o755,
+	} {
+		if info, err := os.Lstat(filepath.Join(dir, rel)); err != nil {
+			t.Error(err)
+		} else if info.Mode() != want {
+			t.Errorf("%s: %v, want %v", rel, info.Mode(), want)
+		}
+	}
+}
+
+func TestExtractStopsAtLimits(t *testing.T) {
+	dir := tempDir(t)
+	tarball := filepath.Join(dir, "many.tar")
+	writeHostileTar(t, tarball, []hostileEntry{
+		{name: "a", typeflag: tar.TypeReg}, {name: "b", typeflag: tar.TypeReg}, {name: "c", typeflag: tar.TypeReg},
+	})
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("zeros")
+	w.Write(make([]byte, 1<<20))
+	zw.Close()
+	zipped := filepath.Join(dir, "bomb.zip")
+	os.WriteFile(zipped, buf.Bytes(), 0o644)
+
+	for _, tc := range []struct {
+		name       string
+		archive    string
+		maxBytes   int64
+		maxEntries int
+	}{
+		{"bytes", tarball, 12, 10},   // The third file goes over
+		{"entries", tarball, 100, 2}, // So does the third entry
+		{"zip", zipped, 1 << 10, 10}, // Claims a megabyte up front
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			job := newArchiveJob()
+			job.maxBytes, job.maxEntries = tc.maxBytes, tc.maxEntries
+			dest, done, failures := job.extractArchive(tc.archive, conflictNewFolder)
+			if done != 0 || len(failures) != 1 || !errors.Is(failures[0].err, errTooLarge) {
+				t.Errorf("extracted %d, failures %v", done, failures)
+			}
+			assertMissing(t, dest)
+		})
+	}
+}
+
+// bigArchiveTree creates enough data that archiving it takes a while
+func bigArchiveTree(t *testing.T, dir string) string {
+	t.Helper()
+	root := filepath.Join(dir, "big")
+	chunk := strings.Repeat("x", 1<<20)
+	for i := range 64 {
+		writeFile(t, root, filepath.Join("d", strings.Repeat("f", i+1)), chunk, time.Time{})
+	}
+	return root
+}
+
+// cancelOnceStarted stops a job as soon as it has processed something, while work runs
+func cancelOnceStarted[T any](job *archiveJob, work func() T) T {
+	done := make(chan T)
+	go func() { done <- work() }()
+	for job.processed.Load() == 0 {
+		time.Sleep(10 * time.Microsecond)
+	}
+	job.stop()
+	return <-done
+}
+
+func TestCancelledCompressionLeavesNothing(t *testing.T) {
+	dir := tempDir(t)
+	root := bigArchiveTree(t, dir)
+	target := FileSystemObject{Path: root}
+	target.load()
+
+	job := newArchiveJob()
+	archive := filepath.Join(dir, "big.tar")
+	result := cancelOnceStarted(job, func() opResultMsg {
+		return job.create(archive, archiveFormats[1], dir, []FileSystemObject{target})
+	})
+
+	if len(result.failures) != 1 || result.failures[0].err != errCancelled {
+		t.Errorf("failures: %v", result.failures)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("left behind: %v", entries)
+	}
+}
+
+func TestCancelledExtractionLeavesNothing(t *testing.T) {
+	dir := tempDir(t)
+	root := bigArchiveTree(t, dir)
+	target := FileSystemObject{Path: root}
+	target.load()
+	archive := filepath.Join(dir, "big.tar")
+	if result := newArchiveJob().create(archive, archiveFormats[1], dir, []FileSystemObject{target}); len(result.failures) > 0 {
+		t.Fatal(result.failures)
+	}
+
+	// Into a folder of its own, and merged into one that's there, with a file of its own
+	existing := writeFile(t, dir, "merged/mine", "mine", time.Time{})
+	os.Rename(archive, filepath.Join(dir, "merged.tar"))
+	archive = filepath.Join(dir, "merged.tar")
+	for _, conflict := range []extractConflict{conflictNewFolder, conflictOverwrite} {
+		job := newArchiveJob()
+		type outcome struct {
+			dest string
+			done int
+		}
+		got := cancelOnceStarted(job, func() outcome {
+			dest, done, _ := job.extractArchive(archive, conflict)
+			return outcome{dest, done}
+		})
+		if got.done == 65 {
+			t.Skip("the extraction finished before it could be cancelled")
+		}
+
+		if conflict == conflictNewFolder {
+			assertMissing(t, got.dest)
+		} else {
+			entries, _ := os.ReadDir(got.dest)
+			if len(entries) != 1 || readFile(t, existing) != "mine" {
+				t.Errorf("merge left behind: %v", entries)
+			}
+		}
+	}
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+	"lukechampine.com/blake3"
+)
+
+// Verification results on tiles
+var (
+	styleVerifyOK      = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	styleVerifyFailed  = lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Bold(true)
+	styleVerifyMissing = lipgloss.NewStyle().Foreground(lipgloss.Color("3"))
+)
+
+// hashAlgorithm is a checksum cdx can compute and the manifest it's usually kept in
+type hashAlgorithm struct {
+	name     string // As shown in menus
+	manifest string // Conventional name of the list of sums, e.g. "SHA256SUMS"
+	new      func() hash.Hash
+}
+
+// hashAlgorithms are offered in this order
+var hashAlgorithms = []hashAlgorithm{
+	{"MD5", "MD5SUMS", md5.New},
+	{"SHA-1", "SHA1SUMS", sha1.New},
+	{"SHA-256", "SHA256SUMS", sha256.New},
+	{"BLAKE3", "B3SUMS", func() hash.Hash { return blake3.New(32, nil) }},
+}
+
+// checksum is the sum of one file, or why there is none
+type checksum struct {
+	path     string // Absolute path
+	rel      string // As written in manifests: relative to the directory the sums are for
+	sum      string // Lowercase hex
+	expected string // Sum a manifest lists, when verifying
+	err      error
+}
+
+// status is the outcome of verifying a file against its manifest
+func (c checksum) status() string {
+	switch {
+	case errors.Is(c.err, fs.ErrNotExist):
+		return "missing"
+	case c.err != nil:
+		return "unreadable"
+	case c.sum == c.expected:
+		return "ok"
+	default:
+		return "FAILED"
+	}
+}
+
+// hashJob computes checksums in the background, on all CPUs
+type hashJob struct {
+	done chan struct{} // Closed by stop to abandon the job
+	once sync.Once
+
+	// Progress, read by the top bar while the job runs
+	hashed atomic.Int64 // Bytes hashed so far
+	total  atomic.Int64 // Bytes to hash
+}
+
+// checksumsMsg delivers the sums of a job and what to do with them
+type checksumsMsg struct {
+	job  *hashJob
+	sums []checksum
+	then func(m *model, sums []checksum) tea.Cmd
+}
+
+// stop abandons the job
+func (j *hashJob) stop() {
+	j.once.Do(func() { close(j.done) })
+}
+
+// sumAll hashes the files in parallel; files that can't be read keep their error
+func (j *hashJob) sumAll(sums []checksum, algorithm hashAlgorithm) {
+	for _, c := range sums {
+		if info, err := os.Stat(c.path); err == nil {
+			j.total.Add(info.Size())
+		}
+	}
+
+	jobs := make(chan *checksum)
+	var wg sync.WaitGroup
+	for range runtime.NumCPU() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range jobs {
+				c.sum, c.err = j.sumFile(c.path, algorithm.new())
+			}
+		}()
+	}
+	for i := range sums {
+		if sums[i].err == nil {
+			jobs <- &sums[i]
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// sumFile hashes one file, counting the progress
+func (j *hashJob) sumFile(path string, h hash.Hash) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	buf := make([]byte, 256*1024)
+	for {
+		select {
+		case <-j.done:
+			return "", errCancelled
+		default:
+		}
+		n, err := f.Read(buf)
+		h.Write(buf[:n])
+		j.hashed.Add(int64(n))
+		if err == io.EOF {
+			return hex.EncodeToString(h.Sum(nil)), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// startHashJob hashes files in the background and hands the sums to then
+func (m *model) startHashJob(sums []checksum, algorithm hashAlgorithm, then func(m *model, sums []checksum) tea.Cmd) tea.Cmd {
+	if m.hashJob != nil {
+		m.hashJob.stop()
+	}
+	job := &hashJob{done: make(chan struct{})}
+	m.hashJob = job
+
+	cmds := []tea.Cmd{func() tea.Msg {
+		job.sumAll(sums, algorithm)
+		return checksumsMsg{job: job, sums: sums, then: then}
+	}}
+	if !m.spinning {
+		m.spinning = true
+		cmds = append(cmds, spinnerTick())
+	}
+	return tea.Batch(cmds...)
+}
+
+// showChecksums hands the sums of the job still wanted to what asked for them
+func (m *model) showChecksums(msg checksumsMsg) tea.Cmd {
+	if msg.job != m.hashJob {
+		return nil // Cancelled or replaced
+	}
+	m.hashJob = nil
+	return msg.then(m, msg.sums)
+}
+
+// checksumLabel shows how far the checksums are, or the outcome of the verification shown
+func (m model) checksumLabel() string {
+	switch {
+	case m.hashJob != nil:
+		if total := m.hashJob.total.Load(); total > 0 {
+			return fmt.Sprintf("# %d%% ", m.hashJob.hashed.Load()*100/total)
+		}
+		return "# "
+	case m.verify != nil:
+		return m.verify.label()
+	}
+	return ""
+}
+
+// collectSumTargets lists the files below the targets, with paths relative to the current directory
+func (m *model) collectSumTargets() []checksum {
+	var sums []checksum
+	for _, obj := range m.targets() {
+		filepath.WalkDir(obj.Path, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || !entry.Type().IsRegular() {
+				return nil // Symlinks and special files have no content of their own to sum
+			}
+			rel, err := filepath.Rel(m.state.currentPath, path)
+			if err != nil {
+				rel = path
+			}
+			sums = append(sums, checksum{path: path, rel: filepath.ToSlash(rel)})
+			return nil
+		})
+	}
+	return sums
+}
+
+// checksumMenu offers the algorithms for the targets, and writing a SHA256SUMS manifest
+func (m *model) checksumMenu() {
+	if m.hashJob != nil {
+		m.hashJob.stop()
+		m.hashJob = nil
+		m.status = "checksums cancelled"
+		return
+	}
+	if m.tree != nil {
+		m.status = "checksums work on files on disk"
+		return
+	}
+	sums := m.collectSumTargets()
+	if len(sums) == 0 {
+		m.status = "no files to sum"
+		return
+	}
+
+	var items []string
+	for _, a := range hashAlgorithms {
+		items = append(items, a.name)
+	}
+	items = append(items, "Write SHA256SUMS here")
+	title := fmt.Sprintf("Checksums of %d file(s)", len(sums))
+	m.openMenu(title, items, func(m *model, idx int) tea.Cmd {
+		if idx == len(hashAlgorithms) {
+			return m.writeManifest(sums, hashAlgorithms[2])
+		}
+		algorithm := hashAlgorithms[idx]
+		return m.startHashJob(sums, algorithm, func(m *model, sums []checksum) tea.Cmd {
+			m.showSumsPanel(algorithm, sums, 0)
+			return nil
+		})
+	})
+}
+
+// showSumsPanel lists the sums in a menu; picking a line copies its sum to the clipboard,
+// the first line copies them all in manifest format
+func (m *model) showSumsPanel(algorithm hashAlgorithm, sums []checksum, cursor int) {
+	items := []string{"Copy all"}
+	for _, c := range sums {
+		if c.err != nil {
+			items = append(items, fmt.Sprintf("%-*s  %s", len(sums[0].sum), "error: "+c.err.Error(), c.rel))
+		} else {
+			items = append(items, c.sum+"  "+c.rel)
+		}
+	}
+
+	title := algorithm.name + " (Enter copies)"
+	m.openMenu(title, items, func(m *model, idx int) tea.Cmd {
+		if idx == 0 {
+			termenv.Copy(manifestText(sums))
+			m.status = fmt.Sprintf("copied %d sums", len(sums))
+		} else if c := sums[idx-1]; c.err == nil {
+			termenv.Copy(c.sum)
+			m.status = "copied the sum of " + c.rel
+		}
+		// Stay in the panel so more lines can be copied
+		m.showSumsPanel(algorithm, sums, idx)
+		return nil
+	})
+	m.menu.cursor = cursor
+}
+
+// manifestText formats sums like sha256sum does: "sum  path" per line, files that failed left out
+func manifestText(sums []checksum) string {
+	var b strings.Builder
+	for _, c := range sums {
+		if c.err == nil {
+			fmt.Fprintf(&b, "%s  %s\n", c.sum, c.rel)
+		}
+	}
+	return b.String()
+}
+
+// writeManifest sums the files and writes the manifest into the current directory, asking before
+// replacing an existing one
+func (m *model) writeManifest(sums []checksum, algorithm hashAlgorithm) tea.Cmd {
+	path := filepath.Join(m.state.currentPath, algorithm.manifest)
+	// The manifest doesn't list itself
+	sums = slices.DeleteFunc(sums, func(c checksum) bool { return c.path == path })
+
+	write := func(m *model) tea.Cmd {
+		return m.startHashJob(sums, algorithm, func(m *model, sums []checksum) tea.Cmd {
+			return func() tea.Msg {
+				result := opResultMsg{verb: "write " + algorithm.manifest, focus: algorithm.manifest}
+				for _, c := range sums {
+					if c.err != nil {
+						result.failures = append(result.failures, pathError{path: c.rel, err: c.err})
+					}
+				}
+				if err := os.WriteFile(path, []byte(manifestText(sums)), 0o644); err != nil {
+					result.failures = append(result.failures, pathError{path: path, err: err})
+				} else {
+					result.done = len(sums) - len(result.failures)
+				}
+				return result
+			}
+		})
+	}
+	if _, err := os.Lstat(path); err != nil {
+		return write(m)
+	}
+	m.openMenu(algorithm.manifest+" exists: replace it?", []string{"Keep it", "Replace"}, func(m *model, idx int) tea.Cmd {
+		if idx != 1 {
+			return nil
+		}
+		return write(m)
+	})
+	return nil
+}
+
+// isManifest reports whether a file name looks like a list of checksums (SHA256SUMS, MD5SUMS...)
+func isManifest(name string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(strings.ToUpper(name), ".TXT"), "SUMS")
+}
+
+// parseManifest reads a list of checksums in the GNU format ("sum  path", "sum *path") or the
+// BSD one ("SHA256 (path) = sum"). Paths are relative to the manifest's directory.
+func parseManifest(path string) ([]checksum, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dir := filepath.Dir(path)
+	var sums []checksum
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var sum, rel string
+		if open := strings.Index(line, " ("); open > 0 && strings.Contains(line, ") = ") {
+			close := strings.LastIndex(line, ") = ")
+			rel, sum = line[open+2:close], line[close+4:]
+		} else {
+			var ok bool
+			sum, rel, ok = strings.Cut(line, " ")
+			if !ok {
+				continue
+			}
+			rel = strings.TrimPrefix(strings.TrimPrefix(rel, " "), "*")
+		}
+		if _, err := hex.DecodeString(sum); err != nil || rel == "" {
+			continue
+		}
+		sums = append(sums, checksum{
+			path:     filepath.Join(dir, filepath.FromSlash(rel)),
+			rel:      rel,
+			expected: strings.ToLower(sum),
+		})
+	}
+	return sums, scanner.Err()
+}
+
+// manifestAlgorithm picks the algorithm of a manifest from its name, or from the length of its sums
+func manifestAlgorithm(name string, sums []checksum) (hashAlgorithm, error) {
+	upper := strings.ToUpper(name)
+	for _, prefix := range []struct {
+		prefix string
+		idx    int
+	}{{"MD5", 0}, {"SHA1", 1}, {"SHA256", 2}, {"B3", 3}, {"BLAKE3", 3}} {
+		if strings.HasPrefix(upper, prefix.prefix) {
+			return hashAlgorithms[prefix.idx], nil
+		}
+	}
+	if len(sums) > 0 {
+		switch len(sums[0].expected) {
+		case 32:
+			return hashAlgorithms[0], nil
+		case 40:
+			return hashAlgorithms[1], nil
+		case 64:
+			return hashAlgorithms[2], nil // SHA-256 is by far the most common of the two 64-digit sums
+		}
+	}
+	return hashAlgorithm{}, fmt.Errorf("%s: unknown kind of checksums", name)
+}
+
+// offerVerify asks whether to verify the files a manifest lists or open it like any file
+func (m *model) offerVerify(obj FileSystemObject) tea.Cmd {
+	sums, err := parseManifest(obj.Path)
+	if err != nil || len(sums) == 0 {
+		return m.openFile(obj.Path)
+	}
+	algorithm, err := manifestAlgorithm(obj.Name, sums)
+	if err != nil {
+		return m.openFile(obj.Path)
+	}
+
+	title := fmt.Sprintf("%s lists %d %s sum(s)", obj.Name, len(sums), algorithm.name)
+	m.openMenu(title, []string{"Verify them", "Open the file"}, func(m *model, idx int) tea.Cmd {
+		if idx == 1 {
+			return m.openFile(obj.Path)
+		}
+		return m.startHashJob(sums, algorithm, func(m *model, sums []checksum) tea.Cmd {
+			// The listed paths are relative to the manifest, wherever it was opened from
+			m.dupes = nil
+			m.verify = &verifyView{manifest: obj.Path, sums: sums}
+			m.state.currentPath = filepath.Dir(obj.Path)
+			m.openCurrentPath()
+			return nil
+		})
+	})
+	return nil
+}
+
+// leaveVerify goes back to the directory of the manifest, with the cursor on it
+func (m *model) leaveVerify() {
+	manifest := m.verify.manifest
+	m.verify = nil
+	m.openCurrentPath()
+	m.pendingFocus = filepath.Base(manifest)
+}
+
+// verifyView lists the files of a manifest with the outcome of their verification
+type verifyView struct {
+	manifest string
+	sums     []checksum
+}
+
+// list gives the files of the manifest in its order, named as the manifest names them
+func (v *verifyView) list(string) ([]FileSystemObject, error) {
+	objects := make([]FileSystemObject, 0, len(v.sums))
+	for _, c := range v.sums {
+		obj := FileSystemObject{Path: c.path}
+		obj.load()
+		obj.Name = c.rel
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// result returns the status of a file and the style its tile shows it in
+func (v *verifyView) result(path string) (string, lipgloss.Style, bool) {
+	for _, c := range v.sums {
+		if c.path != path {
+			continue
+		}
+		switch status := c.status(); status {
+		case "ok":
+			return "✓ ok", styleVerifyOK, true
+		case "FAILED":
+			return "✗ FAILED", styleVerifyFailed, true
+		default:
+			return "? " + status, styleVerifyMissing, true
+		}
+	}
+	return "", lipgloss.Style{}, false
+}
+
+// label is the top bar summary of a verification
+func (v *verifyView) label() string {
+	counts := map[string]int{}
+	for _, c := range v.sums {
+		counts[c.status()]++
+	}
+	label := fmt.Sprintf("%d ok", counts["ok"])
+	for _, status := range []string{"FAILED", "missing", "unreadable"} {
+		if counts[status] > 0 {
+			label += fmt.Sprintf(", %d %s", counts[status], status)
+		}
+	}
+	return label + " "
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"maps"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// The dual-pane view shows a second directory beside the one on screen, Norton Commander style.
+// The focused pane is the model itself, as with a single pane; the other one waits in m.pane,
+// a tab like those switched between, whose objects are kept ready to draw.
+
+// toggleDualPane splits the explorer in two, the new pane starting at the current directory,
+// or goes back to a single pane
+func (m *model) toggleDualPane() tea.Cmd {
+	if m.pane != nil {
+		m.pane = nil
+		m.compare = nil // It was between the two panes
+		if m.compareJob != nil {
+			m.compareJob.stop()
+			m.compareJob = nil
+		}
+		m.keepFocus(true, m.resize)
+		m.status = "single pane"
+		return nil
+	}
+
+	other := m.currentTab()
+	other.state.selected = nil // Marks stay with the pane they were made in
+	other.state.expanded = maps.Clone(other.state.expanded)
+	other.children = maps.Clone(other.children)
+	m.pane = &other
+	m.paneOnLeft = false
+	m.keepFocus(true, m.resize)
+	m.syncPaneObjects() // Shown as the focused pane's listing until it's read again
+	m.status = "dual pane: tab switches sides"
+	if m.previewOn && !m.previewShown() {
+		m.status += "; the preview pane returns with a single pane"
+	}
+	return m.readPane()
+}
+
+// switchPane moves the focus to the other pane
+func (m *model) switchPane() tea.Cmd {
+	if m.pane == nil {
+		m.status = "only in the dual-pane view (" + m.keys.keyLabel(modeNormal, actionDualPane) + ")"
+		return nil
+	}
+	other := *m.pane
+	*m.pane = m.currentTab()
+	var cmd tea.Cmd
+	if m.pane.listing == nil {
+		cmd = m.readPane() // It was still loading, or it's a list of its own
+	}
+	m.paneOnLeft = !m.paneOnLeft
+	m.watcher, m.paneWatcher = m.paneWatcher, m.watcher // Each keeps watching its directory
+	return tea.Batch(cmd, m.showTab(other))
+}
+
+// syncPane takes the other pane to the focused pane's directory
+func (m *model) syncPane() tea.Cmd {
+	if m.pane == nil {
+		m.status = "only in the dual-pane view (" + m.keys.keyLabel(modeNormal, actionDualPane) + ")"
+		return nil
+	}
+	m.pane = &tab{state: state{
+		currentPath: m.state.currentPath,
+		sort:        m.pane.state.sort,
+		sortReverse: m.pane.state.sortReverse,
+		expanded:    m.pane.state.expanded,
+	}}
+	m.status = "other pane: " + m.state.currentPath
+	return m.readPane()
+}
+
+// readPane reads the other pane's directory again in the background, like refreshListing does for
+// the focused one. The views listed in place of a directory are listed at once.
+func (m *model) readPane() tea.Cmd {
+	if m.pane == nil {
+		return nil
+	}
+	var list func(path string) ([]FileSystemObject, error)
+	switch {
+	case m.pane.tree != nil:
+		list = m.pane.tree.list
+	case m.pane.dupes != nil:
+		list = m.pane.dupes.list
+	case m.pane.verify != nil:
+		list = m.pane.verify.list
+	}
+	path := m.pane.state.currentPath
+	if list != nil {
+		listing, err := list(path)
+		m.showPaneListing(listingRefreshedMsg{path: path, listing: listing, err: err, pane: true}, true)
+		return nil
+	}
+
+	// The directories expanded in its tree are read along
+	refresh := refreshCmd(path)
+	tree, expanded := m.paneModel().treeShown(), maps.Clone(m.pane.state.expanded)
+	return func() tea.Msg {
+		msg := refresh().(listingRefreshedMsg)
+		msg.pane = true
+		if tree {
+			msg.children = readExpanded(msg.listing, expanded)
+		}
+		return msg
+	}
+}
+
+// showPaneListing swaps a listing read for the other pane in, keeping its cursor on the same object.
+// A directory listing is dropped if the pane moved or shows something else meanwhile.
+func (m *model) showPaneListing(msg listingRefreshedMsg, virtual bool) {
+	if m.pane == nil || msg.path != m.pane.state.currentPath || virtual != (m.paneModel().virtualList() != nil) {
+		return
+	}
+	if msg.err != nil {
+		m.status = msg.err.Error()
+	}
+
+	// The pane's own listing is swapped in, so the usual code keeps the cursor in place
+	o := m.paneModel()
+	o.keepFocus(true, func() {
+		o.listing = msg.listing
+		if !virtual {
+			o.children = msg.children
+		}
+		o.applyFilter()
+	})
+	m.storePane(o)
+}
+
+// syncPaneObjects lists the other pane's objects again, after something they depend on changed:
+// the layout, the sizes measured, the size of the window
+func (m *model) syncPaneObjects() {
+	if m.pane == nil {
+		return
+	}
+	o := m.paneModel()
+	o.keepFocus(true, o.applyFilter)
+	m.storePane(o)
+}
+
+// storePane keeps what was listed for the other pane, along with its parent directory for the
+// Miller columns
+func (m *model) storePane(o model) {
+	o.millerParent.path = ""
+	o.syncMiller()
+	m.pane.state, m.pane.listing, m.pane.objects, m.pane.parent, m.pane.children = o.state, o.listing, o.objects, o.millerParent, o.children
+}
+
+// paneFocus returns the path of the object under the other pane's cursor, "" without one
+func (m model) paneFocus() string {
+	if m.pane == nil {
+		return ""
+	}
+	if idx := m.paneModel().selectedIndex(); idx >= 0 && idx < len(m.pane.objects) {
+		return m.pane.objects[idx].Path
+	}
+	return ""
+}
+
+// focusPane puts the other pane's cursor on an object, scrolling it into view with the current grid size
+func (m *model) focusPane(path string) {
+	if m.pane == nil || path == "" {
+		return
+	}
+	for i, obj := range m.pane.objects {
+		if obj.Path == path {
+			m.pane.state.FocusIndex(i, m.rows, m.cols)
+			return
+		}
+	}
+}
+
+// paneModel is the model as it would be with the other pane focused, to reuse the code that
+// lists and draws the focused one
+func (m model) paneModel() model {
+	o := m
+	o.state = m.pane.state
+	o.tree, o.dupes, o.verify = m.pane.tree, m.pane.dupes, m.pane.verify
+	o.listing, o.objects, o.millerParent = m.pane.listing, m.pane.objects, m.pane.parent
+	o.children, o.childLoads = m.pane.children, nil // Expanded directories of the other pane are read along with it
+	o.loader = nil
+	o.preview = m.pane.preview // Its cursor doesn't move while it's unfocused, so the preview still applies
+	return o
+}
+
+// renderPanes draws the focused pane beside the other one, each under the directory it shows
+func (m model) renderPanes(focused string, width, height int) string {
+	o := m.paneModel()
+	other := o.renderExplorer(width, height)
+
+	focusedTitle := styleTabActive.Render(m.breadcrumb(width))
+	otherTitle := styleBadge.Render(o.breadcrumb(width))
+	left := lipgloss.JoinVertical(lipgloss.Left, focusedTitle, focused)
+	right := lipgloss.JoinVertical(lipgloss.Left, otherTitle, other)
+	if m.paneOnLeft {
+		left, right = right, left
+	}
+
+	separator := lipgloss.NewStyle().Foreground(borderColor).Render(strings.TrimSuffix(strings.Repeat("│\n", height+1), "\n"))
+	return lipgloss.JoinHorizontal(lipgloss.Top,
+		lipgloss.NewStyle().Width(width).Render(left), separator, right)
+}
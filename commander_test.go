@@ -0,0 +1,123 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// paneNames lists the names of the objects the other pane shows
+func paneNames(m model) []string {
+	var names []string
+	for _, obj := range m.pane.objects {
+		names = append(names, obj.Name)
+	}
+	return names
+}
+
+func TestReadPaneInBackground(t *testing.T) {
+	dir := tempDir(t)
+	writeFile(t, dir, "a", "", time.Time{})
+	m := newTestModel(t, dir)
+	m.toggleDualPane()
+	if got := paneNames(m); len(got) != 1 || got[0] != "a" {
+		t.Fatalf("the new pane shows %v, want [a]", got)
+	}
+
+	writeFile(t, dir, "b", "", time.Time{})
+	cmd := m.readPane()
+	if cmd == nil {
+		t.Fatal("the pane was read in Update")
+	}
+	msg, ok := cmd().(listingRefreshedMsg)
+	if !ok || !msg.pane {
+		t.Fatalf("got %#v, want a listing for the pane", msg)
+	}
+
+	// Only for the directory the pane still shows
+	m.pane.state.currentPath = filepath.Join(dir, "elsewhere")
+	m.showPaneListing(msg, false)
+	if got := paneNames(m); len(got) != 1 {
+		t.Errorf("a listing for another directory was taken: %v", got)
+	}
+	m.pane.state.currentPath = dir
+	m.showPaneListing(msg, false)
+	if got := paneNames(m); len(got) != 2 || got[1] != "b" {
+		t.Errorf("the pane shows %v, want [a b]", got)
+	}
+}
+
+func TestPaneWatcher(t *testing.T) {
+	dir := tempDir(t)
+	writeFile(t, dir, "sub/a", "", time.Time{})
+	m := newTestModel(t, dir)
+	m.toggleDualPane()
+	m.pane.state.currentPath = filepath.Join(dir, "sub")
+	wait := m.syncPaneWatcher()
+	if wait == nil || m.paneWatcher.path != m.pane.state.currentPath {
+		t.Fatal("the other pane isn't watched")
+	}
+
+	changed := make(chan any, 1)
+	go func() { changed <- wait() }()
+	writeFile(t, dir, "sub/b", "", time.Time{})
+	select {
+	case msg := <-changed:
+		if msg != (dirChangedMsg{watcher: m.paneWatcher}) {
+			t.Errorf("got %#v, want a change from the pane's watcher", msg)
+		}
+	case <-time.After(WATCH_POLL_INTERVAL + 3*time.Second):
+		t.Fatal("no change reported for the other pane")
+	}
+
+	// Switching sides takes the watchers along; closing the pane stops its watcher
+	m.syncWatcher()
+	defer m.watcher.stop()
+	m.switchPane()
+	if m.watcher.path != filepath.Join(dir, "sub") || m.paneWatcher.path != dir {
+		t.Error("the watchers didn't switch sides with the panes")
+	}
+	paneWatcher := m.paneWatcher
+	m.toggleDualPane()
+	m.syncPaneWatcher()
+	if m.paneWatcher != nil {
+		t.Error("the pane's watcher outlived the pane")
+	}
+	for range paneWatcher.changes {
+		// Closed once the watcher stopped; a notification may still be pending
+	}
+}
+
+func TestMillerPreviewPerPane(t *testing.T) {
+	dir := tempDir(t)
+	writeFile(t, dir, "notes.txt", "hello", time.Time{})
+	m := newTestModel(t, dir)
+	m.layout = layoutMiller
+	m.toggleDualPane()
+	if !m.previewShown() || m.previewWidth() != 0 {
+		t.Fatal("the Miller preview isn't drawn inside the panes")
+	}
+
+	cmd := m.syncPreview()
+	if cmd == nil {
+		t.Fatal("no preview asked for in the focused pane")
+	}
+	m.showPreview(cmd().(previewMsg))
+	if out := m.renderMiller(90, 10); !strings.Contains(out, "hello") {
+		t.Errorf("the focused pane has no preview column:\n%s", out)
+	}
+
+	// The pane that loses the focus keeps its preview
+	m.switchPane()
+	if out := m.paneModel().renderMiller(90, 10); !strings.Contains(out, "hello") {
+		t.Errorf("the other pane lost its preview column:\n%s", out)
+	}
+
+	// Other layouts leave the preview to a single pane, and say so
+	m.layout = layoutGrid
+	m.togglePreview()
+	if m.previewShown() || !strings.Contains(m.status, "single pane") {
+		t.Errorf("preview shown %v with status %q", m.previewShown(), m.status)
+	}
+}
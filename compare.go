@@ -0,0 +1,730 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Directory comparison
+const (
+	COMPARE_TIME_WINDOW = time.Second // Modification times closer than this are the same, as copies made elsewhere often drop the fraction
+)
+
+// Colors of the comparison results on tiles and rows
+var (
+	styleCompareSame    = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	styleCompareOnly    = lipgloss.NewStyle().Foreground(lipgloss.Color("3"))
+	styleCompareNewer   = lipgloss.NewStyle().Foreground(lipgloss.Color("6"))
+	styleCompareOlder   = lipgloss.NewStyle().Faint(true)
+	styleCompareDiffers = lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Bold(true)
+)
+
+// compareMethod decides when two files are the same
+type compareMethod int
+
+const (
+	compareBySize    compareMethod = iota // Same size and modification time
+	compareByContent                      // Same size and SHA-256 of the content
+)
+
+// compareStatus is how an object of one directory relates to the one at the same place in the other
+type compareStatus int
+
+const (
+	compareIdentical compareStatus = iota
+	compareOnlyLeft
+	compareOnlyRight
+	compareNewerLeft
+	compareNewerRight
+	compareDiffers // Different at the same time, a file on one side and a directory on the other, or unreadable
+)
+
+// compareStatusNames name the results in the summary, in the order listed there
+var compareStatusNames = []struct {
+	status compareStatus
+	name   string
+}{
+	{compareOnlyLeft, "Only left"},
+	{compareOnlyRight, "Only right"},
+	{compareNewerLeft, "Newer left"},
+	{compareNewerRight, "Newer right"},
+	{compareDiffers, "Different"},
+	{compareIdentical, "Identical"},
+}
+
+// compareEntry is the result for one path
+type compareEntry struct {
+	status      compareStatus
+	dirs        bool        // Directories on both sides: the status sums up what's inside
+	left, right fs.FileInfo // What was compared on each side; nil where there was nothing
+}
+
+// compareTally counts the files below the roots with one status
+type compareTally struct {
+	files int
+	bytes int64
+}
+
+// dirCompare compares two directories recursively in the background, and keeps the result
+type dirCompare struct {
+	left, right string
+	method      compareMethod
+	announce    bool // The summary opens once the comparison is over, rather than a status line
+
+	entries    map[string]compareEntry // By path relative to both roots
+	tallies    map[compareStatus]compareTally
+	unreadable int
+
+	done chan struct{} // Closed by stop to abandon the comparison
+	once sync.Once
+
+	// Progress, read by the top bar while the comparison runs
+	files  atomic.Int64 // Pairs of files compared
+	hashed atomic.Int64 // Bytes hashed so far
+}
+
+// compareDoneMsg delivers a finished comparison
+type compareDoneMsg struct {
+	cmp *dirCompare
+}
+
+// syncDirection is which way a sync copies
+type syncDirection int
+
+const (
+	syncLeftToRight syncDirection = iota
+	syncRightToLeft
+	syncBothWays
+	syncMirrorLeft  // The right side ends up like the left one
+	syncMirrorRight // The left side ends up like the right one
+)
+
+// syncOp is one step of a sync: an object copied over, or trashed to mirror its absence
+type syncOp struct {
+	verb     string // "copy", "replace" or "trash"
+	from, to string // Source and destination; only to for "trash"
+	rel      string // Path below the roots, for the dry run
+	dir      bool
+	toRight  bool        // Which side changes
+	seen     fs.FileInfo // What the comparison saw at to, which a replace or trash must still find there
+}
+
+// stop abandons the comparison
+func (c *dirCompare) stop() {
+	c.once.Do(func() { close(c.done) })
+}
+
+// stopped reports whether the comparison was abandoned
+func (c *dirCompare) stopped() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// run compares both trees from the roots down
+func (c *dirCompare) run() tea.Msg {
+	c.entries = map[string]compareEntry{}
+	c.tallies = map[compareStatus]compareTally{}
+	c.compareDir("")
+	return compareDoneMsg{cmp: c}
+}
+
+// compareDir compares the objects of a directory on both sides, descending into directories
+// found on both. It returns compareIdentical when nothing inside differs.
+func (c *dirCompare) compareDir(rel string) compareStatus {
+	left, errLeft := readDirInfo(filepath.Join(c.left, rel))
+	right, errRight := readDirInfo(filepath.Join(c.right, rel))
+	status := compareIdentical
+	if errLeft != nil || errRight != nil {
+		c.unreadable++
+		status = compareDiffers
+	}
+
+	names := slices.Collect(maps.Keys(left))
+	for name := range right {
+		if _, ok := left[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if c.stopped() {
+			return compareDiffers
+		}
+		childRel := filepath.Join(rel, name)
+		l, r := left[name], right[name]
+		entry := compareEntry{left: l, right: r}
+		switch {
+		case r == nil:
+			entry.status = compareOnlyLeft
+			c.tally(entry.status, filepath.Join(c.left, childRel), l)
+		case l == nil:
+			entry.status = compareOnlyRight
+			c.tally(entry.status, filepath.Join(c.right, childRel), r)
+		case l.IsDir() && r.IsDir():
+			entry.status, entry.dirs = c.compareDir(childRel), true
+		case l.IsDir() || r.IsDir():
+			entry.status = compareDiffers
+			c.tally(entry.status, "", r)
+		default:
+			entry.status = c.compareFiles(childRel, l, r)
+			if entry.status == compareNewerLeft {
+				c.tally(entry.status, "", l)
+			} else {
+				c.tally(entry.status, "", r)
+			}
+		}
+		c.entries[childRel] = entry
+		if entry.status != compareIdentical {
+			status = compareDiffers
+		}
+	}
+	return status
+}
+
+// readDirInfo lists a directory by name, without following links. A directory that doesn't
+// exist is empty.
+func readDirInfo(dir string) (map[string]fs.FileInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	infos := map[string]fs.FileInfo{}
+	for _, entry := range entries {
+		if info, infoErr := entry.Info(); infoErr == nil {
+			infos[entry.Name()] = info
+		} else if err == nil {
+			err = infoErr
+		}
+	}
+	return infos, err
+}
+
+// tally counts an object towards its status in the summary. A directory found on one side only
+// counts with every file inside it, which path is walked for; an empty one counts as one.
+func (c *dirCompare) tally(status compareStatus, path string, info fs.FileInfo) {
+	t := c.tallies[status]
+	if info.IsDir() && path != "" {
+		filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return nil
+			}
+			t.files++
+			if info, err := entry.Info(); err == nil {
+				t.bytes += info.Size()
+			}
+			return nil
+		})
+		t.files = max(t.files, c.tallies[status].files+1)
+	} else {
+		t.files++
+		t.bytes += info.Size()
+	}
+	c.tallies[status] = t
+}
+
+// compareFiles compares two objects that aren't directories. Links are the same when they point
+// at the same target; other objects by the method chosen, the newer one winning otherwise.
+func (c *dirCompare) compareFiles(rel string, l, r fs.FileInfo) compareStatus {
+	c.files.Add(1)
+	same := false
+	switch {
+	case l.Mode().Type() != r.Mode().Type():
+	case l.Mode()&fs.ModeSymlink != 0:
+		leftTarget, errLeft := os.Readlink(filepath.Join(c.left, rel))
+		rightTarget, errRight := os.Readlink(filepath.Join(c.right, rel))
+		same = errLeft == nil && errRight == nil && leftTarget == rightTarget
+	case l.Size() != r.Size():
+	case c.method == compareByContent && l.Mode().IsRegular():
+		leftSum, errLeft := c.hashFile(filepath.Join(c.left, rel))
+		rightSum, errRight := c.hashFile(filepath.Join(c.right, rel))
+		if errLeft != nil || errRight != nil {
+			c.unreadable++
+			return compareDiffers
+		}
+		same = leftSum == rightSum
+	default:
+		same = sameTime(l.ModTime(), r.ModTime())
+	}
+
+	switch {
+	case same:
+		return compareIdentical
+	case sameTime(l.ModTime(), r.ModTime()):
+		return compareDiffers
+	case l.ModTime().After(r.ModTime()):
+		return compareNewerLeft
+	default:
+		return compareNewerRight
+	}
+}
+
+// sameTime reports whether two modification times are within COMPARE_TIME_WINDOW of each other
+func sameTime(a, b time.Time) bool {
+	return a.Sub(b).Abs() < COMPARE_TIME_WINDOW
+}
+
+// hashFile returns the SHA-256 of a file's content, giving up when the comparison is abandoned
+func (c *dirCompare) hashFile(path string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	f, err := os.Open(path)
+	if err != nil {
+		return sum, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	buf := make([]byte, 256*1024)
+	for !c.stopped() {
+		n, err := f.Read(buf)
+		h.Write(buf[:n])
+		c.hashed.Add(int64(n))
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return sum, err
+		}
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// relative finds which root a path is below, and where below it
+func (c *dirCompare) relative(path string) (string, bool, bool) {
+	for _, root := range []string{c.left, c.right} {
+		if rel, err := filepath.Rel(root, path); err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return rel, root == c.left, true
+		}
+	}
+	return "", false, false
+}
+
+// result returns what a tile says about an object of either side, seen from that side, and the
+// style its name takes
+func (c *dirCompare) result(path string) (string, lipgloss.Style, bool) {
+	rel, left, ok := c.relative(path)
+	if !ok {
+		return "", lipgloss.Style{}, false
+	}
+	entry, ok := c.entries[rel]
+	if !ok {
+		return "", lipgloss.Style{}, false
+	}
+
+	switch entry.status {
+	case compareIdentical:
+		return "= identical", styleCompareSame, true
+	case compareOnlyLeft, compareOnlyRight:
+		return "+ only here", styleCompareOnly, true
+	case compareNewerLeft, compareNewerRight:
+		if (entry.status == compareNewerLeft) == left {
+			return "▲ newer here", styleCompareNewer, true
+		}
+		return "▼ older here", styleCompareOlder, true
+	}
+	if entry.dirs {
+		return "≠ differs inside", styleCompareDiffers, true
+	}
+	return "≠ differs", styleCompareDiffers, true
+}
+
+// differences counts the objects that aren't identical on both sides, directories missing on one
+// side as one
+func (c *dirCompare) differences() int {
+	n := 0
+	for _, entry := range c.entries {
+		if entry.status != compareIdentical && !entry.dirs {
+			n++
+		}
+	}
+	return n
+}
+
+// summary lists how many files, and how much data, have each status
+func (c *dirCompare) summary() []string {
+	pairs := [][2]string{{"Left", c.left}, {"Right", c.right}}
+	for _, s := range compareStatusNames {
+		if t := c.tallies[s.status]; t.files > 0 {
+			pairs = append(pairs, [2]string{s.name, fmt.Sprintf("%d file(s), %s", t.files, formatSize(t.bytes))})
+		}
+	}
+	if c.unreadable > 0 {
+		pairs = append(pairs, [2]string{"Unreadable", fmt.Sprintf("%d", c.unreadable)})
+	}
+	lines := keyValueLines(pairs)
+	if c.differences() == 0 && c.unreadable == 0 {
+		lines = append(lines, "", "Both sides are identical")
+	}
+	return lines
+}
+
+// title names the comparison by its method
+func (c *dirCompare) title() string {
+	if c.method == compareByContent {
+		return "Comparison by content"
+	}
+	return "Comparison by size and time"
+}
+
+// plan lists what a sync in a direction does, every object once: a directory missing on one side
+// is copied whole. Files that differ without one being newer are only copied by a mirror; the
+// others leave them alone, and they're counted in skipped. A file and a directory of the same
+// name can't be merged: what's in the way is trashed first, and the dry run says so.
+func (c *dirCompare) plan(direction syncDirection) (ops []syncOp, skipped int) {
+	toRight := direction == syncLeftToRight || direction == syncBothWays || direction == syncMirrorLeft
+	toLeft := direction == syncRightToLeft || direction == syncBothWays || direction == syncMirrorRight
+
+	rels := slices.Sorted(maps.Keys(c.entries))
+	covered := map[string]bool{} // Objects handled whole, whose contents have nothing left to do
+	for _, rel := range rels {
+		if coveredBelow(covered, rel) {
+			continue
+		}
+		entry := c.entries[rel]
+		left, right := filepath.Join(c.left, rel), filepath.Join(c.right, rel)
+		copyRight := syncOp{verb: "replace", from: left, to: right, rel: rel, toRight: true}
+		copyLeft := syncOp{verb: "replace", from: right, to: left, rel: rel}
+
+		var op *syncOp
+		switch entry.status {
+		case compareOnlyLeft:
+			copyRight.verb = "copy"
+			switch {
+			case toRight:
+				op = &copyRight
+			case direction == syncMirrorRight:
+				op = &syncOp{verb: "trash", to: left, rel: rel}
+			}
+		case compareOnlyRight:
+			copyLeft.verb = "copy"
+			switch {
+			case toLeft:
+				op = &copyLeft
+			case direction == syncMirrorLeft:
+				op = &syncOp{verb: "trash", to: right, rel: rel, toRight: true}
+			}
+		case compareNewerLeft:
+			switch {
+			case toRight:
+				op = &copyRight
+			case direction == syncMirrorRight:
+				op = &copyLeft
+			}
+		case compareNewerRight:
+			switch {
+			case toLeft:
+				op = &copyLeft
+			case direction == syncMirrorLeft:
+				op = &copyRight
+			}
+		case compareDiffers:
+			switch {
+			case entry.dirs:
+				// What's inside is listed on its own
+			case direction == syncMirrorLeft:
+				op = &copyRight
+			case direction == syncMirrorRight:
+				op = &copyLeft
+			default:
+				skipped++
+			}
+		}
+		if op == nil {
+			continue
+		}
+
+		// What the comparison saw on the side that changes, and on the one copied from
+		seen, source := entry.left, entry.right
+		if op.toRight {
+			seen, source = entry.right, entry.left
+		}
+		if op.verb == "trash" {
+			op.dir, op.seen = seen.IsDir(), seen
+		} else {
+			op.dir = source.IsDir()
+			if seen != nil && seen.IsDir() != source.IsDir() {
+				ops = append(ops, syncOp{verb: "trash", to: op.to, rel: rel, dir: seen.IsDir(), toRight: op.toRight, seen: seen})
+				op.verb = "copy"
+			} else if op.verb == "replace" {
+				op.seen = seen
+			}
+		}
+		ops = append(ops, *op)
+		covered[rel] = true
+	}
+	return ops, skipped
+}
+
+// coveredBelow reports whether a path is inside one of the covered ones
+func coveredBelow(covered map[string]bool, rel string) bool {
+	for dir := filepath.Dir(rel); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		if covered[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// describe is the dry run's line for an operation
+func (op syncOp) describe() string {
+	name := op.rel
+	if op.dir {
+		name += string(filepath.Separator)
+	}
+	side := "left"
+	if op.toRight {
+		side = "right"
+	}
+	if op.verb == "trash" {
+		return fmt.Sprintf("%-8s %s on the %s", op.verb, name, side)
+	}
+	return fmt.Sprintf("%-8s %s → %s", op.verb, name, side)
+}
+
+// compareSides returns the directories of the left and right panes, or an error saying why
+// they can't be compared
+func (m *model) compareSides() (string, string, error) {
+	if m.pane == nil {
+		return "", "", fmt.Errorf("only in the dual-pane view (%s)", m.keys.keyLabel(modeNormal, actionDualPane))
+	}
+	if m.virtualList() != nil || m.pane.tree != nil || m.pane.dupes != nil || m.pane.verify != nil {
+		return "", "", fmt.Errorf("both panes must show directories on disk")
+	}
+	left, right := m.state.currentPath, m.pane.state.currentPath
+	if m.paneOnLeft {
+		left, right = right, left
+	}
+	if left == right || sameObject(left, right) {
+		return "", "", fmt.Errorf("both panes show %s: open another directory in one of them", filepath.Base(left))
+	}
+	for _, pair := range [][2]string{{left, right}, {right, left}} {
+		if rel, err := filepath.Rel(pair[0], pair[1]); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", "", fmt.Errorf("can't compare %s with a directory inside it", filepath.Base(pair[0]))
+		}
+	}
+	return left, right, nil
+}
+
+// compareMenu offers the ways to compare the two panes, or cancels a comparison in progress
+func (m *model) compareMenu() {
+	if m.compareJob != nil {
+		m.compareJob.stop()
+		m.compareJob = nil
+		m.status = "comparison cancelled"
+		return
+	}
+	left, right, err := m.compareSides()
+	if err != nil {
+		m.status = err.Error()
+		return
+	}
+
+	items := []string{"By size and modification time", "By content (SHA-256)"}
+	if m.compare != nil {
+		items = append(items, "Show the last summary", "Clear the comparison")
+	}
+	title := fmt.Sprintf("Compare %s with %s", filepath.Base(left), filepath.Base(right))
+	m.openMenu(title, items, func(m *model, idx int) tea.Cmd {
+		switch idx {
+		case 0:
+			return m.startCompare(left, right, compareBySize, true)
+		case 1:
+			return m.startCompare(left, right, compareByContent, true)
+		case 2:
+			m.openOverlay(m.compare.title(), m.compare.summary())
+		case 3:
+			m.compare = nil
+			m.status = "comparison cleared"
+		}
+		return nil
+	})
+}
+
+// startCompare compares two directories in the background
+func (m *model) startCompare(left, right string, method compareMethod, announce bool) tea.Cmd {
+	if m.compareJob != nil {
+		m.compareJob.stop()
+	}
+	job := &dirCompare{left: left, right: right, method: method, announce: announce, done: make(chan struct{})}
+	m.compareJob = job
+
+	cmds := []tea.Cmd{job.run}
+	if !m.spinning {
+		m.spinning = true
+		cmds = append(cmds, spinnerTick())
+	}
+	return tea.Batch(cmds...)
+}
+
+// recompare compares the same directories again after something changed them
+func (m *model) recompare() tea.Cmd {
+	if m.compare == nil || m.compareJob != nil {
+		return nil
+	}
+	return m.startCompare(m.compare.left, m.compare.right, m.compare.method, false)
+}
+
+// showCompare shows the result of a comparison still wanted
+func (m *model) showCompare(msg compareDoneMsg) {
+	if msg.cmp != m.compareJob {
+		return // Cancelled or replaced
+	}
+	m.compareJob = nil
+	m.compare = msg.cmp
+	if msg.cmp.announce {
+		m.openOverlay(msg.cmp.title(), msg.cmp.summary())
+	} // Compared again quietly, the top bar has the count, the status line what changed it
+}
+
+// compareLabel shows how far a comparison is, or how many differences the one shown found
+func (m model) compareLabel() string {
+	switch {
+	case m.compareJob != nil:
+		if m.compareJob.method == compareByContent {
+			return fmt.Sprintf("⇄ %d files, %s ", m.compareJob.files.Load(), formatSize(m.compareJob.hashed.Load()))
+		}
+		return fmt.Sprintf("⇄ %d files ", m.compareJob.files.Load())
+	case m.compare != nil:
+		if n := m.compare.differences(); n > 0 {
+			return fmt.Sprintf("⇄ %d difference(s) ", n)
+		}
+		return "⇄ identical "
+	}
+	return ""
+}
+
+// nameStyle returns the style of an object's name on an unfocused row: the comparison result
+// while the panes are compared, the object's own style otherwise
+func (m model) nameStyle(obj FileSystemObject) lipgloss.Style {
+	if m.compare != nil {
+		if _, style, ok := m.compare.result(obj.Path); ok {
+			return style
+		}
+	}
+	return objectStyle(obj)
+}
+
+// syncMenu offers the directions a sync can go in, after a comparison
+func (m *model) syncMenu() {
+	if m.compare == nil {
+		m.status = "compare the panes first (" + m.keys.keyLabel(modeNormal, actionCompare) + ")"
+		return
+	}
+	c := m.compare
+	left, right := filepath.Base(c.left), filepath.Base(c.right)
+	items := []string{
+		fmt.Sprintf("%s → %s: copy what's missing or newer", left, right),
+		fmt.Sprintf("%s → %s: copy what's missing or newer", right, left),
+		"Both ways: copy what's missing or newer on either side",
+		fmt.Sprintf("Mirror %s onto %s: also replace what differs, trash what's only there", left, right),
+		fmt.Sprintf("Mirror %s onto %s: also replace what differs, trash what's only there", right, left),
+	}
+	m.openMenu("Sync "+left+" and "+right, items, func(m *model, idx int) tea.Cmd {
+		ops, skipped := c.plan(syncDirection(idx))
+		if len(ops) == 0 {
+			m.status = "nothing to sync"
+			if skipped > 0 {
+				m.status += fmt.Sprintf(": %d file(s) differ with the same time, only a mirror replaces them", skipped)
+			}
+			return nil
+		}
+		m.showSyncPlan(ops, skipped, 0)
+		return nil
+	})
+}
+
+// showSyncPlan lists every operation of a sync as a dry run, to run or cancel. Cancel comes
+// first, so a hasty Enter doesn't run it.
+func (m *model) showSyncPlan(ops []syncOp, skipped int, cursor int) {
+	items := []string{"Cancel", fmt.Sprintf("Run %d operation(s)", len(ops))}
+	for _, op := range ops {
+		items = append(items, op.describe())
+	}
+
+	title := "Dry run: nothing changes until it runs"
+	if skipped > 0 {
+		title += fmt.Sprintf(" (%d file(s) differing at the same time are left alone)", skipped)
+	}
+	m.openMenu(title, items, func(m *model, idx int) tea.Cmd {
+		switch idx {
+		case 0:
+			m.status = "sync cancelled"
+			return nil
+		case 1:
+			return runSync(ops)
+		}
+		// Stay in the dry run, so the rest can be read
+		m.showSyncPlan(ops, skipped, idx)
+		return nil
+	})
+	m.menu.cursor = cursor
+}
+
+// runSync carries out a sync in the background. Objects are copied as by cp/F5, and those
+// trashed or replaced go to the trash as duplicates do. Nothing is trashed or replaced unless
+// it's still what the comparison saw, and a copy doesn't replace anything: when something is
+// in its way, left by a trash that failed or made since the comparison, it's skipped.
+func runSync(ops []syncOp) tea.Cmd {
+	return func() tea.Msg {
+		result := opResultMsg{verb: "sync"}
+		for _, op := range ops {
+			var failures []pathError
+			_, statErr := os.Lstat(op.to)
+			switch err := op.check(); {
+			case err != nil:
+				failures = []pathError{{op.to, err}}
+			case op.verb == "copy" && statErr == nil:
+				failures = []pathError{{op.to, errors.New("something is in the way: not copied")}}
+			case op.verb == "copy":
+				failures = copyObject(op.from, op.to)
+			default:
+				if err := moveToTrash(op.to); err != nil {
+					failures = []pathError{{op.to, err}}
+				} else if op.verb == "replace" {
+					failures = copyObject(op.from, op.to)
+				}
+			}
+			if len(failures) > 0 {
+				result.failures = append(result.failures, failures...)
+			} else {
+				result.done++
+			}
+		}
+		return result
+	}
+}
+
+// check makes sure the object a replace or trash is about to take away is still the one the
+// comparison saw: same type, size and modification time
+func (op syncOp) check() error {
+	if op.seen == nil {
+		return nil
+	}
+	info, err := os.Lstat(op.to)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != op.seen.Mode().Type() || info.Size() != op.seen.Size() || !info.ModTime().Equal(op.seen.ModTime()) {
+		return fmt.Errorf("%s changed since the comparison: skipped", filepath.Base(op.to))
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// compareDirs compares two directories by size and time, as the compare menu does
+func compareDirs(t *testing.T, left, right string) *dirCompare {
+	t.Helper()
+	c := &dirCompare{left: left, right: right, method: compareBySize, done: make(chan struct{})}
+	c.run()
+	return c
+}
+
+// describeOps is the dry run of a sync, one line per operation
+func describeOps(ops []syncOp) []string {
+	var lines []string
+	for _, op := range ops {
+		lines = append(lines, strings.Join(strings.Fields(op.describe()), " "))
+	}
+	return lines
+}
+
+func TestSyncMirror(t *testing.T) {
+	trash := testTrash(t)
+	dir := tempDir(t)
+	old, recent := time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour)
+	left, right := filepath.Join(dir, "left"), filepath.Join(dir, "right")
+	writeFile(t, left, "same", "same", old)
+	writeFile(t, right, "same", "same", old)
+	writeFile(t, left, "newer", "new", recent)
+	writeFile(t, right, "newer", "old", old)
+	writeFile(t, left, "sub/missing", "missing", old)
+	writeFile(t, right, "extra/file", "only right", old)
+	writeFile(t, left, "kind", "a file on the left", old)
+	writeFile(t, right, "kind/precious", "a directory on the right", old)
+
+	ops, skipped := compareDirs(t, left, right).plan(syncMirrorLeft)
+	sep := string(filepath.Separator)
+	want := []string{
+		"trash extra" + sep + " on the right",
+		"trash kind" + sep + " on the right",
+		"copy kind → right",
+		"replace newer → right",
+		"copy sub" + sep + " → right",
+	}
+	if got := describeOps(ops); !slices.Equal(got, want) || skipped != 0 {
+		t.Fatalf("dry run:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	result := runOp(t, runSync(ops))
+	if result.done != len(ops) {
+		t.Errorf("%d operations done, want %d", result.done, len(ops))
+	}
+	if again, _ := compareDirs(t, left, right).plan(syncMirrorLeft); len(again) != 0 {
+		t.Errorf("still to do after the mirror: %q", describeOps(again))
+	}
+	for rel, want := range map[string]string{"kind": "a file on the left", "newer": "new", "sub/missing": "missing"} {
+		if got := readFile(t, filepath.Join(right, rel)); got != want {
+			t.Errorf("%s: %q, want %q", rel, got, want)
+		}
+	}
+	// The directory in the way went to the trash, not away for good
+	if got := readFile(t, filepath.Join(trash, "kind", "precious")); got != "a directory on the right" {
+		t.Errorf("trashed directory holds %q", got)
+	}
+	readFile(t, filepath.Join(trash, "extra", "file"))
+	if got := readFile(t, filepath.Join(trash, "newer")); got != "old" {
+		t.Errorf("replaced file in the trash holds %q", got)
+	}
+}
+
+func TestSyncSkipsWhatChangedSinceTheComparison(t *testing.T) {
+	testTrash(t)
+	dir := tempDir(t)
+	old, recent := time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour)
+	left, right := filepath.Join(dir, "left"), filepath.Join(dir, "right")
+	writeFile(t, left, "newer", "new", recent)
+	writeFile(t, right, "newer", "old", old)
+	writeFile(t, right, "extra", "only right", old)
+	ops, _ := compareDirs(t, left, right).plan(syncMirrorLeft)
+	if len(ops) != 2 {
+		t.Fatalf("dry run: %q", describeOps(ops))
+	}
+
+	// Both files on the right are edited after the comparison
+	writeFile(t, right, "newer", "edited", time.Now())
+	writeFile(t, right, "extra", "edited", old)
+	result := runSync(ops)().(opResultMsg)
+	if result.done != 0 || len(result.failures) != 2 {
+		t.Errorf("done %d, failures %v", result.done, result.failures)
+	}
+	for _, rel := range []string{"newer", "extra"} {
+		if got := readFile(t, filepath.Join(right, rel)); got != "edited" {
+			t.Errorf("%s: %q, want the edit kept", rel, got)
+		}
+	}
+}
+
+func TestSyncPlanStartsOnCancel(t *testing.T) {
+	m := newTestModel(t, tempDir(t))
+	m.showSyncPlan([]syncOp{{verb: "copy", rel: "file", toRight: true}}, 0, 0)
+	if got := m.menu.items[m.menu.cursor]; got != "Cancel" {
+		t.Errorf("the dry run opens on %q", got)
+	}
+}
+
+func TestCompareRelative(t *testing.T) {
+	dir := tempDir(t)
+	c := &dirCompare{left: filepath.Join(dir, "left"), right: filepath.Join(dir, "right")}
+	if rel, left, ok := c.relative(filepath.Join(dir, "left", "..file")); !ok || !left || rel != "..file" {
+		t.Errorf("..file on the left: %q %v %v", rel, left, ok)
+	}
+	if _, _, ok := c.relative(filepath.Join(dir, "other")); ok {
+		t.Error("a path beside both roots was found below one")
+	}
+}
+
+func TestSyncCopyLeavesWhatsInTheWay(t *testing.T) {
+	dir := tempDir(t)
+	left, right := filepath.Join(dir, "left"), filepath.Join(dir, "right")
+	writeFile(t, left, "file", "left", time.Time{})
+	os.MkdirAll(right, 0o755)
+	ops, _ := compareDirs(t, left, right).plan(syncLeftToRight)
+
+	// Made after the comparison
+	writeFile(t, right, "file/mine", "mine", time.Time{})
+	result := runSync(ops)().(opResultMsg)
+	if result.done != 0 || len(result.failures) != 1 {
+		t.Errorf("done %d, failures %v", result.done, result.failures)
+	}
+	if got := readFile(t, filepath.Join(right, "file", "mine")); got != "mine" {
+		t.Errorf("the object in the way changed: %q", got)
+	}
+}
+
+func TestCompareSidesRefusesTheSameDirectory(t *testing.T) {
+	dir := tempDir(t)
+	writeFile(t, dir, "sub/file", "", time.Time{})
+	writeFile(t, dir, "..sub/file", "", time.Time{})
+	m := newTestModel(t, dir)
+	m.toggleDualPane()
+
+	if _, _, err := m.compareSides(); err == nil || !strings.Contains(err.Error(), "both panes show") {
+		t.Errorf("the same directory on both sides: %v", err)
+	}
+
+	m.pane.state.currentPath = filepath.Join(dir, "sub")
+	if _, _, err := m.compareSides(); err == nil || !strings.Contains(err.Error(), "inside it") {
+		t.Errorf("a directory and one inside it: %v", err)
+	}
+
+	// A name starting with .. is inside the directory all the same
+	m.pane.state.currentPath = filepath.Join(dir, "..sub")
+	if _, _, err := m.compareSides(); err == nil || !strings.Contains(err.Error(), "inside it") {
+		t.Errorf("a directory and ..sub inside it: %v", err)
+	}
+	m.state.currentPath = filepath.Join(dir, "sub")
+	if _, _, err := m.compareSides(); err != nil {
+		t.Errorf("two sibling directories: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// config mirrors the optional JSON file at ~/.config/cdx/config.json
+type config struct {
+	// Keys overrides key bindings: mode ("normal", "filter", "prompt") -> action -> key sequences.
+	// Listing an action replaces all of its default keys, e.g. {"normal": {"move-left": ["n"]}}.
+	Keys map[string]map[string][]string `json:"keys"`
+
+	Theme    string                 `json:"theme"`     // Name of the theme to use (overridden by -theme)
+	Themes   map[string]themeConfig `json:"themes"`    // User-defined themes, by name
+	LSColors bool                   `json:"ls_colors"` // Color tiles from LS_COLORS (same as -ls-colors)
+
+	// DuOneFilesystem keeps disk usage scans from descending into other mounted filesystems (same as -one-file-system)
+	DuOneFilesystem bool `json:"du_one_filesystem"`
+
+	// DetailsColumns are the columns of the details layout in order, with an optional width:
+	// "git", "name", "size", "mtime", "mode", "owner", e.g. ["name", "size:12", "owner"]
+	DetailsColumns []string `json:"details_columns"`
+
+	// Openers decide what Enter and "open with" run for a file; they take precedence over the built-in ones
+	Openers []openerRule `json:"openers"`
+}
+
+// configDir returns the directory holding cdx's configuration.
+// XDG_CONFIG_HOME is honoured on every platform so the layout is the same everywhere.
+func configDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "cdx")
+	}
+	return filepath.Join(getHomeDir(), ".config", "cdx")
+}
+
+// xdgDataDirs lists the XDG data directories in order of precedence
+func xdgDataDirs() []string {
+	home := os.Getenv("XDG_DATA_HOME")
+	if home == "" {
+		home = filepath.Join(getHomeDir(), ".local", "share")
+	}
+	dirs := os.Getenv("XDG_DATA_DIRS")
+	if dirs == "" {
+		dirs = "/usr/local/share:/usr/share"
+	}
+	return append([]string{home}, filepath.SplitList(dirs)...)
+}
+
+// xdgConfigHome is the user's XDG configuration directory
+func xdgConfigHome() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return dir
+	}
+	return filepath.Join(getHomeDir(), ".config")
+}
+
+// loadConfig reads the config file; a missing file simply yields the defaults
+func loadConfig() (config, error) {
+	var cfg config
+
+	path := filepath.Join(configDir(), "config.json")
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
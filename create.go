@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// linkKind selects what createLinks makes
+type linkKind int
+
+const (
+	linkSymbolic         linkKind = iota // Symlink with an absolute target
+	linkSymbolicRelative                 // Symlink with a target relative to the link's directory
+	linkHard                             // Hard link
+)
+
+// promptCreate asks for the name of a new file, or a directory when dir is set.
+// A trailing slash also makes a directory, and nested names create missing parents.
+func (m *model) promptCreate(dir bool) {
+	label := "New file"
+	if dir {
+		label = "New directory"
+	}
+
+	m.openPrompt(label, "", func(m *model, value string) tea.Cmd {
+		if value == "" {
+			return nil
+		}
+		if strings.HasSuffix(value, "/") {
+			dir = true
+		}
+
+		rel := filepath.Clean(value)
+		if filepath.IsAbs(rel) || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			m.status = "names must stay inside the current directory"
+			return nil
+		}
+
+		var err error
+		path := filepath.Join(m.state.currentPath, rel)
+		if dir {
+			err = createDir(path)
+		} else {
+			err = createFile(path)
+		}
+		if err != nil {
+			m.status = err.Error()
+			return nil
+		}
+
+		// Land on the new tile, or on the first directory created on the way to it
+		top := strings.Split(rel, string(filepath.Separator))[0]
+		cmd := m.refreshListing()
+		m.revealName(top)
+		m.status = "created " + rel
+		return cmd
+	})
+}
+
+// createDir makes a directory and any missing parents, refusing to reuse an existing one
+func createDir(path string) error {
+	if _, err := os.Lstat(path); err == nil {
+		return fmt.Errorf("%s already exists", filepath.Base(path))
+	}
+	return os.MkdirAll(path, 0o755)
+}
+
+// createFile makes an empty file (or a copy of the matching template) and any missing parents
+func createFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	perm := fs.FileMode(0o644)
+	template, templateInfo := findTemplate(filepath.Base(path))
+	if template != "" {
+		perm = templateInfo.Mode().Perm() // An executable script template makes executable scripts
+	}
+
+	// O_EXCL: never clobber an existing file
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s already exists", filepath.Base(path))
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if template == "" {
+		return nil
+	}
+	src, err := os.Open(template)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	_, err = io.Copy(f, src)
+	return err
+}
+
+// templatesDir holds optional templates for new files
+func templatesDir() string {
+	return filepath.Join(configDir(), "templates")
+}
+
+// findTemplate picks the template for a new file: one with exactly the same name
+// (e.g. "Makefile") wins, otherwise the first one with the same extension ("script.sh" for "*.sh")
+func findTemplate(name string) (string, fs.FileInfo) {
+	dir := templatesDir()
+
+	if info, err := os.Stat(filepath.Join(dir, name)); err == nil && info.Mode().IsRegular() {
+		return filepath.Join(dir, name), info
+	}
+
+	ext := filepath.Ext(name)
+	if ext == "" {
+		return "", nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", nil
+	}
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) != ext {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path, info
+		}
+	}
+	return "", nil
+}
+
+// yank remembers the targets for later link (and paste) operations
+func (m *model) yank() {
+	m.yanked = m.targetPaths()
+	if len(m.yanked) > 0 {
+		m.status = fmt.Sprintf("yanked %d item(s)", len(m.yanked))
+	}
+}
+
+// createLinks makes a link in the current directory to every yanked object
+func (m *model) createLinks(kind linkKind) tea.Cmd {
+	if len(m.yanked) == 0 {
+		m.status = "nothing yanked"
+		return nil
+	}
+
+	verb := map[linkKind]string{
+		linkSymbolic:         "symlink",
+		linkSymbolicRelative: "relative symlink",
+		linkHard:             "hard link",
+	}[kind]
+	dir := m.state.currentPath
+
+	cmd := runBatch(verb, m.yanked, func(target string) (int, []pathError) {
+		link := filepath.Join(dir, filepath.Base(target))
+
+		var err error
+		switch kind {
+		case linkSymbolic:
+			err = os.Symlink(target, link)
+		case linkSymbolicRelative:
+			var rel string
+			if rel, err = filepath.Rel(dir, target); err == nil {
+				err = os.Symlink(rel, link)
+			}
+		case linkHard:
+			err = os.Link(target, link)
+		}
+		if err != nil {
+			return 0, []pathError{{link, err}}
+		}
+		return 1, nil
+	})
+
+	// Put the cursor on the first new link once the listing has been refreshed
+	return focusAfter(cmd, filepath.Base(m.yanked[0]))
+}
+
+// revealName puts the cursor on an object by name, clearing the filter if it hides the object
+func (m *model) revealName(name string) {
+	if m.state.filter != "" && !strings.Contains(strings.ToLower(name), strings.ToLower(m.state.filter)) {
+		m.state.filter = ""
+		m.applyFilter()
+	}
+	m.focusName(name)
+}
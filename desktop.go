@@ -0,0 +1,531 @@
+//go:build linux || freebsd || openbsd || netbsd
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// desktopApp is an application registered through a freedesktop .desktop file
+type desktopApp struct {
+	id        string   // Desktop file ID, e.g. "org.gnome.gedit.desktop"
+	name      string   // Name, localized when possible
+	exec      string   // Exec line with field codes
+	terminal  bool     // Terminal=true
+	mimeTypes []string // MimeType list
+	path      string   // Where the .desktop file lives
+	icon      string   // Icon, for %i
+}
+
+// mimeappsLists lists the mimeapps.list files in order of precedence. In each directory, the
+// lists of the current desktops ($desktop-mimeapps.list) come before the common one.
+func mimeappsLists() []string {
+	dirs := []string{xdgConfigHome()}
+	configDirs := os.Getenv("XDG_CONFIG_DIRS")
+	if configDirs == "" {
+		configDirs = "/etc/xdg"
+	}
+	dirs = append(dirs, filepath.SplitList(configDirs)...)
+	for _, dir := range xdgDataDirs() {
+		dirs = append(dirs, filepath.Join(dir, "applications"))
+	}
+
+	var lists []string
+	for _, dir := range dirs {
+		for _, name := range mimeappsNames() {
+			lists = append(lists, filepath.Join(dir, name))
+		}
+	}
+	return lists
+}
+
+// mimeappsNames lists the names of the mimeapps.list files of one directory, in order of
+// precedence: one per desktop of $XDG_CURRENT_DESKTOP, e.g. gnome-mimeapps.list, then mimeapps.list
+func mimeappsNames() []string {
+	var names []string
+	for _, desktop := range strings.Split(os.Getenv("XDG_CURRENT_DESKTOP"), ":") {
+		if desktop = strings.ToLower(strings.TrimSpace(desktop)); desktop != "" {
+			names = append(names, desktop+"-mimeapps.list")
+		}
+	}
+	return append(names, "mimeapps.list")
+}
+
+// parseDesktopFile reads the groups of a .desktop or mimeapps.list style file:
+// group -> key -> value. Comments and blank lines are skipped.
+func parseDesktopFile(path string) (map[string]map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	groups := map[string]map[string]string{}
+	var group map[string]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			name := line[1 : len(line)-1]
+			if groups[name] == nil {
+				groups[name] = map[string]string{}
+			}
+			group = groups[name]
+		case group != nil:
+			key, value, ok := strings.Cut(line, "=")
+			if ok {
+				group[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+	}
+	return groups, scanner.Err()
+}
+
+// unescapeDesktopValue resolves the escapes allowed in .desktop string values
+func unescapeDesktopValue(value string) string {
+	return strings.NewReplacer(`\s`, " ", `\n`, "\n", `\t`, "\t", `\r`, "\r", `\\`, `\`).Replace(value)
+}
+
+// splitList splits a semicolon separated list value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// localeKeys lists the localized variants of a key to try, most specific first (Name[de_DE], Name[de], Name)
+func localeKeys(key string) []string {
+	var lang string
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if lang = os.Getenv(name); lang != "" {
+			break
+		}
+	}
+	lang, _, _ = strings.Cut(lang, ".") // Drop the encoding
+	lang, _, _ = strings.Cut(lang, "@") // and the modifier
+
+	var keys []string
+	if lang != "" && lang != "C" && lang != "POSIX" {
+		keys = append(keys, key+"["+lang+"]")
+		if short, _, ok := strings.Cut(lang, "_"); ok {
+			keys = append(keys, key+"["+short+"]")
+		}
+	}
+	return append(keys, key)
+}
+
+// loadDesktopApp reads one .desktop file; ok is false for entries that can't launch anything
+func loadDesktopApp(id, path string) (desktopApp, bool) {
+	groups, err := parseDesktopFile(path)
+	if err != nil {
+		return desktopApp{}, false
+	}
+	entry := groups["Desktop Entry"]
+	if entry == nil || entry["Type"] != "Application" || entry["Hidden"] == "true" || entry["Exec"] == "" {
+		return desktopApp{}, false
+	}
+	if try := entry["TryExec"]; try != "" {
+		if _, err := exec.LookPath(unescapeDesktopValue(try)); err != nil {
+			return desktopApp{}, false // Not installed
+		}
+	}
+
+	app := desktopApp{
+		id:        id,
+		exec:      unescapeDesktopValue(entry["Exec"]),
+		terminal:  entry["Terminal"] == "true",
+		mimeTypes: splitList(entry["MimeType"]),
+		path:      path,
+		icon:      entry["Icon"],
+	}
+	for _, key := range localeKeys("Name") {
+		if name := entry[key]; name != "" {
+			app.name = unescapeDesktopValue(name)
+			break
+		}
+	}
+	if app.name == "" {
+		app.name = strings.TrimSuffix(id, ".desktop")
+	}
+	return app, true
+}
+
+// desktopApps finds every installed application by desktop file ID.
+// A file in a directory of higher precedence hides one with the same ID further down.
+func desktopApps() map[string]desktopApp {
+	apps := map[string]desktopApp{}
+	hidden := map[string]bool{}
+
+	for _, dataDir := range xdgDataDirs() {
+		root := filepath.Join(dataDir, "applications")
+		filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() || !strings.HasSuffix(path, ".desktop") {
+				return nil
+			}
+			// The ID is the path below applications/ with slashes turned into dashes
+			rel, _ := filepath.Rel(root, path)
+			id := strings.ReplaceAll(rel, string(filepath.Separator), "-")
+			if _, seen := apps[id]; seen || hidden[id] {
+				return nil
+			}
+			if app, ok := loadDesktopApp(id, path); ok {
+				apps[id] = app
+			} else {
+				hidden[id] = true // e.g. Hidden=true overrides a system-wide entry
+			}
+			return nil
+		})
+	}
+	return apps
+}
+
+// mimeHierarchy lists a MIME type and the types it is an alias or subclass of, as declared by
+// shared-mime-info, so that an app for text/plain is offered for text/x-go as well
+func mimeHierarchy(mimeType string) []string {
+	aliases := map[string]string{}
+	parents := map[string][]string{}
+	for _, dir := range xdgDataDirs() {
+		readPairs(filepath.Join(dir, "mime", "aliases"), func(alias, canonical string) {
+			if _, ok := aliases[alias]; !ok {
+				aliases[alias] = canonical
+			}
+		})
+		readPairs(filepath.Join(dir, "mime", "subclasses"), func(child, parent string) {
+			parents[child] = append(parents[child], parent)
+		})
+	}
+
+	if canonical, ok := aliases[mimeType]; ok {
+		mimeType = canonical
+	}
+	types := []string{mimeType}
+	for i := 0; i < len(types); i++ {
+		for _, parent := range parents[types[i]] {
+			if !slices.Contains(types, parent) {
+				types = append(types, parent)
+			}
+		}
+	}
+	// Every text file is also text/plain
+	if strings.HasPrefix(mimeType, "text/") && !slices.Contains(types, "text/plain") {
+		types = append(types, "text/plain")
+	}
+	return types
+}
+
+// readPairs calls fn for every "a b" line of a shared-mime-info table
+func readPairs(path string, fn func(a, b string)) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if a, b, ok := strings.Cut(strings.TrimSpace(line), " "); ok {
+			fn(a, b)
+		}
+	}
+}
+
+// appsForMIME returns the applications that can open a MIME type, the default one first.
+// Associations come from mimeapps.list (defaults, added and removed) and the apps' own MimeType lists.
+func appsForMIME(mimeType string) (apps []desktopApp, defaultID string) {
+	installed := desktopApps()
+
+	var lists []map[string]map[string]string
+	for _, path := range mimeappsLists() {
+		if groups, err := parseDesktopFile(path); err == nil {
+			lists = append(lists, groups)
+		}
+	}
+
+	seen := map[string]bool{}
+	removed := map[string]bool{}
+	add := func(id string) {
+		if app, ok := installed[id]; ok && !seen[id] && !removed[id] {
+			seen[id] = true
+			apps = append(apps, app)
+		}
+	}
+
+	for _, t := range mimeHierarchy(mimeType) {
+		// The first installed default, by precedence of the lists, wins
+		if defaultID == "" {
+			for _, groups := range lists {
+				for _, id := range splitList(groups["Default Applications"][t]) {
+					if _, ok := installed[id]; ok && defaultID == "" {
+						defaultID = id
+					}
+				}
+			}
+			add(defaultID)
+		}
+
+		for _, groups := range lists {
+			for _, id := range splitList(groups["Removed Associations"][t]) {
+				removed[id] = true
+			}
+		}
+		for _, groups := range lists {
+			for _, id := range splitList(groups["Added Associations"][t]) {
+				add(id)
+			}
+		}
+
+		// Then every app declaring the type itself, in a stable order
+		var ids []string
+		for id, app := range installed {
+			if slices.Contains(app.mimeTypes, t) {
+				ids = append(ids, id)
+			}
+		}
+		slices.Sort(ids)
+		for _, id := range ids {
+			add(id)
+		}
+	}
+	return apps, defaultID
+}
+
+// splitExec splits an Exec value into arguments. Arguments may be double quoted,
+// with backslash escaping ", `, $ and \ inside the quotes.
+func splitExec(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg, quoted := false, false
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(line):
+			i++
+			current.WriteByte(line[i])
+		case c == '"':
+			quoted = !quoted
+			inArg = true
+		case !quoted && (c == ' ' || c == '\t'):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteByte(c)
+			inArg = true
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quote in Exec")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// fileURL turns a path into a file:// URL for the %u and %U field codes
+func fileURL(path string) string {
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+// commands expands the Exec field codes for the paths. %f and %u take one file, so the app is
+// started once per path; %F and %U take them all at once.
+func (a desktopApp) commands(paths []string) ([]*exec.Cmd, error) {
+	args, err := splitExec(a.exec)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", a.id, err)
+	}
+
+	single := false
+	for _, arg := range args {
+		single = single || strings.Contains(arg, "%f") || strings.Contains(arg, "%u")
+	}
+
+	// expand builds one invocation; files are the paths it receives
+	expand := func(files []string) (*exec.Cmd, error) {
+		var argv []string
+		for _, arg := range args {
+			switch arg {
+			case "%F":
+				argv = append(argv, files...)
+				continue
+			case "%U":
+				for _, f := range files {
+					argv = append(argv, fileURL(f))
+				}
+				continue
+			case "%i":
+				if a.icon != "" {
+					argv = append(argv, "--icon", a.icon)
+				}
+				continue
+			}
+
+			var b strings.Builder
+			for i := 0; i < len(arg); i++ {
+				if arg[i] != '%' || i+1 == len(arg) {
+					b.WriteByte(arg[i])
+					continue
+				}
+				i++
+				switch arg[i] {
+				case '%':
+					b.WriteByte('%')
+				case 'F', 'U':
+					// A list of files can't be part of a larger argument
+					return nil, fmt.Errorf("%s: %%%c must be an argument of its own in Exec", a.id, arg[i])
+				case 'f':
+					b.WriteString(files[0])
+				case 'u':
+					b.WriteString(fileURL(files[0]))
+				case 'c':
+					b.WriteString(a.name)
+				case 'k':
+					b.WriteString(a.path)
+				default:
+					// Deprecated codes (%d, %n, %m...) expand to nothing
+				}
+			}
+			if b.Len() > 0 {
+				argv = append(argv, b.String())
+			}
+		}
+		if len(argv) == 0 {
+			return nil, fmt.Errorf("%s: empty Exec", a.id)
+		}
+		cmd := exec.Command(argv[0], argv[1:]...)
+		cmd.Dir = filepath.Dir(files[0])
+		return cmd, nil
+	}
+
+	if !single {
+		cmd, err := expand(paths)
+		if err != nil {
+			return nil, err
+		}
+		return []*exec.Cmd{cmd}, nil
+	}
+	var cmds []*exec.Cmd
+	for _, path := range paths {
+		cmd, err := expand([]string{path})
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds, nil
+}
+
+// setDefaultApp makes an application the default for a MIME type in the user's mimeapps.list.
+// A desktop's own list of the user, e.g. gnome-mimeapps.list, takes precedence over it: a
+// default it has for the type is replaced too. Everything else in the files is kept as it was.
+func setDefaultApp(mimeType, id string) error {
+	for _, name := range mimeappsNames() {
+		path := filepath.Join(xdgConfigHome(), name)
+		if err := setListDefault(path, mimeType, id, name != "mimeapps.list"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setListDefault writes a MIME type's default application into one mimeapps.list. With
+// onlyReplace, a list without a default for the type is left alone.
+func setListDefault(path, mimeType, id string, onlyReplace bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	entry := mimeType + "=" + id + ";"
+	var lines []string
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	}
+
+	// Find the [Default Applications] group and replace or append the type's entry in it
+	group, replaced := -1, false
+	end := len(lines)
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			if group >= 0 {
+				end = i
+				break
+			}
+			if trimmed == "[Default Applications]" {
+				group = i
+			}
+			continue
+		}
+		if key, _, ok := strings.Cut(trimmed, "="); group >= 0 && ok && strings.TrimSpace(key) == mimeType {
+			lines[i] = entry
+			replaced = true
+		}
+	}
+
+	switch {
+	case replaced:
+	case onlyReplace:
+		return nil
+	case group >= 0:
+		// Insert after the group's last non-blank line
+		at := end
+		for at > group+1 && strings.TrimSpace(lines[at-1]) == "" {
+			at--
+		}
+		lines = slices.Insert(lines, at, entry)
+	default:
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "[Default Applications]", entry)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// Write a sibling file and rename it over the list so a failure never leaves it half written
+	tmp := path + ".cdx-tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// desktopOpeners turns the applications registered for a MIME type into opener rules.
+// The default application is labeled as such, and each rule can be made the new default.
+func desktopOpeners(mimeType string) []openerRule {
+	apps, defaultID := appsForMIME(mimeType)
+
+	rules := make([]openerRule, len(apps))
+	for i, app := range apps {
+		name := app.name
+		if app.id == defaultID {
+			name += " (default)"
+		}
+		id := app.id
+		rules[i] = openerRule{
+			Name:       name,
+			Command:    app.exec,
+			Terminal:   app.terminal,
+			build:      app.commands,
+			setDefault: func() error { return setDefaultApp(mimeType, id) },
+		}
+	}
+	return rules
+}
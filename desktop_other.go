@@ -0,0 +1,8 @@
+//go:build !(linux || freebsd || openbsd || netbsd)
+
+package main
+
+// desktopOpeners has no application registry to read outside freedesktop platforms
+func desktopOpeners(mimeType string) []openerRule {
+	return nil
+}
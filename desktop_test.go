@@ -0,0 +1,205 @@
+//go:build linux || freebsd || openbsd || netbsd
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// desktopFixture points the XDG directories at a temporary tree and returns its root:
+// data-home and data-sys hold applications and shared-mime-info tables, config and etc the
+// user's and the system's mimeapps.list. The current desktop is GNOME, and the language German.
+func desktopFixture(t *testing.T) string {
+	t.Helper()
+	root := tempDir(t)
+	t.Setenv("XDG_DATA_HOME", filepath.Join(root, "data-home"))
+	t.Setenv("XDG_DATA_DIRS", filepath.Join(root, "data-sys"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(root, "config"))
+	t.Setenv("XDG_CONFIG_DIRS", filepath.Join(root, "etc"))
+	t.Setenv("XDG_CURRENT_DESKTOP", "ubuntu:GNOME")
+	t.Setenv("LC_ALL", "de_DE.UTF-8")
+
+	app := func(dir, id, extra string) {
+		writeFile(t, root, filepath.Join(dir, "applications", id),
+			"[Desktop Entry]\nType=Application\nName="+strings.TrimSuffix(id, ".desktop")+"\nExec="+id+" %F\n"+extra, time.Time{})
+	}
+	app("data-sys", "editor.desktop", "MimeType=text/plain;\nName[de]=Editor DE\n")
+	app("data-sys", "viewer.desktop", "MimeType=text/plain;image/png;\n")
+	app("data-sys", "ide.desktop", "MimeType=text/x-go;\n")
+	app("data-sys", "tool.desktop", "")
+	app("data-sys", "gone.desktop", "MimeType=text/plain;\n")
+	app("data-home", "gone.desktop", "Hidden=true\n") // The user's copy hides the system one
+	writeFile(t, root, "data-sys/mime/subclasses", "text/x-go text/plain\n", time.Time{})
+	return root
+}
+
+// appIDs lists the IDs of applications
+func appIDs(apps []desktopApp) []string {
+	var ids []string
+	for _, app := range apps {
+		ids = append(ids, app.id)
+	}
+	return ids
+}
+
+func TestParseDesktopFile(t *testing.T) {
+	path := writeFile(t, tempDir(t), "a.desktop", `# Comment
+ignored=before any group
+
+[Desktop Entry]
+Name = Spaced
+Exec=sh -c "a=b"
+  Indented=yes
+
+[Other]
+Key=value
+`, time.Time{})
+	groups, err := parseDesktopFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := groups["Desktop Entry"]
+	if entry["Name"] != "Spaced" || entry["Exec"] != `sh -c "a=b"` || entry["Indented"] != "yes" {
+		t.Errorf("Desktop Entry: %q", entry)
+	}
+	if len(groups) != 2 || groups["Other"]["Key"] != "value" {
+		t.Errorf("groups: %q", groups)
+	}
+}
+
+func TestAppsForMIME(t *testing.T) {
+	root := desktopFixture(t)
+
+	apps, defaultID := appsForMIME("text/x-go")
+	if got := appIDs(apps); !slices.Equal(got, []string{"ide.desktop", "editor.desktop", "viewer.desktop"}) || defaultID != "" {
+		t.Errorf("without lists: %q, default %q", got, defaultID)
+	}
+	if apps[1].name != "Editor DE" {
+		t.Errorf("name %q, want the German one", apps[1].name)
+	}
+
+	// The lists in order of precedence, the system's first so that each is overridden
+	for _, tc := range []struct {
+		list, content, wantDefault string
+	}{
+		{"data-sys/applications/mimeapps.list", "[Default Applications]\ntext/plain=viewer.desktop\n", "viewer.desktop"},
+		{"etc/mimeapps.list", "[Default Applications]\ntext/plain=missing.desktop;editor.desktop;\n", "editor.desktop"},
+		{"etc/gnome-mimeapps.list", "[Default Applications]\ntext/plain=viewer.desktop\n", "viewer.desktop"},
+		{"config/mimeapps.list", "[Default Applications]\ntext/plain=editor.desktop\n[Added Associations]\ntext/plain=tool.desktop;\n[Removed Associations]\ntext/plain=viewer.desktop;\n", "editor.desktop"},
+		{"config/gnome-mimeapps.list", "[Default Applications]\ntext/plain=tool.desktop\n", "tool.desktop"},
+	} {
+		writeFile(t, root, tc.list, tc.content, time.Time{})
+		if _, defaultID := appsForMIME("text/plain"); defaultID != tc.wantDefault {
+			t.Errorf("with %s: default %q, want %q", tc.list, defaultID, tc.wantDefault)
+		}
+	}
+
+	apps, _ = appsForMIME("text/plain")
+	if got := appIDs(apps); !slices.Equal(got, []string{"tool.desktop", "editor.desktop"}) {
+		t.Errorf("apps for text/plain: %q", got)
+	}
+}
+
+func TestSetDefaultApp(t *testing.T) {
+	root := desktopFixture(t)
+	list := writeFile(t, root, "config/mimeapps.list", `[Added Associations]
+text/plain=tool.desktop;
+
+[Default Applications]
+image/png=viewer.desktop;
+text/plain=viewer.desktop;
+
+[Removed Associations]
+`, time.Time{})
+	gnome := writeFile(t, root, "config/gnome-mimeapps.list", "[Default Applications]\ntext/plain=viewer.desktop;\n", time.Time{})
+
+	if err := setDefaultApp("text/plain", "editor.desktop"); err != nil {
+		t.Fatal(err)
+	}
+	if err := setDefaultApp("text/x-go", "ide.desktop"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `[Added Associations]
+text/plain=tool.desktop;
+
+[Default Applications]
+image/png=viewer.desktop;
+text/plain=editor.desktop;
+text/x-go=ide.desktop;
+
+[Removed Associations]
+`
+	if got := readFile(t, list); got != want {
+		t.Errorf("mimeapps.list:\n%s\nwant:\n%s", got, want)
+	}
+	// The desktop's own list only has what it named a default for replaced
+	if got := readFile(t, gnome); got != "[Default Applications]\ntext/plain=editor.desktop;\n" {
+		t.Errorf("gnome-mimeapps.list:\n%s", got)
+	}
+	assertMissing(t, filepath.Join(root, "config", "ubuntu-mimeapps.list"))
+
+	for mimeType, id := range map[string]string{"text/plain": "editor.desktop", "text/x-go": "ide.desktop"} {
+		if _, defaultID := appsForMIME(mimeType); defaultID != id {
+			t.Errorf("%s: default %q, want %q", mimeType, defaultID, id)
+		}
+	}
+}
+
+func TestSetDefaultAppCreatesList(t *testing.T) {
+	root := desktopFixture(t)
+	if err := setDefaultApp("text/plain", "editor.desktop"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(root, "config", "mimeapps.list")); got != "[Default Applications]\ntext/plain=editor.desktop;\n" {
+		t.Errorf("mimeapps.list:\n%s", got)
+	}
+	entries, _ := os.ReadDir(filepath.Join(root, "config"))
+	if len(entries) != 1 {
+		t.Errorf("config holds %d files", len(entries))
+	}
+}
+
+func TestDesktopAppCommands(t *testing.T) {
+	app := desktopApp{id: "app.desktop", name: "App", icon: "app-icon", path: "/apps/app.desktop"}
+	paths := []string{"/d/one two", "/d/three"}
+	for _, tc := range []struct {
+		exec string
+		want []string // One command per line, arguments separated by |
+	}{
+		{"app %F", []string{"app|/d/one two|/d/three"}},
+		{"app %U", []string{"app|file:///d/one%20two|file:///d/three"}},
+		{"app --file=%f", []string{"app|--file=/d/one two", "app|--file=/d/three"}},
+		{`app %i "%c" 100%% %k %d %f`, []string{
+			"app|--icon|app-icon|App|100%|/apps/app.desktop|/d/one two",
+			"app|--icon|app-icon|App|100%|/apps/app.desktop|/d/three",
+		}},
+	} {
+		app.exec = tc.exec
+		cmds, err := app.commands(paths)
+		if err != nil {
+			t.Errorf("%s: %v", tc.exec, err)
+			continue
+		}
+		var got []string
+		for _, cmd := range cmds {
+			got = append(got, strings.Join(cmd.Args, "|"))
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s:\n%q\nwant:\n%q", tc.exec, got, tc.want)
+		}
+	}
+
+	// A list of files can't be part of a larger argument
+	for _, exec := range []string{"app --files=%F", "app %Uend"} {
+		app.exec = exec
+		if _, err := app.commands(paths); err == nil {
+			t.Errorf("%s was accepted", exec)
+		}
+	}
+}
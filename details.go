@@ -0,0 +1,337 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Layout of the details view
+const (
+	DETAILS_MIN_WIDTH = 2 // Narrowest a column can be made
+	DETAILS_GUTTER    = 3 // Room left of the columns for the cursor and the mark
+)
+
+// layout decides how the objects of a directory are drawn
+type layout int
+
+const (
+	layoutGrid    layout = iota // Tiles, several per row
+	layoutDetails               // One row per object, in columns
+	layoutMiller                // Parent, current directory and preview side by side
+	layoutTree                  // One row per object, directories expanding in place
+)
+
+// layouts are switched between in this order
+var layouts = []layout{layoutGrid, layoutDetails, layoutMiller, layoutTree}
+
+// layoutNames are shown when switching layouts
+var layoutNames = map[layout]string{
+	layoutGrid:    "grid",
+	layoutDetails: "details",
+	layoutMiller:  "Miller columns",
+	layoutTree:    "tree",
+}
+
+// detailsColumn is a column the details layout can show
+type detailsColumn struct {
+	id    string    // As named in the config file
+	title string    // Header text
+	width int       // Default width; the name column fills what the others leave when it has none
+	right bool      // Right-aligned, for numbers
+	sort  sortOrder // Order picked by sorting on this column
+}
+
+// detailsColumns are all the columns there are
+var detailsColumns = []detailsColumn{
+	{id: "git", title: "Git", width: 3, sort: sortByGit},
+	{id: "name", title: "Name", sort: sortByName},
+	{id: "size", title: "Size", width: 9, right: true, sort: sortBySize},
+	{id: "mtime", title: "Modified", width: 16, sort: sortByTime},
+	{id: "mode", title: "Mode", width: 10, sort: sortByMode},
+	{id: "owner", title: "Owner", width: 16, sort: sortByOwner},
+}
+
+// defaultDetailsColumns are shown when the config doesn't list any
+var defaultDetailsColumns = []string{"git", "name", "size", "mtime", "mode"}
+
+// detailsView is what the details layout shows: which columns, how wide, and which one
+// the header keys act on
+type detailsView struct {
+	columns []detailsColumn // In display order, with their current widths
+	focus   int             // Index in columns of the column resized and sorted on
+}
+
+// newDetailsView builds the columns from config entries such as "size" or "owner:24".
+// Unknown entries are an error; without entries the defaults are used.
+func newDetailsView(entries []string) (detailsView, error) {
+	if len(entries) == 0 {
+		entries = defaultDetailsColumns
+	}
+
+	var v detailsView
+	for _, entry := range entries {
+		id, width, hasWidth := strings.Cut(entry, ":")
+		col, ok := detailsColumnByID(id)
+		if !ok {
+			return detailsView{}, fmt.Errorf("unknown details column %q", id)
+		}
+		if hasWidth {
+			n, err := strconv.Atoi(width)
+			if err != nil || n < DETAILS_MIN_WIDTH {
+				return detailsView{}, fmt.Errorf("details column %q: bad width %q", id, width)
+			}
+			col.width = n
+		}
+		v.columns = append(v.columns, col)
+	}
+
+	// The name can't be hidden: it's what tells the rows apart
+	if _, ok := v.column("name"); !ok {
+		col, _ := detailsColumnByID("name")
+		v.columns = append([]detailsColumn{col}, v.columns...)
+	}
+	return v, nil
+}
+
+// detailsColumnByID looks a column up by its config name
+func detailsColumnByID(id string) (detailsColumn, bool) {
+	for _, col := range detailsColumns {
+		if col.id == id {
+			return col, true
+		}
+	}
+	return detailsColumn{}, false
+}
+
+// column returns the index of a shown column
+func (v detailsView) column(id string) (int, bool) {
+	for i, col := range v.columns {
+		if col.id == id {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// widths resolves the width of every column for a row of the given width: the name column,
+// unless it was given a width, takes whatever the others leave
+func (v detailsView) widths(total int) []int {
+	widths := make([]int, len(v.columns))
+	used := len(v.columns) - 1 // One space between columns
+	fill := -1
+	for i, col := range v.columns {
+		if col.width == 0 {
+			fill = i
+			continue
+		}
+		widths[i] = col.width
+		used += col.width
+	}
+	if fill >= 0 {
+		widths[fill] = max(total-used, 10)
+	}
+	return widths
+}
+
+// cycleLayout switches to the next layout, keeping the cursor on the same object
+func (m *model) cycleLayout() {
+	i := 0
+	for i < len(layouts) && layouts[i] != m.layout {
+		i++
+	}
+	m.layout = layouts[(i+1)%len(layouts)]
+	m.keepFocus(true, func() {
+		m.resize()
+		m.applyFilter() // The tree layout lists expanded directories along
+	})
+	m.syncPaneObjects()
+	m.status = layoutNames[m.layout] + " layout"
+}
+
+// inDetails reports whether the details layout is shown, telling the user when it isn't
+func (m *model) inDetails() bool {
+	if m.layout != layoutDetails || m.treemapOn {
+		m.status = "only in the details layout"
+		return false
+	}
+	return true
+}
+
+// focusColumn moves the header's focus to the next or previous column
+func (m *model) focusColumn(delta int) {
+	if !m.inDetails() {
+		return
+	}
+	n := len(m.details.columns)
+	m.details.focus = ((m.details.focus+delta)%n + n) % n
+}
+
+// resizeColumn makes the focused column wider or narrower. A name column that fills the row
+// gets a width of its own the first time.
+func (m *model) resizeColumn(delta int) {
+	if !m.inDetails() {
+		return
+	}
+	width, _ := m.explorerSize()
+	col := &m.details.columns[m.details.focus]
+	if col.width == 0 {
+		col.width = m.details.widths(width - DETAILS_GUTTER)[m.details.focus]
+	}
+	col.width = max(col.width+delta, DETAILS_MIN_WIDTH)
+}
+
+// sortByColumn sorts on the focused column, or turns the order around if it's sorted on already
+func (m *model) sortByColumn() {
+	if !m.inDetails() {
+		return
+	}
+	m.sortBy(m.details.columns[m.details.focus].sort)
+}
+
+// columnsMenu shows and hides columns; the menu stays open so several can be changed
+func (m *model) columnsMenu(cursor int) {
+	var items []string
+	for _, col := range detailsColumns {
+		check := "[ ]"
+		if _, ok := m.details.column(col.id); ok {
+			check = "[x]"
+		}
+		items = append(items, check+" "+col.title)
+	}
+	m.openMenu("Columns", items, func(m *model, idx int) tea.Cmd {
+		col := detailsColumns[idx]
+		if i, ok := m.details.column(col.id); ok && col.id != "name" {
+			m.details.columns = append(m.details.columns[:i:i], m.details.columns[i+1:]...)
+		} else if !ok {
+			m.details.columns = append(m.details.columns, col)
+		}
+		m.details.focus = min(m.details.focus, len(m.details.columns)-1)
+		m.columnsMenu(idx)
+		return nil
+	})
+	m.menu.cursor = cursor
+}
+
+// renderDetails draws the header and one row per visible object
+func (m model) renderDetails(width, height int) string {
+	widths := m.details.widths(width - DETAILS_GUTTER)
+	total := m.duTotal()
+
+	// The header names the columns, shows which one is sorted on and which one the keys act on
+	var header []string
+	for i, col := range m.details.columns {
+		title := col.title
+		if col.sort == m.state.sort {
+			arrow := "↓"
+			if m.state.sortReverse {
+				arrow = "↑"
+			}
+			title += arrow
+		}
+		style := styleDetailsHeader
+		if i == m.details.focus {
+			style = style.Underline(true)
+		}
+		header = append(header, style.Render(fitCell(title, widths[i], col.right)))
+	}
+	lines := []string{strings.Repeat(" ", DETAILS_GUTTER) + strings.Join(header, " ")}
+
+	for row := 0; row < m.rows && row < height-1; row++ {
+		idx := m.state.viewportRowOffset + row
+		if idx >= len(m.objects) {
+			break
+		}
+		obj := m.objects[idx]
+		focused := row == m.state.coordinateIdx[0]
+
+		cells := make([]string, len(m.details.columns))
+		for i, col := range m.details.columns {
+			text := m.detailsCell(obj, col.id, total)
+			cell := fitCell(text, widths[i], col.right)
+			switch {
+			case focused:
+				// The row takes the selection color as a whole
+			case col.id == "name":
+				cell = m.nameStyle(obj).Render(cell)
+			case col.id == "git":
+				cell = renderGitBadge(m.gitCode(obj)) + strings.Repeat(" ", max(widths[i]-lipgloss.Width(text), 0))
+			default:
+				cell = styleBadge.Render(cell)
+			}
+			cells[i] = cell
+		}
+
+		gutter := "  "
+		if focused {
+			gutter = "› "
+		}
+		if m.state.selected[obj.Path] {
+			gutter = gutter[:len(gutter)-1] + "✓"
+		}
+		line := gutter + " " + strings.Join(cells, " ")
+		if focused {
+			line = styleRowSelected.Render(line)
+		}
+		lines = append(lines, line)
+	}
+
+	return lipgloss.NewStyle().
+		Width(width).
+		MaxWidth(width).
+		Height(height).
+		Render(strings.Join(lines, "\n"))
+}
+
+// detailsCell is the plain text of one cell
+func (m model) detailsCell(obj FileSystemObject, id string, total int64) string {
+	if !obj.Loaded && id != "name" {
+		if id == "size" {
+			return "…"
+		}
+		return ""
+	}
+
+	switch id {
+	case "git":
+		return string(m.gitCode(obj))
+	case "name":
+		name := fmt.Sprintf("[%s] %s", obj.Marker(), obj.Name)
+		if obj.IsSymlink() {
+			arrow := " → "
+			if obj.BrokenLink {
+				arrow = " ✗ "
+			}
+			name += arrow + obj.LinkTarget
+		}
+		return name
+	case "size":
+		if !obj.IsDir {
+			return formatSize(obj.Size)
+		}
+		if size, _ := m.duTileInfo(obj, total, FILE_OBJECT_WIDTH-2); size != "" {
+			return size
+		}
+		return "-"
+	case "mtime":
+		return obj.ModTime.Format("2006-01-02 15:04")
+	case "mode":
+		return symbolicMode(obj.Mode)
+	case "owner":
+		return obj.Owner
+	}
+	return ""
+}
+
+// fitCell pads or cuts text to exactly width cells
+func fitCell(text string, width int, right bool) string {
+	text = truncateCenter(text, width)
+	pad := strings.Repeat(" ", max(width-lipgloss.Width(text), 0))
+	if right {
+		return pad + text
+	}
+	return text + pad
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Disk usage mode
+const (
+	DU_WORKERS     = 8       // Directories read at the same time; the scan is bound by the disk, not the CPU
+	DU_CACHE_LIMIT = 1 << 20 // Directory sizes remembered before the cache starts over
+)
+
+// duSize is the recursive size of a directory
+type duSize struct {
+	bytes      int64 // Apparent size of everything below, multiply-linked files counted once
+	files      int64 // Number of non-directory entries below
+	incomplete bool  // Some entries couldn't be read; the size is a lower bound
+	mount      bool  // Another filesystem mounted here, skipped in one-filesystem mode
+}
+
+// add accumulates the size of a subdirectory
+func (s *duSize) add(other duSize) {
+	s.bytes += other.bytes
+	s.files += other.files
+	s.incomplete = s.incomplete || other.incomplete
+}
+
+// duCache remembers the size of every directory a scan went through, so going into a directory
+// that was measured from above, or back up again, costs nothing. It's shared by every scan.
+var duCache = struct {
+	sync.Mutex
+	sizes map[string]duSize
+}{sizes: map[string]duSize{}}
+
+// cachedDu returns the size measured for a directory, if any
+func cachedDu(path string) (duSize, bool) {
+	duCache.Lock()
+	defer duCache.Unlock()
+	size, ok := duCache.sizes[path]
+	return size, ok
+}
+
+// storeDu remembers the size of a directory
+func storeDu(path string, size duSize) {
+	duCache.Lock()
+	defer duCache.Unlock()
+	if len(duCache.sizes) >= DU_CACHE_LIMIT {
+		duCache.sizes = map[string]duSize{}
+	}
+	duCache.sizes[path] = size
+}
+
+// forgetDu drops the sizes of a directory and the directories above it, which include it.
+// With subtree set, everything below goes too.
+func forgetDu(path string, subtree bool) {
+	duCache.Lock()
+	defer duCache.Unlock()
+	for dir := path; ; dir = filepath.Dir(dir) {
+		delete(duCache.sizes, dir)
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	if subtree {
+		prefix := strings.TrimSuffix(path, string(filepath.Separator)) + string(filepath.Separator)
+		for dir := range duCache.sizes {
+			if strings.HasPrefix(dir, prefix) {
+				delete(duCache.sizes, dir)
+			}
+		}
+	}
+}
+
+// inodeKey identifies a file across its hard links
+type inodeKey struct {
+	dev, ino uint64
+}
+
+// duScan measures the subdirectories of one directory in the background. Each result is sent as
+// soon as its directory is done, so tiles fill in one by one.
+type duScan struct {
+	root          string
+	oneFilesystem bool             // Don't descend into other filesystems mounted below root
+	out           chan duResultMsg // Results for the model; closed when the scan is over
+	done          chan struct{}    // Closed by stop to abandon the scan
+	once          sync.Once
+	slots         chan struct{} // One token per running worker
+	seen          sync.Map      // inodeKey of multiply-linked files already counted
+	finished      bool          // Owned by the model: the last result came in
+}
+
+// duResultMsg carries the size of one subdirectory, or the end of a scan
+type duResultMsg struct {
+	scan *duScan
+	path string
+	size duSize
+	done bool
+}
+
+// newDuScan starts measuring the subdirectories of root that aren't cached yet
+func newDuScan(root string, oneFilesystem bool) *duScan {
+	s := &duScan{
+		root:          root,
+		oneFilesystem: oneFilesystem,
+		out:           make(chan duResultMsg),
+		done:          make(chan struct{}),
+		slots:         make(chan struct{}, DU_WORKERS),
+	}
+	go s.run()
+	return s
+}
+
+// stop abandons the scan; sizes finished so far stay cached
+func (s *duScan) stop() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// next returns a command that delivers the scan's next result
+func (s *duScan) next() tea.Cmd {
+	return func() tea.Msg {
+		msg, ok := <-s.out
+		if !ok {
+			return nil // Scan stopped
+		}
+		return msg
+	}
+}
+
+// send hands a result to the model, giving up if the scan is stopped meanwhile
+func (s *duScan) send(msg duResultMsg) bool {
+	msg.scan = s
+	select {
+	case s.out <- msg:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// run measures each subdirectory of root in its own worker, as many at a time as there are slots
+func (s *duScan) run() {
+	defer close(s.out)
+
+	entries, err := os.ReadDir(s.root)
+	if err != nil {
+		s.send(duResultMsg{done: true})
+		return
+	}
+	rootDev, _, _, _ := fileID(s.root)
+
+	var wg sync.WaitGroup
+	for _, entry := range entries {
+		// Symlinked directories are measured where they really are, not here
+		if !entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(s.root, entry.Name())
+		if _, ok := cachedDu(path); ok {
+			continue
+		}
+		if s.oneFilesystem && s.otherDevice(path, rootDev) {
+			storeDu(path, duSize{mount: true})
+			s.send(duResultMsg{path: path, size: duSize{mount: true}})
+			continue
+		}
+
+		select {
+		case s.slots <- struct{}{}:
+		case <-s.done:
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			size, ok := s.measure(path, rootDev)
+			<-s.slots
+			if ok {
+				s.send(duResultMsg{path: path, size: size})
+			}
+		}()
+	}
+	wg.Wait()
+	s.send(duResultMsg{done: true})
+}
+
+// measure adds up a directory recursively and caches the size of every directory on the way.
+// Subdirectories get a worker of their own while slots are free and are walked in place otherwise,
+// so the number of directories read at once stays bounded. It reports false when the scan was
+// stopped before the directory was done.
+func (s *duScan) measure(path string, rootDev uint64) (duSize, bool) {
+	if size, ok := cachedDu(path); ok {
+		return size, true
+	}
+	select {
+	case <-s.done:
+		return duSize{}, false
+	default:
+	}
+
+	var (
+		total   duSize
+		mu      sync.Mutex // Guards total and stopped against the workers below
+		stopped bool
+		wg      sync.WaitGroup
+	)
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		total.incomplete = true
+	}
+	for _, entry := range entries {
+		child := filepath.Join(path, entry.Name())
+
+		if entry.IsDir() {
+			if s.oneFilesystem && s.otherDevice(child, rootDev) {
+				continue
+			}
+			// The directory itself takes room too, as du counts it
+			if info, err := entry.Info(); err == nil {
+				mu.Lock()
+				total.bytes += info.Size()
+				mu.Unlock()
+			}
+			sub := func() {
+				size, ok := s.measure(child, rootDev)
+				mu.Lock()
+				total.add(size)
+				stopped = stopped || !ok
+				mu.Unlock()
+			}
+			select {
+			case s.slots <- struct{}{}:
+				wg.Add(1)
+				go func() {
+					defer func() { <-s.slots; wg.Done() }()
+					sub()
+				}()
+			default:
+				sub()
+			}
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			mu.Lock()
+			total.incomplete = true
+			mu.Unlock()
+			continue
+		}
+		// A file with several links is counted where the scan meets it first
+		if dev, ino, links, ok := fileInfoID(info); ok && links > 1 {
+			if _, dup := s.seen.LoadOrStore(inodeKey{dev, ino}, struct{}{}); dup {
+				continue
+			}
+		}
+		mu.Lock()
+		total.files++
+		total.bytes += info.Size()
+		mu.Unlock()
+	}
+	wg.Wait()
+
+	if stopped {
+		return total, false
+	}
+	storeDu(path, total)
+	return total, true
+}
+
+// otherDevice reports whether a directory is on another filesystem than the scan's root
+func (s *duScan) otherDevice(path string, rootDev uint64) bool {
+	dev, _, _, ok := fileID(path)
+	return ok && dev != rootDev
+}
+
+// duTracker is the model's side of disk usage mode
+type duTracker struct {
+	on            bool    // Directory tiles show their recursive size
+	oneFilesystem bool    // Scans stay on the filesystem they start on (-one-file-system)
+	scan          *duScan // Scan of the current directory; kept once finished so it isn't redone
+}
+
+// scanning reports whether sizes are still coming in
+func (d duTracker) scanning() bool {
+	return d.scan != nil && !d.scan.finished
+}
+
+// toggleDu switches disk usage mode on or off
+func (m *model) toggleDu() {
+	m.du.on = !m.du.on
+	if !m.du.on && m.du.scan != nil {
+		m.du.scan.stop()
+		m.du.scan = nil
+	}
+	m.keepFocus(true, m.applyFilter)
+}
+
+// rescanDu forgets every size below the current directory and measures it again
+func (m *model) rescanDu() {
+	forgetDu(m.state.currentPath, true)
+	if m.du.scan != nil {
+		m.du.scan.stop()
+		m.du.scan = nil
+	}
+	m.du.on = true
+}
+
+// invalidateDu is called when the current directory changed: its size and those above it are
+// measured again next time. Sizes of the subdirectories stay, as nothing says they changed.
+func (m *model) invalidateDu() {
+	forgetDu(m.state.currentPath, false)
+	if m.du.scan != nil {
+		m.du.scan.stop()
+		m.du.scan = nil
+	}
+}
+
+// syncDu starts measuring the current directory's subdirectories in disk usage mode
+func (m *model) syncDu() tea.Cmd {
+	if !m.du.on || m.tree != nil {
+		if m.du.scan != nil {
+			m.du.scan.stop()
+			m.du.scan = nil
+		}
+		return nil
+	}
+	if m.du.scan != nil && m.du.scan.root == m.state.currentPath {
+		return nil
+	}
+	if m.du.scan != nil {
+		m.du.scan.stop()
+	}
+	m.du.scan = newDuScan(m.state.currentPath, m.du.oneFilesystem)
+
+	cmds := []tea.Cmd{m.du.scan.next()}
+	if !m.spinning {
+		m.spinning = true
+		cmds = append(cmds, spinnerTick())
+	}
+	return tea.Batch(cmds...)
+}
+
+// handleDu takes in the size of a subdirectory; the tiles pick it out of the cache when drawn
+func (m *model) handleDu(msg duResultMsg) tea.Cmd {
+	if msg.scan != m.du.scan {
+		return nil // From a directory we already left
+	}
+	if msg.done {
+		m.du.scan.finished = true
+		return nil
+	}
+	if m.state.sort == sortBySize {
+		m.keepFocus(true, m.applyFilter)
+	}
+	return m.du.scan.next()
+}
+
+// dirSize returns the recursive size of a directory tile in disk usage mode
+func (m model) dirSize(obj FileSystemObject) (duSize, bool) {
+	if !m.du.on || m.tree != nil || !obj.IsDir || obj.IsSymlink() {
+		return duSize{}, false
+	}
+	return cachedDu(obj.Path)
+}
+
+// duTotal is the size of the current directory as far as it's known: what the bars are relative to
+func (m model) duTotal() int64 {
+	var total int64
+	for _, obj := range m.listing {
+		if size, ok := m.dirSize(obj); ok {
+			total += size.bytes
+		} else if !obj.IsDir {
+			total += obj.Size
+		}
+	}
+	return total
+}
+
+// duTileInfo gives what disk usage mode puts on a tile: the size of a directory ("" when it's not
+// measured or the mode is off) and the bar showing its share of the directory on screen
+func (m model) duTileInfo(obj FileSystemObject, total int64, width int) (string, string) {
+	if !m.du.on || m.tree != nil {
+		return "", ""
+	}
+
+	size := ""
+	bytes := obj.Size
+	if obj.IsDir {
+		d, ok := m.dirSize(obj)
+		switch {
+		case obj.IsSymlink():
+			return "", ""
+		case !ok && m.du.scanning():
+			return "…", ""
+		case !ok:
+			return "", ""
+		case d.mount:
+			return "mount", ""
+		}
+		size, bytes = formatSize(d.bytes), d.bytes
+		if d.incomplete {
+			size = "≥" + size
+		}
+	}
+	return size, renderDuBar(bytes, total, width)
+}
+
+// renderDuBar draws a share of the total as a bar followed by its percentage
+func renderDuBar(part, total int64, width int) string {
+	// Scans keep filling the cache while the screen is drawn, so a part may be newer than the total
+	share := 0.0
+	if total > 0 {
+		share = min(float64(part)/float64(total), 1)
+	}
+	label := fmt.Sprintf(" %3.0f%%", share*100)
+	barWidth := width - lipgloss.Width(label)
+	filled := int(share*float64(barWidth) + 0.5)
+	return lipgloss.NewStyle().Foreground(borderColor).Render(strings.Repeat("█", filled)) +
+		styleBadge.Render(strings.Repeat("░", barWidth-filled)+label)
+}
+
+// duLabel is the top bar note in disk usage mode: the total of the directory so far
+func (m model) duLabel() string {
+	if !m.du.on || m.tree != nil {
+		return ""
+	}
+	return "Σ " + formatSize(m.duTotal()) + " "
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package main
+
+import "io/fs"
+
+// fileID is unknown on this platform: hard links are counted each time and mounts are crossed
+func fileID(path string) (dev, ino, links uint64, ok bool) {
+	return 0, 0, 0, false
+}
+
+// fileInfoID is unknown on this platform
+func fileInfoID(info fs.FileInfo) (dev, ino, links uint64, ok bool) {
+	return 0, 0, 0, false
+}
@@ -0,0 +1,27 @@
+//go:build unix
+
+package main
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// fileID returns the device and inode of a path, and how many links point to it
+func fileID(path string) (dev, ino, links uint64, ok bool) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	return fileInfoID(info)
+}
+
+// fileInfoID returns the device, inode and link count behind a FileInfo from Lstat
+func fileInfoID(info fs.FileInfo) (dev, ino, links uint64, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, 0, false
+	}
+	return uint64(st.Dev), uint64(st.Ino), uint64(st.Nlink), true
+}
@@ -0,0 +1,580 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Duplicate finder
+const (
+	DUPE_PARTIAL_SIZE = 16 * 1024 // Bytes hashed from the start of each candidate before hashing it whole
+)
+
+// dupeFile is one candidate copy
+type dupeFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+	hash    [sha256.Size]byte // Of the first DUPE_PARTIAL_SIZE bytes, then of the whole content
+	err     error             // Couldn't be read: left out of every group
+}
+
+// dupeGroup is a set of files with the same content
+type dupeGroup struct {
+	size  int64
+	files []dupeFile // Sorted by path
+}
+
+// wasted is the room the group takes beyond a single copy
+func (g dupeGroup) wasted() int64 {
+	return g.size * int64(len(g.files)-1)
+}
+
+// dupeScan looks for duplicates below a directory in the background
+type dupeScan struct {
+	root string
+	done chan struct{} // Closed by stop to abandon the scan
+	once sync.Once
+
+	// Progress, read by the top bar while the scan runs
+	files  atomic.Int64 // Files walked
+	hashed atomic.Int64 // Bytes hashed so far
+	total  atomic.Int64 // Bytes to hash, known once walking is over
+}
+
+// dupesFoundMsg delivers the groups a scan found
+type dupesFoundMsg struct {
+	scan   *dupeScan
+	groups []dupeGroup
+	err    error
+}
+
+// stop abandons the scan
+func (s *dupeScan) stop() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// stopped reports whether the scan was abandoned
+func (s *dupeScan) stopped() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// run walks the tree, groups regular files by size, then by a hash of their start, then by
+// a hash of their whole content, hashing in parallel. Each step only looks at what's still
+// ambiguous after the previous one, so most files are never read.
+func (s *dupeScan) run() tea.Msg {
+	// Files of the same size are candidates. Hard links to the same inode are one file:
+	// they take no extra room.
+	bySize := map[int64][]dupeFile{}
+	inodes := map[inodeKey]bool{}
+	err := filepath.WalkDir(s.root, func(path string, entry fs.DirEntry, err error) error {
+		if s.stopped() {
+			return fs.SkipAll
+		}
+		if err != nil || !entry.Type().IsRegular() {
+			return nil // Unreadable directories are skipped; symlinks aren't followed
+		}
+		info, err := entry.Info()
+		if err != nil || info.Size() == 0 {
+			return nil
+		}
+		s.files.Add(1)
+		if dev, ino, links, ok := fileInfoID(info); ok && links > 1 {
+			if inodes[inodeKey{dev, ino}] {
+				return nil
+			}
+			inodes[inodeKey{dev, ino}] = true
+		}
+		bySize[info.Size()] = append(bySize[info.Size()], dupeFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return dupesFoundMsg{scan: s, err: err}
+	}
+
+	var candidates [][]dupeFile
+	for _, files := range bySize {
+		if len(files) > 1 {
+			candidates = append(candidates, files)
+			for _, f := range files {
+				s.total.Add(min(f.size, DUPE_PARTIAL_SIZE))
+			}
+		}
+	}
+
+	// The start of the files first: different files usually differ early
+	candidates = s.refine(candidates, DUPE_PARTIAL_SIZE)
+
+	// Whatever still matches is read whole, unless the start was the whole file
+	var whole, done [][]dupeFile
+	for _, files := range candidates {
+		if files[0].size <= DUPE_PARTIAL_SIZE {
+			done = append(done, files)
+			continue
+		}
+		whole = append(whole, files)
+		for _, f := range files {
+			s.total.Add(f.size)
+		}
+	}
+	done = append(done, s.refine(whole, -1)...)
+	if s.stopped() {
+		return nil
+	}
+
+	groups := make([]dupeGroup, 0, len(done))
+	for _, files := range done {
+		slices.SortFunc(files, func(a, b dupeFile) int { return strings.Compare(a.path, b.path) })
+		groups = append(groups, dupeGroup{size: files[0].size, files: files})
+	}
+	// The groups worth cleaning up most come first
+	slices.SortFunc(groups, func(a, b dupeGroup) int {
+		return cmp.Or(cmp.Compare(b.wasted(), a.wasted()), strings.Compare(a.files[0].path, b.files[0].path))
+	})
+	return dupesFoundMsg{scan: s, groups: groups}
+}
+
+// refine hashes every file of the candidate sets (their first limit bytes, or all of them when
+// limit is negative) on all CPUs, and splits the sets by hash. Sets left with one file are dropped.
+func (s *dupeScan) refine(candidates [][]dupeFile, limit int64) [][]dupeFile {
+	jobs := make(chan *dupeFile)
+	var wg sync.WaitGroup
+	for range runtime.NumCPU() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				f.hash, f.err = s.hashFile(f.path, limit)
+			}
+		}()
+	}
+	for _, files := range candidates {
+		for i := range files {
+			if s.stopped() {
+				break
+			}
+			jobs <- &files[i]
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	var refined [][]dupeFile
+	for _, files := range candidates {
+		byHash := map[[sha256.Size]byte][]dupeFile{}
+		for _, f := range files {
+			if f.err == nil {
+				byHash[f.hash] = append(byHash[f.hash], f)
+			}
+		}
+		for _, same := range byHash {
+			if len(same) > 1 {
+				refined = append(refined, same)
+			}
+		}
+	}
+	return refined
+}
+
+// hashFile hashes the start of a file, or all of it when limit is negative, counting the progress
+func (s *dupeScan) hashFile(path string, limit int64) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	f, err := os.Open(path)
+	if err != nil {
+		return sum, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if limit >= 0 {
+		r = io.LimitReader(f, limit)
+	}
+	h := sha256.New()
+	buf := make([]byte, 256*1024)
+	for {
+		if s.stopped() {
+			return sum, errors.New("stopped")
+		}
+		n, err := r.Read(buf)
+		h.Write(buf[:n])
+		s.hashed.Add(int64(n))
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return sum, err
+		}
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// dupeView lists duplicate groups in place of a directory. The tiles are the real files, so they
+// open, preview and take operations as usual.
+type dupeView struct {
+	root   string
+	groups []dupeGroup
+	group  map[string]int // Group index of every file, by path
+}
+
+// newDupeView shows the groups a scan found
+func newDupeView(root string, groups []dupeGroup) *dupeView {
+	v := &dupeView{root: root, groups: groups}
+	v.index()
+	return v
+}
+
+// index maps every file to its group
+func (v *dupeView) index() {
+	v.group = map[string]int{}
+	for i, g := range v.groups {
+		for _, f := range g.files {
+			v.group[f.path] = i
+		}
+	}
+}
+
+// list gives the files of every group, group by group, named by their path below the root
+func (v *dupeView) list(string) ([]FileSystemObject, error) {
+	var objects []FileSystemObject
+	for _, g := range v.groups {
+		for _, f := range g.files {
+			obj := FileSystemObject{Path: f.path}
+			obj.load()
+			if rel, err := filepath.Rel(v.root, f.path); err == nil {
+				obj.Name = rel
+			}
+			objects = append(objects, obj)
+		}
+	}
+	return objects, nil
+}
+
+// prune drops files that were removed or made into links of a copy kept in the same group,
+// and the groups that are no longer duplicated
+func (v *dupeView) prune() {
+	groups := v.groups[:0]
+	for _, g := range v.groups {
+		var files []dupeFile
+		seen := map[inodeKey]bool{}
+		for _, f := range g.files {
+			info, err := os.Lstat(f.path)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			if dev, ino, _, ok := fileInfoID(info); ok {
+				if seen[inodeKey{dev, ino}] {
+					continue
+				}
+				seen[inodeKey{dev, ino}] = true
+			}
+			files = append(files, f)
+		}
+		if len(files) > 1 {
+			g.files = files
+			groups = append(groups, g)
+		}
+	}
+	v.groups = groups
+	v.index()
+}
+
+// wasted is the room all groups take beyond one copy each
+func (v *dupeView) wasted() int64 {
+	var total int64
+	for _, g := range v.groups {
+		total += g.wasted()
+	}
+	return total
+}
+
+// badge is what a file's tile says about its group
+func (v *dupeView) badge(path string) string {
+	i, ok := v.group[path]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("#%d · %d copies", i+1, len(v.groups[i].files))
+}
+
+// label is the top bar summary of the duplicates
+func (v *dupeView) label() string {
+	return fmt.Sprintf("⧉ %d groups, %s wasted ", len(v.groups), formatSize(v.wasted()))
+}
+
+// findDupes looks for duplicates below the current directory, or leaves the duplicates view
+func (m *model) findDupes() tea.Cmd {
+	if m.dupes != nil {
+		m.dupes = nil
+		m.openCurrentPath()
+		return nil
+	}
+	if m.tree != nil {
+		m.status = "read-only: this is the tree of " + m.tree.rev
+		return nil
+	}
+	if m.dupeScan != nil {
+		m.dupeScan.stop()
+		m.dupeScan = nil
+		m.status = "duplicate search cancelled"
+		return nil
+	}
+
+	scan := &dupeScan{root: m.state.currentPath, done: make(chan struct{})}
+	m.dupeScan = scan
+	cmds := []tea.Cmd{scan.run}
+	if !m.spinning {
+		m.spinning = true
+		cmds = append(cmds, spinnerTick())
+	}
+	return tea.Batch(cmds...)
+}
+
+// showDupes opens the duplicates view once a scan is over
+func (m *model) showDupes(msg dupesFoundMsg) {
+	if msg.scan != m.dupeScan {
+		return // Cancelled
+	}
+	m.dupeScan = nil
+	switch {
+	case msg.err != nil:
+		m.status = msg.err.Error()
+	case msg.scan.root != m.state.currentPath:
+		m.status = fmt.Sprintf("%d duplicate groups found in %s", len(msg.groups), msg.scan.root)
+	case len(msg.groups) == 0:
+		m.status = "no duplicates below " + msg.scan.root
+	default:
+		m.verify = nil
+		m.dupes = newDupeView(msg.scan.root, msg.groups)
+		m.openCurrentPath()
+	}
+}
+
+// dupesLabel shows the progress of a search, or the summary of the duplicates shown
+func (m model) dupesLabel() string {
+	switch {
+	case m.dupeScan != nil:
+		s := m.dupeScan
+		if total := s.total.Load(); total > 0 {
+			return fmt.Sprintf("⧉ hashing %d%% ", s.hashed.Load()*100/total)
+		}
+		return fmt.Sprintf("⧉ %d files ", s.files.Load())
+	case m.dupes != nil:
+		return m.dupes.label()
+	}
+	return ""
+}
+
+// markDupes offers ways to mark every copy but one in each group
+func (m *model) markDupes() {
+	if m.dupes == nil {
+		m.status = "find duplicates first"
+		return
+	}
+	items := []string{"Keep the newest", "Keep the oldest", "Keep the one in a path…"}
+	m.openMenu("Mark duplicates, keeping one copy per group", items, func(m *model, idx int) tea.Cmd {
+		switch idx {
+		case 0:
+			m.keepDupes(func(a, b dupeFile) bool { return a.modTime.After(b.modTime) })
+		case 1:
+			m.keepDupes(func(a, b dupeFile) bool { return a.modTime.Before(b.modTime) })
+		case 2:
+			m.openPrompt("Keep copies whose path contains", "", func(m *model, part string) tea.Cmd {
+				if part == "" {
+					return nil
+				}
+				m.keepDupes(func(a, b dupeFile) bool {
+					return strings.Contains(a.path, part) && !strings.Contains(b.path, part)
+				})
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+// keepDupes marks every file but the best one of each group; better reports whether a copy is
+// preferable to another. Groups where no copy is better than the others are left alone.
+func (m *model) keepDupes(better func(a, b dupeFile) bool) {
+	m.state.selected = map[string]bool{}
+	marked, groups := 0, 0
+	for _, g := range m.dupes.groups {
+		keep := 0
+		for i, f := range g.files {
+			if better(f, g.files[keep]) {
+				keep = i
+			}
+		}
+		if !slices.ContainsFunc(g.files, func(f dupeFile) bool { return better(g.files[keep], f) }) {
+			continue // Nothing to choose from
+		}
+		for i, f := range g.files {
+			if i != keep {
+				m.state.selected[f.path] = true
+				marked++
+			}
+		}
+		groups++
+	}
+	m.status = fmt.Sprintf("marked %d files in %d groups", marked, groups)
+}
+
+// resolveDupes trashes the marked duplicates, or replaces them with hard links to the copy kept
+// in their group. A group must keep at least one unmarked copy.
+func (m *model) resolveDupes() {
+	if m.dupes == nil {
+		m.status = "find duplicates first"
+		return
+	}
+	if len(m.state.selected) == 0 {
+		m.status = "mark the copies to get rid of first"
+		return
+	}
+
+	// Pair every marked file with the copy that stays
+	var removals []dupeRemoval
+	for _, g := range m.dupes.groups {
+		kept := -1
+		for i, f := range g.files {
+			if !m.state.selected[f.path] {
+				kept = i
+				break
+			}
+		}
+		for _, f := range g.files {
+			if !m.state.selected[f.path] {
+				continue
+			}
+			if kept < 0 {
+				m.status = fmt.Sprintf("every copy of %s is marked: keep one", filepath.Base(f.path))
+				return
+			}
+			removals = append(removals, dupeRemoval{f, g.files[kept]})
+		}
+	}
+
+	title := fmt.Sprintf("Get rid of %d duplicates", len(removals))
+	m.openMenu(title, []string{"Cancel", "Move to the trash", "Replace with hard links to the kept copy"}, func(m *model, idx int) tea.Cmd {
+		if idx == 0 {
+			return nil
+		}
+		return func() tea.Msg { return removeDupes(removals, idx == 2) }
+	})
+}
+
+// dupeRemoval is a marked copy to get rid of, and the copy of its group that stays
+type dupeRemoval struct {
+	file, kept dupeFile
+}
+
+// removeDupes trashes every marked copy, or replaces it with a hard link to the kept one.
+// A copy is skipped, and reported, unless both it and the kept copy are still as the scan left them.
+func removeDupes(removals []dupeRemoval, link bool) opResultMsg {
+	result := opResultMsg{verb: "trash"}
+	if link {
+		result.verb = "hard link"
+	}
+	for _, r := range removals {
+		err := checkDupe(r)
+		if err == nil && link {
+			err = replaceWithLink(r.kept.path, r.file.path)
+		} else if err == nil {
+			err = moveToTrash(r.file.path)
+		}
+		if err != nil {
+			result.failures = append(result.failures, pathError{path: r.file.path, err: err})
+		} else {
+			result.done++
+		}
+	}
+	return result
+}
+
+// checkDupe makes sure a copy is still a duplicate of the one kept: both have the size and
+// modification time the scan saw, and the same content, compared byte by byte
+func checkDupe(r dupeRemoval) error {
+	for _, f := range []dupeFile{r.file, r.kept} {
+		info, err := os.Lstat(f.path)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || info.Size() != f.size || !info.ModTime().Equal(f.modTime) {
+			return fmt.Errorf("%s changed since the scan: skipped", filepath.Base(f.path))
+		}
+	}
+	same, err := sameContent(r.file.path, r.kept.path)
+	if err != nil {
+		return err
+	}
+	if !same {
+		return fmt.Errorf("no longer the same as %s: skipped", r.kept.path)
+	}
+	return nil
+}
+
+// sameContent reports whether two files hold the same bytes
+func sameContent(a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	bufA, bufB := make([]byte, 256*1024), make([]byte, 256*1024)
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+		doneA := errA == io.EOF || errA == io.ErrUnexpectedEOF
+		doneB := errB == io.EOF || errB == io.ErrUnexpectedEOF
+		switch {
+		case errA != nil && !doneA:
+			return false, errA
+		case errB != nil && !doneB:
+			return false, errB
+		case doneA || doneB:
+			return doneA && doneB, nil // Equal so far: the same unless one is longer
+		}
+	}
+}
+
+// replaceWithLink makes path a hard link to kept. The link is made under a temporary name and
+// renamed over path, so path never goes missing.
+func replaceWithLink(kept, path string) error {
+	tmp := filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.cdx-link-%d", filepath.Base(path), os.Getpid()))
+	if err := os.Link(kept, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scanDupes runs a duplicate search below dir and returns the groups found
+func scanDupes(t *testing.T, dir string) []dupeGroup {
+	t.Helper()
+	msg := (&dupeScan{root: dir, done: make(chan struct{})}).run().(dupesFoundMsg)
+	if msg.err != nil {
+		t.Fatal(msg.err)
+	}
+	return msg.groups
+}
+
+// dupeRemovals pairs every copy of each group but the first with the first
+func dupeRemovals(groups []dupeGroup) []dupeRemoval {
+	var removals []dupeRemoval
+	for _, g := range groups {
+		for _, f := range g.files[1:] {
+			removals = append(removals, dupeRemoval{f, g.files[0]})
+		}
+	}
+	return removals
+}
+
+func TestFindDupes(t *testing.T) {
+	dir := tempDir(t)
+	big := strings.Repeat("0123456789abcdef", DUPE_PARTIAL_SIZE/8) // Past the partial hash
+	writeFile(t, dir, "a", big, time.Time{})
+	writeFile(t, dir, "sub/b", big, time.Time{})
+	writeFile(t, dir, "c", big[:len(big)-1]+"!", time.Time{}) // Differs only at the end
+	writeFile(t, dir, "small1", "same", time.Time{})
+	writeFile(t, dir, "small2", "same", time.Time{})
+	writeFile(t, dir, "empty1", "", time.Time{})
+	writeFile(t, dir, "empty2", "", time.Time{})
+
+	groups := scanDupes(t, dir)
+	if len(groups) != 2 {
+		t.Fatalf("%d groups, want 2: %v", len(groups), groups)
+	}
+	if g := groups[0]; len(g.files) != 2 || g.files[0].path != filepath.Join(dir, "a") || g.files[1].path != filepath.Join(dir, "sub", "b") {
+		t.Errorf("first group: %v", g.files)
+	}
+}
+
+func TestRemoveDupes(t *testing.T) {
+	for _, link := range []bool{false, true} {
+		name := "trash"
+		if link {
+			name = "link"
+		}
+		t.Run(name, func(t *testing.T) {
+			trash := testTrash(t)
+			dir := tempDir(t)
+			kept := writeFile(t, dir, "a-kept", "content", time.Time{})
+			copied := writeFile(t, dir, "b-copy", "content", time.Time{})
+
+			result := removeDupes(dupeRemovals(scanDupes(t, dir)), link)
+			if result.done != 1 || len(result.failures) > 0 {
+				t.Fatalf("done %d, failures %v", result.done, result.failures)
+			}
+			if link {
+				a, _ := os.Stat(kept)
+				b, _ := os.Stat(copied)
+				if !os.SameFile(a, b) {
+					t.Error("the copy isn't a link to the kept file")
+				}
+			} else {
+				assertMissing(t, copied)
+				if got := readFile(t, filepath.Join(trash, "b-copy")); got != "content" {
+					t.Errorf("trashed copy holds %q", got)
+				}
+			}
+			if got := readFile(t, kept); got != "content" {
+				t.Errorf("kept file holds %q", got)
+			}
+		})
+	}
+}
+
+func TestRemoveDupesSkipsChangedFiles(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		change func(t *testing.T, dir string)
+	}{
+		{"copy rewritten", func(t *testing.T, dir string) {
+			// The same size and time: only the content tells
+			info, _ := os.Stat(filepath.Join(dir, "b-copy"))
+			writeFile(t, dir, "b-copy", "CONTENT", info.ModTime())
+		}},
+		{"kept rewritten", func(t *testing.T, dir string) {
+			info, _ := os.Stat(filepath.Join(dir, "a-kept"))
+			writeFile(t, dir, "a-kept", "CONTENT", info.ModTime())
+		}},
+		{"copy grew", func(t *testing.T, dir string) {
+			writeFile(t, dir, "b-copy", "content and more", time.Time{})
+		}},
+		{"copy touched", func(t *testing.T, dir string) {
+			writeFile(t, dir, "b-copy", "content", time.Now().Add(time.Hour))
+		}},
+		{"kept removed", func(t *testing.T, dir string) {
+			os.Remove(filepath.Join(dir, "a-kept"))
+		}},
+	} {
+		for _, link := range []bool{false, true} {
+			name := tc.name + "/trash"
+			if link {
+				name = tc.name + "/link"
+			}
+			t.Run(name, func(t *testing.T) {
+				trash := testTrash(t)
+				dir := tempDir(t)
+				writeFile(t, dir, "a-kept", "content", time.Time{})
+				copied := writeFile(t, dir, "b-copy", "content", time.Time{})
+				removals := dupeRemovals(scanDupes(t, dir))
+				tc.change(t, dir)
+				before := readFile(t, copied)
+
+				result := removeDupes(removals, link)
+				if result.done != 0 || len(result.failures) != 1 || result.failures[0].path != copied {
+					t.Errorf("done %d, failures %v", result.done, result.failures)
+				}
+				if got := readFile(t, copied); got != before {
+					t.Errorf("the copy changed: %q", got)
+				}
+				assertMissing(t, filepath.Join(trash, "b-copy"))
+			})
+		}
+	}
+}
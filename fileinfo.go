@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// fileDetails is everything the info panel shows about one object.
+// Fields the platform can't provide are left at their zero value and hidden.
+type fileDetails struct {
+	Path       string
+	Mode       fs.FileMode
+	Size       int64
+	Owner      string // User name, or numeric id if it can't be resolved
+	Group      string // Group name, or numeric id if it can't be resolved
+	Inode      uint64
+	Links      uint64
+	Device     string // major:minor of the filesystem holding the object
+	RDevice    string // major:minor of the device itself (block/char devices only)
+	Blocks     int64  // 512-byte blocks allocated
+	Accessed   time.Time
+	Modified   time.Time
+	Changed    time.Time // Metadata change time
+	Born       time.Time // Creation time, only on filesystems/kernels that record it
+	LinkTarget string
+	MIME       string // Detected content type (regular files only)
+	Kind       string // Human readable description of the content
+	Lines      int    // Line count, for text files
+	IsText     bool
+}
+
+// fileDetailsMsg delivers the result of a background gatherDetails call
+type fileDetailsMsg struct {
+	details fileDetails
+	err     error
+}
+
+// gatherDetailsCmd collects file details off the UI loop, since counting lines may read a large file
+func gatherDetailsCmd(path string) tea.Cmd {
+	return func() tea.Msg {
+		d, err := gatherDetails(path)
+		return fileDetailsMsg{details: d, err: err}
+	}
+}
+
+// gatherDetails stats an object without following symlinks and fills in everything we can learn about it
+func gatherDetails(path string) (fileDetails, error) {
+	d := fileDetails{Path: path}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return d, err
+	}
+	d.Mode = info.Mode()
+	d.Size = info.Size()
+	d.Modified = info.ModTime()
+
+	// Platform specific fields: owner, inode, device, extra timestamps...
+	platformDetails(path, &d)
+
+	if d.Mode&fs.ModeSymlink != 0 {
+		d.LinkTarget, _ = os.Readlink(path)
+	}
+
+	if d.Mode.IsRegular() {
+		t := detectType(path)
+		d.MIME, d.Kind, d.IsText = t.MIME, t.Description, t.Text
+		if d.IsText {
+			d.Lines, _ = countLines(path)
+		}
+	}
+	return d, nil
+}
+
+// countLines counts newline-terminated lines, plus a final unterminated one
+func countLines(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	lines := 0
+	last := byte('\n')
+	buf := make([]byte, 64*1024)
+	r := bufio.NewReader(f)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			lines += bytes.Count(buf[:n], []byte{'\n'})
+			last = buf[n-1]
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return lines, err
+		}
+	}
+
+	if last != '\n' {
+		lines += 1
+	}
+	return lines, nil
+}
+
+// lookupOwner turns numeric user and group ids into names, keeping the number when there's no match
+func lookupOwner(uid, gid uint32) (string, string) {
+	owner := strconv.FormatUint(uint64(uid), 10)
+	if u, err := user.LookupId(owner); err == nil {
+		owner = u.Username
+	}
+
+	group := strconv.FormatUint(uint64(gid), 10)
+	if g, err := user.LookupGroupId(group); err == nil {
+		group = g.Name
+	}
+	return owner, group
+}
+
+// unixPermBits converts a Go FileMode into classic Unix permission bits, including setuid/setgid/sticky
+func unixPermBits(mode fs.FileMode) uint32 {
+	bits := uint32(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		bits |= 0o4000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		bits |= 0o2000
+	}
+	if mode&fs.ModeSticky != 0 {
+		bits |= 0o1000
+	}
+	return bits
+}
+
+// symbolicMode renders a mode the way ls -l does, e.g. "drwxr-sr-x" or "-rwsr-xr-x"
+func symbolicMode(mode fs.FileMode) string {
+	var b [10]byte
+
+	// File type character
+	switch {
+	case mode.IsDir():
+		b[0] = 'd'
+	case mode&fs.ModeSymlink != 0:
+		b[0] = 'l'
+	case mode&fs.ModeNamedPipe != 0:
+		b[0] = 'p'
+	case mode&fs.ModeSocket != 0:
+		b[0] = 's'
+	case mode&fs.ModeCharDevice != 0:
+		b[0] = 'c'
+	case mode&fs.ModeDevice != 0:
+		b[0] = 'b'
+	default:
+		b[0] = '-'
+	}
+
+	// rwx triplets for user, group and other
+	const rwx = "rwxrwxrwx"
+	perm := mode.Perm()
+	for i := 0; i < 9; i++ {
+		if perm&(1<<uint(8-i)) != 0 {
+			b[i+1] = rwx[i]
+		} else {
+			b[i+1] = '-'
+		}
+	}
+
+	// Special bits replace the execute slot: lowercase if execute is also set, uppercase otherwise
+	special := func(idx int, set bool, lower, upper byte) {
+		if !set {
+			return
+		}
+		if b[idx] == 'x' {
+			b[idx] = lower
+		} else {
+			b[idx] = upper
+		}
+	}
+	special(3, mode&fs.ModeSetuid != 0, 's', 'S')
+	special(6, mode&fs.ModeSetgid != 0, 's', 'S')
+	special(9, mode&fs.ModeSticky != 0, 't', 'T')
+
+	return string(b[:])
+}
+
+// formatTimestamp renders a time for the info panel; unknown times are left empty so they're hidden
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05 MST")
+}
+
+// lines formats the details as aligned label/value rows for the info overlay
+func (d fileDetails) lines() []string {
+	size := formatSize(d.Size)
+	if d.Size >= 1024 {
+		size += fmt.Sprintf(" (%d bytes)", d.Size)
+	}
+
+	var blocks, inode, links, lineCount string
+	if d.Blocks > 0 {
+		blocks = strconv.FormatInt(d.Blocks, 10)
+	}
+	if d.Inode > 0 {
+		inode = strconv.FormatUint(d.Inode, 10)
+	}
+	if d.Links > 0 {
+		links = strconv.FormatUint(d.Links, 10)
+	}
+	if d.IsText {
+		lineCount = strconv.Itoa(d.Lines)
+	}
+
+	return keyValueLines([][2]string{
+		{"Path", d.Path},
+		{"Target", d.LinkTarget},
+		{"Mode", fmt.Sprintf("%04o  %s", unixPermBits(d.Mode), symbolicMode(d.Mode))},
+		{"Owner", d.Owner},
+		{"Group", d.Group},
+		{"Size", size},
+		{"Blocks", blocks},
+		{"Inode", inode},
+		{"Links", links},
+		{"Device", d.Device},
+		{"Dev type", d.RDevice},
+		{"Accessed", formatTimestamp(d.Accessed)},
+		{"Modified", formatTimestamp(d.Modified)},
+		{"Changed", formatTimestamp(d.Changed)},
+		{"Born", formatTimestamp(d.Born)},
+		{"Type", strings.TrimSpace(d.Kind + "  " + d.MIME)},
+		{"Lines", lineCount},
+	})
+}
@@ -0,0 +1,30 @@
+//go:build darwin || freebsd
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// platformDetails fills in the Unix-specific fields from lstat; these systems always record birth times
+func platformDetails(path string, d *fileDetails) {
+	var st unix.Stat_t
+	if err := unix.Lstat(path, &st); err != nil {
+		return
+	}
+
+	d.Owner, d.Group = lookupOwner(st.Uid, st.Gid)
+	d.Inode = uint64(st.Ino)
+	d.Links = uint64(st.Nlink)
+	d.Blocks = st.Blocks
+	d.Device = fmt.Sprintf("%d:%d", unix.Major(uint64(st.Dev)), unix.Minor(uint64(st.Dev)))
+	if st.Rdev != 0 {
+		d.RDevice = fmt.Sprintf("%d:%d", unix.Major(uint64(st.Rdev)), unix.Minor(uint64(st.Rdev)))
+	}
+	d.Accessed = time.Unix(st.Atim.Unix())
+	d.Changed = time.Unix(st.Ctim.Unix())
+	d.Born = time.Unix(st.Btim.Unix())
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// platformDetails fills in the Unix-specific fields using statx, which also reports
+// the birth time on filesystems that record it. Older kernels fall back to lstat.
+func platformDetails(path string, d *fileDetails) {
+	var stx unix.Statx_t
+	mask := unix.STATX_BASIC_STATS | unix.STATX_BTIME
+	if err := unix.Statx(unix.AT_FDCWD, path, unix.AT_SYMLINK_NOFOLLOW, mask, &stx); err != nil {
+		lstatDetails(path, d)
+		return
+	}
+
+	d.Owner, d.Group = lookupOwner(stx.Uid, stx.Gid)
+	d.Inode = stx.Ino
+	d.Links = uint64(stx.Nlink)
+	d.Blocks = int64(stx.Blocks)
+	d.Device = fmt.Sprintf("%d:%d", stx.Dev_major, stx.Dev_minor)
+	if stx.Rdev_major != 0 || stx.Rdev_minor != 0 {
+		d.RDevice = fmt.Sprintf("%d:%d", stx.Rdev_major, stx.Rdev_minor)
+	}
+
+	d.Accessed = statxTime(stx.Atime)
+	d.Changed = statxTime(stx.Ctime)
+	d.Modified = statxTime(stx.Mtime)
+	// The kernel clears the BTIME bit when the filesystem doesn't keep creation times
+	if stx.Mask&unix.STATX_BTIME != 0 {
+		d.Born = statxTime(stx.Btime)
+	}
+}
+
+// statxTime converts a statx timestamp into a time.Time
+func statxTime(ts unix.StatxTimestamp) time.Time {
+	return time.Unix(ts.Sec, int64(ts.Nsec))
+}
+
+// lstatDetails is the pre-statx fallback; it has no birth time
+func lstatDetails(path string, d *fileDetails) {
+	var st unix.Stat_t
+	if err := unix.Lstat(path, &st); err != nil {
+		return
+	}
+
+	d.Owner, d.Group = lookupOwner(st.Uid, st.Gid)
+	d.Inode = st.Ino
+	d.Links = uint64(st.Nlink)
+	d.Blocks = st.Blocks
+	d.Device = fmt.Sprintf("%d:%d", unix.Major(st.Dev), unix.Minor(st.Dev))
+	if st.Rdev != 0 {
+		d.RDevice = fmt.Sprintf("%d:%d", unix.Major(st.Rdev), unix.Minor(st.Rdev))
+	}
+	d.Accessed = time.Unix(st.Atim.Unix())
+	d.Changed = time.Unix(st.Ctim.Unix())
+}
@@ -0,0 +1,6 @@
+//go:build !linux && !darwin && !freebsd
+
+package main
+
+// platformDetails has nothing to add beyond what os.Lstat provides on this platform
+func platformDetails(path string, d *fileDetails) {}
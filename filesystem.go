@@ -1,11 +1,9 @@
 package main
 
 import (
-	"log"
+	"io/fs"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"runtime"
 	"time"
 
 	"github.com/charmbracelet/lipgloss"
@@ -13,44 +11,119 @@ import (
 
 // FileSystemObject holds metadata for a file or directory
 type FileSystemObject struct {
-	Name    string    // Entry name
-	Path    string    // Absolute path
-	IsDir   bool      // True if directory
-	Size    int64     // Size in bytes (files only)
-	ModTime time.Time // Last modified time
+	Name       string      // Entry name
+	Path       string      // Absolute path
+	IsDir      bool        // True if directory, or a symlink pointing to one
+	Size       int64       // Size in bytes (files only)
+	ModTime    time.Time   // Last modified time
+	Mode       fs.FileMode // Type and permission bits of the entry itself (not following symlinks)
+	Owner      string      // Owner and group as "user:group" (Unix only)
+	LinkTarget string      // Target as written in the link (symlinks only)
+	BrokenLink bool        // True if this is a symlink whose target doesn't exist
+	Loaded     bool        // False until stat has filled in Size, ModTime, permission bits and link details
 }
 
-// listObjects reads a directory and returns its entries as FileSystemObjects
-func listObjects(path string) []FileSystemObject {
-	entries, err := os.ReadDir(path)
+// listObjects reads a directory and returns its entries as fully loaded FileSystemObjects, sorted by name.
+// It stats every entry, so the UI only calls it for refreshes; dirLoader streams the initial listing.
+func listObjects(path string) ([]FileSystemObject, error) {
+	dir, err := filepath.Abs(path)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
 	}
 
-	var objects []FileSystemObject
-
+	objects := make([]FileSystemObject, 0, len(entries))
 	for _, entry := range entries {
-		info, err := entry.Info()
-		if err != nil {
-			log.Fatal("Cannot get entry info", err)
-		}
+		obj := newObject(dir, entry)
+		obj.load()
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
 
-		entryPath := filepath.Join(path, entry.Name())
-		absPath, err := filepath.Abs(entryPath)
-		if err != nil {
-			log.Fatal("Cannot get abs path", err)
-		}
+// newObject builds an object from a directory entry without touching the disk again.
+// Only the name and the type bits are known; load fills in the rest.
+func newObject(dir string, entry fs.DirEntry) FileSystemObject {
+	return FileSystemObject{
+		Name:  entry.Name(),
+		Path:  filepath.Join(dir, entry.Name()),
+		IsDir: entry.IsDir(),
+		Mode:  entry.Type(),
+	}
+}
+
+// load stats the object and fills in its size, time, permissions, owner and link details.
+// An entry that vanished in the meantime keeps what newObject knew about it.
+func (f *FileSystemObject) load() {
+	f.Loaded = true
+
+	info, err := os.Lstat(f.Path)
+	if err != nil {
+		return
+	}
+	f.IsDir = info.IsDir()
+	f.Size = info.Size()
+	f.ModTime = info.ModTime()
+	f.Mode = info.Mode()
+	f.Owner = fileOwner(info)
+	if f.IsSymlink() {
+		resolveLink(f)
+	}
+}
+
+// resolveLink fills in the symlink fields of an object: where it points,
+// whether that target exists, and whether it is a directory we can enter.
+func resolveLink(obj *FileSystemObject) {
+	target, err := os.Readlink(obj.Path)
+	if err == nil {
+		obj.LinkTarget = target
+	}
 
-		objects = append(objects, FileSystemObject{
-			Name:    entry.Name(),
-			IsDir:   entry.IsDir(),
-			Path:    absPath,
-			Size:    info.Size(),
-			ModTime: info.ModTime(),
-		})
+	// Stat follows the whole chain of links; failure means the link is dangling (or looping)
+	targetInfo, err := os.Stat(obj.Path)
+	if err != nil {
+		obj.BrokenLink = true
+		return
 	}
+	obj.IsDir = targetInfo.IsDir()
+}
+
+// IsSymlink reports whether the entry itself is a symbolic link
+func (f FileSystemObject) IsSymlink() bool {
+	return f.Mode&fs.ModeSymlink != 0
+}
 
-	return objects
+// IsExecutable reports whether the entry is a regular file with any execute bit set
+func (f FileSystemObject) IsExecutable() bool {
+	return f.Mode.IsRegular() && f.Mode.Perm()&0o111 != 0
+}
+
+// Marker returns the one-letter type label shown in front of the name on a tile:
+// D directory, F file, X executable, L symlink, P named pipe, S socket,
+// B block device, C character device, ? anything else
+func (f FileSystemObject) Marker() string {
+	switch {
+	case f.IsSymlink():
+		return "L"
+	case f.Mode.IsDir():
+		return "D"
+	case f.Mode&fs.ModeNamedPipe != 0:
+		return "P"
+	case f.Mode&fs.ModeSocket != 0:
+		return "S"
+	case f.Mode&fs.ModeDevice != 0 && f.Mode&fs.ModeCharDevice != 0:
+		return "C"
+	case f.Mode&fs.ModeDevice != 0:
+		return "B"
+	case f.IsExecutable():
+		return "X"
+	case f.Mode.IsRegular():
+		return "F"
+	}
+	return "?"
 }
 
 // ShortName trims long filenames to fit within a tile width
@@ -81,19 +154,3 @@ func (f FileSystemObject) ShortName(maxWidth int) string {
 
 	return f.Name[:i] + dots
 }
-
-// OpenFile opens a file using the OS default app
-func OpenFile(path string) error {
-	var cmd *exec.Cmd
-
-	switch runtime.GOOS {
-	case "darwin":
-		cmd = exec.Command("open", path)
-	case "windows":
-		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", path)
-	default:
-		cmd = exec.Command("xdg-open", path)
-	}
-
-	return cmd.Start()
-}
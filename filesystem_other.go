@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "io/fs"
+
+// fileOwner has nothing to report where files have no Unix owner
+func fileOwner(info fs.FileInfo) string {
+	return ""
+}
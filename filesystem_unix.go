@@ -0,0 +1,34 @@
+//go:build unix
+
+package main
+
+import (
+	"io/fs"
+	"sync"
+	"syscall"
+)
+
+// ownerNames caches "user:group" by ids: looking names up reads the user and group databases,
+// and objects are loaded from several goroutines at once
+var ownerNames = struct {
+	sync.Mutex
+	names map[[2]uint32]string
+}{names: map[[2]uint32]string{}}
+
+// fileOwner names the owner and group of a file as "user:group"
+func fileOwner(info fs.FileInfo) string {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	ids := [2]uint32{st.Uid, st.Gid}
+
+	ownerNames.Lock()
+	defer ownerNames.Unlock()
+	if name, ok := ownerNames.names[ids]; ok {
+		return name
+	}
+	owner, group := lookupOwner(st.Uid, st.Gid)
+	ownerNames.names[ids] = owner + ":" + group
+	return ownerNames.names[ids]
+}
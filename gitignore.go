@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreRule is one line of a .gitignore file
+type ignoreRule struct {
+	base     string   // Directory of the .gitignore, relative to the work tree, with a trailing slash ("" at the top)
+	segments []string // Pattern split on slashes; "**" matches any number of directories
+	basename bool     // No slash in the pattern: it matches the name at any depth
+	negate   bool     // "!pattern" re-includes what an earlier rule excluded
+	dirOnly  bool     // "pattern/" only matches directories
+}
+
+// ignoreRules are applied in order; the last rule that matches decides
+type ignoreRules []ignoreRule
+
+// parseIgnoreFile reads the rules of a .gitignore (or info/exclude) file whose patterns are
+// relative to base. A missing file has no rules.
+func parseIgnoreFile(file, base string) ignoreRules {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var rules ignoreRules
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreLine(scanner.Text(), base); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// parseIgnoreLine turns one line into a rule; blank lines and comments give none
+func parseIgnoreLine(line, base string) (ignoreRule, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	// Trailing spaces are dropped unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || line[0] == '#' {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{base: base}
+	if line[0] == '!' {
+		rule.negate = true
+		line = line[1:]
+	} else if line[0] == '\\' && len(line) > 1 && (line[1] == '#' || line[1] == '!') {
+		line = line[1:] // Escaped leading # or !
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	// A slash anywhere but at the end anchors the pattern to the .gitignore's directory
+	rule.basename = !strings.Contains(line, "/")
+	rule.segments = strings.Split(strings.TrimPrefix(line, "/"), "/")
+	return rule, true
+}
+
+// globalIgnoreRules are the rules that apply to the whole work tree before any .gitignore:
+// core.excludesFile (by default ~/.config/git/ignore), then .git/info/exclude
+func (r *gitRepo) globalIgnoreRules() ignoreRules {
+	excludes := r.config["core.excludesfile"]
+	if excludes == "" {
+		user := readGitConfig(filepath.Join(getHomeDir(), ".gitconfig"))
+		excludes = user["core.excludesfile"]
+		if excludes == "" {
+			excludes = readGitConfig(filepath.Join(xdgConfigHome(), "git", "config"))["core.excludesfile"]
+		}
+	}
+	if excludes == "" {
+		excludes = filepath.Join(xdgConfigHome(), "git", "ignore")
+	} else if rest, ok := strings.CutPrefix(excludes, "~/"); ok {
+		excludes = filepath.Join(getHomeDir(), rest)
+	}
+
+	rules := parseIgnoreFile(excludes, "")
+	return append(rules, parseIgnoreFile(filepath.Join(r.commonDir, "info", "exclude"), "")...)
+}
+
+// with returns the rules extended by a directory's .gitignore, leaving the receiver untouched
+// so sibling directories don't see each other's rules
+func (rules ignoreRules) with(workTree, dir string) ignoreRules {
+	more := parseIgnoreFile(filepath.Join(workTree, filepath.FromSlash(dir), ".gitignore"), dir)
+	if len(more) == 0 {
+		return rules
+	}
+	return append(rules[:len(rules):len(rules)], more...)
+}
+
+// ignored reports whether a path relative to the work tree is excluded
+func (rules ignoreRules) ignored(rel string, isDir bool) bool {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].matches(rel, isDir) {
+			return !rules[i].negate
+		}
+	}
+	return false
+}
+
+// matches reports whether the rule's pattern applies to a path
+func (rule ignoreRule) matches(rel string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	local, ok := strings.CutPrefix(rel, rule.base)
+	if !ok {
+		return false
+	}
+	if rule.basename {
+		ok, _ := path.Match(rule.segments[0], path.Base(local))
+		return ok
+	}
+	return matchSegments(rule.segments, strings.Split(local, "/"))
+}
+
+// matchSegments matches a slash-split pattern against a slash-split path. "**" stands for any
+// number of directories, except at the end where it needs at least one entry ("dir/**" is the
+// content of dir, not dir itself).
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return len(parts) > 0
+			}
+			for skip := 0; skip <= len(parts); skip++ {
+				if matchSegments(pattern[1:], parts[skip:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
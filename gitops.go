@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Log overlay
+const (
+	GIT_LOG_MIN = 5 // Commits shown even on tiny terminals
+)
+
+// Diff coloring in the preview pane
+var (
+	styleDiffAdded   = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	styleDiffRemoved = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	styleDiffHunk    = lipgloss.NewStyle().Foreground(lipgloss.Color("6"))
+	styleDiffHeader  = lipgloss.NewStyle().Bold(true)
+)
+
+// gitLogMsg delivers the history of a path for the log overlay
+type gitLogMsg struct {
+	title string
+	lines []string
+	err   error
+}
+
+// runGitCommand runs git in a work tree and returns its output; failures carry git's own message.
+// Changes go through git rather than the repository reader, as git knows how to write the index safely.
+func runGitCommand(workTree string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", workTree, "-c", "color.ui=false", "-c", "core.quotepath=false"}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			// The first line says it all; the rest is usually hints
+			msg, _, _ = strings.Cut(msg, "\n")
+			return out, errors.New(strings.TrimPrefix(msg, "fatal: "))
+		}
+		return out, err
+	}
+	return out, nil
+}
+
+// gitTargets gives the targets' paths relative to the work tree, or sets the status and returns
+// nil when there is nothing to act on
+func (m *model) gitTargets() []string {
+	if m.git.repo == nil {
+		m.status = "not in a git repository"
+		return nil
+	}
+	var paths []string
+	for _, obj := range m.targets() {
+		if rel, err := filepath.Rel(m.git.repo.workTree, obj.Path); err == nil {
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+	}
+	if len(paths) == 0 {
+		m.status = "nothing selected"
+	}
+	return paths
+}
+
+// gitBatch runs one git command over paths in the background and reports it like any other operation
+func gitBatch(workTree, verb string, args, paths []string) tea.Cmd {
+	return func() tea.Msg {
+		result := opResultMsg{verb: verb}
+		if _, err := runGitCommand(workTree, append(append(args, "--"), paths...)...); err != nil {
+			result.failures = []pathError{{path: "git", err: err}}
+		} else {
+			result.done = len(paths)
+		}
+		return result
+	}
+}
+
+// gitStage stages the targets as they are in the work tree, deletions included
+func (m *model) gitStage() tea.Cmd {
+	paths := m.gitTargets()
+	if paths == nil {
+		return nil
+	}
+	return gitBatch(m.git.repo.workTree, "stage", []string{"add", "--all"}, paths)
+}
+
+// gitUnstage puts the targets in the index back the way HEAD has them, leaving the work tree alone
+func (m *model) gitUnstage() tea.Cmd {
+	paths := m.gitTargets()
+	if paths == nil {
+		return nil
+	}
+	// Before the first commit there is no HEAD to restore from: unstaging means untracking
+	if m.git.status != nil && m.git.status.unborn {
+		return gitBatch(m.git.repo.workTree, "unstage", []string{"rm", "--cached", "-r", "--quiet"}, paths)
+	}
+	return gitBatch(m.git.repo.workTree, "unstage", []string{"restore", "--staged"}, paths)
+}
+
+// gitDiscard throws away the unstaged changes of the targets after asking: tracked files get their
+// staged (or committed) content back, untracked files are deleted. Staged changes are kept.
+func (m *model) gitDiscard() {
+	paths := m.gitTargets()
+	if paths == nil || m.git.status == nil {
+		return
+	}
+
+	// Sort the targets by what discarding does to them
+	var restore, remove []string
+	for _, path := range paths {
+		abs := filepath.Join(m.git.repo.workTree, filepath.FromSlash(path))
+		info, _ := os.Lstat(abs)
+		code := m.git.status.lookup(m.git.repo.workTree, abs, info != nil && info.IsDir())
+		switch {
+		case code == "??":
+			remove = append(remove, path)
+		case code == "•" || len(code) == 2 && code[1] != ' ' && code != "!!":
+			restore = append(restore, path)
+		}
+	}
+	if len(restore)+len(remove) == 0 {
+		m.status = "no unstaged changes to discard"
+		return
+	}
+
+	var what []string
+	if len(restore) > 0 {
+		what = append(what, fmt.Sprintf("revert %d changed", len(restore)))
+	}
+	if len(remove) > 0 {
+		what = append(what, fmt.Sprintf("delete %d untracked", len(remove)))
+	}
+	workTree := m.git.repo.workTree
+	title := "Discard changes: " + strings.Join(what, ", ") + "? This can't be undone"
+	m.openMenu(title, []string{"Keep them", "Discard"}, func(m *model, idx int) tea.Cmd {
+		if idx != 1 {
+			return nil
+		}
+		return func() tea.Msg {
+			result := opResultMsg{verb: "discard"}
+			if len(restore) > 0 {
+				if _, err := runGitCommand(workTree, append([]string{"restore", "--worktree", "--"}, restore...)...); err != nil {
+					result.failures = append(result.failures, pathError{path: "git", err: err})
+				} else {
+					result.done += len(restore)
+				}
+			}
+			for _, path := range remove {
+				if err := os.RemoveAll(filepath.Join(workTree, filepath.FromSlash(path))); err != nil {
+					result.failures = append(result.failures, pathError{path: path, err: err})
+				} else {
+					result.done++
+				}
+			}
+			return result
+		}
+	})
+}
+
+// toggleDiffPreview switches the preview pane between content and git diffs, opening it if needed
+func (m *model) toggleDiffPreview() {
+	if m.git.repo == nil {
+		m.status = "not in a git repository"
+		return
+	}
+	m.previewDiff = !m.previewDiff
+	if !m.previewShown() {
+		m.togglePreview()
+	}
+	m.preview, m.previewPath = nil, ""
+}
+
+// buildDiffPreview shows how an object differs from HEAD: unstaged changes first, then staged
+// ones. Untracked files are shown whole, directories as a summary of changed files.
+// With a commit given, it shows what changed in the work tree since that commit instead.
+func buildDiffPreview(workTree, commit string, obj FileSystemObject) preview {
+	p := preview{path: obj.Path, modTime: obj.ModTime, title: obj.Name}
+	rel, err := filepath.Rel(workTree, obj.Path)
+	if err != nil {
+		p.summary = err.Error()
+		return p
+	}
+
+	if commit != "" {
+		args := []string{"diff", "--no-ext-diff", commit, "--", rel}
+		if obj.IsDir {
+			args = []string{"diff", commit, "--stat=1000", "--", rel}
+		}
+		out, err := runGitCommand(workTree, args...)
+		p.summary, p.lines = "work tree against "+commit[:7], diffLines(out)
+		if err != nil {
+			p.summary = err.Error()
+		} else if len(p.lines) == 0 {
+			p.summary = "same in the work tree"
+		}
+		return p
+	}
+
+	if obj.IsDir {
+		out, err := runGitCommand(workTree, "diff", "HEAD", "--stat=1000", "--", rel)
+		p.summary, p.lines = "changes against HEAD", diffLines(out)
+		if err != nil {
+			p.summary = err.Error()
+		} else if len(p.lines) == 0 {
+			p.summary = "no changes"
+		}
+		return p
+	}
+
+	unstaged, err := runGitCommand(workTree, "diff", "--no-ext-diff", "--", rel)
+	if err != nil {
+		p.summary = err.Error()
+		return p
+	}
+	staged, _ := runGitCommand(workTree, "diff", "--no-ext-diff", "--cached", "--", rel)
+
+	// Untracked files aren't in either diff: compare with nothing instead
+	if len(unstaged) == 0 && len(staged) == 0 {
+		if out, _ := runGitCommand(workTree, "ls-files", "--others", "--exclude-standard", "--", rel); len(out) > 0 {
+			// --no-index exits 1 when the files differ, which they always do here
+			untracked, _ := runGitCommand(workTree, "diff", "--no-ext-diff", "--no-index", "--", os.DevNull, rel)
+			p.summary, p.lines = "untracked", diffLines(untracked)
+			return p
+		}
+		p.summary = "no changes"
+		return p
+	}
+
+	switch {
+	case len(unstaged) > 0 && len(staged) > 0:
+		p.summary = "unstaged and staged changes"
+		p.lines = append([]string{styleDiffHeader.Render("Unstaged")}, diffLines(unstaged)...)
+		p.lines = append(append(p.lines, "", styleDiffHeader.Render("Staged")), diffLines(staged)...)
+	case len(unstaged) > 0:
+		p.summary, p.lines = "unstaged changes", diffLines(unstaged)
+	default:
+		p.summary, p.lines = "staged changes", diffLines(staged)
+	}
+	return p
+}
+
+// diffLines colors a diff for the preview pane, dropping the header lines the pane already shows
+func diffLines(diff []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(string(diff), "\n"), "\n") {
+		if len(lines) >= PREVIEW_MAX_LINES {
+			break
+		}
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "diff --git"), strings.HasPrefix(line, "index "),
+			strings.HasPrefix(line, "--- "), strings.HasPrefix(line, "+++ "):
+			continue
+		case strings.HasPrefix(line, "@@"):
+			lines = append(lines, styleDiffHunk.Render(cleanLine(line)))
+		case line[0] == '+':
+			lines = append(lines, styleDiffAdded.Render(cleanLine(line)))
+		case line[0] == '-':
+			lines = append(lines, styleDiffRemoved.Render(cleanLine(line)))
+		default:
+			lines = append(lines, cleanLine(line))
+		}
+	}
+	return lines
+}
+
+// gitLog reads the recent history of the object under the cursor, following renames, in the background
+func (m *model) gitLog() tea.Cmd {
+	if m.git.repo == nil {
+		m.status = "not in a git repository"
+		return nil
+	}
+	idx := m.selectedIndex()
+	if idx < 0 || idx >= len(m.objects) {
+		return nil
+	}
+	obj := m.objects[idx]
+	rel, err := filepath.Rel(m.git.repo.workTree, obj.Path)
+	if err != nil {
+		m.status = err.Error()
+		return nil
+	}
+
+	// As many commits as the overlay can show without flowing into columns
+	limit := max(m.height-2*BORDER_SIZE-TOP_BAR_HEIGHT-BOTTOM_BAR_HEIGHT-6, GIT_LOG_MIN)
+	width := max(m.width-2*BORDER_SIZE-8, 20)
+	args := []string{"log", fmt.Sprintf("-n%d", limit), "--date=short", "--format=%h  %ad  %an  %s"}
+	if !obj.IsDir {
+		args = append(args, "--follow")
+	}
+	if m.tree != nil {
+		args = append(args, m.tree.commit.String()) // History up to the commit shown
+	}
+	workTree := m.git.repo.workTree
+	return func() tea.Msg {
+		out, err := runGitCommand(workTree, append(args, "--", rel)...)
+		msg := gitLogMsg{title: "History of " + obj.Name, err: err}
+		for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+			if line != "" {
+				msg.lines = append(msg.lines, truncateCenter(cleanLine(line), width))
+			}
+		}
+		if err == nil && len(msg.lines) == 0 {
+			msg.lines = []string{"No commits yet"}
+		}
+		return msg
+	}
+}
+
+// showGitLog opens the log overlay
+func (m *model) showGitLog(msg gitLogMsg) {
+	if msg.err != nil {
+		m.status = "git: " + msg.err.Error()
+		return
+	}
+	m.openOverlay(msg.title, msg.lines)
+}
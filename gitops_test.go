@@ -0,0 +1,236 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// gitTestRepo creates a repository in a temporary directory, skipping the test without git
+func gitTestRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := tempDir(t)
+	git(t, dir, "init", "-q", "-b", "main")
+	git(t, dir, "config", "user.name", "Test")
+	git(t, dir, "config", "user.email", "test@example.com")
+	git(t, dir, "config", "commit.gpgsign", "false")
+	return dir
+}
+
+// git runs a git command in dir and returns its output, failing the test when it fails
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := runGitCommand(dir, args...)
+	if err != nil {
+		t.Fatalf("git %s: %v", strings.Join(args, " "), err)
+	}
+	return string(out)
+}
+
+// gitTestModel shows the root of the repository, with its status read as the top bar has it
+func gitTestModel(t *testing.T, dir string) model {
+	t.Helper()
+	m := newTestModel(t, dir)
+	m.git.repo = findRepo(dir)
+	if m.git.repo == nil {
+		t.Fatal("repository not found")
+	}
+	status, err := readGitStatus(m.git.repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.git.status = status
+	return m
+}
+
+// runOp runs an operation's command and fails the test on any failure it reports
+func runOp(t *testing.T, cmd tea.Cmd) opResultMsg {
+	t.Helper()
+	if cmd == nil {
+		t.Fatal("no command to run")
+	}
+	result, ok := cmd().(opResultMsg)
+	if !ok {
+		t.Fatal("the command didn't report an operation result")
+	}
+	for _, f := range result.failures {
+		t.Errorf("%s: %v", f.path, f.err)
+	}
+	return result
+}
+
+// porcelain returns git's short status
+func porcelain(t *testing.T, dir string) string {
+	return git(t, dir, "status", "--porcelain", "--untracked-files=all")
+}
+
+func TestGitStageIncludesDeletions(t *testing.T) {
+	dir := gitTestRepo(t)
+	writeFile(t, dir, "sub/kept", "kept\n", time.Time{})
+	writeFile(t, dir, "sub/gone", "gone\n", time.Time{})
+	git(t, dir, "add", ".")
+	git(t, dir, "commit", "-q", "-m", "initial")
+
+	os.Remove(filepath.Join(dir, "sub", "gone"))
+	writeFile(t, dir, "sub/kept", "changed\n", time.Time{})
+	writeFile(t, dir, "sub/new", "new\n", time.Time{})
+
+	m := gitTestModel(t, dir)
+	markPaths(&m, filepath.Join(dir, "sub"))
+	runOp(t, m.gitStage())
+
+	want := "D  sub/gone\nM  sub/kept\nA  sub/new\n"
+	if got := porcelain(t, dir); got != want {
+		t.Errorf("status after staging:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGitUnstage(t *testing.T) {
+	dir := gitTestRepo(t)
+	writeFile(t, dir, "a", "one\n", time.Time{})
+	git(t, dir, "add", "a")
+	git(t, dir, "commit", "-q", "-m", "initial")
+	writeFile(t, dir, "a", "two\n", time.Time{})
+	git(t, dir, "add", "a")
+
+	m := gitTestModel(t, dir)
+	markPaths(&m, filepath.Join(dir, "a"))
+	runOp(t, m.gitUnstage())
+
+	if got := porcelain(t, dir); got != " M a\n" {
+		t.Errorf("status after unstaging: %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "a")); got != "two\n" {
+		t.Errorf("the work tree changed: %q", got)
+	}
+}
+
+func TestGitUnstageUnbornHead(t *testing.T) {
+	dir := gitTestRepo(t)
+	writeFile(t, dir, "a", "one\n", time.Time{})
+	writeFile(t, dir, "b", "two\n", time.Time{})
+	git(t, dir, "add", "a", "b")
+
+	m := gitTestModel(t, dir)
+	if !m.git.status.unborn {
+		t.Fatal("HEAD should be unborn before the first commit")
+	}
+	markPaths(&m, filepath.Join(dir, "a"))
+	runOp(t, m.gitUnstage())
+
+	if got := porcelain(t, dir); got != "A  b\n?? a\n" {
+		t.Errorf("status after unstaging: %q", got)
+	}
+}
+
+func TestGitDiscard(t *testing.T) {
+	dir := gitTestRepo(t)
+	writeFile(t, dir, "tracked", "committed\n", time.Time{})
+	writeFile(t, dir, "staged", "committed\n", time.Time{})
+	git(t, dir, "add", ".")
+	git(t, dir, "commit", "-q", "-m", "initial")
+	writeFile(t, dir, "tracked", "changed\n", time.Time{})
+	writeFile(t, dir, "staged", "staged\n", time.Time{})
+	git(t, dir, "add", "staged")
+	writeFile(t, dir, "untracked", "scratch\n", time.Time{})
+
+	m := gitTestModel(t, dir)
+	markPaths(&m, filepath.Join(dir, "tracked"), filepath.Join(dir, "staged"), filepath.Join(dir, "untracked"))
+	m.gitDiscard()
+	if m.menu == nil {
+		t.Fatal("discarding should ask first")
+	}
+	result := runOp(t, m.menu.onSelect(&m, 1))
+
+	if result.done != 2 {
+		t.Errorf("%d discarded, want 2 (the staged file has no unstaged changes)", result.done)
+	}
+	if got := readFile(t, filepath.Join(dir, "tracked")); got != "committed\n" {
+		t.Errorf("tracked file not restored: %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "staged")); got != "staged\n" {
+		t.Errorf("staged change lost: %q", got)
+	}
+	assertMissing(t, filepath.Join(dir, "untracked"))
+}
+
+func TestGitDiscardKeepIsHarmless(t *testing.T) {
+	dir := gitTestRepo(t)
+	writeFile(t, dir, "untracked", "scratch\n", time.Time{})
+	git(t, dir, "commit", "-q", "--allow-empty", "-m", "initial")
+
+	m := gitTestModel(t, dir)
+	markPaths(&m, filepath.Join(dir, "untracked"))
+	m.gitDiscard()
+	if cmd := m.menu.onSelect(&m, 0); cmd != nil {
+		t.Error("keeping the changes shouldn't run anything")
+	}
+	readFile(t, filepath.Join(dir, "untracked"))
+}
+
+func TestBuildDiffPreview(t *testing.T) {
+	dir := gitTestRepo(t)
+	writeFile(t, dir, "unstaged", "old\n", time.Time{})
+	writeFile(t, dir, "staged", "old\n", time.Time{})
+	git(t, dir, "add", ".")
+	git(t, dir, "commit", "-q", "-m", "initial")
+	writeFile(t, dir, "unstaged", "new unstaged\n", time.Time{})
+	writeFile(t, dir, "staged", "new staged\n", time.Time{})
+	git(t, dir, "add", "staged")
+	writeFile(t, dir, "untracked", "brand new\n", time.Time{})
+
+	for _, tc := range []struct {
+		name, summary, added string
+	}{
+		{"unstaged", "unstaged changes", "+new unstaged"},
+		{"staged", "staged changes", "+new staged"},
+		{"untracked", "untracked", "+brand new"},
+	} {
+		obj := FileSystemObject{Path: filepath.Join(dir, tc.name), Name: tc.name}
+		obj.load()
+		p := buildDiffPreview(dir, "", obj)
+		if p.summary != tc.summary {
+			t.Errorf("%s: summary %q, want %q", tc.name, p.summary, tc.summary)
+		}
+		if !containsLine(p.lines, tc.added) {
+			t.Errorf("%s: no %q line in %q", tc.name, tc.added, p.lines)
+		}
+	}
+}
+
+func TestGitLogFollowsRenames(t *testing.T) {
+	dir := gitTestRepo(t)
+	writeFile(t, dir, "before.txt", strings.Repeat("the same content\n", 20), time.Time{})
+	git(t, dir, "add", ".")
+	git(t, dir, "commit", "-q", "-m", "add before")
+	git(t, dir, "mv", "before.txt", "after.txt")
+	git(t, dir, "commit", "-q", "-m", "rename to after")
+
+	m := gitTestModel(t, dir)
+	m.focusName("after.txt")
+	msg, ok := m.gitLog()().(gitLogMsg)
+	if !ok || msg.err != nil {
+		t.Fatalf("no log: %v", msg.err)
+	}
+	if len(msg.lines) != 2 || !strings.Contains(msg.lines[0], "rename to after") || !strings.Contains(msg.lines[1], "add before") {
+		t.Errorf("log doesn't follow the rename: %q", msg.lines)
+	}
+}
+
+// containsLine reports whether one of the lines contains s
+func containsLine(lines []string, s string) bool {
+	for _, line := range lines {
+		if strings.Contains(line, s) {
+			return true
+		}
+	}
+	return false
+}
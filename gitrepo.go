@@ -0,0 +1,1078 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Git object store
+const (
+	GIT_HASH_SIZE       = 20   // SHA-1; SHA-256 repositories aren't supported
+	GIT_DELTA_CACHE     = 256  // Pack objects kept around as delta bases
+	GIT_MAX_DELTA_DEPTH = 5000 // Longer delta chains mean a corrupt pack
+)
+
+// gitHash is a SHA-1 object name
+type gitHash [GIT_HASH_SIZE]byte
+
+// String is the usual hexadecimal form
+func (h gitHash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// parseGitHash reads a hexadecimal object name
+func parseGitHash(s string) (gitHash, error) {
+	var h gitHash
+	if len(s) != 2*GIT_HASH_SIZE {
+		return h, fmt.Errorf("bad object name %q", s)
+	}
+	_, err := hex.Decode(h[:], []byte(s))
+	return h, err
+}
+
+// gitRepo reads a repository directly from its .git directory: refs, config and objects,
+// loose or packed. It is safe for concurrent use.
+type gitRepo struct {
+	workTree  string // Top of the work tree
+	gitDir    string // Per-worktree files: HEAD, index
+	commonDir string // Shared files: objects, refs, config (the same as gitDir outside linked worktrees)
+
+	mu         sync.Mutex
+	objectDirs []string                    // objects directory followed by its alternates
+	packs      []*gitPack                  // Loaded lazily by loadPacks
+	packsSeen  string                      // Pack directory fingerprint the packs were loaded for
+	deltaCache map[gitPackOffset]gitObject // Recently inflated pack objects
+	config     map[string]string           // Parsed config, see readGitConfig
+}
+
+// gitObject is an inflated object
+type gitObject struct {
+	kind string // commit, tree, blob or tag
+	data []byte
+}
+
+// findRepo looks for the work tree containing path. It returns nil outside any repository,
+// and inside a .git directory, which has no work tree to speak of.
+func findRepo(path string) *gitRepo {
+	for _, segment := range strings.Split(filepath.ToSlash(path), "/") {
+		if segment == ".git" {
+			return nil
+		}
+	}
+
+	for dir := path; ; dir = filepath.Dir(dir) {
+		dotGit := filepath.Join(dir, ".git")
+		if info, err := os.Stat(dotGit); err == nil {
+			if repo, err := openRepo(dir, dotGit, info.IsDir()); err == nil {
+				return repo
+			}
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return nil
+		}
+	}
+}
+
+// openRepo opens the repository of a work tree. Linked worktrees and submodules have a .git file
+// pointing at the real git directory, which may itself point at a common directory.
+func openRepo(workTree, dotGit string, isDir bool) (*gitRepo, error) {
+	gitDir := dotGit
+	if !isDir {
+		data, err := os.ReadFile(dotGit)
+		if err != nil {
+			return nil, err
+		}
+		target, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+		if !ok {
+			return nil, fmt.Errorf("%s: not a gitdir file", dotGit)
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(workTree, target)
+		}
+		gitDir = filepath.Clean(target)
+	}
+	if _, err := os.Stat(filepath.Join(gitDir, "HEAD")); err != nil {
+		return nil, err
+	}
+
+	commonDir := gitDir
+	if data, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir = strings.TrimSpace(string(data))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+		commonDir = filepath.Clean(commonDir)
+	}
+
+	repo := &gitRepo{
+		workTree:   workTree,
+		gitDir:     gitDir,
+		commonDir:  commonDir,
+		deltaCache: make(map[gitPackOffset]gitObject),
+	}
+	repo.config = readGitConfig(filepath.Join(commonDir, "config"))
+	if format := repo.config["extensions.objectformat"]; format != "" && format != "sha1" {
+		return nil, fmt.Errorf("%s: %s repositories are not supported", workTree, format)
+	}
+	if repo.config["core.bare"] == "true" {
+		return nil, fmt.Errorf("%s: bare repository", workTree)
+	}
+	repo.objectDirs = objectDirs(filepath.Join(commonDir, "objects"))
+	return repo, nil
+}
+
+// objectDirs lists an objects directory and, recursively, the alternates it borrows from
+func objectDirs(dir string) []string {
+	dirs := []string{dir}
+	data, err := os.ReadFile(filepath.Join(dir, "info", "alternates"))
+	if err != nil {
+		return dirs
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(dir, line)
+		}
+		if len(dirs) < 10 { // Guard against alternates that loop
+			dirs = append(dirs, objectDirs(filepath.Clean(line))...)
+		}
+	}
+	return dirs
+}
+
+// readGitConfig parses a git config file into "section.subsection.key" keys. Section and key
+// names are lowercased like git does; subsections keep their case. Later values win, and
+// included files are ignored.
+func readGitConfig(path string) map[string]string {
+	values := make(map[string]string)
+	f, err := os.Open(path)
+	if err != nil {
+		return values
+	}
+	defer f.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		// [section], [section "subsection"] or the old [section.subsection]
+		if line[0] == '[' {
+			end := strings.LastIndexByte(line, ']')
+			if end < 0 {
+				continue
+			}
+			header := line[1:end]
+			if name, sub, ok := strings.Cut(header, " "); ok {
+				sub = strings.Trim(strings.TrimSpace(sub), `"`)
+				sub = strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(sub)
+				section = strings.ToLower(name) + "." + sub
+			} else if name, sub, ok := strings.Cut(header, "."); ok {
+				section = strings.ToLower(name) + "." + strings.ToLower(sub)
+			} else {
+				section = strings.ToLower(header)
+			}
+			// A key can follow the header on the same line
+			line = strings.TrimSpace(line[end+1:])
+			if line == "" {
+				continue
+			}
+		}
+
+		key, value, hasValue := strings.Cut(line, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !hasValue {
+			values[section+"."+key] = "true" // A bare key is a true boolean
+			continue
+		}
+		values[section+"."+key] = parseConfigValue(value)
+	}
+	return values
+}
+
+// parseConfigValue strips comments and quotes from a config value and resolves its escapes
+func parseConfigValue(raw string) string {
+	var b strings.Builder
+	quoted := false
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '\\' && i+1 < len(raw):
+			i++
+			switch raw[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(raw[i])
+			}
+		case (c == '#' || c == ';') && !quoted:
+			return strings.TrimSpace(b.String())
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// readRef resolves a ref name ("HEAD", "refs/heads/main") to an object, following symbolic refs.
+// It also returns the name of the last ref in the chain, so HEAD resolves to its branch.
+func (r *gitRepo) readRef(name string) (gitHash, string, error) {
+	for depth := 0; depth < 10; depth++ {
+		value, err := r.refValue(name)
+		if err != nil {
+			return gitHash{}, name, err
+		}
+		if target, ok := strings.CutPrefix(value, "ref: "); ok {
+			name = target
+			continue
+		}
+		h, err := parseGitHash(value)
+		return h, name, err
+	}
+	return gitHash{}, name, fmt.Errorf("%s: symbolic ref loop", name)
+}
+
+// refValue reads one ref, loose or packed, without following it
+func (r *gitRepo) refValue(name string) (string, error) {
+	// HEAD and other pseudo refs belong to the worktree; refs/ are shared
+	dir := r.commonDir
+	if !strings.HasPrefix(name, "refs/") {
+		dir = r.gitDir
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name))); err == nil {
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	f, err := os.Open(filepath.Join(r.commonDir, "packed-refs"))
+	if err != nil {
+		return "", fmt.Errorf("%s: no such ref", name)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if hash, ref, ok := strings.Cut(line, " "); ok && ref == name {
+			return hash, nil
+		}
+	}
+	return "", fmt.Errorf("%s: no such ref", name)
+}
+
+// upstream returns the remote-tracking ref a branch follows ("refs/remotes/origin/main"), if any
+func (r *gitRepo) upstream(branch string) string {
+	name := strings.TrimPrefix(branch, "refs/heads/")
+	remote := r.config["branch."+name+".remote"]
+	merge := r.config["branch."+name+".merge"]
+	if remote == "" || merge == "" {
+		return ""
+	}
+	if remote == "." {
+		return merge // Tracks a local branch
+	}
+	return "refs/remotes/" + remote + "/" + strings.TrimPrefix(merge, "refs/heads/")
+}
+
+// readObject returns an object from the loose store or from a pack
+func (r *gitRepo) readObject(h gitHash) (gitObject, error) {
+	name := h.String()
+	for _, dir := range r.objectDirs {
+		f, err := os.Open(filepath.Join(dir, name[:2], name[2:]))
+		if err != nil {
+			continue
+		}
+		obj, err := readLooseObject(f)
+		f.Close()
+		if err != nil {
+			return obj, fmt.Errorf("object %s: %w", name, err)
+		}
+		return obj, nil
+	}
+
+	for _, pack := range r.loadPacks() {
+		if offset, ok := pack.find(h); ok {
+			return r.readPacked(pack, offset, 0)
+		}
+	}
+	return gitObject{}, fmt.Errorf("object %s not found", name)
+}
+
+// readLooseObject inflates a loose object: a "kind size\0" header, then the content
+func readLooseObject(f io.Reader) (gitObject, error) {
+	z, err := zlib.NewReader(f)
+	if err != nil {
+		return gitObject{}, err
+	}
+	defer z.Close()
+	data, err := io.ReadAll(z)
+	if err != nil {
+		return gitObject{}, err
+	}
+
+	header, content, ok := bytes.Cut(data, []byte{0})
+	kind, size, ok2 := strings.Cut(string(header), " ")
+	if !ok || !ok2 || size != strconv.Itoa(len(content)) {
+		return gitObject{}, errors.New("corrupt loose object")
+	}
+	return gitObject{kind: kind, data: content}, nil
+}
+
+// gitPack is one packfile and its index (version 2)
+type gitPack struct {
+	file    *os.File
+	fanout  [256]uint32 // Number of objects whose first byte is at most i
+	names   []byte      // Sorted object names
+	offsets []byte      // 32-bit offsets, or indexes into large when the high bit is set
+	large   []byte      // 64-bit offsets
+}
+
+// gitPackOffset identifies an object inside a pack
+type gitPackOffset struct {
+	pack   *gitPack
+	offset int64
+}
+
+// loadPacks opens the repository's packs, again whenever the set of packs changes (after a gc or fetch)
+func (r *gitRepo) loadPacks() []*gitPack {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var idxFiles []string
+	for _, dir := range r.objectDirs {
+		found, _ := filepath.Glob(filepath.Join(dir, "pack", "*.idx"))
+		idxFiles = append(idxFiles, found...)
+	}
+	sort.Strings(idxFiles)
+	seen := strings.Join(idxFiles, "\n")
+	if seen == r.packsSeen {
+		return r.packs
+	}
+
+	for _, pack := range r.packs {
+		pack.file.Close()
+	}
+	r.packs, r.packsSeen = nil, seen
+	clear(r.deltaCache)
+	for _, idx := range idxFiles {
+		if pack, err := openPack(idx); err == nil {
+			r.packs = append(r.packs, pack)
+		}
+	}
+	return r.packs
+}
+
+// openPack reads a pack index and opens the pack next to it
+func openPack(idxPath string) (*gitPack, error) {
+	idx, err := os.ReadFile(idxPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(idx) < 8+256*4 || !bytes.Equal(idx[:8], []byte{0xff, 't', 'O', 'c', 0, 0, 0, 2}) {
+		return nil, fmt.Errorf("%s: unsupported pack index version", idxPath)
+	}
+
+	pack := &gitPack{}
+	for i := range pack.fanout {
+		pack.fanout[i] = binary.BigEndian.Uint32(idx[8+4*i:])
+	}
+	count := int(pack.fanout[255])
+	pos := 8 + 256*4
+	if len(idx) < pos+count*(GIT_HASH_SIZE+8) {
+		return nil, fmt.Errorf("%s: truncated pack index", idxPath)
+	}
+	pack.names = idx[pos : pos+count*GIT_HASH_SIZE]
+	pos += count * GIT_HASH_SIZE
+	pos += count * 4 // CRCs
+	pack.offsets = idx[pos : pos+count*4]
+	pack.large = idx[pos+count*4:]
+
+	pack.file, err = os.Open(strings.TrimSuffix(idxPath, ".idx") + ".pack")
+	if err != nil {
+		return nil, err
+	}
+	return pack, nil
+}
+
+// find looks an object up in the index
+func (p *gitPack) find(h gitHash) (int64, bool) {
+	lo := 0
+	if h[0] > 0 {
+		lo = int(p.fanout[h[0]-1])
+	}
+	hi := int(p.fanout[h[0]])
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(p.names[(lo+i)*GIT_HASH_SIZE:(lo+i+1)*GIT_HASH_SIZE], h[:]) >= 0
+	})
+	if i >= hi || !bytes.Equal(p.names[i*GIT_HASH_SIZE:(i+1)*GIT_HASH_SIZE], h[:]) {
+		return 0, false
+	}
+
+	offset := binary.BigEndian.Uint32(p.offsets[i*4:])
+	if offset&0x80000000 == 0 {
+		return int64(offset), true
+	}
+	large := int(offset&0x7fffffff) * 8
+	if large+8 > len(p.large) {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint64(p.large[large:])), true
+}
+
+// Pack object types
+const (
+	packCommit   = 1
+	packTree     = 2
+	packBlob     = 3
+	packTag      = 4
+	packOfsDelta = 6
+	packRefDelta = 7
+)
+
+// readPacked reads the object at an offset, resolving deltas against their bases
+func (r *gitRepo) readPacked(pack *gitPack, offset int64, depth int) (gitObject, error) {
+	key := gitPackOffset{pack, offset}
+	r.mu.Lock()
+	obj, ok := r.deltaCache[key]
+	r.mu.Unlock()
+	if ok {
+		return obj, nil
+	}
+	if depth > GIT_MAX_DELTA_DEPTH {
+		return gitObject{}, errors.New("pack delta chain too long")
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(pack.file, offset, 1<<62))
+
+	// Header: type in bits 4-6 of the first byte, size in little-endian groups of 7 bits after that
+	c, err := reader.ReadByte()
+	if err != nil {
+		return gitObject{}, err
+	}
+	kind := (c >> 4) & 7
+	size := int64(c & 15)
+	for shift := 4; c&0x80 != 0; shift += 7 {
+		if c, err = reader.ReadByte(); err != nil {
+			return gitObject{}, err
+		}
+		size |= int64(c&0x7f) << shift
+	}
+
+	var base gitObject
+	switch kind {
+	case packOfsDelta:
+		// Base offset, relative to this object, in git's big-endian "add one per extra byte" encoding
+		c, err := reader.ReadByte()
+		if err != nil {
+			return gitObject{}, err
+		}
+		rel := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			if c, err = reader.ReadByte(); err != nil {
+				return gitObject{}, err
+			}
+			rel = ((rel + 1) << 7) | int64(c&0x7f)
+		}
+		if base, err = r.readPacked(pack, offset-rel, depth+1); err != nil {
+			return gitObject{}, err
+		}
+	case packRefDelta:
+		var h gitHash
+		if _, err := io.ReadFull(reader, h[:]); err != nil {
+			return gitObject{}, err
+		}
+		if base, err = r.readObject(h); err != nil {
+			return gitObject{}, err
+		}
+	}
+
+	data, err := inflate(reader, size)
+	if err != nil {
+		return gitObject{}, err
+	}
+
+	switch kind {
+	case packCommit, packTree, packBlob, packTag:
+		obj = gitObject{kind: [...]string{"", "commit", "tree", "blob", "tag"}[kind], data: data}
+	case packOfsDelta, packRefDelta:
+		patched, err := applyDelta(base.data, data)
+		if err != nil {
+			return gitObject{}, err
+		}
+		obj = gitObject{kind: base.kind, data: patched}
+	default:
+		return gitObject{}, fmt.Errorf("unknown pack object type %d", kind)
+	}
+
+	// Trees and commits make good delta bases and are small; blobs are only read to compare them
+	if obj.kind != "blob" {
+		r.mu.Lock()
+		if len(r.deltaCache) >= GIT_DELTA_CACHE {
+			clear(r.deltaCache)
+		}
+		r.deltaCache[key] = obj
+		r.mu.Unlock()
+	}
+	return obj, nil
+}
+
+// inflate decompresses exactly size bytes of zlib data
+func inflate(r io.Reader, size int64) ([]byte, error) {
+	z, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+	data := make([]byte, size)
+	if _, err := io.ReadFull(z, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// applyDelta rebuilds an object from its base and a delta: copy instructions take ranges of the
+// base, insert instructions carry literal bytes
+func applyDelta(base, delta []byte) ([]byte, error) {
+	errCorrupt := errors.New("corrupt pack delta")
+
+	// varint reads a little-endian base-128 number
+	varint := func() (int, bool) {
+		n, shift := 0, 0
+		for len(delta) > 0 {
+			c := delta[0]
+			delta = delta[1:]
+			n |= int(c&0x7f) << shift
+			shift += 7
+			if c&0x80 == 0 {
+				return n, true
+			}
+		}
+		return 0, false
+	}
+
+	srcSize, ok1 := varint()
+	dstSize, ok2 := varint()
+	if !ok1 || !ok2 || srcSize != len(base) {
+		return nil, errCorrupt
+	}
+
+	out := make([]byte, 0, dstSize)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		switch {
+		case op&0x80 != 0:
+			// Copy: which offset and size bytes follow is given by the low bits of op
+			var offset, size int
+			for i := 0; i < 4; i++ {
+				if op&(1<<i) != 0 {
+					if len(delta) == 0 {
+						return nil, errCorrupt
+					}
+					offset |= int(delta[0]) << (8 * i)
+					delta = delta[1:]
+				}
+			}
+			for i := 0; i < 3; i++ {
+				if op&(0x10<<i) != 0 {
+					if len(delta) == 0 {
+						return nil, errCorrupt
+					}
+					size |= int(delta[0]) << (8 * i)
+					delta = delta[1:]
+				}
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > len(base) {
+				return nil, errCorrupt
+			}
+			out = append(out, base[offset:offset+size]...)
+		case op != 0:
+			// Insert op literal bytes
+			if int(op) > len(delta) {
+				return nil, errCorrupt
+			}
+			out = append(out, delta[:op]...)
+			delta = delta[op:]
+		default:
+			return nil, errCorrupt
+		}
+	}
+	if len(out) != dstSize {
+		return nil, errCorrupt
+	}
+	return out, nil
+}
+
+// gitCommit is the part of a commit the status needs
+type gitCommit struct {
+	tree    gitHash
+	parents []gitHash
+	time    int64 // Committer timestamp
+	subject string
+	author  string
+}
+
+// readCommit parses a commit object
+func (r *gitRepo) readCommit(h gitHash) (gitCommit, error) {
+	obj, err := r.readObject(h)
+	if err != nil {
+		return gitCommit{}, err
+	}
+	if obj.kind != "commit" {
+		return gitCommit{}, fmt.Errorf("%s is a %s, not a commit", h, obj.kind)
+	}
+
+	var c gitCommit
+	headers, message, _ := bytes.Cut(obj.data, []byte("\n\n"))
+	for _, line := range strings.Split(string(headers), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "tree":
+			c.tree, err = parseGitHash(value)
+		case "parent":
+			var p gitHash
+			p, err = parseGitHash(value)
+			c.parents = append(c.parents, p)
+		case "author":
+			if end := strings.Index(value, " <"); end >= 0 {
+				c.author = value[:end]
+			}
+		case "committer":
+			// "Name <email> 1700000000 +0100"
+			fields := strings.Fields(value)
+			if len(fields) >= 2 {
+				c.time, _ = strconv.ParseInt(fields[len(fields)-2], 10, 64)
+			}
+		}
+		if err != nil {
+			return gitCommit{}, err
+		}
+	}
+	c.subject, _, _ = strings.Cut(string(message), "\n")
+	return c, nil
+}
+
+// gitTreeEntry is one entry of a tree object
+type gitTreeEntry struct {
+	name string
+	mode uint32 // 0o40000 tree, 0o100644/0o100755 blob, 0o120000 symlink, 0o160000 submodule
+	hash gitHash
+}
+
+// readTree parses a tree object: "mode name\0" followed by the raw object name, repeated
+func (r *gitRepo) readTree(h gitHash) ([]gitTreeEntry, error) {
+	obj, err := r.readObject(h)
+	if err != nil {
+		return nil, err
+	}
+	if obj.kind != "tree" {
+		return nil, fmt.Errorf("%s is a %s, not a tree", h, obj.kind)
+	}
+
+	var entries []gitTreeEntry
+	data := obj.data
+	for len(data) > 0 {
+		header, rest, ok := bytes.Cut(data, []byte{0})
+		mode, name, ok2 := strings.Cut(string(header), " ")
+		if !ok || !ok2 || len(rest) < GIT_HASH_SIZE {
+			return nil, fmt.Errorf("tree %s is corrupt", h)
+		}
+		m, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("tree %s is corrupt", h)
+		}
+		entry := gitTreeEntry{name: name, mode: uint32(m)}
+		copy(entry.hash[:], rest)
+		entries = append(entries, entry)
+		data = rest[GIT_HASH_SIZE:]
+	}
+	return entries, nil
+}
+
+// aheadBehind counts the commits reachable from one side but not the other, like
+// "git rev-list --left-right --count a...b". Commits are walked newest first and the walk
+// stops once every commit still queued is reachable from both sides.
+func (r *gitRepo) aheadBehind(a, b gitHash) (ahead, behind int, err error) {
+	const (
+		fromA = 1 << iota
+		fromB
+		both = fromA | fromB
+	)
+	if a == b {
+		return 0, 0, nil
+	}
+
+	flags := map[gitHash]int{a: fromA, b: fromB}
+	commits := map[gitHash]gitCommit{}
+	queue := []gitHash{a, b}
+
+	// load reads a commit once
+	load := func(h gitHash) (gitCommit, error) {
+		if c, ok := commits[h]; ok {
+			return c, nil
+		}
+		c, err := r.readCommit(h)
+		commits[h] = c
+		return c, err
+	}
+	for _, h := range queue {
+		if _, err := load(h); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	// interesting reports whether any queued commit still belongs to only one side
+	interesting := func() bool {
+		for _, h := range queue {
+			if flags[h] != both {
+				return true
+			}
+		}
+		return false
+	}
+
+	for len(queue) > 0 && interesting() {
+		// Take the newest commit so sides meet as early as possible
+		newest := 0
+		for i, h := range queue {
+			if commits[h].time > commits[queue[newest]].time {
+				newest = i
+			}
+		}
+		h := queue[newest]
+		queue = append(queue[:newest], queue[newest+1:]...)
+
+		for _, parent := range commits[h].parents {
+			merged := flags[parent] | flags[h]
+			if merged == flags[parent] {
+				continue
+			}
+			flags[parent] = merged
+			if _, err := load(parent); err != nil {
+				return 0, 0, err
+			}
+			queue = append(queue, parent)
+		}
+	}
+
+	// Ties and clock skew can take a commit off the queue before the other side reaches it, leaving
+	// it marked for one side only. Carry the mark of both sides down again, as far back in time as
+	// the oldest commit marked for one side.
+	oldest := int64(math.MaxInt64)
+	for h, f := range flags {
+		if f != both {
+			oldest = min(oldest, commits[h].time)
+		}
+	}
+	var stack []gitHash
+	for h, f := range flags {
+		if f == both {
+			stack = append(stack, h)
+		}
+	}
+	for len(stack) > 0 {
+		h := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, parent := range commits[h].parents {
+			if flags[parent] == both {
+				continue
+			}
+			c, err := load(parent)
+			if err != nil {
+				return 0, 0, err
+			}
+			if flags[parent] == 0 && c.time < oldest {
+				continue
+			}
+			flags[parent] = both
+			stack = append(stack, parent)
+		}
+	}
+
+	for _, f := range flags {
+		switch f {
+		case fromA:
+			ahead++
+		case fromB:
+			behind++
+		}
+	}
+	return ahead, behind, nil
+}
+
+// objectSize returns an object's size without inflating all of it: loose objects carry it in
+// their header, packed ones in the pack entry or, for deltas, at the start of the delta
+func (r *gitRepo) objectSize(h gitHash) (int64, error) {
+	name := h.String()
+	for _, dir := range r.objectDirs {
+		f, err := os.Open(filepath.Join(dir, name[:2], name[2:]))
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+		z, err := zlib.NewReader(f)
+		if err != nil {
+			return 0, err
+		}
+		header, err := bufio.NewReader(z).ReadString(0)
+		if err != nil {
+			return 0, err
+		}
+		_, size, _ := strings.Cut(strings.TrimSuffix(header, "\x00"), " ")
+		return strconv.ParseInt(size, 10, 64)
+	}
+
+	for _, pack := range r.loadPacks() {
+		offset, ok := pack.find(h)
+		if !ok {
+			continue
+		}
+		reader := bufio.NewReader(io.NewSectionReader(pack.file, offset, 1<<62))
+		c, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		kind := (c >> 4) & 7
+		size := int64(c & 15)
+		for shift := 4; c&0x80 != 0; shift += 7 {
+			if c, err = reader.ReadByte(); err != nil {
+				return 0, err
+			}
+			size |= int64(c&0x7f) << shift
+		}
+		switch kind {
+		case packOfsDelta:
+			for c = 0x80; c&0x80 != 0; { // Skip the base offset
+				if c, err = reader.ReadByte(); err != nil {
+					return 0, err
+				}
+			}
+		case packRefDelta:
+			if _, err := reader.Discard(GIT_HASH_SIZE); err != nil {
+				return 0, err
+			}
+		default:
+			return size, nil
+		}
+
+		// Deltas begin with the base size, then the size of the result; 20 bytes hold both
+		z, err := zlib.NewReader(reader)
+		if err != nil {
+			return 0, err
+		}
+		head := make([]byte, 20)
+		n, _ := io.ReadFull(z, head)
+		z.Close()
+		head = head[:n]
+
+		// varint reads a little-endian base-128 number off the delta header
+		varint := func() int64 {
+			value, shift := int64(0), 0
+			for len(head) > 0 {
+				c := head[0]
+				head = head[1:]
+				value |= int64(c&0x7f) << shift
+				shift += 7
+				if c&0x80 == 0 {
+					break
+				}
+			}
+			return value
+		}
+		varint() // Base size
+		return varint(), nil
+	}
+	return 0, fmt.Errorf("object %s not found", name)
+}
+
+// resolveRevision turns what a user would give git ("v1.2.0", "main", "origin/dev", "HEAD~3",
+// "a1b2c3d^2") into a commit. Annotated tags are peeled to the commit they point at.
+func (r *gitRepo) resolveRevision(rev string) (gitHash, error) {
+	// Split off the trailing ~N and ^N steps
+	base := rev
+	var steps []string
+	for {
+		i := strings.LastIndexAny(base, "~^")
+		if i <= 0 {
+			break
+		}
+		if _, err := strconv.Atoi(base[i+1:]); err != nil && base[i+1:] != "" {
+			break
+		}
+		steps = append([]string{base[i:]}, steps...)
+		base = base[:i]
+	}
+
+	h, err := r.resolveName(base)
+	if err != nil {
+		return h, err
+	}
+	if h, err = r.peelToCommit(h); err != nil {
+		return h, err
+	}
+
+	for _, step := range steps {
+		n := 1
+		if step[1:] != "" {
+			n, _ = strconv.Atoi(step[1:])
+		}
+		if step[0] == '~' {
+			// ~N: N first parents back
+			for ; n > 0; n-- {
+				c, err := r.readCommit(h)
+				if err != nil {
+					return h, err
+				}
+				if len(c.parents) == 0 {
+					return h, fmt.Errorf("%s: no such commit", rev)
+				}
+				h = c.parents[0]
+			}
+			continue
+		}
+		// ^N: the Nth parent, ^0 the commit itself
+		if n == 0 {
+			continue
+		}
+		c, err := r.readCommit(h)
+		if err != nil {
+			return h, err
+		}
+		if n > len(c.parents) {
+			return h, fmt.Errorf("%s: no such commit", rev)
+		}
+		h = c.parents[n-1]
+	}
+	return h, nil
+}
+
+// resolveName looks a name up the way git does: refs first, then object names, full or abbreviated
+func (r *gitRepo) resolveName(name string) (gitHash, error) {
+	for _, ref := range []string{
+		name, "refs/" + name, "refs/tags/" + name, "refs/heads/" + name,
+		"refs/remotes/" + name, "refs/remotes/" + name + "/HEAD",
+	} {
+		if h, _, err := r.readRef(ref); err == nil {
+			return h, nil
+		}
+	}
+
+	if len(name) >= 4 && len(name) <= 2*GIT_HASH_SIZE && strings.Trim(strings.ToLower(name), "0123456789abcdef") == "" {
+		return r.findAbbrev(strings.ToLower(name))
+	}
+	return gitHash{}, fmt.Errorf("%s: unknown revision", name)
+}
+
+// findAbbrev finds the one object whose name starts with a hexadecimal prefix
+func (r *gitRepo) findAbbrev(prefix string) (gitHash, error) {
+	found := map[gitHash]bool{}
+
+	for _, dir := range r.objectDirs {
+		names, _ := os.ReadDir(filepath.Join(dir, prefix[:2]))
+		for _, entry := range names {
+			if full := prefix[:2] + entry.Name(); strings.HasPrefix(full, prefix) {
+				if h, err := parseGitHash(full); err == nil {
+					found[h] = true
+				}
+			}
+		}
+	}
+
+	// Pack indexes are sorted: start at the first name not below the prefix and stop when it no longer matches
+	even, _ := hex.DecodeString(prefix[:len(prefix)&^1])
+	for _, pack := range r.loadPacks() {
+		count := int(pack.fanout[255])
+		i := sort.Search(count, func(i int) bool {
+			return bytes.Compare(pack.names[i*GIT_HASH_SIZE:(i+1)*GIT_HASH_SIZE], even) >= 0
+		})
+		for ; i < count; i++ {
+			var h gitHash
+			copy(h[:], pack.names[i*GIT_HASH_SIZE:])
+			if !strings.HasPrefix(h.String(), prefix) {
+				break
+			}
+			found[h] = true
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return gitHash{}, fmt.Errorf("%s: unknown revision", prefix)
+	case 1:
+		for h := range found {
+			return h, nil
+		}
+	}
+	return gitHash{}, fmt.Errorf("%s: ambiguous object name", prefix)
+}
+
+// peelToCommit follows annotated tags down to the commit they name
+func (r *gitRepo) peelToCommit(h gitHash) (gitHash, error) {
+	for depth := 0; depth < 10; depth++ {
+		obj, err := r.readObject(h)
+		if err != nil {
+			return h, err
+		}
+		switch obj.kind {
+		case "commit":
+			return h, nil
+		case "tag":
+			target, _, _ := strings.Cut(strings.TrimPrefix(string(obj.data), "object "), "\n")
+			if h, err = parseGitHash(target); err != nil {
+				return h, err
+			}
+		default:
+			return h, fmt.Errorf("%s is a %s, not a commit", h.String()[:7], obj.kind)
+		}
+	}
+	return h, errors.New("tag chain too long")
+}
+
+// treeAt finds the tree of a directory, given as a slash-separated path, under a root tree
+func (r *gitRepo) treeAt(root gitHash, dir string) (gitHash, error) {
+	h := root
+	if dir == "" {
+		return h, nil
+	}
+	for _, name := range strings.Split(dir, "/") {
+		entries, err := r.readTree(h)
+		if err != nil {
+			return h, err
+		}
+		found := false
+		for _, entry := range entries {
+			if entry.name == name && entry.mode == 0o40000 {
+				h, found = entry.hash, true
+				break
+			}
+		}
+		if !found {
+			return h, fmt.Errorf("%s: no such directory in this commit", dir)
+		}
+	}
+	return h, nil
+}
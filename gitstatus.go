@@ -0,0 +1,827 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Git status refresh
+const (
+	GIT_POLL_INTERVAL = 2 * time.Second // How often the index and refs are checked for outside changes
+)
+
+// gitIndexEntry is one path of the index (the staging area)
+type gitIndexEntry struct {
+	path         string
+	mode         uint32
+	hash         gitHash
+	size         uint32 // Truncated to 32 bits like git does
+	mtime        time.Time
+	stage        int  // 0 normally; 1 base, 2 ours, 3 theirs during a conflict
+	skipWorktree bool // Sparse checkout: not in the work tree on purpose
+	intentToAdd  bool // "git add -N": tracked but not staged yet
+}
+
+// gitIndex is the parsed index file
+type gitIndex struct {
+	entries   []gitIndexEntry
+	modTime   time.Time          // Entries whose file changed in the same instant must be hashed
+	cacheTree map[string]gitHash // Tree objects the index would write, by directory ("" for the top); only valid ones
+}
+
+// readIndex parses the index file (versions 2 to 4). Of the extensions, only the cache tree is read.
+func readIndex(path string) (gitIndex, error) {
+	var idx gitIndex
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return idx, nil // Nothing staged yet in a fresh repository
+	}
+	if err != nil {
+		return idx, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return idx, err
+	}
+	errCorrupt := fmt.Errorf("%s: corrupt index", path)
+	if len(data) < 12+GIT_HASH_SIZE || string(data[:4]) != "DIRC" {
+		return idx, errCorrupt
+	}
+	version := binary.BigEndian.Uint32(data[4:])
+	if version < 2 || version > 4 {
+		return idx, fmt.Errorf("%s: unsupported index version %d", path, version)
+	}
+	count := int(binary.BigEndian.Uint32(data[8:]))
+	idx.modTime = info.ModTime()
+
+	entries := make([]gitIndexEntry, 0, count)
+	pos := 12
+	previous := ""
+	for i := 0; i < count; i++ {
+		start := pos
+		if pos+62 > len(data) {
+			return idx, errCorrupt
+		}
+		e := gitIndexEntry{
+			mtime: time.Unix(int64(binary.BigEndian.Uint32(data[pos+8:])), int64(binary.BigEndian.Uint32(data[pos+12:]))),
+			mode:  binary.BigEndian.Uint32(data[pos+24:]),
+			size:  binary.BigEndian.Uint32(data[pos+36:]),
+		}
+		copy(e.hash[:], data[pos+40:])
+		flags := binary.BigEndian.Uint16(data[pos+60:])
+		e.stage = int(flags>>12) & 3
+		pos += 62
+
+		// Version 3 adds a second flags word to entries with the extended bit
+		if flags&0x4000 != 0 {
+			if pos+2 > len(data) {
+				return idx, errCorrupt
+			}
+			extended := binary.BigEndian.Uint16(data[pos:])
+			e.skipWorktree = extended&0x4000 != 0
+			e.intentToAdd = extended&0x2000 != 0
+			pos += 2
+		}
+
+		if version == 4 {
+			// The name drops a number of bytes from the end of the previous one, then adds a suffix
+			strip, n := indexVarint(data[pos:])
+			if n == 0 || strip > len(previous) {
+				return idx, errCorrupt
+			}
+			pos += n
+			end := bytes.IndexByte(data[pos:], 0)
+			if end < 0 {
+				return idx, errCorrupt
+			}
+			e.path = previous[:len(previous)-strip] + string(data[pos:pos+end])
+			pos += end + 1
+		} else {
+			// NUL-terminated, then padded so the entry is a multiple of 8 bytes
+			end := bytes.IndexByte(data[pos:], 0)
+			if end < 0 {
+				return idx, errCorrupt
+			}
+			e.path = string(data[pos : pos+end])
+			pos = start + (pos-start+end+8)/8*8
+		}
+		previous = e.path
+		entries = append(entries, e)
+	}
+	idx.entries = entries
+
+	// Extensions follow, each a signature and a size, then the checksum of the whole file
+	for pos+8 <= len(data)-GIT_HASH_SIZE {
+		signature := string(data[pos : pos+4])
+		size := int(binary.BigEndian.Uint32(data[pos+4:]))
+		pos += 8
+		if pos+size > len(data)-GIT_HASH_SIZE {
+			return idx, errCorrupt
+		}
+		if signature == "TREE" {
+			idx.cacheTree = parseCacheTree(data[pos : pos+size])
+		}
+		pos += size
+	}
+	return idx, nil
+}
+
+// parseCacheTree reads the cache tree extension: for each directory, depth first, its name,
+// "entries subtrees\n" and, unless invalidated by a later change (entries is -1), its tree object
+func parseCacheTree(data []byte) map[string]gitHash {
+	trees := make(map[string]gitHash)
+
+	var parse func(prefix string) bool
+	parse = func(prefix string) bool {
+		end := bytes.IndexByte(data, 0)
+		if end < 0 {
+			return false
+		}
+		dir := prefix + string(data[:end])
+		line, rest, ok := bytes.Cut(data[end+1:], []byte("\n"))
+		if !ok {
+			return false
+		}
+		data = rest
+		entries, subtrees, _ := strings.Cut(string(line), " ")
+		n, err1 := strconv.Atoi(entries)
+		children, err2 := strconv.Atoi(subtrees)
+		if err1 != nil || err2 != nil {
+			return false
+		}
+		if n >= 0 {
+			if len(data) < GIT_HASH_SIZE {
+				return false
+			}
+			var h gitHash
+			copy(h[:], data)
+			trees[dir] = h
+			data = data[GIT_HASH_SIZE:]
+		}
+
+		if dir != "" {
+			dir += "/"
+		}
+		for i := 0; i < children; i++ {
+			if !parse(dir) {
+				return false
+			}
+		}
+		return true
+	}
+
+	parse("")
+	return trees
+}
+
+// indexVarint decodes git's offset encoding, used for path prefixes in version 4 indexes.
+// It returns the value and the number of bytes read (0 on truncated input).
+func indexVarint(data []byte) (int, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	value := int(data[0] & 0x7f)
+	i := 0
+	for data[i]&0x80 != 0 {
+		i++
+		if i >= len(data) {
+			return 0, 0
+		}
+		value = ((value + 1) << 7) | int(data[i]&0x7f)
+	}
+	return value, i + 1
+}
+
+// gitFileStatus is a two-letter code like "git status --short": the index against HEAD,
+// then the work tree against the index. "??" is untracked and "!!" ignored.
+type gitFileStatus string
+
+// gitStatus is a snapshot of a repository's state
+type gitStatus struct {
+	branch   string // Branch name, empty when HEAD is detached
+	head     gitHash
+	unborn   bool   // The branch has no commits yet
+	upstream string // Remote-tracking branch, if the branch has one
+	ahead    int
+	behind   int
+	state    string // Operation in progress: merging, rebasing...
+	dirty    bool   // Tracked files differ from HEAD, in the index or the work tree
+
+	files   map[string]gitFileStatus // Changed, untracked and ignored paths relative to the work tree
+	changed map[string]bool          // Directories with changes somewhere below them
+}
+
+// readGitStatus compares HEAD, the index and the work tree. The work tree is stat'ed in parallel
+// and only files whose stat data no longer matches the index are hashed.
+func readGitStatus(repo *gitRepo) (*gitStatus, error) {
+	st := &gitStatus{files: make(map[string]gitFileStatus), changed: make(map[string]bool)}
+
+	index, err := readIndex(filepath.Join(repo.gitDir, "index"))
+	if err != nil {
+		return nil, err
+	}
+
+	// HEAD and the tree it points at, where it differs from the index's cache tree
+	head := make(map[string]gitTreeEntry)
+	sameAsHead := make(map[string]bool)
+	hash, ref, err := repo.readRef("HEAD")
+	if name, ok := strings.CutPrefix(ref, "refs/heads/"); ok {
+		st.branch = name
+	}
+	switch {
+	case err != nil && st.branch != "":
+		st.unborn = true
+	case err != nil:
+		return nil, err
+	default:
+		st.head = hash
+		commit, err := repo.readCommit(hash)
+		if err != nil {
+			return nil, err
+		}
+		if err := repo.diffHeadTree(commit.tree, "", index.cacheTree, head, sameAsHead); err != nil {
+			return nil, err
+		}
+	}
+	st.state = repo.operationState()
+
+	// inSameTree reports whether a path lies in a directory the index holds just as HEAD has it
+	inSameTree := func(path string) bool {
+		for dir := path; ; {
+			i := strings.LastIndexByte(dir, '/')
+			dir = dir[:max(i, 0)]
+			if sameAsHead[dir] {
+				return true
+			}
+			if i < 0 {
+				return false
+			}
+		}
+	}
+
+	// Index against HEAD; conflicts get their code from the stages present
+	stages := make(map[string]int)
+	tracked := make(map[string]bool)
+	added := make(map[gitHash][]string) // Files new to the index by content, the new names of renames
+	for _, e := range index.entries {
+		tracked[e.path] = true
+		if e.stage > 0 {
+			stages[e.path] |= 1 << (e.stage - 1)
+			continue
+		}
+		if inSameTree(e.path) {
+			continue
+		}
+		old, inHead := head[e.path]
+		switch {
+		case e.intentToAdd:
+			st.files[e.path] = " A"
+		case !inHead:
+			st.files[e.path] = "A "
+			added[e.hash] = append(added[e.hash], e.path)
+		case old.hash != e.hash || old.mode != e.mode:
+			st.files[e.path] = "M "
+		}
+	}
+	for path, mask := range stages {
+		st.files[path] = map[int]gitFileStatus{
+			1: "DD", 2: "AU", 3: "UD", 4: "UA", 5: "DU", 6: "AA", 7: "UU",
+		}[mask]
+	}
+
+	// A file gone from the index whose content was added under another name was renamed: like git,
+	// the new name says "R" and the old one isn't listed. Only exact renames are paired; one whose
+	// content changed as well is a deletion and an addition, where git would match them by similarity.
+	for _, path := range slices.Sorted(maps.Keys(head)) {
+		if tracked[path] {
+			continue
+		}
+		if names := added[head[path].hash]; len(names) > 0 {
+			st.files[names[0]] = "R "
+			added[head[path].hash] = names[1:]
+			continue
+		}
+		st.files[path] = "D "
+	}
+
+	// Work tree against the index
+	fileMode := repo.config["core.filemode"] != "false"
+	for path, change := range repo.worktreeChanges(index, fileMode) {
+		x := st.files[path]
+		if x == "" {
+			x = " "
+		}
+		st.files[path] = gitFileStatus(string(x[0]) + string(change))
+	}
+
+	// Untracked and ignored files
+	trackedDirs := map[string]bool{"": true}
+	for _, e := range index.entries {
+		for dir := e.path; ; {
+			i := strings.LastIndexByte(dir, '/')
+			if i < 0 || trackedDirs[dir[:i]] {
+				break
+			}
+			dir = dir[:i]
+			trackedDirs[dir] = true
+		}
+	}
+	for path, code := range repo.untracked(tracked, trackedDirs) {
+		st.files[path] = code
+	}
+
+	// Directories containing changes, and whether tracked files changed at all
+	for path, code := range st.files {
+		if code == "!!" {
+			continue
+		}
+		if code != "??" {
+			st.dirty = true
+		}
+		for dir := path; dir != ""; {
+			i := strings.LastIndexByte(dir, '/')
+			dir = dir[:max(i, 0)]
+			if st.changed[dir] {
+				break
+			}
+			st.changed[dir] = true
+		}
+	}
+
+	// How far the branch and its upstream have diverged
+	if st.branch != "" && !st.unborn {
+		if upstream := repo.upstream("refs/heads/" + st.branch); upstream != "" {
+			if theirs, _, err := repo.readRef(upstream); err == nil {
+				st.upstream = strings.TrimPrefix(strings.TrimPrefix(upstream, "refs/remotes/"), "refs/heads/")
+				st.ahead, st.behind, _ = repo.aheadBehind(st.head, theirs)
+			}
+		}
+	}
+	return st, nil
+}
+
+// diffHeadTree lists HEAD's files under the directories where the index's cache tree doesn't
+// vouch for it. A directory whose cached tree is HEAD's holds exactly what HEAD has, so it's
+// recorded in same and skipped; right after a commit nothing is read at all.
+func (r *gitRepo) diffHeadTree(tree gitHash, dir string, cacheTree map[string]gitHash, files map[string]gitTreeEntry, same map[string]bool) error {
+	if cached, ok := cacheTree[dir]; ok && cached == tree {
+		same[dir] = true
+		return nil
+	}
+	entries, err := r.readTree(tree)
+	if err != nil {
+		return err
+	}
+	prefix := ""
+	if dir != "" {
+		prefix = dir + "/"
+	}
+	for _, entry := range entries {
+		if entry.mode == 0o40000 {
+			if err := r.diffHeadTree(entry.hash, prefix+entry.name, cacheTree, files, same); err != nil {
+				return err
+			}
+			continue
+		}
+		files[prefix+entry.name] = entry
+	}
+	return nil
+}
+
+// operationState names the multi-step operation in progress, if any
+func (r *gitRepo) operationState() string {
+	for _, check := range []struct{ file, state string }{
+		{"rebase-merge", "rebasing"},
+		{"rebase-apply", "rebasing"},
+		{"MERGE_HEAD", "merging"},
+		{"CHERRY_PICK_HEAD", "cherry-picking"},
+		{"REVERT_HEAD", "reverting"},
+		{"BISECT_LOG", "bisecting"},
+	} {
+		if _, err := os.Lstat(filepath.Join(r.gitDir, check.file)); err == nil {
+			return check.state
+		}
+	}
+	return ""
+}
+
+// worktreeChanges compares the work tree with the index entries: 'M' modified, 'D' deleted,
+// 'T' type changed. Entries whose stat data matches the index are trusted unless the index was
+// written in the same instant as the file (git's "racy" case); the others are hashed.
+func (r *gitRepo) worktreeChanges(index gitIndex, fileMode bool) map[string]byte {
+	changes := make(map[string]byte)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	workers := runtime.GOMAXPROCS(0)
+	entries := index.entries
+	chunk := max((len(entries)+workers-1)/workers, 1)
+	for start := 0; start < len(entries); start += chunk {
+		wg.Add(1)
+		go func(entries []gitIndexEntry) {
+			defer wg.Done()
+			for _, e := range entries {
+				if e.stage > 0 || e.skipWorktree || e.intentToAdd || e.mode == 0o40000 {
+					continue // Conflicts are reported as such; sparse entries aren't meant to be there
+				}
+				if change := r.compareEntry(e, index.modTime, fileMode); change != 0 {
+					mu.Lock()
+					changes[e.path] = change
+					mu.Unlock()
+				}
+			}
+		}(entries[start:min(start+chunk, len(entries))])
+	}
+	wg.Wait()
+	return changes
+}
+
+// compareEntry checks one index entry against its file
+func (r *gitRepo) compareEntry(e gitIndexEntry, indexTime time.Time, fileMode bool) byte {
+	path := filepath.Join(r.workTree, filepath.FromSlash(e.path))
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 'D'
+	}
+
+	// Submodules: only whether their directory is still there
+	if e.mode == 0o160000 {
+		if !info.IsDir() {
+			return 'T'
+		}
+		return 0
+	}
+
+	isLink := info.Mode()&fs.ModeSymlink != 0
+	if isLink != (e.mode == 0o120000) || !isLink && !info.Mode().IsRegular() {
+		return 'T'
+	}
+	if !isLink && fileMode && (info.Mode()&0o111 != 0) != (e.mode == 0o100755) {
+		return 'M'
+	}
+	if uint32(info.Size()) != e.size {
+		return 'M'
+	}
+	if info.ModTime().Equal(e.mtime) && e.mtime.Before(indexTime) {
+		return 0
+	}
+
+	// Same size, different or racy timestamp: the content decides
+	if h, err := hashWorktreeFile(path, info); err != nil || h != e.hash {
+		return 'M'
+	}
+	return 0
+}
+
+// hashWorktreeFile computes the blob name a file would get: the SHA-1 of a "blob size\0"
+// header and the content (the target, for symlinks)
+func hashWorktreeFile(path string, info fs.FileInfo) (gitHash, error) {
+	var h gitHash
+	sum := sha1.New()
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return h, err
+		}
+		fmt.Fprintf(sum, "blob %d\x00%s", len(target), target)
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return h, err
+		}
+		defer f.Close()
+		fmt.Fprintf(sum, "blob %d\x00", info.Size())
+		if _, err := io.Copy(sum, f); err != nil {
+			return h, err
+		}
+	}
+	copy(h[:], sum.Sum(nil))
+	return h, nil
+}
+
+// untracked walks the directories that hold tracked files and reports what else is there:
+// "??" for untracked files and directories, "!!" for ignored ones. Like git, it doesn't descend
+// into untracked or ignored directories, and skips untracked directories with nothing in them.
+// Subdirectories are read in parallel.
+func (r *gitRepo) untracked(tracked, trackedDirs map[string]bool) map[string]gitFileStatus {
+	found := make(map[string]gitFileStatus)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, runtime.GOMAXPROCS(0)*2) // Limits concurrent directory reads
+
+	var walk func(dir string, rules ignoreRules)
+	walk = func(dir string, rules ignoreRules) {
+		defer wg.Done()
+		slots <- struct{}{}
+		entries, err := os.ReadDir(filepath.Join(r.workTree, filepath.FromSlash(dir)))
+		<-slots
+		if err != nil {
+			return
+		}
+		prefix := ""
+		if dir != "" {
+			prefix = dir + "/"
+		}
+		rules = rules.with(r.workTree, prefix)
+
+		for _, entry := range entries {
+			rel := prefix + entry.Name()
+			if entry.Name() == ".git" || tracked[rel] {
+				continue
+			}
+			isDir := entry.IsDir()
+			if isDir && trackedDirs[rel] {
+				wg.Add(1)
+				go walk(rel, rules)
+				continue
+			}
+
+			code := gitFileStatus("??")
+			switch {
+			case rules.ignored(rel, isDir):
+				code = "!!"
+			case isDir:
+				if code = r.untrackedContent(rel, rules); code == "" {
+					continue
+				}
+			}
+			mu.Lock()
+			found[rel] = code
+			mu.Unlock()
+		}
+	}
+
+	wg.Add(1)
+	walk("", r.globalIgnoreRules())
+	wg.Wait()
+	return found
+}
+
+// untrackedContent tells how git lists an untracked directory: "??" when it holds a file that
+// isn't ignored, at any depth, or a nested repository; "!!" when all it holds is ignored; ""
+// when there's no file in it at all
+func (r *gitRepo) untrackedContent(dir string, rules ignoreRules) gitFileStatus {
+	path := filepath.Join(r.workTree, filepath.FromSlash(dir))
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return ""
+	}
+	rules = rules.with(r.workTree, dir+"/")
+	code := gitFileStatus("")
+	for _, entry := range entries {
+		rel := dir + "/" + entry.Name()
+		if entry.Name() == ".git" {
+			return "??"
+		}
+		if rules.ignored(rel, entry.IsDir()) {
+			code = "!!"
+			continue
+		}
+		if !entry.IsDir() {
+			return "??"
+		}
+		switch r.untrackedContent(rel, rules) {
+		case "??":
+			return "??"
+		case "!!":
+			code = "!!"
+		}
+	}
+	return code
+}
+
+// lookup returns the status of an object, relative paths being resolved against the work tree.
+// Directories with changes below them report "•"; objects inside untracked or ignored
+// directories inherit their code.
+func (st *gitStatus) lookup(workTree, path string, isDir bool) gitFileStatus {
+	rel, err := filepath.Rel(workTree, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	rel = filepath.ToSlash(rel)
+	if code, ok := st.files[rel]; ok {
+		return code
+	}
+	for dir := rel; ; {
+		i := strings.LastIndexByte(dir, '/')
+		if i < 0 {
+			break
+		}
+		dir = dir[:i]
+		if code := st.files[dir]; code == "??" || code == "!!" {
+			return code
+		}
+	}
+	if isDir && st.changed[rel] {
+		return "•"
+	}
+	return ""
+}
+
+// label is the top bar summary: branch (or detached commit), divergence from upstream,
+// operation in progress and a star when tracked files changed
+func (st *gitStatus) label() string {
+	parts := []string{}
+	switch {
+	case st.branch != "":
+		parts = append(parts, "⎇ "+st.branch)
+	default:
+		parts = append(parts, "@"+st.head.String()[:7])
+	}
+	if st.ahead > 0 {
+		parts = append(parts, "↑"+strconv.Itoa(st.ahead))
+	}
+	if st.behind > 0 {
+		parts = append(parts, "↓"+strconv.Itoa(st.behind))
+	}
+	if st.state != "" {
+		parts = append(parts, st.state)
+	}
+	if st.dirty {
+		parts = append(parts, "*")
+	}
+	return strings.Join(parts, " ")
+}
+
+// renderGitBadge colors a status code: staged changes green, unstaged red, conflicts bold magenta
+func renderGitBadge(code gitFileStatus) string {
+	switch {
+	case code == "":
+		return ""
+	case code == "!!":
+		return styleGitIgnored.Render(string(code))
+	case code == "•":
+		return styleGitChanged.Render(string(code))
+	case strings.ContainsRune(string(code), 'U') || code == "AA" || code == "DD":
+		return styleGitConflict.Render(string(code))
+	}
+	return styleGitStaged.Render(string(code[:1])) + styleGitChanged.Render(string(code[1:]))
+}
+
+// gitTracker keeps the status of the repository containing the current directory up to date
+type gitTracker struct {
+	path    string     // Directory the repository was looked up for
+	repo    *gitRepo   // nil outside a work tree
+	status  *gitStatus // Last snapshot; nil until the first one arrives
+	running bool       // A snapshot is being taken
+	again   bool       // Something changed while it was: take another one afterwards
+	stamp   string     // Index and ref timestamps when the last snapshot was started
+}
+
+// gitStatusMsg delivers a snapshot taken in the background
+type gitStatusMsg struct {
+	repo   *gitRepo
+	status *gitStatus
+	err    error
+}
+
+// gitPollMsg is the periodic check for changes made by git itself (commits, staging, fetches)
+type gitPollMsg struct {
+	repo *gitRepo
+}
+
+// syncGit looks the repository up whenever the current directory changes, and starts tracking it
+func (m *model) syncGit() tea.Cmd {
+	if m.git.path == m.state.currentPath {
+		return nil
+	}
+	m.git.path = m.state.currentPath
+
+	// Still inside the same work tree: the snapshot covers it already
+	repo := findRepo(m.git.path)
+	if repo != nil && m.git.repo != nil && repo.workTree == m.git.repo.workTree {
+		return nil
+	}
+
+	m.git = gitTracker{path: m.git.path, repo: repo}
+	if repo == nil {
+		return nil
+	}
+	return tea.Batch(m.refreshGit(), gitPoll(m.git.repo))
+}
+
+// refreshGit takes a new snapshot in the background, or queues one if a snapshot is under way
+func (m *model) refreshGit() tea.Cmd {
+	if m.git.repo == nil {
+		return nil
+	}
+	if m.git.running {
+		m.git.again = true
+		return nil
+	}
+	m.git.running = true
+	m.git.stamp = m.git.repo.stamp()
+	repo := m.git.repo
+	return func() tea.Msg {
+		status, err := readGitStatus(repo)
+		return gitStatusMsg{repo: repo, status: status, err: err}
+	}
+}
+
+// showGitStatus stores a finished snapshot and starts the queued one, if any
+func (m *model) showGitStatus(msg gitStatusMsg) tea.Cmd {
+	if msg.repo != m.git.repo {
+		return nil // From a repository we already left
+	}
+	m.git.running = false
+	if msg.err != nil {
+		m.status = "git: " + msg.err.Error()
+	} else {
+		m.git.status = msg.status
+		if m.previewDiff {
+			m.previewPath = "" // Diffs may have changed with the status: show them again
+		}
+		if m.state.sort == sortByGit {
+			m.keepFocus(true, m.applyFilter)
+		}
+	}
+	if m.git.again {
+		m.git.again = false
+		return m.refreshGit()
+	}
+	return nil
+}
+
+// gitPoll schedules the next check of the repository's own files
+func gitPoll(repo *gitRepo) tea.Cmd {
+	return tea.Tick(GIT_POLL_INTERVAL, func(time.Time) tea.Msg {
+		return gitPollMsg{repo: repo}
+	})
+}
+
+// pollGit refreshes the status when git changed the index, HEAD or the refs behind cdx's back
+func (m *model) pollGit(msg gitPollMsg) tea.Cmd {
+	if msg.repo != m.git.repo {
+		return nil // Polling stops once we leave the repository
+	}
+	if !m.git.running && msg.repo.stamp() != m.git.stamp {
+		return tea.Batch(m.refreshGit(), gitPoll(msg.repo))
+	}
+	return gitPoll(msg.repo)
+}
+
+// stamp fingerprints the files git rewrites when it changes state
+func (r *gitRepo) stamp() string {
+	var b strings.Builder
+	for _, path := range []string{
+		filepath.Join(r.gitDir, "index"),
+		filepath.Join(r.gitDir, "HEAD"),
+		filepath.Join(r.commonDir, "packed-refs"),
+		filepath.Join(r.commonDir, "refs", "heads"),
+		filepath.Join(r.commonDir, "refs", "remotes"),
+	} {
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&b, "%d:%d;", info.ModTime().UnixNano(), info.Size())
+		} else {
+			b.WriteString("-;")
+		}
+	}
+	// The branch file itself changes on commit
+	if _, ref, err := r.readRef("HEAD"); err == nil {
+		if info, err := os.Stat(filepath.Join(r.commonDir, filepath.FromSlash(ref))); err == nil {
+			fmt.Fprintf(&b, "%d", info.ModTime().UnixNano())
+		}
+	}
+	return b.String()
+}
+
+// gitBadge is the status code shown on an object's tile, if the current directory is in a repository
+func (m model) gitBadge(obj FileSystemObject) string {
+	return renderGitBadge(m.gitCode(obj))
+}
+
+// gitCode is the git status of an object, empty when it's clean or outside a work tree
+func (m model) gitCode(obj FileSystemObject) gitFileStatus {
+	if m.git.status == nil || m.tree != nil {
+		return ""
+	}
+	return m.git.status.lookup(m.git.repo.workTree, obj.Path, obj.IsDir)
+}
+
+// gitLabel is the repository summary for the top bar
+func (m model) gitLabel() string {
+	if m.tree != nil {
+		return lipgloss.NewStyle().Foreground(borderColor).Render(m.tree.label())
+	}
+	if m.git.status == nil {
+		return ""
+	}
+	return lipgloss.NewStyle().Foreground(borderColor).Render(m.git.status.label()) + " "
+}
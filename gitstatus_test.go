@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGitStatusNamesStartingWithDots(t *testing.T) {
+	dir := gitTestRepo(t)
+	writeFile(t, dir, "..notes", "", time.Time{})
+	m := gitTestModel(t, dir)
+
+	if got := m.git.status.lookup(dir, filepath.Join(dir, "..notes"), false); got != "??" {
+		t.Errorf("..notes: %q, want ??", got)
+	}
+	if got := m.git.status.lookup(dir, filepath.Dir(dir), true); got != "" {
+		t.Errorf("the parent of the work tree: %q", got)
+	}
+}
+
+func TestGitStatusIgnoredDirectories(t *testing.T) {
+	dir := gitTestRepo(t)
+	writeFile(t, dir, ".gitignore", "*.log\n", time.Time{})
+	writeFile(t, dir, "logs/x.log", "", time.Time{})
+	writeFile(t, dir, "logs/sub/y.log", "", time.Time{})
+	writeFile(t, dir, "mixed/a.log", "", time.Time{})
+	writeFile(t, dir, "mixed/b", "", time.Time{})
+	writeFile(t, dir, "deep/a/z.log", "", time.Time{})
+	if err := os.MkdirAll(filepath.Join(dir, "empty", "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	m := gitTestModel(t, dir)
+
+	// As git status --porcelain --ignored lists them
+	for rel, want := range map[string]gitFileStatus{"logs": "!!", "deep": "!!", "mixed": "??", "empty": ""} {
+		if got := m.git.status.lookup(dir, filepath.Join(dir, rel), true); got != want {
+			t.Errorf("%s: %q, want %q", rel, got, want)
+		}
+	}
+	status := git(t, dir, "status", "--porcelain", "--ignored")
+	for _, line := range []string{"!! logs/", "!! deep/", "?? mixed/"} {
+		if !containsLine(strings.Split(status, "\n"), line) {
+			t.Errorf("git doesn't list %q:\n%s", line, status)
+		}
+	}
+}
+
+func TestGitStatusRenames(t *testing.T) {
+	dir := gitTestRepo(t)
+	writeFile(t, dir, "a", "moved as is\n", time.Time{})
+	writeFile(t, dir, "b", "moved and edited\n", time.Time{})
+	git(t, dir, "add", ".")
+	git(t, dir, "commit", "-q", "-m", "first")
+	git(t, dir, "mv", "a", "renamed")
+	git(t, dir, "mv", "b", "edited")
+	writeFile(t, dir, "edited", "something else entirely\n", time.Time{})
+	git(t, dir, "add", "edited")
+	m := gitTestModel(t, dir)
+
+	// An exact rename pairs up; the edited one is a deletion and an addition, as git has it too
+	for rel, want := range map[string]gitFileStatus{"renamed": "R ", "a": "", "edited": "A ", "b": "D "} {
+		if got := m.git.status.files[rel]; got != want {
+			t.Errorf("%s: %q, want %q", rel, got, want)
+		}
+	}
+	status := porcelain(t, dir)
+	for _, line := range []string{"R  a -> renamed", "A  edited", "D  b"} {
+		if !containsLine(strings.Split(status, "\n"), line) {
+			t.Errorf("git doesn't list %q:\n%s", line, status)
+		}
+	}
+}
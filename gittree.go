@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// treeBrowser shows the tree of a commit in place of the work tree it describes. Objects keep the
+// paths they would have in the work tree, so they can be compared with the files there.
+type treeBrowser struct {
+	repo       *gitRepo
+	rev        string    // What was asked for: "v1.2.0", "main~3"...
+	commit     gitHash   // The commit it resolved to
+	root       gitHash   // The commit's tree
+	time       time.Time // Commit time, the date shown on every object
+	returnPath string    // Directory to go back to when leaving
+
+	entries map[string]gitTreeEntry // Entries of every directory listed so far, by object path
+}
+
+// readOnlyActions are the normal-mode actions that make sense on a commit's tree
+var readOnlyActions = map[action]bool{
+	actionMoveLeft: true, actionMoveDown: true, actionMoveUp: true, actionMoveRight: true,
+	actionTop: true, actionBottom: true, actionOpen: true, actionParent: true,
+	actionFilter: true, actionHelp: true, actionQuit: true,
+	actionToggleSelect: true, actionSelectAll: true, actionClearSelection: true,
+	actionTogglePreview: true, actionGitDiff: true, actionGitLog: true,
+	actionGitBrowse: true, actionGitExtract: true, actionCycleSort: true, actionTreemap: true,
+	actionLayout: true, actionToggleNode: true, actionExpandAll: true,
+	actionNewTab: true, actionCloseTab: true, actionNextTab: true, actionPrevTab: true,
+	actionTab1: true, actionTab2: true, actionTab3: true, actionTab4: true, actionTab5: true,
+	actionTab6: true, actionTab7: true, actionTab8: true, actionTab9: true,
+	actionDualPane: true, actionSwitchPane: true, actionSyncPane: true,
+}
+
+// promptBrowse asks for a revision and shows its tree, or goes back to the work tree if one is shown
+func (m *model) promptBrowse() {
+	if m.tree != nil {
+		m.leaveTree()
+		return
+	}
+	if m.git.repo == nil {
+		m.status = "not in a git repository"
+		return
+	}
+	m.openPrompt("Browse revision", "HEAD", func(m *model, rev string) tea.Cmd {
+		m.enterTree(rev)
+		return nil
+	})
+}
+
+// enterTree switches the grid to a revision's tree, at the directory we are in if the commit has it
+func (m *model) enterTree(rev string) {
+	repo := m.git.repo
+	commit, err := repo.resolveRevision(rev)
+	if err != nil {
+		m.status = err.Error()
+		return
+	}
+	c, err := repo.readCommit(commit)
+	if err != nil {
+		m.status = err.Error()
+		return
+	}
+
+	m.tree = &treeBrowser{
+		repo:       repo,
+		rev:        rev,
+		commit:     commit,
+		root:       c.tree,
+		time:       time.Unix(c.time, 0),
+		returnPath: m.state.currentPath,
+	}
+	if _, err := repo.treeAt(c.tree, m.tree.rel(m.state.currentPath)); err != nil {
+		m.state.currentPath = repo.workTree
+	}
+	m.preview, m.previewPath = nil, ""
+	m.openCurrentPath()
+}
+
+// leaveTree goes back to the work tree, staying in the same directory if it exists on disk
+func (m *model) leaveTree() {
+	if info, err := os.Stat(m.state.currentPath); err != nil || !info.IsDir() {
+		m.state.currentPath = m.tree.returnPath
+	}
+	m.tree = nil
+	m.preview, m.previewPath = nil, ""
+	m.openCurrentPath()
+}
+
+// rel turns an object path into a path inside the commit ("" for the top)
+func (t *treeBrowser) rel(path string) string {
+	rel, err := filepath.Rel(t.repo.workTree, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// atRoot reports whether the top of the commit is on screen
+func (t *treeBrowser) atRoot(path string) bool {
+	return t.rel(path) == ""
+}
+
+// list reads a directory of the commit as objects
+func (t *treeBrowser) list(path string) ([]FileSystemObject, error) {
+	h, err := t.repo.treeAt(t.root, t.rel(path))
+	if err != nil {
+		return nil, err
+	}
+	entries, err := t.repo.readTree(h)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.entries == nil {
+		t.entries = make(map[string]gitTreeEntry, len(entries))
+	}
+	objects := make([]FileSystemObject, 0, len(entries))
+	for _, entry := range entries {
+		obj := FileSystemObject{
+			Name:    entry.name,
+			Path:    filepath.Join(path, entry.name),
+			ModTime: t.time,
+			Loaded:  true,
+		}
+		switch entry.mode {
+		case 0o40000:
+			obj.IsDir, obj.Mode = true, fs.ModeDir|0o755
+		case 0o100755:
+			obj.Mode = 0o755
+		case 0o120000:
+			obj.Mode = fs.ModeSymlink | 0o777
+			if blob, err := t.repo.readObject(entry.hash); err == nil {
+				obj.LinkTarget = string(blob.data)
+			}
+		case 0o160000:
+			obj.Mode = fs.ModeIrregular // A submodule: its content lives in another repository
+		default:
+			obj.Mode = 0o644
+		}
+		if !obj.IsDir && entry.mode != 0o160000 {
+			obj.Size, _ = t.repo.objectSize(entry.hash)
+		}
+		t.entries[obj.Path] = entry
+		objects = append(objects, obj)
+	}
+	slices.SortFunc(objects, compareObjects)
+	return objects, nil
+}
+
+// breadcrumb is the top bar path: the revision, then the directories inside it
+func (t *treeBrowser) breadcrumb(path string, maxWidth int) string {
+	s := state{currentPath: "/@" + t.rev}
+	if rel := t.rel(path); rel != "" {
+		s.currentPath += "/" + rel
+	}
+	// Drop the root slash: the revision is the root here
+	return " " + strings.TrimPrefix(s.currentPathBreadcrumb(maxWidth+2), " / ")
+}
+
+// breadcrumb is the top bar path, inside the commit when one is browsed
+func (m model) breadcrumb(maxWidth int) string {
+	if m.tree != nil {
+		return m.tree.breadcrumb(m.state.currentPath, maxWidth)
+	}
+	if m.dupes != nil {
+		const suffix = " / ⧉ duplicates"
+		return m.state.currentPathBreadcrumb(maxWidth-len([]rune(suffix))) + suffix
+	}
+	if m.verify != nil {
+		suffix := " / ✓ " + filepath.Base(m.verify.manifest)
+		return m.state.currentPathBreadcrumb(maxWidth-len([]rune(suffix))) + suffix
+	}
+	return m.state.currentPathBreadcrumb(maxWidth)
+}
+
+// label is the top bar note saying which commit is shown
+func (t *treeBrowser) label() string {
+	return fmt.Sprintf("read-only %s %s ", t.commit.String()[:7], t.time.Format("2006-01-02"))
+}
+
+// buildPreview shows a blob or a subtree of the commit
+func (t *treeBrowser) buildPreview(obj FileSystemObject, entry gitTreeEntry) preview {
+	p := preview{path: obj.Path, modTime: obj.ModTime, title: obj.Name}
+
+	switch entry.mode {
+	case 0o40000:
+		entries, err := t.repo.readTree(entry.hash)
+		if err != nil {
+			p.summary = err.Error()
+			return p
+		}
+		p.summary = fmt.Sprintf("%d entries", len(entries))
+		for _, e := range entries[:min(len(entries), PREVIEW_MAX_LINES)] {
+			if e.mode == 0o40000 {
+				p.lines = append(p.lines, e.name+"/")
+			} else {
+				p.lines = append(p.lines, e.name)
+			}
+		}
+		return p
+	case 0o160000:
+		p.summary = "submodule at " + entry.hash.String()[:7]
+		return p
+	case 0o120000:
+		p.summary = "link to " + obj.LinkTarget
+		return p
+	}
+
+	blob, err := t.repo.readObject(entry.hash)
+	if err != nil {
+		p.summary = err.Error()
+		return p
+	}
+	head := blob.data[:min(len(blob.data), SNIFF_HEAD_SIZE)]
+	kind := sniffType(head, obj.Name, len(blob.data) > len(head))
+	p.summary = strings.TrimSpace(kind.Description + ", " + formatSize(int64(len(blob.data))))
+
+	switch {
+	case kind.Text:
+		p.lines = textLines(bytes.NewReader(blob.data))
+	case strings.HasPrefix(kind.MIME, "image/"):
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(blob.data)); err == nil {
+			p.summary += fmt.Sprintf(", %d×%d", cfg.Width, cfg.Height)
+		}
+	default:
+		p.lines = hexLines(blob.data[:min(len(blob.data), 512)])
+	}
+	return p
+}
+
+// openBlob writes a file of the commit to a temporary directory and opens that copy
+func (m *model) openBlob(obj FileSystemObject) tea.Cmd {
+	entry, ok := m.tree.entries[obj.Path]
+	if !ok {
+		return nil
+	}
+	if entry.mode == 0o160000 || entry.mode == 0o120000 {
+		m.status = obj.Name + " can't be opened from a commit"
+		return nil
+	}
+	dir := filepath.Join(os.TempDir(), "cdx-"+m.tree.commit.String()[:12])
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		m.status = err.Error()
+		return nil
+	}
+	path := filepath.Join(dir, obj.Name)
+	if _, err := os.Stat(path); err != nil {
+		if _, errs := m.tree.repo.extract(entry, dir); len(errs) > 0 {
+			m.status = errs[0].err.Error()
+			return nil
+		}
+	}
+	return m.openFile(path)
+}
+
+// promptExtract asks where to write the targets of the commit, the directory we came from by default
+func (m *model) promptExtract() {
+	if m.tree == nil {
+		m.status = "extracting works on a commit's tree (browse one first)"
+		return
+	}
+	var entries []gitTreeEntry
+	for _, obj := range m.targets() {
+		if entry, ok := m.tree.entries[obj.Path]; ok {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		m.status = "nothing to extract"
+		return
+	}
+
+	repo, rev := m.tree.repo, m.tree.rev
+	m.openPrompt("Extract to", m.tree.returnPath, func(m *model, dir string) tea.Cmd {
+		if dir == "~" || strings.HasPrefix(dir, "~/") {
+			dir = filepath.Join(getHomeDir(), dir[1:])
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			m.status = dir + " is not a directory"
+			return nil
+		}
+		return func() tea.Msg {
+			result := opResultMsg{verb: "extract from " + rev}
+			for _, entry := range entries {
+				done, failures := repo.extract(entry, dir)
+				result.done += done
+				result.failures = append(result.failures, failures...)
+			}
+			return result
+		}
+	})
+}
+
+// extract writes a tree entry into a directory: files with their executable bit, symlinks as
+// symlinks and directories recursively. Existing files are never overwritten.
+func (r *gitRepo) extract(entry gitTreeEntry, dir string) (int, []pathError) {
+	path := filepath.Join(dir, entry.name)
+
+	switch entry.mode {
+	case 0o40000:
+		if err := os.Mkdir(path, 0o755); err != nil && !errors.Is(err, fs.ErrExist) {
+			return 0, []pathError{{path, err}}
+		}
+		entries, err := r.readTree(entry.hash)
+		if err != nil {
+			return 0, []pathError{{path, err}}
+		}
+		done, failures := 0, []pathError(nil)
+		for _, child := range entries {
+			n, errs := r.extract(child, path)
+			done += n
+			failures = append(failures, errs...)
+		}
+		return done, failures
+	case 0o160000:
+		// Submodules come out as the empty directory git checks out without --recurse-submodules
+		if err := os.Mkdir(path, 0o755); err != nil && !errors.Is(err, fs.ErrExist) {
+			return 0, []pathError{{path, err}}
+		}
+		return 0, nil
+	}
+
+	blob, err := r.readObject(entry.hash)
+	if err != nil {
+		return 0, []pathError{{path, err}}
+	}
+	if entry.mode == 0o120000 {
+		err = os.Symlink(string(blob.data), path)
+	} else {
+		perm := fs.FileMode(0o644)
+		if entry.mode == 0o100755 {
+			perm = 0o755
+		}
+		var f *os.File
+		if f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm); err == nil {
+			_, err = f.Write(blob.data)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	if err != nil {
+		return 0, []pathError{{path, err}}
+	}
+	return 1, nil
+}
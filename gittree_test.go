@@ -0,0 +1,23 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestTreeBrowserRel(t *testing.T) {
+	dir := tempDir(t)
+	tb := &treeBrowser{repo: &gitRepo{workTree: dir}}
+	for path, want := range map[string]string{
+		dir:                                    "",
+		filepath.Join(dir, "..notes"):          "..notes",
+		filepath.Join(dir, "sub", "..", "sub"): "sub",
+		filepath.Join(dir, "sub", "file"):      "sub/file",
+		filepath.Dir(dir):                      "",
+		filepath.Join(filepath.Dir(dir), "x"):  "",
+	} {
+		if got := tb.rel(path); got != want {
+			t.Errorf("%s: %q, want %q", path, got, want)
+		}
+	}
+}
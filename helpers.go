@@ -2,8 +2,11 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
 
@@ -29,34 +32,59 @@ func formatSize(bytes int64) string {
 
 // renderFileTile returns a vertical, multi-line string that represents one file or directory.
 // This includes name, modified date, size (or "-"), and vertical padding for layout balance.
-func renderFileTile(obj FileSystemObject, width int) string {
+// nameStyle colors the name line, typically according to the object type; marked objects get a check mark.
+// badge describes the content (e.g. "PNG image") once it has been detected; gitBadge is the object's
+// git status code, already colored.
+func renderFileTile(obj FileSystemObject, width int, nameStyle lipgloss.Style, marked bool, badge, gitBadge, dirSize, bar string) string {
 	date := obj.ModTime.Format("2006-01-02") // Fixed format for consistency
 
-	// Files show human-readable size; directories use "-"
+	// Files show human-readable size; directories use "-" unless disk usage mode measured them
 	size := "-"
 	if !obj.IsDir {
 		size = formatSize(obj.Size)
+	} else if dirSize != "" {
+		size = dirSize
+	}
+	if !obj.Loaded {
+		date, size = "", "…" // Not stat'ed yet
 	}
 
 	// Align date and size at opposite ends of the line
 	infoLine := spaceBetween([]string{date, size}, width)
 
-	// Label as [D] for directory, [F] for file
-	namePrefix := "F"
-	if obj.IsDir {
-		namePrefix = "D"
-	}
+	// Label with the object type: [D] directory, [F] file, [L] link, [X] executable...
+	namePrefix := obj.Marker()
 
 	// Combine prefix and name; truncate with ellipsis if it doesn't fit
-	name := truncateCenter(fmt.Sprintf("[%s] %s", namePrefix, obj.Name), width)
+	name := nameStyle.Render(truncateCenter(fmt.Sprintf("[%s] %s", namePrefix, obj.Name), width))
+
+	// Symlinks use the middle spacer to show where they point; dangling ones are flagged.
+	// Other files show what their content is there.
+	midLine := ""
+	if obj.IsSymlink() {
+		arrow := "→ "
+		if obj.BrokenLink {
+			arrow = "✗ "
+		}
+		midLine = nameStyle.Render(truncateCenter(arrow+obj.LinkTarget, width))
+	} else if badge != "" {
+		midLine = styleBadge.Render(truncateCenter(badge, width))
+	}
+
+	// The git status goes in the top left corner; marked objects show a check mark in the top right one
+	mark := ""
+	if marked {
+		mark = "✓"
+	}
+	topLine := spaceBetween([]string{gitBadge, mark}, width)
 
 	// Final tile: top/bottom padding, name, spacer, and info
 	return lipgloss.JoinVertical(lipgloss.Top,
-		"",       // Top spacer
+		topLine,  // Top spacer (or mark)
 		name,     // Name line
-		"",       // Mid spacer
+		midLine,  // Mid spacer (or link target)
 		infoLine, // Info (date + size)
-		"",       // Bottom spacer
+		bar,      // Bottom spacer (or disk usage bar)
 	)
 }
 
@@ -75,37 +103,279 @@ func truncateCenter(s string, width int) string {
 }
 
 // openCurrentPath resets the grid view when entering a new directory.
-// It reinitializes the cursor, scroll offset, and reloads the file list.
+// It reinitializes the cursor and scroll offset, and drops the old listing so syncLoader
+// starts reading the new directory in the background.
 func (m *model) openCurrentPath() {
 	if m.state.currentPath == "" {
 		m.state.currentPath = "/" // Normalize empty path as root
 	}
 
-	// Reset viewport and cursor position
+	// Reset viewport, cursor position and any filter from the previous directory
 	m.state.coordinateIdx = [2]int{0, 0}
 	m.state.viewportRowOffset = 0
+	m.state.filter = ""
+	m.clearSelection()
+	m.dropListing()
+}
+
+// dropListing forgets the objects on screen so syncLoader reads the current directory afresh
+func (m *model) dropListing() {
+	// Abandon whatever was still loading; the new directory's contents stream in from syncLoader
+	if m.loader != nil {
+		m.loader.stop()
+		m.loader = nil
+	}
+	m.listing = nil
+	m.objects = nil
+	m.listingPath = ""
+	m.pendingFocus = ""
+	m.refreshing = false
+	m.millerParent.path = "" // The same path may now be a commit's tree, or the disk again
+	m.children = nil         // Expanded directories are read again, as they are now
+	m.childLoads = nil
+}
+
+// refreshListing re-reads the current directory without moving the cursor or dropping the filter.
+// The directory is read in the background by the returned command; while it is still loading,
+// the refresh is deferred until loading is done. Names focused meanwhile wait for the new listing.
+func (m *model) refreshListing() tea.Cmd {
+	m.millerParent.path = "" // Read the parent again too, once syncMiller gets to it
+	if m.tree != nil {
+		return nil // Commits don't change
+	}
+	m.reloadChildren() // And the expanded directories of the tree
+	if m.dupes != nil {
+		// Copies removed or linked together meanwhile are no longer duplicates
+		m.dupes.prune()
+		listing, err := m.dupes.list(m.state.currentPath)
+		m.applyListing(listing, err)
+		return nil
+	}
+	if m.verify != nil {
+		listing, err := m.verify.list(m.state.currentPath)
+		m.applyListing(listing, err)
+		return nil
+	}
+	m.refreshing = true
+	if m.loading() {
+		m.loader.stale = true
+		return nil
+	}
+	return refreshCmd(m.state.currentPath)
+}
+
+// showRefreshed applies a listing re-read in the background, if it is still the current directory's,
+// and focuses the name that was waiting for it
+func (m *model) showRefreshed(msg listingRefreshedMsg) {
+	if msg.path != m.state.currentPath || m.loading() {
+		return // Left meanwhile, or loading again; the loader has the newer contents
+	}
+	m.refreshing = false
+	m.applyListing(msg.listing, msg.err)
+	if name := m.pendingFocus; name != "" {
+		m.focusName(name)
+	}
+}
 
-	// Fetch directory contents
-	m.objects = listObjects(m.state.currentPath)
+// applyListing replaces the listing with a freshly read one. Marks on objects that no longer
+// exist are forgotten, and the cursor stays on the same object.
+func (m *model) applyListing(listing []FileSystemObject, err error) {
+	if err != nil {
+		if _, statErr := os.Stat(m.state.currentPath); statErr == nil {
+			m.status = err.Error()
+			return
+		}
+
+		// The directory itself was removed or renamed away: fall back to the nearest ancestor
+		gone := m.state.currentPath
+		for m.state.currentPath != filepath.Dir(m.state.currentPath) {
+			m.state.currentPath = filepath.Dir(m.state.currentPath)
+			if info, err := os.Stat(m.state.currentPath); err == nil && info.IsDir() {
+				break
+			}
+		}
+		m.openCurrentPath()
+		m.status = filepath.Base(gone) + " no longer exists"
+		return
+	}
+
+	if sameListing(m.listing, listing) {
+		return // Nothing visible changed; leave the cursor and viewport alone
+	}
+
+	m.keepFocus(true, func() {
+		m.listing = listing
+		m.applyFilter()
+	})
+
+	for path := range m.state.selected {
+		if _, err := os.Lstat(path); err != nil {
+			delete(m.state.selected, path)
+		}
+	}
+}
+
+// keepFocus runs update and then puts the cursor back on the object it was on, if follow is
+// set and the object is still visible. FocusIndex only scrolls when the object left the
+// viewport, so the view doesn't jump. If the object is gone, the cursor keeps its index,
+// which Update clamps to the end of the list.
+func (m *model) keepFocus(follow bool, update func()) {
+	var focused string
+	if idx := m.selectedIndex(); follow && idx >= 0 && idx < len(m.objects) {
+		focused = m.objects[idx].Path
+	}
+
+	update()
+
+	if focused == "" {
+		return
+	}
+	for i, obj := range m.objects {
+		if obj.Path == focused {
+			m.state.FocusIndex(i, m.rows, m.cols)
+			return
+		}
+	}
+}
+
+// sameListing reports whether two listings would render identically
+func sameListing(a, b []FileSystemObject) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Path != b[i].Path || a[i].Size != b[i].Size || !a[i].ModTime.Equal(b[i].ModTime) ||
+			a[i].Mode != b[i].Mode || a[i].Owner != b[i].Owner || a[i].LinkTarget != b[i].LinkTarget || a[i].BrokenLink != b[i].BrokenLink {
+			return false
+		}
+	}
+	return true
+}
+
+// applyFilter rebuilds the visible object list from the full listing using the current filter
+func (m *model) applyFilter() {
+	if m.treeShown() {
+		m.objects = m.treeLevel(m.listing, 0)
+		return
+	}
+	if m.state.filter == "" {
+		m.objects = m.listing
+		m.sortObjects()
+		return
+	}
+
+	needle := strings.ToLower(m.state.filter)
+	m.objects = nil
+	for _, obj := range m.listing {
+		if strings.Contains(strings.ToLower(obj.Name), needle) {
+			m.objects = append(m.objects, obj)
+		}
+	}
+	m.sortObjects()
+}
+
+// onScreen returns the objects currently drawn: the visible rows of the grid, or every object
+// with a rectangle in the treemap
+func (m model) onScreen() []FileSystemObject {
+	if m.treemapOn {
+		var objects []FileSystemObject
+		for _, r := range m.treemapLayout() {
+			objects = append(objects, m.objects[r.idx])
+		}
+		return objects
+	}
+	first := m.state.viewportRowOffset * m.cols
+	last := min(first+m.rows*m.cols, len(m.objects))
+	return m.objects[min(first, last):last]
+}
+
+// selectedIndex returns the index in m.objects of the tile under the cursor.
+// The result may be past the end of the list when the cursor sits on an empty cell.
+func (m model) selectedIndex() int {
+	return (m.state.viewportRowOffset+m.state.coordinateIdx[0])*m.cols + m.state.coordinateIdx[1]
 }
 
 // handleSelection determines the action when the user presses Enter:
-// If the item is a directory, enter it; if it's a file, open it using the OS.
-func (m *model) handleSelection() {
-	idx := (m.state.viewportRowOffset+m.state.coordinateIdx[0])*m.cols + m.state.coordinateIdx[1]
+// If the item is a directory, enter it; if it's a file, open it with its opener.
+func (m *model) handleSelection() tea.Cmd {
+	idx := m.selectedIndex()
 
-	if idx >= len(m.objects) {
-		return // Invalid index (likely empty space), do nothing
+	if idx < 0 || idx >= len(m.objects) || isLoadingNode(m.objects[idx]) {
+		return nil // Invalid index (likely empty space), or a directory still being read: do nothing
 	}
 
 	obj := m.objects[idx]
-	if obj.IsDir {
-		// Change into directory and refresh view
+	if !obj.Loaded {
+		obj.load() // Still streaming in: we need to know what it is before opening it
+	}
+	switch {
+	case obj.BrokenLink:
+		m.status = fmt.Sprintf("%s is a broken link to %s", obj.Name, obj.LinkTarget)
+	case obj.IsDir:
+		// Change into directory and refresh view. Symlinked directories keep the
+		// link's path, like cd does; followLink jumps to the real location instead.
 		m.state.currentPath = obj.Path
 		m.openCurrentPath()
-	} else {
-		// Open the file in the system default app
-		OpenFile(obj.Path)
+	case m.tree != nil:
+		// Files of a commit only exist in the object database
+		return m.openBlob(obj)
+	case m.verify == nil && isManifest(obj.Name):
+		// A list of checksums can be checked right away
+		return m.offerVerify(obj)
+	case !obj.Mode.IsRegular() && !obj.IsSymlink():
+		// Pipes, sockets and devices would block or confuse a regular opener
+		m.status = fmt.Sprintf("%s is not a regular file", obj.Name)
+	default:
+		// Open the file with the first matching opener rule (the system default app unless configured)
+		return m.openFile(obj.Path)
+	}
+	return nil
+}
+
+// followLink navigates to the real location behind the selected symlink.
+// For a directory it enters the resolved path; for a file it opens the directory
+// holding the target and puts the cursor on it.
+func (m *model) followLink() {
+	idx := m.selectedIndex()
+	if idx < 0 || idx >= len(m.objects) {
+		return
+	}
+
+	obj := m.objects[idx]
+	if !obj.IsSymlink() {
+		m.status = fmt.Sprintf("%s is not a symlink", obj.Name)
+		return
+	}
+
+	real, err := filepath.EvalSymlinks(obj.Path)
+	if err != nil {
+		m.status = fmt.Sprintf("%s is a broken link to %s", obj.Name, obj.LinkTarget)
+		return
+	}
+
+	if obj.IsDir {
+		m.state.currentPath = real
+		m.openCurrentPath()
+		return
+	}
+
+	m.state.currentPath = filepath.Dir(real)
+	m.openCurrentPath()
+	m.focusName(filepath.Base(real))
+}
+
+// focusName moves the cursor to the visible object with the given name, if there is one.
+// While the directory is loading or being refreshed, a name that hasn't arrived yet is focused when it does.
+func (m *model) focusName(name string) {
+	m.pendingFocus = ""
+	for i, obj := range m.objects {
+		if obj.Name == name && m.nodeDepth(obj) == 0 {
+			m.state.FocusIndex(i, m.rows, m.cols)
+			return
+		}
+	}
+	if m.loading() || m.refreshing {
+		m.pendingFocus = name
 	}
 }
 
@@ -203,3 +473,22 @@ func spaceBetween(items []string, totalWidth int) string {
 	}
 	return builder.String()
 }
+
+// columnize flows lines top-to-bottom into as many side-by-side columns as needed
+// so that no column is taller than height. Used for overlays that may outgrow the screen.
+func columnize(lines []string, height int) string {
+	if height < 1 {
+		height = 1
+	}
+
+	var columns []string
+	for start := 0; start < len(lines); start += height {
+		end := start + height
+		if end > len(lines) {
+			end = len(lines)
+		}
+		// Pad each column on the right so neighbouring columns don't touch
+		columns = append(columns, lipgloss.NewStyle().PaddingRight(2).Render(strings.Join(lines[start:end], "\n")))
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Top, columns...)
+}
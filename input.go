@@ -0,0 +1,135 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+	lipgloss "github.com/charmbracelet/lipgloss"
+)
+
+// styleCursor renders the character under the text cursor in reverse video
+var styleCursor = lipgloss.NewStyle().Reverse(true)
+
+// textInput is a minimal single-line editor used by the filter and prompt modes
+type textInput struct {
+	value  []rune // Current text
+	cursor int    // Insertion point, 0..len(value)
+}
+
+// newTextInput returns an input pre-filled with value and the cursor at the end
+func newTextInput(value string) textInput {
+	runes := []rune(value)
+	return textInput{value: runes, cursor: len(runes)}
+}
+
+// Value returns the current text
+func (t textInput) Value() string {
+	return string(t.value)
+}
+
+// handleKey applies an editing key to the input and reports whether the text changed.
+// Keys it doesn't understand are ignored.
+func (t *textInput) handleKey(msg tea.KeyMsg) bool {
+	switch msg.Type {
+	case tea.KeyRunes, tea.KeySpace:
+		// Insert typed (or pasted) characters at the cursor
+		runes := msg.Runes
+		if msg.Type == tea.KeySpace {
+			runes = []rune{' '}
+		}
+		t.value = append(t.value[:t.cursor], append(runes, t.value[t.cursor:]...)...)
+		t.cursor += len(runes)
+		return true
+	case tea.KeyBackspace:
+		if t.cursor == 0 {
+			return false
+		}
+		t.value = append(t.value[:t.cursor-1], t.value[t.cursor:]...)
+		t.cursor -= 1
+		return true
+	case tea.KeyDelete:
+		if t.cursor >= len(t.value) {
+			return false
+		}
+		t.value = append(t.value[:t.cursor], t.value[t.cursor+1:]...)
+		return true
+	case tea.KeyLeft:
+		if t.cursor > 0 {
+			t.cursor -= 1
+		}
+	case tea.KeyRight:
+		if t.cursor < len(t.value) {
+			t.cursor += 1
+		}
+	case tea.KeyHome, tea.KeyCtrlA:
+		t.cursor = 0
+	case tea.KeyEnd, tea.KeyCtrlE:
+		t.cursor = len(t.value)
+	case tea.KeyCtrlU:
+		// Delete everything before the cursor
+		changed := t.cursor > 0
+		t.value = t.value[t.cursor:]
+		t.cursor = 0
+		return changed
+	case tea.KeyCtrlW:
+		// Delete the word before the cursor, skipping trailing spaces first
+		start := t.cursor
+		for start > 0 && unicode.IsSpace(t.value[start-1]) {
+			start -= 1
+		}
+		for start > 0 && !unicode.IsSpace(t.value[start-1]) && t.value[start-1] != '/' {
+			start -= 1
+		}
+		if start == t.cursor && start > 0 {
+			start -= 1 // Nothing but a separator before the cursor: drop it
+		}
+		changed := start != t.cursor
+		t.value = append(t.value[:start], t.value[t.cursor:]...)
+		t.cursor = start
+		return changed
+	}
+	return false
+}
+
+// View renders the text with the cursor shown as a reversed character
+func (t textInput) View() string {
+	before := string(t.value[:t.cursor])
+	if t.cursor >= len(t.value) {
+		return before + styleCursor.Render(" ")
+	}
+	return before + styleCursor.Render(string(t.value[t.cursor])) + string(t.value[t.cursor+1:])
+}
+
+// prompt asks the user for a line of text and hands the answer to onSubmit
+type prompt struct {
+	label    string                               // Question shown before the input, e.g. "Go to"
+	input    textInput                            // The answer being typed
+	onSubmit func(m *model, value string) tea.Cmd // Called with the final answer when confirmed
+}
+
+// openPrompt switches to prompt mode with the given question and initial answer
+func (m *model) openPrompt(label, value string, onSubmit func(m *model, value string) tea.Cmd) {
+	m.prompt = &prompt{
+		label:    label,
+		input:    newTextInput(value),
+		onSubmit: onSubmit,
+	}
+	m.mode = modePrompt
+}
+
+// closePrompt leaves prompt mode without running the callback
+func (m *model) closePrompt() {
+	m.prompt = nil
+	m.mode = modeNormal
+}
+
+// submitPrompt leaves prompt mode and runs the callback with the typed answer
+func (m *model) submitPrompt() tea.Cmd {
+	p := m.prompt
+	m.closePrompt()
+	if p == nil || p.onSubmit == nil {
+		return nil
+	}
+	return p.onSubmit(m, strings.TrimSpace(p.input.Value()))
+}
@@ -0,0 +1,599 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// action names a command the user can trigger; keys are bound to actions, never to code directly
+type action string
+
+// Actions understood by the dispatcher in runAction
+const (
+	actionMoveLeft       action = "move-left"
+	actionMoveDown       action = "move-down"
+	actionMoveUp         action = "move-up"
+	actionMoveRight      action = "move-right"
+	actionTop            action = "top"
+	actionBottom         action = "bottom"
+	actionOpen           action = "open"
+	actionParent         action = "parent"
+	actionFollowLink     action = "follow-link"
+	actionGoto           action = "goto"
+	actionInfo           action = "info"
+	actionFilter         action = "filter"
+	actionFilterAccept   action = "filter-accept"
+	actionFilterCancel   action = "filter-cancel"
+	actionPromptSubmit   action = "prompt-submit"
+	actionPromptCancel   action = "prompt-cancel"
+	actionToggleSelect   action = "toggle-select"
+	actionSelectAll      action = "select-all"
+	actionClearSelection action = "clear-selection"
+	actionChmod          action = "chmod"
+	actionChmodRecursive action = "chmod-recursive"
+	actionChmodGrid      action = "chmod-grid"
+	actionChown          action = "chown"
+	actionChgrp          action = "chgrp"
+	actionPermToggle     action = "perm-toggle"
+	actionPermRecursive  action = "perm-recursive"
+	actionCreateFile     action = "create-file"
+	actionCreateDir      action = "create-dir"
+	actionYank           action = "yank"
+	actionLinkSymbolic   action = "link-symbolic"
+	actionLinkRelative   action = "link-relative"
+	actionLinkHard       action = "link-hard"
+	actionOpenWith       action = "open-with"
+	actionMenuDefault    action = "menu-default"
+	actionTogglePreview  action = "toggle-preview"
+	actionGitStage       action = "git-stage"
+	actionGitUnstage     action = "git-unstage"
+	actionGitDiscard     action = "git-discard"
+	actionGitDiff        action = "git-diff"
+	actionGitLog         action = "git-log"
+	actionGitBrowse      action = "git-browse"
+	actionGitExtract     action = "git-extract"
+	actionDiskUsage      action = "disk-usage"
+	actionRescanUsage    action = "rescan-usage"
+	actionCycleSort      action = "sort"
+	actionTreemap        action = "treemap"
+	actionFindDupes      action = "find-dupes"
+	actionMarkDupes      action = "mark-dupes"
+	actionResolveDupes   action = "resolve-dupes"
+	actionChecksums      action = "checksums"
+	actionCompress       action = "compress"
+	actionExtract        action = "extract"
+	actionLayout         action = "layout"
+	actionColumnPrev     action = "column-prev"
+	actionColumnNext     action = "column-next"
+	actionColumnNarrow   action = "column-narrow"
+	actionColumnWiden    action = "column-widen"
+	actionColumnSort     action = "column-sort"
+	actionColumns        action = "columns"
+	actionToggleNode     action = "toggle-node"
+	actionExpandAll      action = "expand-all"
+	actionTrashNode      action = "trash-node"
+	actionNewTab         action = "new-tab"
+	actionCloseTab       action = "close-tab"
+	actionNextTab        action = "next-tab"
+	actionPrevTab        action = "prev-tab"
+	actionTab1           action = "tab-1"
+	actionTab2           action = "tab-2"
+	actionTab3           action = "tab-3"
+	actionTab4           action = "tab-4"
+	actionTab5           action = "tab-5"
+	actionTab6           action = "tab-6"
+	actionTab7           action = "tab-7"
+	actionTab8           action = "tab-8"
+	actionTab9           action = "tab-9"
+	actionCopy           action = "copy"
+	actionMove           action = "move"
+	actionDualPane       action = "dual-pane"
+	actionSwitchPane     action = "switch-pane"
+	actionSyncPane       action = "sync-pane"
+	actionCompare        action = "compare"
+	actionSync           action = "sync"
+	actionHelp           action = "help"
+	actionQuit           action = "quit"
+)
+
+// mode selects which keymap is active; text entry modes leave unbound keys to the input line
+type mode int
+
+const (
+	modeNormal mode = iota // Grid navigation
+	modeFilter             // Typing a filter for the current listing
+	modePrompt             // Typing an answer to a prompt (path, name, ...)
+	modePerms              // Toggling permission bits in the chmod grid
+	modeMenu               // Picking an entry from a menu (open with, ...)
+)
+
+// modeNames maps each mode to the name used for it in the config file
+var modeNames = map[mode]string{
+	modeNormal: "normal",
+	modeFilter: "filter",
+	modePrompt: "prompt",
+	modePerms:  "perms",
+	modeMenu:   "menu",
+}
+
+// modeOrder lists the modes in the order the help overlay shows them
+var modeOrder = []mode{modeNormal, modeFilter, modePrompt, modePerms, modeMenu}
+
+// String returns the config name of the mode
+func (md mode) String() string {
+	return modeNames[md]
+}
+
+// actionDescriptions documents every action; it doubles as the list of valid action names
+var actionDescriptions = map[action]string{
+	actionMoveLeft:       "move left",
+	actionMoveDown:       "move down",
+	actionMoveUp:         "move up",
+	actionMoveRight:      "move right",
+	actionTop:            "jump to first entry",
+	actionBottom:         "jump to last entry",
+	actionOpen:           "open/navigate",
+	actionParent:         "up",
+	actionFollowLink:     "go to the real location of a symlink",
+	actionGoto:           "go to path",
+	actionInfo:           "show file details",
+	actionFilter:         "filter",
+	actionFilterAccept:   "accept filter",
+	actionFilterCancel:   "clear filter",
+	actionPromptSubmit:   "confirm",
+	actionPromptCancel:   "cancel",
+	actionToggleSelect:   "mark/unmark the object under the cursor",
+	actionSelectAll:      "mark/unmark every visible object",
+	actionClearSelection: "unmark everything",
+	actionChmod:          "change permissions (octal or symbolic)",
+	actionChmodRecursive: "change permissions recursively (dirs:files)",
+	actionChmodGrid:      "toggle permission bits in a grid",
+	actionChown:          "change owner",
+	actionChgrp:          "change group",
+	actionPermToggle:     "toggle the permission bit under the cursor",
+	actionPermRecursive:  "toggle applying permissions recursively",
+	actionCreateFile:     "create a file (trailing / for a directory)",
+	actionCreateDir:      "create a directory",
+	actionYank:           "yank the marked objects (or the one under the cursor)",
+	actionLinkSymbolic:   "symlink the yanked objects here",
+	actionLinkRelative:   "relative symlink the yanked objects here",
+	actionLinkHard:       "hard link the yanked objects here",
+	actionOpenWith:       "choose an application to open the targets with",
+	actionMenuDefault:    "make the chosen application the default for the file type",
+	actionTogglePreview:  "show or hide the preview pane",
+	actionGitStage:       "stage the targets in git",
+	actionGitUnstage:     "unstage the targets",
+	actionGitDiscard:     "discard unstaged changes to the targets (asks first)",
+	actionGitDiff:        "show git diffs in the preview pane",
+	actionGitLog:         "show the git history of the object under the cursor",
+	actionGitBrowse:      "browse the tree of a commit, branch or tag read-only (again to leave)",
+	actionGitExtract:     "write the targets of the browsed commit to a directory",
+	actionDiskUsage:      "toggle disk usage mode: recursive sizes and shares on directory tiles",
+	actionRescanUsage:    "measure the sizes below the current directory again",
+	actionCycleSort:      "cycle the sort order (name, size)",
+	actionTreemap:        "toggle the treemap of disk usage in place of the grid",
+	actionFindDupes:      "find duplicate files below the current directory (again to leave or cancel)",
+	actionMarkDupes:      "mark every duplicate but one per group (newest, oldest or in a path)",
+	actionResolveDupes:   "trash the marked duplicates or hard link them to the kept copy",
+	actionChecksums:      "compute checksums of the targets or write a SHA256SUMS manifest (again to cancel)",
+	actionCompress:       "pack the targets into a zip, tar, tar.gz or tar.zst archive (again to cancel)",
+	actionExtract:        "unpack the targeted archives into folders named after them (again to cancel)",
+	actionLayout:         "switch layouts: grid, details list, Miller columns, tree",
+	actionColumnPrev:     "focus the previous column of the details header",
+	actionColumnNext:     "focus the next column of the details header",
+	actionColumnNarrow:   "make the focused details column narrower",
+	actionColumnWiden:    "make the focused details column wider",
+	actionColumnSort:     "sort on the focused details column (again to reverse)",
+	actionColumns:        "show or hide details columns",
+	actionToggleNode:     "expand or collapse the directory under the cursor (tree layout)",
+	actionExpandAll:      "expand every directory down to a depth (tree layout)",
+	actionTrashNode:      "move the object under the cursor to the trash, after asking (tree layout)",
+	actionNewTab:         "open a tab at the directory under the cursor",
+	actionCloseTab:       "close the current tab",
+	actionNextTab:        "switch to the next tab",
+	actionPrevTab:        "switch to the previous tab",
+	actionTab1:           "switch to tab 1",
+	actionTab2:           "switch to tab 2",
+	actionTab3:           "switch to tab 3",
+	actionTab4:           "switch to tab 4",
+	actionTab5:           "switch to tab 5",
+	actionTab6:           "switch to tab 6",
+	actionTab7:           "switch to tab 7",
+	actionTab8:           "switch to tab 8",
+	actionTab9:           "switch to tab 9",
+	actionCopy:           "copy the targets; the other pane is the destination offered",
+	actionMove:           "move the targets; the other pane is the destination offered",
+	actionDualPane:       "split into two panes, or back to one",
+	actionSwitchPane:     "move the focus to the other pane",
+	actionSyncPane:       "take the other pane to this directory",
+	actionCompare:        "compare the two panes recursively",
+	actionSync:           "copy or mirror what differs between the compared panes, after a dry run",
+	actionHelp:           "help",
+	actionQuit:           "quit",
+}
+
+// defaultBindings holds the built-in key sequences for each mode.
+// Sequences are written the same way as in the config file (see parseKeySequence).
+var defaultBindings = map[mode]map[action][]string{
+	modeNormal: {
+		actionMoveLeft:       {"h", "left"},
+		actionMoveDown:       {"j", "down"},
+		actionMoveUp:         {"k", "up"},
+		actionMoveRight:      {"l", "right"},
+		actionTop:            {"gg", "home"},
+		actionBottom:         {"G", "end"},
+		actionOpen:           {"enter"},
+		actionParent:         {"backspace"},
+		actionFollowLink:     {"gl"},
+		actionGoto:           {":"},
+		actionInfo:           {"i"},
+		actionFilter:         {"/"},
+		actionHelp:           {"?"},
+		actionQuit:           {"q", "ctrl+c"},
+		actionToggleSelect:   {"space"},
+		actionSelectAll:      {"V"},
+		actionClearSelection: {"esc"},
+		actionChmod:          {"cm"},
+		actionChmodRecursive: {"cr"},
+		actionChmodGrid:      {"cM"},
+		actionChown:          {"co"},
+		actionChgrp:          {"cg"},
+		actionCreateFile:     {"a"},
+		actionCreateDir:      {"A"},
+		actionYank:           {"yy"},
+		actionLinkSymbolic:   {"pl"},
+		actionLinkRelative:   {"pL"},
+		actionLinkHard:       {"ph"},
+		actionOpenWith:       {"o"},
+		actionTogglePreview:  {"P"},
+		actionGitStage:       {"ss"},
+		actionGitUnstage:     {"su"},
+		actionGitDiscard:     {"sx"},
+		actionGitDiff:        {"sd"},
+		actionGitLog:         {"sl"},
+		actionGitBrowse:      {"sb"},
+		actionGitExtract:     {"se"},
+		actionDiskUsage:      {"D"},
+		actionRescanUsage:    {"R"},
+		actionCycleSort:      {"S"},
+		actionTreemap:        {"T"},
+		actionFindDupes:      {"F"},
+		actionMarkDupes:      {"M"},
+		actionResolveDupes:   {"X"},
+		actionChecksums:      {"ck"},
+		actionCompress:       {"cz"},
+		actionExtract:        {"cx"},
+		actionLayout:         {"L"},
+		actionColumnPrev:     {"["},
+		actionColumnNext:     {"]"},
+		actionColumnNarrow:   {"<"},
+		actionColumnWiden:    {">"},
+		actionColumnSort:     {"="},
+		actionColumns:        {"C"},
+		actionToggleNode:     {"za"},
+		actionExpandAll:      {"zR"},
+		actionTrashNode:      {"zd"},
+		actionNewTab:         {"gn"},
+		actionCloseTab:       {"gc"},
+		actionNextTab:        {"gt"},
+		actionPrevTab:        {"gT"},
+		actionTab1:           {"1"},
+		actionTab2:           {"2"},
+		actionTab3:           {"3"},
+		actionTab4:           {"4"},
+		actionTab5:           {"5"},
+		actionTab6:           {"6"},
+		actionTab7:           {"7"},
+		actionTab8:           {"8"},
+		actionTab9:           {"9"},
+		actionCopy:           {"cp", "f5"},
+		actionMove:           {"mv", "f6"},
+		actionDualPane:       {"|"},
+		actionSwitchPane:     {"tab"},
+		actionSyncPane:       {"gs"},
+		actionCompare:        {"cc"},
+		actionSync:           {"cs"},
+	},
+	modeFilter: {
+		actionMoveDown:     {"down"},
+		actionMoveUp:       {"up"},
+		actionFilterAccept: {"enter"},
+		actionFilterCancel: {"esc"},
+		actionQuit:         {"ctrl+c"},
+	},
+	modePrompt: {
+		actionPromptSubmit: {"enter"},
+		actionPromptCancel: {"esc"},
+		actionQuit:         {"ctrl+c"},
+	},
+	modePerms: {
+		actionMoveLeft:      {"h", "left"},
+		actionMoveDown:      {"j", "down"},
+		actionMoveUp:        {"k", "up"},
+		actionMoveRight:     {"l", "right"},
+		actionPromptSubmit:  {"enter"},
+		actionPromptCancel:  {"esc"},
+		actionQuit:          {"ctrl+c"},
+		actionPermToggle:    {"space"},
+		actionPermRecursive: {"R"},
+	},
+	modeMenu: {
+		actionMoveDown:     {"j", "down"},
+		actionMoveUp:       {"k", "up"},
+		actionPromptSubmit: {"enter"},
+		actionPromptCancel: {"esc", "q"},
+		actionQuit:         {"ctrl+c"},
+		actionMenuDefault:  {"d"},
+	},
+}
+
+// hintGroup is one entry of the bottom bar: several actions sharing a single label
+type hintGroup struct {
+	actions []action
+	label   string
+}
+
+// modeHints lists, in display order, the bottom bar entries for each mode
+var modeHints = map[mode][]hintGroup{
+	modeNormal: {
+		{[]action{actionMoveLeft, actionMoveDown, actionMoveUp, actionMoveRight}, "move"},
+		{[]action{actionOpen}, "open/navigate"},
+		{[]action{actionParent}, "up"},
+		{[]action{actionFilter}, "filter"},
+		{[]action{actionInfo}, "info"},
+		{[]action{actionHelp}, "help"},
+		{[]action{actionQuit}, "quit"},
+	},
+	modeFilter: {
+		{[]action{actionFilterAccept}, "accept"},
+		{[]action{actionFilterCancel}, "clear"},
+	},
+	modePrompt: {
+		{[]action{actionPromptSubmit}, "confirm"},
+		{[]action{actionPromptCancel}, "cancel"},
+	},
+	modePerms: {
+		{[]action{actionMoveLeft, actionMoveDown, actionMoveUp, actionMoveRight}, "move"},
+		{[]action{actionPermToggle}, "toggle"},
+		{[]action{actionPermRecursive}, "recursive"},
+		{[]action{actionPromptSubmit}, "apply"},
+		{[]action{actionPromptCancel}, "cancel"},
+	},
+	modeMenu: {
+		{[]action{actionMoveDown, actionMoveUp}, "move"},
+		{[]action{actionPromptSubmit}, "choose"},
+		{[]action{actionMenuDefault}, "set default"},
+		{[]action{actionPromptCancel}, "cancel"},
+	},
+}
+
+// namedKeys are multi-character key names as reported by Bubble Tea's KeyMsg.String()
+var namedKeys = map[string]bool{
+	"enter": true, "esc": true, "backspace": true, "tab": true, "shift+tab": true,
+	"up": true, "down": true, "left": true, "right": true,
+	"home": true, "end": true, "pgup": true, "pgdown": true,
+	"delete": true, "insert": true, "space": true,
+}
+
+// keySymbols gives compact labels for keys that have a well-known glyph
+var keySymbols = map[string]string{
+	"enter":     "⏎",
+	"backspace": "⌫",
+	" ":         "space",
+}
+
+// keymap resolves key sequences to actions for every mode
+type keymap struct {
+	bindings map[mode]map[action][][]string // Action -> list of key sequences, per mode
+	lookup   map[mode]map[string]action     // Joined sequence -> action, per mode
+	prefixes map[mode]map[string]bool       // Every proper prefix of a bound sequence, per mode
+}
+
+// newKeymap builds a keymap from the defaults, replacing the keys of any action present in overrides.
+// overrides uses the config file layout: mode name -> action name -> key sequences.
+// Default keys that collide with a user binding are dropped, so remapping one action never
+// requires remapping whatever used to live on that key.
+func newKeymap(overrides map[string]map[string][]string) (keymap, error) {
+	user := map[mode]map[action][]string{}
+	for modeName, actions := range overrides {
+		md, ok := parseMode(modeName)
+		if !ok {
+			return keymap{}, fmt.Errorf("unknown key mode %q", modeName)
+		}
+		user[md] = map[action][]string{}
+		for actionName, keys := range actions {
+			a := action(actionName)
+			if _, ok := actionDescriptions[a]; !ok {
+				return keymap{}, fmt.Errorf("unknown action %q in %s keys", actionName, modeName)
+			}
+			user[md][a] = keys
+		}
+	}
+
+	km := keymap{
+		bindings: map[mode]map[action][][]string{},
+		lookup:   map[mode]map[string]action{},
+		prefixes: map[mode]map[string]bool{},
+	}
+
+	for md := range modeNames {
+		km.bindings[md] = map[action][][]string{}
+		km.lookup[md] = map[string]action{}
+		km.prefixes[md] = map[string]bool{}
+
+		// User bindings go in first and must not conflict with each other
+		for a, keys := range user[md] {
+			for _, k := range keys {
+				if err := km.bind(md, a, parseKeySequence(k)); err != nil {
+					return keymap{}, err
+				}
+			}
+		}
+
+		// Defaults fill in every action the user didn't mention, skipping keys already taken
+		for a, keys := range defaultBindings[md] {
+			if _, overridden := user[md][a]; overridden {
+				continue
+			}
+			for _, k := range keys {
+				_ = km.bind(md, a, parseKeySequence(k))
+			}
+		}
+	}
+
+	return km, nil
+}
+
+// bind adds one key sequence for an action, refusing sequences that are already bound,
+// that are a prefix of a bound sequence, or that start with a bound sequence (either could never fire)
+func (km keymap) bind(md mode, a action, seq []string) error {
+	if len(seq) == 0 {
+		return nil // An empty string binds nothing
+	}
+
+	joined := strings.Join(seq, " ")
+	if other, taken := km.lookup[md][joined]; taken {
+		if other == a {
+			return nil // Same binding listed twice
+		}
+		return fmt.Errorf("key %q bound to both %s and %s in %s mode", joined, other, a, md)
+	}
+	if km.prefixes[md][joined] {
+		return fmt.Errorf("key %q for %s shadows a longer sequence in %s mode", joined, a, md)
+	}
+	for i := 1; i < len(seq); i++ {
+		if other, taken := km.lookup[md][strings.Join(seq[:i], " ")]; taken {
+			return fmt.Errorf("key %q for %s is shadowed by %s in %s mode", joined, a, other, md)
+		}
+	}
+
+	km.lookup[md][joined] = a
+	km.bindings[md][a] = append(km.bindings[md][a], seq)
+
+	// Remember every prefix so we know when to wait for more keys
+	for i := 1; i < len(seq); i++ {
+		km.prefixes[md][strings.Join(seq[:i], " ")] = true
+	}
+	return nil
+}
+
+// parseMode converts a config mode name into a mode
+func parseMode(name string) (mode, bool) {
+	for md, n := range modeNames {
+		if n == name {
+			return md, true
+		}
+	}
+	return modeNormal, false
+}
+
+// parseKeySequence splits a binding into individual key names.
+// Tokens are separated by spaces; a token that is a named key ("enter", "ctrl+x")
+// is one key, otherwise each character is its own key, so "gg" means g followed by g.
+func parseKeySequence(s string) []string {
+	var seq []string
+	for _, token := range strings.Fields(s) {
+		switch {
+		case token == "space":
+			seq = append(seq, " ") // Bubble Tea reports the space bar as a literal space
+		case isNamedKey(token):
+			seq = append(seq, token)
+		default:
+			for _, r := range token {
+				seq = append(seq, string(r))
+			}
+		}
+	}
+	return seq
+}
+
+// isNamedKey reports whether a token is a single multi-character key such as "enter", "ctrl+x" or "f5"
+func isNamedKey(token string) bool {
+	if namedKeys[token] {
+		return true
+	}
+	if len(token) > 1 && strings.Contains(token, "+") {
+		return true // Modifier combinations: ctrl+x, alt+enter, shift+tab...
+	}
+	// Function keys f1..f20
+	return len(token) > 1 && token[0] == 'f' && strings.Trim(token[1:], "0123456789") == ""
+}
+
+// resolve looks up the pending key sequence in the given mode.
+// It reports the bound action (if any) and whether the sequence could still grow into a binding.
+func (km keymap) resolve(md mode, seq []string) (a action, found bool, partial bool) {
+	joined := strings.Join(seq, " ")
+	if a, ok := km.lookup[md][joined]; ok {
+		return a, true, false
+	}
+	return "", false, km.prefixes[md][joined]
+}
+
+// keyLabel renders the first sequence bound to an action for display, e.g. "gg" or "⏎"
+func (km keymap) keyLabel(md mode, a action) string {
+	seqs := km.bindings[md][a]
+	if len(seqs) == 0 {
+		return ""
+	}
+	return formatKeySequence(seqs[0])
+}
+
+// formatKeySequence turns a parsed sequence back into a short human-readable label
+func formatKeySequence(seq []string) string {
+	var b strings.Builder
+	for i, k := range seq {
+		if sym, ok := keySymbols[k]; ok {
+			k = sym
+		}
+		// Separate named keys so "g enter" doesn't read as "genter"
+		if i > 0 && (len([]rune(k)) > 1 || len([]rune(seq[i-1])) > 1) {
+			b.WriteString(" ")
+		}
+		b.WriteString(k)
+	}
+	return b.String()
+}
+
+// hints returns the bottom bar items for a mode, built from whatever keys are currently bound
+func (km keymap) hints(md mode) []string {
+	var items []string
+	for _, group := range modeHints[md] {
+		var labels []string
+		for _, a := range group.actions {
+			if label := km.keyLabel(md, a); label != "" {
+				labels = append(labels, label)
+			}
+		}
+		if len(labels) == 0 {
+			continue // Every action of this group is unbound, so don't advertise it
+		}
+		items = append(items, strings.Join(labels, "/")+" - "+group.label)
+	}
+	return items
+}
+
+// helpLines lists every binding of every mode with its action name, used by the help overlay
+func (km keymap) helpLines() []string {
+	var lines []string
+	for _, md := range modeOrder {
+		lines = append(lines, strings.ToUpper(md.String()))
+
+		// Sort actions by name so the listing is stable between renders
+		var actions []action
+		for a := range km.bindings[md] {
+			actions = append(actions, a)
+		}
+		sort.Slice(actions, func(i, j int) bool { return actions[i] < actions[j] })
+
+		for _, a := range actions {
+			var labels []string
+			for _, seq := range km.bindings[md][a] {
+				labels = append(labels, formatKeySequence(seq))
+			}
+			lines = append(lines, fmt.Sprintf("  %-14s %-16s %s", strings.Join(labels, ", "), a, actionDescriptions[a]))
+		}
+		lines = append(lines, "")
+	}
+	return lines
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Streaming of directory listings
+const (
+	LISTING_BATCH_SIZE = 1024                   // Entries read from the directory per batch
+	LISTING_STAT_BATCH = 256                    // Entries stat'ed per batch once reading is done
+	SPINNER_INTERVAL   = 100 * time.Millisecond // Frame duration of the loading spinner
+)
+
+// spinnerFrames animate the top bar while a directory is loading
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// dirLoader reads one directory in the background. Names are streamed first, in batches,
+// so the grid fills in immediately; stat results follow, for the tiles on screen first.
+type dirLoader struct {
+	path     string
+	out      chan listingMsg // Batches for the model; closed when loading is over
+	priority chan []string   // Paths the model wants stat'ed next (the visible tiles)
+	done     chan struct{}   // Closed by stop to abandon loading
+	once     sync.Once
+
+	// Owned by the model
+	count int  // Entries received so far
+	stale bool // The directory changed while loading; refresh once done
+}
+
+// listingMsg carries one batch from a dirLoader
+type listingMsg struct {
+	loader *dirLoader
+	added  []FileSystemObject // New entries, sorted by name, not stat'ed yet
+	loaded []FileSystemObject // Entries that have been stat'ed since the last batch
+	done   bool               // Loading is over (successfully or not)
+	err    error              // Why the directory could not be read
+}
+
+// spinnerTickMsg advances the loading spinner
+type spinnerTickMsg struct{}
+
+// newDirLoader starts loading a directory in the background
+func newDirLoader(path string) *dirLoader {
+	l := &dirLoader{
+		path:     path,
+		out:      make(chan listingMsg),
+		priority: make(chan []string, 1),
+		done:     make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// stop abandons loading; the pending next command returns without a message
+func (l *dirLoader) stop() {
+	l.once.Do(func() { close(l.done) })
+}
+
+// next returns a command that delivers the loader's next batch
+func (l *dirLoader) next() tea.Cmd {
+	return func() tea.Msg {
+		msg, ok := <-l.out
+		if !ok {
+			return nil // Loader stopped
+		}
+		return msg
+	}
+}
+
+// prioritize asks the loader to stat these paths before anything else.
+// Only the latest request matters, so an unread older one is replaced.
+func (l *dirLoader) prioritize(paths []string) {
+	select {
+	case <-l.priority:
+	default:
+	}
+	select {
+	case l.priority <- paths:
+	default:
+	}
+}
+
+// send hands a batch to the model, giving up if the loader is stopped meanwhile
+func (l *dirLoader) send(msg listingMsg) bool {
+	msg.loader = l
+	select {
+	case l.out <- msg:
+		return true
+	case <-l.done:
+		return false
+	}
+}
+
+// run reads the directory in batches, then stats every entry. Requests for visible
+// tiles are served between batches so they never wait for the whole directory.
+func (l *dirLoader) run() {
+	defer close(l.out)
+
+	dir, err := filepath.Abs(l.path)
+	var f *os.File
+	if err == nil {
+		f, err = os.Open(dir)
+	}
+	if err != nil {
+		l.send(listingMsg{done: true, err: err})
+		return
+	}
+	defer f.Close()
+
+	var pending []string        // Paths not stat'ed yet, in directory order
+	loaded := map[string]bool{} // Paths already stat'ed
+	reading := true
+
+	// stat loads the given paths, skipping those done already, and sends the results
+	stat := func(paths []string) bool {
+		var objects []FileSystemObject
+		for _, path := range paths {
+			if loaded[path] {
+				continue
+			}
+			loaded[path] = true
+			obj := FileSystemObject{Name: filepath.Base(path), Path: path}
+			obj.load()
+			objects = append(objects, obj)
+		}
+		return len(objects) == 0 || l.send(listingMsg{loaded: objects})
+	}
+
+	for reading || len(pending) > 0 {
+		// Visible tiles first
+		select {
+		case <-l.done:
+			return
+		case paths := <-l.priority:
+			if !stat(paths) {
+				return
+			}
+			continue
+		default:
+		}
+
+		if reading {
+			entries, err := f.ReadDir(LISTING_BATCH_SIZE)
+			if errors.Is(err, io.EOF) || err == nil && len(entries) == 0 {
+				reading = false
+			} else if err != nil {
+				reading = false
+				if !l.send(listingMsg{err: err}) {
+					return
+				}
+			}
+
+			batch := make([]FileSystemObject, 0, len(entries))
+			for _, entry := range entries {
+				obj := newObject(dir, entry)
+				batch = append(batch, obj)
+				pending = append(pending, obj.Path)
+			}
+			if len(batch) > 0 {
+				slices.SortFunc(batch, compareObjects)
+				if !l.send(listingMsg{added: batch}) {
+					return
+				}
+			}
+			continue
+		}
+
+		// Everything is listed: stat the rest in the background
+		n := min(LISTING_STAT_BATCH, len(pending))
+		chunk := pending[:n]
+		pending = pending[n:]
+		if !stat(chunk) {
+			return
+		}
+	}
+
+	l.send(listingMsg{done: true})
+}
+
+// compareObjects orders objects by name, like os.ReadDir does
+func compareObjects(a, b FileSystemObject) int {
+	return strings.Compare(a.Name, b.Name)
+}
+
+// mergeObjects merges a sorted batch into a sorted listing. An entry already in the
+// listing (e.g. added by a refresh) is replaced rather than duplicated.
+func mergeObjects(listing, batch []FileSystemObject) []FileSystemObject {
+	merged := make([]FileSystemObject, 0, len(listing)+len(batch))
+	i, j := 0, 0
+	for i < len(listing) && j < len(batch) {
+		switch c := compareObjects(listing[i], batch[j]); {
+		case c < 0:
+			merged = append(merged, listing[i])
+			i++
+		case c > 0:
+			merged = append(merged, batch[j])
+			j++
+		default:
+			merged = append(merged, batch[j])
+			i++
+			j++
+		}
+	}
+	merged = append(merged, listing[i:]...)
+	return append(merged, batch[j:]...)
+}
+
+// loading reports whether the current directory is still being read
+func (m model) loading() bool {
+	return m.loader != nil
+}
+
+// virtualList returns what lists the objects shown in place of the current directory when they
+// don't come from reading it (a commit's tree, duplicate groups, a manifest's files), or nil
+func (m model) virtualList() func(path string) ([]FileSystemObject, error) {
+	switch {
+	case m.tree != nil:
+		return m.tree.list
+	case m.dupes != nil:
+		return m.dupes.list
+	case m.verify != nil:
+		return m.verify.list
+	}
+	return nil
+}
+
+// syncLoader starts loading the current directory when the listing doesn't belong to it,
+// i.e. after openCurrentPath. It returns the commands that receive the batches and spin the spinner.
+func (m *model) syncLoader() tea.Cmd {
+	if m.listingPath == m.state.currentPath {
+		return nil
+	}
+	if m.loader != nil {
+		m.loader.stop()
+		m.loader = nil
+	}
+	m.listingPath = m.state.currentPath
+
+	// A commit's tree or the duplicate groups are listed in one go; there is nothing to stream
+	if list := m.virtualList(); list != nil {
+		listing, err := list(m.state.currentPath)
+		if err != nil {
+			m.status = err.Error()
+		}
+		m.listing = listing
+		m.applyFilter()
+		if m.pendingFocus != "" {
+			m.focusName(m.pendingFocus)
+		}
+		return nil
+	}
+
+	m.loader = newDirLoader(m.state.currentPath)
+
+	cmds := []tea.Cmd{m.loader.next()}
+	if !m.spinning {
+		m.spinning = true
+		cmds = append(cmds, spinnerTick())
+	}
+	return tea.Batch(cmds...)
+}
+
+// handleListing merges a batch from the loader into the listing
+func (m *model) handleListing(msg listingMsg) tea.Cmd {
+	if msg.loader != m.loader {
+		return nil // From a directory we already left
+	}
+	if msg.err != nil {
+		m.status = msg.err.Error()
+	}
+
+	// The cursor keeps its object while entries stream in around it, unless it's
+	// still at the top, where the first entries should simply fill in
+	m.keepFocus(m.selectedIndex() > 0, func() {
+		if len(msg.added) > 0 {
+			m.loader.count += len(msg.added)
+			m.listing = mergeObjects(m.listing, msg.added)
+		}
+		for _, obj := range msg.loaded {
+			i, found := slices.BinarySearchFunc(m.listing, obj, compareObjects)
+			if found {
+				m.listing[i] = obj
+			}
+		}
+		m.applyFilter()
+	})
+
+	if m.pendingFocus != "" {
+		m.focusName(m.pendingFocus)
+	}
+
+	if msg.done {
+		stale := m.loader.stale
+		m.loader = nil
+		if stale {
+			// A name still awaited may come with the refresh
+			m.refreshing = true
+			return refreshCmd(m.state.currentPath)
+		}
+		m.pendingFocus = ""
+		return nil
+	}
+	return m.loader.next()
+}
+
+// requestVisibleStats asks the loader to stat the tiles on screen that aren't loaded yet
+func (m *model) requestVisibleStats() {
+	if m.loader == nil || m.cols < 1 {
+		return
+	}
+	first := m.state.viewportRowOffset * m.cols
+	last := min(first+m.rows*m.cols, len(m.objects))
+
+	var paths []string
+	for i := first; i < last; i++ {
+		if !m.objects[i].Loaded {
+			paths = append(paths, m.objects[i].Path)
+		}
+	}
+	if len(paths) > 0 {
+		m.loader.prioritize(paths)
+	}
+}
+
+// spinnerTick schedules the next spinner frame
+func spinnerTick() tea.Cmd {
+	return tea.Tick(SPINNER_INTERVAL, func(time.Time) tea.Msg { return spinnerTickMsg{} })
+}
+
+// loadingLabel shows the spinner and the number of entries read so far
+func (m model) loadingLabel() string {
+	if m.loader == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s %d ", spinnerFrames[m.spinnerFrame%len(spinnerFrames)], m.loader.count)
+}
+
+// listingRefreshedMsg delivers a listing re-read in the background after a change on disk
+type listingRefreshedMsg struct {
+	path     string
+	listing  []FileSystemObject
+	err      error
+	pane     bool                          // Read for the other pane of the dual-pane view
+	children map[string][]FileSystemObject // And the directories expanded in its tree
+}
+
+// refreshCmd re-reads a directory in the background
+func refreshCmd(path string) tea.Cmd {
+	return func() tea.Msg {
+		listing, err := listObjects(path)
+		return listingRefreshedMsg{path: path, listing: listing, err: err}
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// makeEntries creates n empty files and every tenth a directory, named so that directory order
+// and name order differ
+func makeEntries(t testing.TB, dir string, n int) {
+	t.Helper()
+	for i := range n {
+		path := filepath.Join(dir, fmt.Sprintf("%x-%d", (i*7919)%n, i))
+		var err error
+		if i%10 == 0 {
+			err = os.Mkdir(path, 0o755)
+		} else {
+			var f *os.File
+			if f, err = os.Create(path); err == nil {
+				err = f.Close()
+			}
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// receive returns the loader's next batch, failing the test if none comes
+func receive(t *testing.T, l *dirLoader) listingMsg {
+	t.Helper()
+	msg, ok := l.next()().(listingMsg)
+	if !ok {
+		t.Fatal("the loader closed without saying it's done")
+	}
+	return msg
+}
+
+func TestDirLoaderStreamsBatches(t *testing.T) {
+	dir := tempDir(t)
+	n := LISTING_BATCH_SIZE*2 + LISTING_BATCH_SIZE/2
+	makeEntries(t, dir, n)
+
+	l := newDirLoader(dir)
+	defer l.stop()
+	var batches, added, loaded int
+	for {
+		msg := receive(t, l)
+		if msg.err != nil {
+			t.Fatal(msg.err)
+		}
+		if len(msg.added) > 0 {
+			if loaded > 0 {
+				t.Error("entries were stat'ed before all of them were listed")
+			}
+			if len(msg.added) > LISTING_BATCH_SIZE || !slices.IsSortedFunc(msg.added, compareObjects) {
+				t.Errorf("batch of %d, sorted: %v", len(msg.added), slices.IsSortedFunc(msg.added, compareObjects))
+			}
+			for _, obj := range msg.added {
+				if obj.Loaded {
+					t.Fatalf("%s came stat'ed with the names", obj.Name)
+				}
+			}
+			batches++
+			added += len(msg.added)
+		}
+		loaded += len(msg.loaded)
+		if msg.done {
+			break
+		}
+	}
+	if batches != 3 || added != n || loaded != n {
+		t.Errorf("%d batches, %d listed, %d stat'ed; want 3, %d, %d", batches, added, loaded, n, n)
+	}
+}
+
+func TestDirLoaderServesVisibleTilesFirst(t *testing.T) {
+	dir := tempDir(t)
+	makeEntries(t, dir, LISTING_BATCH_SIZE*3)
+
+	l := newDirLoader(dir)
+	defer l.stop()
+	first := receive(t, l)
+	wanted := []string{first.added[5].Path, first.added[0].Path}
+	l.prioritize(wanted)
+
+	// The loader may be holding the next batch already; the tiles come right after it
+	for {
+		msg := receive(t, l)
+		if len(msg.loaded) == 0 {
+			continue
+		}
+		var got []string
+		for _, obj := range msg.loaded {
+			got = append(got, obj.Path)
+		}
+		if !slices.Equal(got, wanted) {
+			t.Errorf("first stat'ed %d entries, want the %d asked for", len(got), len(wanted))
+		}
+		return
+	}
+}
+
+func TestDirLoaderMatchesListObjects(t *testing.T) {
+	dir := tempDir(t)
+	makeEntries(t, dir, LISTING_BATCH_SIZE*2+3)
+	os.Symlink("missing", filepath.Join(dir, "broken"))
+	os.Symlink("0-0", filepath.Join(dir, "to-dir"))
+	writeFile(t, dir, "sized", "twelve bytes", time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC))
+
+	// Batches go through the model as they arrive, with a visible page asked for along the way
+	m := newTestModel(t, tempDir(t))
+	m.listing, m.objects = nil, nil
+	m.loader = newDirLoader(dir)
+	for cmd := m.loader.next(); cmd != nil; {
+		msg, ok := cmd().(listingMsg)
+		if !ok {
+			t.Fatal("the loader closed without saying it's done")
+		}
+		cmd = m.handleListing(msg)
+		m.requestVisibleStats()
+	}
+
+	want, err := listObjects(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(m.listing, want) {
+		for i := range min(len(m.listing), len(want)) {
+			if m.listing[i] != want[i] {
+				t.Fatalf("entry %d: streamed %+v, listed %+v", i, m.listing[i], want[i])
+			}
+		}
+		t.Fatalf("streamed %d entries, listed %d", len(m.listing), len(want))
+	}
+}
+
+func TestDirLoaderReportsUnreadableDirectory(t *testing.T) {
+	l := newDirLoader(filepath.Join(tempDir(t), "missing"))
+	msg := receive(t, l)
+	if !msg.done || msg.err == nil {
+		t.Errorf("done %v, err %v", msg.done, msg.err)
+	}
+}
+
+func TestDirLoaderStops(t *testing.T) {
+	dir := tempDir(t)
+	makeEntries(t, dir, LISTING_BATCH_SIZE*2)
+	l := newDirLoader(dir)
+	receive(t, l)
+	l.stop()
+	for msg := l.next()(); msg != nil; msg = l.next()() {
+		// A batch the loader was already handing over may still come
+	}
+}
+
+func TestRefreshListingFocusesWhenRefreshed(t *testing.T) {
+	dir := tempDir(t)
+	writeFile(t, dir, "a", "", time.Time{})
+	m := newTestModel(t, dir)
+
+	// A rename done in the background: the listing only changes once the refresh is back
+	if err := os.Rename(filepath.Join(dir, "a"), filepath.Join(dir, "b")); err != nil {
+		t.Fatal(err)
+	}
+	cmd := m.showOpResult(opResultMsg{verb: "rename", done: 1, focus: "b"})
+	if cmd == nil {
+		t.Fatal("no refresh was started")
+	}
+	if len(m.listing) != 1 || m.listing[0].Name != "a" {
+		t.Fatal("the directory was read in Update")
+	}
+
+	// Another object takes the first place, so the cursor has to move to find b
+	writeFile(t, dir, "0", "", time.Time{})
+	refreshed, ok := cmd().(listingRefreshedMsg)
+	if !ok {
+		t.Fatalf("got %T, want a listingRefreshedMsg", cmd())
+	}
+	m.showRefreshed(refreshed)
+	if got := m.objects[m.selectedIndex()].Name; got != "b" {
+		t.Errorf("cursor on %s, want b", got)
+	}
+	if m.refreshing || m.pendingFocus != "" {
+		t.Error("the refresh is still awaited")
+	}
+}
+
+func TestRefreshListingWaitsForLoading(t *testing.T) {
+	dir := tempDir(t)
+	writeFile(t, dir, "a", "", time.Time{})
+	m := newTestModel(t, dir)
+	m.listingPath = ""
+	cmd := m.syncLoader()
+	if cmd == nil || !m.loading() {
+		t.Fatal("loading didn't start")
+	}
+
+	// Created while loading: the refresh waits for the loader, then comes back with the new file
+	writeFile(t, dir, "b", "", time.Time{})
+	if m.refreshListing() != nil || !m.loader.stale {
+		t.Fatal("refreshed while still loading")
+	}
+	m.revealName("b")
+	l := m.loader
+	for m.loading() {
+		cmd = m.handleListing(receive(t, l))
+	}
+	if cmd == nil {
+		t.Fatal("no refresh after loading")
+	}
+	m.showRefreshed(cmd().(listingRefreshedMsg))
+	if got := m.objects[m.selectedIndex()].Name; got != "b" {
+		t.Errorf("cursor on %s, want b", got)
+	}
+}
+
+// BenchmarkDirLoader reads a directory of 100k entries: the first batch, which is what the
+// grid waits for, the whole listing streamed in, and listObjects for comparison
+func BenchmarkDirLoader(b *testing.B) {
+	dir, err := filepath.EvalSymlinks(b.TempDir())
+	if err != nil {
+		b.Fatal(err)
+	}
+	makeEntries(b, dir, 100_000)
+
+	b.Run("first batch", func(b *testing.B) {
+		for range b.N {
+			l := newDirLoader(dir)
+			if msg, _ := l.next()().(listingMsg); len(msg.added) == 0 {
+				b.Fatal("no entries")
+			}
+			l.stop()
+		}
+	})
+	b.Run("streamed", func(b *testing.B) {
+		for range b.N {
+			l := newDirLoader(dir)
+			var listing []FileSystemObject
+			for {
+				msg, _ := l.next()().(listingMsg)
+				listing = mergeObjects(listing, msg.added)
+				if msg.done {
+					break
+				}
+			}
+			if len(listing) != 100_000 {
+				b.Fatalf("%d entries", len(listing))
+			}
+		}
+	})
+	b.Run("listObjects", func(b *testing.B) {
+		for range b.N {
+			if _, err := listObjects(dir); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
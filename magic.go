@@ -0,0 +1,664 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Content sniffing
+const (
+	SNIFF_HEAD_SIZE  = 16 * 1024 // Bytes read from the start of a file; enough for every common signature
+	TYPE_CACHE_LIMIT = 50000     // Cached detections kept before the cache starts over
+)
+
+// fileType is what sniffing a file's content tells us about it
+type fileType struct {
+	MIME        string // Content type without parameters, e.g. "image/png"
+	Description string // Short human readable kind, e.g. "PNG image", shown on tiles
+	Text        bool   // The content is text (any encoding we can display)
+}
+
+// magicSignature recognizes a format by the bytes at a fixed offset
+type magicSignature struct {
+	offset      int
+	magic       string
+	mime        string
+	description string
+}
+
+// magicSignatures are checked in order; the first match wins. Formats that need more than a
+// fixed prefix (ELF, scripts, RIFF and ISO media containers, text) are handled in sniffType.
+var magicSignatures = []magicSignature{
+	{0, "\x89PNG\r\n\x1a\n", "image/png", "PNG image"},
+	{0, "\xff\xd8\xff", "image/jpeg", "JPEG image"},
+	{0, "GIF87a", "image/gif", "GIF image"},
+	{0, "GIF89a", "image/gif", "GIF image"},
+	{0, "II*\x00", "image/tiff", "TIFF image"},
+	{0, "MM\x00*", "image/tiff", "TIFF image"},
+	{0, "\x00\x00\x01\x00", "image/vnd.microsoft.icon", "icon"},
+	{0, "%PDF-", "application/pdf", "PDF document"},
+	{0, "%!PS", "application/postscript", "PostScript"},
+	{0, "\x1f\x8b", "application/gzip", "gzip archive"},
+	{0, "BZh", "application/x-bzip2", "bzip2 archive"},
+	{0, "\xfd7zXZ\x00", "application/x-xz", "xz archive"},
+	{0, "\x28\xb5\x2f\xfd", "application/zstd", "zstd archive"},
+	{0, "\x04\x22\x4d\x18", "application/x-lz4", "lz4 archive"},
+	{0, "7z\xbc\xaf\x27\x1c", "application/x-7z-compressed", "7-Zip archive"},
+	{0, "Rar!\x1a\x07", "application/vnd.rar", "RAR archive"},
+	{0, "PK\x03\x04", "application/zip", "zip archive"},
+	{0, "PK\x05\x06", "application/zip", "zip archive"},
+	{257, "ustar", "application/x-tar", "tar archive"},
+	{0, "!<arch>\n", "application/x-archive", "ar archive"},
+	{0, "SQLite format 3\x00", "application/vnd.sqlite3", "SQLite database"},
+	{0, "\x00asm", "application/wasm", "WebAssembly"},
+	{0, "MZ", "application/vnd.microsoft.portable-executable", "Windows executable"},
+	{0, "\xcf\xfa\xed\xfe", "application/x-mach-binary", "Mach-O binary"},
+	{0, "\xce\xfa\xed\xfe", "application/x-mach-binary", "Mach-O binary"},
+	{0, "\xca\xfe\xba\xbe", "application/x-mach-binary", "Mach-O universal"},
+	{0, "ID3", "audio/mpeg", "MP3 audio"},
+	{0, "\xff\xfb", "audio/mpeg", "MP3 audio"},
+	{0, "fLaC", "audio/flac", "FLAC audio"},
+	{0, "OggS", "audio/ogg", "Ogg media"},
+	{0, "\x1a\x45\xdf\xa3", "video/x-matroska", "Matroska video"},
+	{0, "wOFF", "font/woff", "WOFF font"},
+	{0, "wOF2", "font/woff2", "WOFF2 font"},
+	{0, "\x00\x01\x00\x00\x00", "font/ttf", "TrueType font"},
+	{0, "OTTO", "font/otf", "OpenType font"},
+	{0, "-----BEGIN ", "application/x-pem-file", "PEM data"},
+	{0, "\x00\x00\x00\x0cjP  ", "image/jp2", "JPEG 2000 image"},
+	{0, "\xed\xab\xee\xdb", "application/x-rpm", "RPM package"},
+}
+
+// interpreterTypes maps a script interpreter to the type of its scripts
+var interpreterTypes = map[string]fileType{
+	"sh":        {"application/x-shellscript", "shell script", true},
+	"bash":      {"application/x-shellscript", "Bash script", true},
+	"dash":      {"application/x-shellscript", "shell script", true},
+	"zsh":       {"application/x-shellscript", "Zsh script", true},
+	"ksh":       {"application/x-shellscript", "shell script", true},
+	"fish":      {"application/x-fishscript", "fish script", true},
+	"python":    {"text/x-python", "Python script", true},
+	"perl":      {"application/x-perl", "Perl script", true},
+	"ruby":      {"application/x-ruby", "Ruby script", true},
+	"node":      {"text/javascript", "Node.js script", true},
+	"deno":      {"text/javascript", "Deno script", true},
+	"php":       {"application/x-php", "PHP script", true},
+	"lua":       {"text/x-lua", "Lua script", true},
+	"awk":       {"application/x-awk", "awk script", true},
+	"tclsh":     {"text/x-tcl", "Tcl script", true},
+	"make":      {"text/x-makefile", "Makefile", true},
+	"osascript": {"text/plain", "AppleScript", true},
+}
+
+// typeCacheEntry is one cached detection, valid while the file's mtime and size are unchanged
+type typeCacheEntry struct {
+	modTime time.Time
+	size    int64
+	t       fileType
+}
+
+// typeCache remembers detections by path. It's shared by the UI and background commands.
+var typeCache = struct {
+	sync.Mutex
+	entries map[string]typeCacheEntry
+	pending map[string]bool // Paths a background detection is working on
+}{entries: map[string]typeCacheEntry{}, pending: map[string]bool{}}
+
+// typesDetectedMsg tells the model that detections for visible tiles are in the cache
+type typesDetectedMsg struct{}
+
+// cachedType returns the cached detection for a file if it's still current
+func cachedType(path string, modTime time.Time, size int64) (fileType, bool) {
+	typeCache.Lock()
+	defer typeCache.Unlock()
+	e, ok := typeCache.entries[path]
+	if !ok || !e.modTime.Equal(modTime) || e.size != size {
+		return fileType{}, false
+	}
+	return e.t, true
+}
+
+// detectType sniffs a file's content, using the cache when the file hasn't changed.
+// Symlinks are followed; anything that can't be read gets a zero fileType.
+func detectType(path string) fileType {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return fileType{}
+	}
+	if t, ok := cachedType(path, info.ModTime(), info.Size()); ok {
+		return t
+	}
+
+	t := sniffFile(path)
+
+	typeCache.Lock()
+	if len(typeCache.entries) >= TYPE_CACHE_LIMIT {
+		typeCache.entries = map[string]typeCacheEntry{}
+	}
+	typeCache.entries[path] = typeCacheEntry{modTime: info.ModTime(), size: info.Size(), t: t}
+	delete(typeCache.pending, path)
+	typeCache.Unlock()
+	return t
+}
+
+// sniffFile reads the head of a file and identifies it
+func sniffFile(path string) fileType {
+	f, err := os.Open(path)
+	if err != nil {
+		return fileType{}
+	}
+	defer f.Close()
+
+	head := make([]byte, SNIFF_HEAD_SIZE)
+	n, _ := io.ReadFull(f, head)
+	return sniffType(head[:n], filepath.Base(path), n == len(head))
+}
+
+// sniffType identifies content from its first bytes: known signatures first, then the
+// shared-mime-info database if one is installed, then text versus binary. For text and
+// unrecognized binaries the file name refines the answer (a .go file is Go source), but
+// a name never overrides what the content says it is.
+func sniffType(head []byte, name string, truncated bool) fileType {
+	if len(head) == 0 {
+		return fileType{"application/x-zerosize", "empty", true}
+	}
+
+	if t, ok := sniffBinary(head); ok {
+		return t
+	}
+	if bytes.HasPrefix(head, []byte("#!")) {
+		return sniffScript(head)
+	}
+	if t, ok := sharedMimeInfo().match(head); ok {
+		return t
+	}
+
+	t := sniffText(head, truncated)
+	byName := mime.TypeByExtension(filepath.Ext(name))
+	byName, _, _ = strings.Cut(byName, ";")
+	switch {
+	case byName == "":
+	case t.Text && isTextMIME(byName):
+		t.MIME = byName
+		t.Description = describeMIME(byName, t.Description)
+	case !t.Text && !isTextMIME(byName):
+		t.MIME = byName
+		t.Description = describeMIME(byName, "data")
+	}
+	return t
+}
+
+// sniffBinary checks the fixed signatures and the container formats
+func sniffBinary(head []byte) (fileType, bool) {
+	if bytes.HasPrefix(head, []byte("\x7fELF")) {
+		return sniffELF(head), true
+	}
+	// "BM" alone is too common a start for text; the header's reserved bytes must be zero too
+	if len(head) >= 14 && string(head[:2]) == "BM" && string(head[6:10]) == "\x00\x00\x00\x00" {
+		return fileType{"image/bmp", "BMP image", false}, true
+	}
+	if len(head) >= 12 && string(head[:4]) == "RIFF" {
+		switch string(head[8:12]) {
+		case "WEBP":
+			return fileType{"image/webp", "WebP image", false}, true
+		case "WAVE":
+			return fileType{"audio/wav", "WAV audio", false}, true
+		case "AVI ":
+			return fileType{"video/x-msvideo", "AVI video", false}, true
+		}
+	}
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+		switch string(head[8:12]) {
+		case "heic", "heix", "mif1":
+			return fileType{"image/heic", "HEIC image", false}, true
+		case "avif":
+			return fileType{"image/avif", "AVIF image", false}, true
+		case "M4A ":
+			return fileType{"audio/mp4", "M4A audio", false}, true
+		case "qt  ":
+			return fileType{"video/quicktime", "QuickTime video", false}, true
+		}
+		return fileType{"video/mp4", "MP4 video", false}, true
+	}
+	for _, sig := range magicSignatures {
+		end := sig.offset + len(sig.magic)
+		if end <= len(head) && string(head[sig.offset:end]) == sig.magic {
+			return fileType{sig.mime, sig.description, false}, true
+		}
+	}
+	return fileType{}, false
+}
+
+// sniffELF tells executables, libraries, objects and core dumps apart.
+// Position independent executables are shared objects with a program interpreter.
+func sniffELF(head []byte) fileType {
+	if len(head) < 20 {
+		return fileType{"application/x-elf", "ELF file", false}
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if head[5] == 2 {
+		order = binary.BigEndian
+	}
+
+	switch order.Uint16(head[16:]) {
+	case 1:
+		return fileType{"application/x-object", "ELF object", false}
+	case 2:
+		return fileType{"application/x-executable", "ELF executable", false}
+	case 3:
+		if elfHasInterpreter(head, order) {
+			return fileType{"application/x-pie-executable", "ELF executable", false}
+		}
+		return fileType{"application/x-sharedlib", "ELF shared library", false}
+	case 4:
+		return fileType{"application/x-core", "core dump", false}
+	}
+	return fileType{"application/x-elf", "ELF file", false}
+}
+
+// elfHasInterpreter looks for a PT_INTERP program header within the bytes read
+func elfHasInterpreter(head []byte, order binary.ByteOrder) bool {
+	var phoff uint64
+	var phentsize, phnum uint16
+	if head[4] == 2 { // 64-bit
+		if len(head) < 64 {
+			return false
+		}
+		phoff = order.Uint64(head[32:])
+		phentsize, phnum = order.Uint16(head[54:]), order.Uint16(head[56:])
+	} else {
+		if len(head) < 52 {
+			return false
+		}
+		phoff = uint64(order.Uint32(head[28:]))
+		phentsize, phnum = order.Uint16(head[42:]), order.Uint16(head[44:])
+	}
+
+	const ptInterp = 3
+	for i := uint64(0); i < uint64(phnum); i++ {
+		at := phoff + i*uint64(phentsize)
+		if at+4 > uint64(len(head)) {
+			return false
+		}
+		if order.Uint32(head[at:]) == ptInterp {
+			return true
+		}
+	}
+	return false
+}
+
+// sniffScript identifies a script by the interpreter on its shebang line
+func sniffScript(head []byte) fileType {
+	line, _, _ := bytes.Cut(head[2:], []byte("\n"))
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return fileType{"text/plain", "script", true}
+	}
+
+	// "#!/usr/bin/env -S python3 -u" runs the first non-flag argument of env
+	interpreter := filepath.Base(fields[0])
+	if interpreter == "env" {
+		interpreter = ""
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") && !strings.Contains(field, "=") {
+				interpreter = filepath.Base(field)
+				break
+			}
+		}
+	}
+
+	// python3.12 and python3 are python
+	base := strings.TrimRight(interpreter, "0123456789.")
+	if t, ok := interpreterTypes[base]; ok {
+		return t
+	}
+	if interpreter == "" {
+		return fileType{"text/plain", "script", true}
+	}
+	return fileType{"text/plain", interpreter + " script", true}
+}
+
+// sniffText decides between text and binary. Text must be valid UTF-8 (or carry a UTF-16 BOM)
+// with no NUL bytes and hardly any control characters.
+func sniffText(head []byte, truncated bool) fileType {
+	switch {
+	case bytes.HasPrefix(head, []byte("\xef\xbb\xbf")):
+		return fileType{"text/plain", "UTF-8 text", true}
+	case bytes.HasPrefix(head, []byte("\xff\xfe")), bytes.HasPrefix(head, []byte("\xfe\xff")):
+		return fileType{"text/plain", "UTF-16 text", true}
+	}
+
+	binaryData := fileType{"application/octet-stream", "data", false}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return binaryData
+	}
+
+	// A multi-byte character may have been cut off by the end of the head
+	if truncated {
+		for i := 0; i < utf8.UTFMax-1 && len(head) > 0 && !utf8.FullRune(head[len(head)-1-i:]); i++ {
+			if utf8.RuneStart(head[len(head)-1-i]) {
+				head = head[:len(head)-1-i]
+				break
+			}
+		}
+	}
+	if !utf8.Valid(head) {
+		return binaryData
+	}
+
+	ascii, control := true, 0
+	for _, c := range head {
+		switch {
+		case c >= 0x80:
+			ascii = false
+		case c < 0x20 && c != '\t' && c != '\n' && c != '\r' && c != '\f' && c != '\b' && c != 0x1b:
+			control++
+		}
+	}
+	if control*100 > len(head) {
+		return binaryData
+	}
+	if ascii {
+		return fileType{"text/plain", "ASCII text", true}
+	}
+	return fileType{"text/plain", "UTF-8 text", true}
+}
+
+// isTextMIME reports whether a type is some form of text
+func isTextMIME(t string) bool {
+	if strings.HasPrefix(t, "text/") || strings.HasSuffix(t, "+xml") || strings.HasSuffix(t, "+json") {
+		return true
+	}
+	switch t {
+	case "application/json", "application/xml", "application/javascript", "application/x-sh",
+		"application/x-shellscript", "application/toml", "application/yaml", "application/x-yaml",
+		"application/sql", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// describeMIME turns a type found by file name into a tile description,
+// e.g. "text/x-go" becomes "go text"; generic types keep the fallback
+func describeMIME(t, fallback string) string {
+	if t == "text/plain" || t == "application/octet-stream" {
+		return fallback
+	}
+	_, sub, _ := strings.Cut(t, "/")
+	sub = strings.TrimPrefix(sub, "x-")
+	sub = strings.TrimPrefix(sub, "vnd.")
+	if main, _, ok := strings.Cut(t, "/"); ok && main == "text" {
+		return sub + " text"
+	}
+	return sub
+}
+
+// requestVisibleTypes detects the types of the files on screen in the background.
+// Tiles show their badge as soon as the result is in the cache.
+func (m *model) requestVisibleTypes() tea.Cmd {
+	if m.cols < 1 || m.tree != nil {
+		return nil
+	}
+
+	var paths []string
+	typeCache.Lock()
+	for _, obj := range m.onScreen() {
+		if !obj.Loaded || !obj.Mode.IsRegular() || typeCache.pending[obj.Path] {
+			continue
+		}
+		if e, ok := typeCache.entries[obj.Path]; ok && e.modTime.Equal(obj.ModTime) && e.size == obj.Size {
+			continue
+		}
+		typeCache.pending[obj.Path] = true
+		paths = append(paths, obj.Path)
+	}
+	typeCache.Unlock()
+
+	if len(paths) == 0 {
+		return nil
+	}
+	return func() tea.Msg {
+		for _, path := range paths {
+			detectType(path)
+		}
+		// Paths that vanished meanwhile never reach the cache; don't leave them pending forever
+		typeCache.Lock()
+		for _, path := range paths {
+			delete(typeCache.pending, path)
+		}
+		typeCache.Unlock()
+		return typesDetectedMsg{}
+	}
+}
+
+// objectType returns the cached type of a tile's file, if it has been detected
+func objectType(obj FileSystemObject) (fileType, bool) {
+	if !obj.Loaded || !obj.Mode.IsRegular() {
+		return fileType{}, false
+	}
+	return cachedType(obj.Path, obj.ModTime, obj.Size)
+}
+
+// mimeMagic is the parsed magic database of shared-mime-info
+type mimeMagic struct {
+	sections []magicSection // Sorted by priority, highest first
+}
+
+// magicSection lists the rules identifying one MIME type
+type magicSection struct {
+	priority int
+	mime     string
+	rules    []*magicRule // Top-level rules; any of them matching identifies the type
+}
+
+// magicRule is one line of a section. Its children refine it: when it has any,
+// at least one of them must match as well.
+type magicRule struct {
+	offset   int
+	rangeLen int
+	value    []byte
+	mask     []byte
+	children []*magicRule
+}
+
+var (
+	loadedMagic     *mimeMagic
+	loadedMagicOnce sync.Once
+)
+
+// sharedMimeInfo loads the shared-mime-info magic database on first use.
+// Without one, the returned database simply never matches.
+func sharedMimeInfo() *mimeMagic {
+	loadedMagicOnce.Do(func() {
+		loadedMagic = &mimeMagic{}
+		for _, dir := range xdgDataDirs() {
+			if data, err := os.ReadFile(filepath.Join(dir, "mime", "magic")); err == nil {
+				loadedMagic = parseMimeMagic(data)
+				return
+			}
+		}
+	})
+	return loadedMagic
+}
+
+// parseMimeMagic reads the binary magic file format: a "MIME-Magic\0\n" header, then
+// "[priority:type]" sections of rules written as
+// [indent]">"offset"="value-length(2 bytes, big endian)value["&"mask]["~"word-size]["+"range]"\n"
+func parseMimeMagic(data []byte) *mimeMagic {
+	db := &mimeMagic{}
+	header := []byte("MIME-Magic\x00\n")
+	if !bytes.HasPrefix(data, header) {
+		return db
+	}
+	data = data[len(header):]
+
+	// number reads a decimal number, returning what's left of the data
+	number := func() (int, bool) {
+		i := 0
+		for i < len(data) && data[i] >= '0' && data[i] <= '9' {
+			i++
+		}
+		n, err := strconv.Atoi(string(data[:i]))
+		data = data[i:]
+		return n, err == nil
+	}
+
+	var section *magicSection
+	var stack []*magicRule // Most recent rule at each indent level
+	for len(data) > 0 {
+		if data[0] == '[' {
+			end := bytes.IndexByte(data, '\n')
+			if end < 0 {
+				break
+			}
+			priority, t, _ := strings.Cut(string(data[1:end-1]), ":")
+			p, _ := strconv.Atoi(priority)
+			db.sections = append(db.sections, magicSection{priority: p, mime: t})
+			section = &db.sections[len(db.sections)-1]
+			stack = stack[:0]
+			data = data[end+1:]
+			continue
+		}
+		if section == nil {
+			break
+		}
+
+		indent := 0
+		if data[0] != '>' {
+			var ok bool
+			if indent, ok = number(); !ok {
+				break
+			}
+		}
+		if len(data) == 0 || data[0] != '>' {
+			break
+		}
+		data = data[1:]
+		offset, ok := number()
+		if !ok || len(data) < 3 || data[0] != '=' {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[1:3]))
+		data = data[3:]
+		if len(data) < length {
+			break
+		}
+		rule := &magicRule{offset: offset, rangeLen: 1, value: data[:length]}
+		data = data[length:]
+
+		wordSize := 1
+		for len(data) > 0 && data[0] != '\n' {
+			switch data[0] {
+			case '&':
+				if len(data) < 1+length {
+					data = nil
+					break
+				}
+				rule.mask = data[1 : 1+length]
+				data = data[1+length:]
+			case '~':
+				data = data[1:]
+				wordSize, _ = number()
+			case '+':
+				data = data[1:]
+				rule.rangeLen, _ = number()
+			default:
+				data = data[1:] // Unknown extension: skip to the end of the line
+			}
+		}
+		if len(data) > 0 {
+			data = data[1:]
+		}
+		rule.swapWords(wordSize)
+
+		if indent == 0 {
+			section.rules = append(section.rules, rule)
+		} else if indent <= len(stack) {
+			parent := stack[indent-1]
+			parent.children = append(parent.children, rule)
+		}
+		stack = append(stack[:min(indent, len(stack))], rule)
+	}
+
+	slices.SortStableFunc(db.sections, func(a, b magicSection) int { return b.priority - a.priority })
+	return db
+}
+
+// swapWords converts host-endian values (word size 2 or 4) from the file's big endian layout
+func (r *magicRule) swapWords(wordSize int) {
+	if wordSize <= 1 || binary.NativeEndian.Uint16([]byte{1, 0}) != 1 || len(r.value)%wordSize != 0 {
+		return // Big endian host, or nothing to swap
+	}
+	swap := func(b []byte) []byte {
+		out := slices.Clone(b)
+		for i := 0; i+wordSize <= len(out); i += wordSize {
+			slices.Reverse(out[i : i+wordSize])
+		}
+		return out
+	}
+	r.value = swap(r.value)
+	if r.mask != nil {
+		r.mask = swap(r.mask)
+	}
+}
+
+// matches checks the rule (and then its children) against the data
+func (r *magicRule) matches(data []byte) bool {
+	found := false
+	for start := r.offset; start < r.offset+r.rangeLen && start+len(r.value) <= len(data); start++ {
+		if r.matchesAt(data[start : start+len(r.value)]) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false
+	}
+	if len(r.children) == 0 {
+		return true
+	}
+	for _, child := range r.children {
+		if child.matches(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAt compares the value, masked if the rule has a mask
+func (r *magicRule) matchesAt(window []byte) bool {
+	if r.mask == nil {
+		return bytes.Equal(window, r.value)
+	}
+	for i := range window {
+		if window[i]&r.mask[i] != r.value[i]&r.mask[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// match finds the highest priority type whose rules match the data
+func (db *mimeMagic) match(data []byte) (fileType, bool) {
+	for _, section := range db.sections {
+		for _, rule := range section.rules {
+			if rule.matches(data) {
+				text := isTextMIME(section.mime)
+				return fileType{section.mime, describeMIME(section.mime, "data"), text}, true
+			}
+		}
+	}
+	return fileType{}, false
+}
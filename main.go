@@ -1,10 +1,12 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/user"
+	"path/filepath"
 	"runtime"
 	"strings"
 
@@ -23,10 +25,11 @@ const (
 	BORDER_SIZE                    = 1  // Thickness of the screen border (applied on all sides)
 )
 
-// Color and style definitions for various UI components
+// Color and style definitions for various UI components.
+// These are the Silo defaults; applyTheme replaces them with the chosen theme at startup.
 var (
-	borderColor   = lipgloss.Color("#2abbae") // Default border color (teal)
-	selectedColor = lipgloss.Color("#dadb83") // Highlight color (yellow-like)
+	borderColor   lipgloss.TerminalColor = lipgloss.Color("#2abbae") // Default border color (teal)
+	selectedColor lipgloss.TerminalColor = lipgloss.Color("#dadb83") // Highlight color (yellow-like)
 
 	styleScreen = lipgloss.NewStyle().
 			Border(lipgloss.NormalBorder()).
@@ -52,30 +55,108 @@ var (
 			BorderRight(false).
 			BorderBottom(false).
 			BorderForeground(borderColor)
+
+	styleOverlay = lipgloss.NewStyle().
+			Padding(0, 1).
+			Border(lipgloss.NormalBorder()).
+			BorderForeground(selectedColor)
+
+	styleTileSelected = styleTile.
+				BorderForeground(selectedColor).
+				Foreground(selectedColor)
+
+	styleBadge = lipgloss.NewStyle().Faint(true) // Content kind shown on file tiles
+
+	// Row layouts (details, Miller columns)
+	styleDetailsHeader = lipgloss.NewStyle().Bold(true).Foreground(borderColor)
+	styleRowSelected   = lipgloss.NewStyle().Bold(true).Foreground(selectedColor)
+
+	styleTabActive = lipgloss.NewStyle().Bold(true).Foreground(selectedColor) // Title of the tab on screen
+
+	// Git status codes on tiles
+	styleGitStaged   = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))            // Index column (green)
+	styleGitChanged  = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))            // Work tree column (red)
+	styleGitConflict = lipgloss.NewStyle().Foreground(lipgloss.Color("5")).Bold(true) // Unmerged paths (magenta)
+	styleGitIgnored  = lipgloss.NewStyle().Faint(true)
 )
 
 // state contains all mutable information regarding navigation and viewport
 type state struct {
-	currentPath       string // Current path shown on screen
-	coordinateIdx     [2]int // Cursor grid position: [row, col] within the visible area
-	viewportRowOffset int    // Vertical offset from the top of the file list (for scrolling)
+	currentPath       string          // Current path shown on screen
+	coordinateIdx     [2]int          // Cursor grid position: [row, col] within the visible area
+	viewportRowOffset int             // Vertical offset from the top of the file list (for scrolling)
+	filter            string          // Case-insensitive substring that visible names must contain
+	sort              sortOrder       // Order of the tiles
+	sortReverse       bool            // The order is turned around
+	selected          map[string]bool // Paths of marked objects that operations act on
+	expanded          map[string]bool // Directories opened in the tree layout, kept while navigating
 }
 
 // model represents the application state, UI layout, and data
 type model struct {
 	width, height int                // Dimensions of the terminal window (in characters)
-	state         state              // Navigation state
-	objects       []FileSystemObject // Flat list of all objects (files and dirs) in current directory
+	state         state              // Navigation state of the tab on screen
+	tabs          []tab              // Every open tab, the one on screen included
+	tab           int                // Index in tabs of the tab on screen
+	pane          *tab               // Other pane of the dual-pane view, nil with a single pane
+	paneOnLeft    bool               // The other pane is drawn left of the focused one
+	listing       []FileSystemObject // Every object in the current directory, before filtering
+	objects       []FileSystemObject // Flat list of visible objects (files and dirs) after filtering
 	rows, cols    int                // Grid size: number of visible rows and columns based on screen size
+
+	keys         keymap                        // Active key bindings
+	mode         mode                          // Which keymap is in effect (normal, filter, prompt)
+	pendingKeys  []string                      // Keys typed so far of a multi-key sequence such as "gg"
+	filterInput  textInput                     // Text being typed in filter mode
+	prompt       *prompt                       // Active prompt in prompt mode, nil otherwise
+	permGrid     *permGrid                     // Permission bit editor in perms mode, nil otherwise
+	menu         *menu                         // Choices shown in menu mode, nil otherwise
+	openers      []openerRule                  // Rules deciding how files are opened, first match first
+	yanked       []string                      // Paths remembered by yank, used when creating links
+	overlay      *overlay                      // Panel shown in place of the grid (help, file info), nil when closed
+	status       string                        // One-off message (usually an error) shown in the bottom bar
+	watcher      *dirWatcher                   // Reports changes to the current directory on disk
+	paneWatcher  *dirWatcher                   // Reports changes to the other pane's directory in the dual-pane view
+	git          gitTracker                    // Status of the repository around the current directory
+	du           duTracker                     // Recursive directory sizes (disk usage mode)
+	layout       layout                        // How the objects are drawn: tiles or rows
+	details      detailsView                   // Columns of the details layout
+	millerParent millerParent                  // Parent directory shown by the Miller columns layout
+	children     map[string][]FileSystemObject // Listings of the directories expanded in the tree layout
+	childLoads   map[string]bool               // Expanded directories waiting to be read: true once the read started
+	treemapOn    bool                          // Objects are drawn as a treemap sized by disk usage instead of a grid
+	dupes        *dupeView                     // Duplicate groups shown instead of the current directory, nil normally
+	dupeScan     *dupeScan                     // Duplicate search running in the background, nil otherwise
+	tree         *treeBrowser                  // Commit whose tree is shown instead of the disk, nil normally
+	hashJob      *hashJob                      // Checksums being computed in the background, nil otherwise
+	verify       *verifyView                   // Files of a checksum manifest with their verification, nil normally
+	archiveJob   *archiveJob                   // Archive being created or extracted in the background, nil otherwise
+	compare      *dirCompare                   // Comparison of the two panes shown on their objects, nil normally
+	compareJob   *dirCompare                   // Comparison running in the background, nil otherwise
+
+	previewOn   bool     // The preview pane is shown beside the grid
+	preview     *preview // What the pane shows; nil while it's being built
+	previewPath string   // Object the pane shows or is about to show
+	previewDiff bool     // The pane shows git diffs rather than content
+
+	loader       *dirLoader // Streams the current directory in; nil once it's fully loaded
+	listingPath  string     // Directory the listing belongs to; differs from currentPath until loading starts
+	pendingFocus string     // Name to put the cursor on as soon as it streams in
+	refreshing   bool       // A refresh asked for by refreshListing hasn't come back yet
+	spinning     bool       // A spinner tick is scheduled
+	spinnerFrame int        // Current frame of the loading spinner
 }
 
 // initModel returns a fresh model for a given path with initial position at top-left
-func initModel(path string) model {
+func initModel(path string, keys keymap, openers []openerRule) model {
 	return model{
 		state: state{
 			currentPath:   path,
 			coordinateIdx: [2]int{0, 0}, // Start selection at the top-left tile
 		},
+		tabs:    []tab{{}}, // The one tab there is, on screen
+		keys:    keys,
+		openers: openers,
 	}
 }
 
@@ -84,63 +165,150 @@ func (m model) Init() tea.Cmd {
 	return tea.Batch(tea.EnterAltScreen, tea.ClearScreen, tea.WindowSize())
 }
 
+// resize recomputes the grid dimensions from the terminal size
+func (m *model) resize() {
+	// The other pane keeps its cursor on the same object through the new grid size
+	paneFocus := m.paneFocus()
+
+	// The explorer area is beside the preview pane, or half the width with two panes.
+	// The bars' borders overlapping it don't hold tiles.
+	width, height := m.explorerSize()
+	availableHeight := height - 2
+
+	// Determine how many full tiles (including spacing) fit vertically
+	m.rows = availableHeight / (FILE_OBJECT_HEIGHT + FILE_OBJECT_VERTICAL_PADDING)
+	// Determine how many full tiles (including spacing) fit horizontally
+	m.cols = width / (FILE_OBJECT_WIDTH + FILE_OBJECT_HORIZONTAL_PADDING)
+
+	// The row layouts have one object per row: below the header in details, the whole height otherwise
+	switch m.layout {
+	case layoutDetails:
+		m.rows, m.cols = height-1, 1
+	case layoutMiller, layoutTree:
+		m.rows, m.cols = height, 1
+	}
+
+	// Ensure there’s always at least 1 row and 1 column to prevent divide-by-zero or invisible UI
+	if m.rows < 1 {
+		m.rows = 1
+	}
+	if m.cols < 1 {
+		m.cols = 1
+	}
+
+	m.focusPane(paneFocus)
+}
+
 // Update handles terminal events like key presses and window resizes
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
 		// Save new terminal size
 		m.width = msg.Width
 		m.height = msg.Height
 
-		// Compute usable width/height after removing outer borders
-		contentWidth := m.width - (2 * BORDER_SIZE)
-		contentHeight := m.height - (2 * BORDER_SIZE)
-
-		// Deduct top and bottom bar height from total usable height
-		availableHeight := contentHeight - TOP_BAR_HEIGHT - BOTTOM_BAR_HEIGHT
+		// The cursor stays on the same object when the grid is reflowed
+		m.keepFocus(true, func() { m.resize() })
 
-		// Determine how many full tiles (including spacing) fit vertically
-		m.rows = availableHeight / (FILE_OBJECT_HEIGHT + FILE_OBJECT_VERTICAL_PADDING)
-		// Determine how many full tiles (including spacing) fit horizontally
-		m.cols = contentWidth / (FILE_OBJECT_WIDTH + FILE_OBJECT_HORIZONTAL_PADDING)
+	case tea.KeyMsg:
+		cmd = m.handleKey(msg)
+
+	case opResultMsg:
+		cmd = m.showOpResult(msg)
+		m.invalidateDu()
+		// The other pane may well be where things were copied or moved to, and what the comparison showed may have changed too
+		cmd = tea.Batch(cmd, m.readPane(), m.refreshGit(), m.recompare()) // What the comparison showed may have changed too
+
+	case dirChangedMsg:
+		// Stale notifications from the watcher of a directory we already left are dropped.
+		// The directory is re-read in the background, or once loading is done if it's still loading.
+		if msg.watcher == m.watcher {
+			if m.loading() {
+				m.loader.stale = true
+				cmd = m.watcher.wait()
+			} else {
+				cmd = tea.Batch(m.watcher.wait(), refreshCmd(m.state.currentPath))
+			}
+			cmd = tea.Batch(cmd, m.refreshGit())
+			m.invalidateDu()
+		} else if msg.watcher == m.paneWatcher {
+			// The other pane's directory is read again as a whole, which is no slower than what it shows
+			cmd = tea.Batch(m.paneWatcher.wait(), m.readPane())
+		}
 
-		// Ensure there’s always at least 1 row and 1 column to prevent divide-by-zero or invisible UI
-		if m.rows < 1 {
-			m.rows = 1
+	case listingRefreshedMsg:
+		if msg.pane {
+			m.showPaneListing(msg, false)
+		} else {
+			m.showRefreshed(msg)
 		}
-		if m.cols < 1 {
-			m.cols = 1
+
+	case listingMsg:
+		cmd = m.handleListing(msg)
+
+	case childrenMsg:
+		m.showChildren(msg)
+
+	case dupesFoundMsg:
+		m.showDupes(msg)
+
+	case compareDoneMsg:
+		m.showCompare(msg)
+
+	case checksumsMsg:
+		cmd = m.showChecksums(msg)
+
+	case archiveDoneMsg:
+		cmd = m.showArchiveResult(msg)
+
+	case duResultMsg:
+		cmd = m.handleDu(msg)
+
+	case spinnerTickMsg:
+		m.spinning = m.loading() || m.du.scanning() || m.dupeScan != nil || m.hashJob != nil || m.archiveJob != nil || m.compareJob != nil
+		if m.spinning {
+			m.spinnerFrame++
+			cmd = spinnerTick()
 		}
 
-		// Reload file list for new screen layout
-		m.objects = listObjects(m.state.currentPath)
+	case openResultMsg:
+		cmd = tea.Batch(m.showOpenResult(msg), m.refreshGit())
 
-	case tea.KeyMsg:
-		switch msg.String() {
-		case "h":
-			m.state.MoveLeft(m.cols)
-		case "j":
-			m.state.MoveDown(m.rows, m.cols, len(m.objects))
-		case "k":
-			m.state.MoveUp(m.rows, m.cols, len(m.objects))
-		case "l":
-			m.state.MoveRight(m.cols)
-		case "q":
-			return m, tea.Quit
-		case tea.KeyEnter.String():
-			m.handleSelection()
-		case tea.KeyBackspace.String():
-			// Move to parent directory by trimming last path segment
-			segments := strings.Split(m.state.currentPath, "/")
-			m.state.currentPath = strings.Join(segments[:len(segments)-1], "/")
-			m.openCurrentPath()
+	case gitStatusMsg:
+		cmd = m.showGitStatus(msg)
+
+	case gitLogMsg:
+		m.showGitLog(msg)
+
+	case gitPollMsg:
+		cmd = m.pollGit(msg)
+
+	case typesDetectedMsg:
+		// Nothing to do: the next render picks the new types out of the cache
+
+	case previewMsg:
+		m.showPreview(msg)
+
+	case fileDetailsMsg:
+		// Details gathered in the background are ready: show them in the info panel
+		if msg.err != nil {
+			m.status = msg.err.Error()
+		} else {
+			m.openOverlay(filepath.Base(msg.details.Path), msg.details.lines())
 		}
 	}
 
-	// Ensure cursor remains within bounds of updated object list
-	idx := (m.state.viewportRowOffset+m.state.coordinateIdx[0])*m.cols + m.state.coordinateIdx[1]
+	// Ensure cursor remains within bounds of updated object list.
+	// A cursor before the start, as moving in an empty list once left it, goes back to the top.
+	idx := m.selectedIndex()
+	if idx < 0 || m.state.coordinateIdx[0] < 0 || m.state.coordinateIdx[1] < 0 || m.state.viewportRowOffset < 0 {
+		m.state.MoveTop()
+		idx = 0
+	}
 
-	if idx >= len(m.objects) && len(m.objects) > 0 {
+	if idx >= len(m.objects) && len(m.objects) > 0 && m.cols > 0 {
 		last := len(m.objects) - 1
 
 		// Calculate object's row and column in the full list (0-based)
@@ -159,27 +327,34 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.state.coordinateIdx[1] = lastCol
 	}
 
-	return m, nil
+	// Load and watch the current directory after any navigation; stat what's on screen first
+	m.syncTreemap()
+	m.syncMiller()
+	cmd = tea.Batch(cmd, m.syncLoader(), m.syncChildren(), m.syncWatcher(), m.syncPaneWatcher(), m.requestVisibleTypes(), m.syncPreview(), m.syncGit(), m.syncDu())
+	m.requestVisibleStats()
+	return m, cmd
 }
 
-// View constructs the entire screen output as a string and returns it.
-// It builds the top bar (path), file grid, and bottom bar (key hints),
-// and arranges them vertically within the available content area.
-func (m model) View() string {
-	// Calculate dimensions of usable area inside the border
+// explorerSize is the area left for the grid (or treemap) between the bars, beside the preview pane.
+// In the dual-pane view, it's the area of one pane.
+func (m model) explorerSize() (int, int) {
 	contentWidth := m.width - (2 * BORDER_SIZE)
 	contentHeight := m.height - (2 * BORDER_SIZE)
 
-	// Calculate the height left for the file explorer section (grid of files)
-	// Add 2 to prevent clipping due to border interactions or rounding
-	explorerHeight := contentHeight - TOP_BAR_HEIGHT - BOTTOM_BAR_HEIGHT + 2
+	// The bars' borders overlap the explorer by one row each
+	width, height := contentWidth-m.previewWidth(), contentHeight-TOP_BAR_HEIGHT-BOTTOM_BAR_HEIGHT+2
 
-	// Render the top bar: breadcrumb-style path navigation
-	topBar := styleTopBar.
-		Width(contentWidth).
-		Render(m.state.currentPathBreadcrumb(contentWidth))
+	// Each pane of the dual-pane view gets half, less the separator and the title
+	if m.pane != nil {
+		width, height = (width-1)/2, height-1
+	}
+	return width, height
+}
 
+// renderGrid draws the visible objects as rows of tiles, centered in the area beside the preview pane
+func (m model) renderGrid(width, height int) string {
 	var fileExplorerRows []string
+	total := m.duTotal() // What the disk usage bars are relative to
 
 	// Build the 2D grid row by row
 	for rowIdx := 0; rowIdx < m.rows; rowIdx++ {
@@ -195,17 +370,49 @@ func (m model) View() string {
 				continue
 			}
 
-			// Highlight tile if it's currently selected
+			// Highlight tile if it's currently selected; otherwise color the name by object type
 			style := styleTile
-			if rowIdx == m.state.coordinateIdx[0] && colIdx == m.state.coordinateIdx[1] {
-				style = style.
-					BorderForeground(selectedColor).
-					Foreground(selectedColor)
+			nameStyle := objectStyle(m.objects[objectIdx])
+			focused := rowIdx == m.state.coordinateIdx[0] && colIdx == m.state.coordinateIdx[1]
+			if focused {
+				style = styleTileSelected
+				nameStyle = lipgloss.NewStyle() // Let the selection color show through
+			}
+
+			// Describe the content once it has been sniffed in the background
+			badge := ""
+			if t, ok := objectType(m.objects[objectIdx]); ok {
+				badge = t.Description
+			}
+			// In the duplicates view, say which group the copy belongs to instead
+			if m.dupes != nil {
+				badge = m.dupes.badge(m.objects[objectIdx].Path)
+			}
+			// When verifying a manifest, whether the file matches its sum, in the name's color too
+			if m.verify != nil {
+				if result, resultStyle, ok := m.verify.result(m.objects[objectIdx].Path); ok {
+					badge = result
+					if !focused {
+						nameStyle = resultStyle
+					}
+				}
+			}
+			// When the panes are compared, how the object relates to the one in the other pane
+			if m.compare != nil {
+				if result, resultStyle, ok := m.compare.result(m.objects[objectIdx].Path); ok {
+					badge = result
+					if !focused {
+						nameStyle = resultStyle
+					}
+				}
 			}
 
+			// In disk usage mode directories show their recursive size and every tile its share
+			dirSize, bar := m.duTileInfo(m.objects[objectIdx], total, FILE_OBJECT_WIDTH-2)
+
 			// Render a single tile (file or folder)
 			cols = append(cols, style.Render(
-				renderFileTile(m.objects[objectIdx], FILE_OBJECT_WIDTH-2),
+				renderFileTile(m.objects[objectIdx], FILE_OBJECT_WIDTH-2, nameStyle, m.state.selected[m.objects[objectIdx].Path], badge, m.gitBadge(m.objects[objectIdx]), dirSize, bar),
 			))
 		}
 
@@ -213,31 +420,113 @@ func (m model) View() string {
 		fileExplorerRows = append(fileExplorerRows, lipgloss.JoinHorizontal(lipgloss.Top, cols...))
 	}
 
-	// Center the entire grid horizontally within the content area
+	// Center the entire grid horizontally within the space the preview pane leaves
 	gridWidth := m.cols * (FILE_OBJECT_WIDTH + FILE_OBJECT_HORIZONTAL_PADDING)
-	marginLeft := (contentWidth - gridWidth) / 2
+	marginLeft := (width - gridWidth) / 2
 	if marginLeft < 0 {
 		marginLeft = 0
 	}
 
 	// Final rendering of the file explorer block
-	fileExplorer := lipgloss.NewStyle().
+	return lipgloss.NewStyle().
 		MarginLeft(marginLeft).
-		Height(explorerHeight).
+		Width(width - marginLeft).
+		Height(height).
 		Render(lipgloss.JoinVertical(lipgloss.Left, fileExplorerRows...))
+}
+
+// renderExplorer draws the objects in the chosen layout, unless the treemap takes the whole area
+func (m model) renderExplorer(width, height int) string {
+	switch {
+	case m.treemapOn:
+		return m.renderTreemap(width, height)
+	case m.layout == layoutDetails:
+		return m.renderDetails(width, height)
+	case m.layout == layoutMiller:
+		return m.renderMiller(width, height)
+	case m.layout == layoutTree:
+		return m.renderTree(width, height)
+	}
+	return m.renderGrid(width, height)
+}
+
+// View constructs the entire screen output as a string and returns it.
+// It builds the top bar (path), file grid, and bottom bar (key hints),
+// and arranges them vertically within the available content area.
+func (m model) View() string {
+	// Calculate dimensions of usable area inside the border
+	contentWidth := m.width - (2 * BORDER_SIZE)
+	contentHeight := m.height - (2 * BORDER_SIZE)
+
+	// Calculate the area left for the file explorer section (grid of files)
+	gridArea, explorerHeight := m.explorerSize()
+
+	// Render the top bar: breadcrumb-style path navigation, plus the repository's branch,
+	// the directory total in disk usage mode, the sort order, the loading spinner and the active filter if any
+	rightLabel := m.gitLabel() + m.dupesLabel() + m.compareLabel() + m.checksumLabel() + m.archiveLabel() + m.duLabel() + m.sortLabel() + m.loadingLabel()
+	if m.state.filter != "" && m.mode != modeFilter {
+		rightLabel += "/" + m.state.filter + " "
+	}
+	// Tab titles follow the breadcrumb, which is shortened to make room for them
+	tabs := m.tabsLabel()
+	topText := m.breadcrumb(contentWidth-lipgloss.Width(tabs)) + tabs
+	if rightLabel != "" {
+		topText = spaceBetween([]string{
+			m.breadcrumb(contentWidth-lipgloss.Width(rightLabel)-lipgloss.Width(tabs)-1) + tabs,
+			rightLabel,
+		}, contentWidth)
+	}
+	topBar := styleTopBar.
+		Width(contentWidth).
+		Render(topText)
+
+	// The dual-pane view draws the other pane beside this one, each under a title
+	fileExplorer := m.renderExplorer(gridArea, explorerHeight)
+	if m.pane != nil {
+		fileExplorer = m.renderPanes(fileExplorer, gridArea, explorerHeight)
+		explorerHeight++
+	}
 
-	// Key hint items shown at bottom
-	navItems := []string{
-		"h/j/k/l - move",
-		"⏎ - open/navigate",
-		"⌫ - up",
-		"q - quit",
+	// The preview pane sits to the right of the grid
+	if m.previewWidth() > 0 {
+		fileExplorer = lipgloss.JoinHorizontal(lipgloss.Top, fileExplorer, m.preview.render(m.previewWidth(), explorerHeight))
+	}
+
+	// An open overlay or editor takes the place of the grid
+	switch {
+	case m.overlay != nil:
+		fileExplorer = m.overlay.render(contentWidth, explorerHeight)
+	case m.permGrid != nil:
+		fileExplorer = lipgloss.Place(contentWidth, explorerHeight, lipgloss.Center, lipgloss.Center, m.permGrid.render())
+	case m.menu != nil:
+		fileExplorer = lipgloss.Place(contentWidth, explorerHeight, lipgloss.Center, lipgloss.Center, m.menu.render(explorerHeight))
+	}
+
+	// Key hint items shown at bottom, generated from the active keymap
+	navItems := m.keys.hints(m.mode)
+	if len(navItems) == 0 {
+		navItems = []string{""}
+	}
+
+	// Text entry modes show the line being typed before the hints
+	switch {
+	case m.mode == modeFilter:
+		navItems = append([]string{"/" + m.filterInput.View()}, navItems...)
+	case m.mode == modePrompt && m.prompt != nil:
+		navItems = append([]string{m.prompt.label + ": " + m.prompt.input.View()}, navItems...)
+	case m.status != "":
+		navItems = []string{m.status}
+	}
+
+	// Drop trailing hints that don't fit rather than wrapping the bar onto a second line
+	for len(navItems) > 1 && lipgloss.Width(strings.Join(navItems, " ")) > contentWidth-2 {
+		navItems = navItems[:len(navItems)-1]
 	}
 
 	// Calculate total fixed length of nav items (text only)
 	totalItemLength := 0
 	for _, item := range navItems {
-		totalItemLength += len(item)
+		totalItemLength += lipgloss.Width(item)
 	}
 	// Calculate spacing between nav items so they spread across the width
 	spacesNeeded := contentWidth - totalItemLength - 2 // Allow for some margin
@@ -300,11 +589,20 @@ func getHomeDir() string {
 // main is the entry point of the application.
 // It determines the initial path to explore and starts the Bubble Tea program.
 func main() {
+	themeFlag := flag.String("theme", "", "color theme to use (silo, amber, green or one from the config file)")
+	lsColorsFlag := flag.Bool("ls-colors", false, "color tiles using the LS_COLORS environment variable")
+	oneFilesystemFlag := flag.Bool("one-file-system", false, "don't count other filesystems mounted below a directory in disk usage mode")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [path]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
 	var argPath string
 
-	if len(os.Args) > 1 {
+	if flag.NArg() > 0 {
 		// Use user-supplied argument if provided
-		argPath = os.Args[1]
+		argPath = flag.Arg(0)
 	} else {
 		// Attempt to use current working directory
 		var err error
@@ -327,8 +625,41 @@ func main() {
 		argPath = strings.Join(segments[0:len(segments)-1], "/")
 	}
 
+	// Load user configuration and build the key bindings from it
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Could not load config: %v", err)
+	}
+	keys, err := newKeymap(cfg.Keys)
+	if err != nil {
+		log.Fatalf("Invalid key bindings: %v", err)
+	}
+
+	// Pick the theme: command line flag first, then config, then the Silo default
+	themeName := cfg.Theme
+	if *themeFlag != "" {
+		themeName = *themeFlag
+	}
+	if themeName == "" {
+		themeName = "silo"
+	}
+	t, err := resolveTheme(themeName, cfg.Themes)
+	if err != nil {
+		log.Fatalf("Invalid theme: %v", err)
+	}
+	applyTheme(t)
+	if *lsColorsFlag || cfg.LSColors {
+		loadLSColors()
+	}
+
 	// Start the terminal UI program using Bubble Tea
-	p := tea.NewProgram(initModel(argPath), tea.WithAltScreen())
+	m := initModel(argPath, keys, append(cfg.Openers, defaultOpeners()...))
+	m.du.oneFilesystem = *oneFilesystemFlag || cfg.DuOneFilesystem
+	m.details, err = newDetailsView(cfg.DetailsColumns)
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	p := tea.NewProgram(m, tea.WithAltScreen())
 	if _, err := p.Run(); err != nil {
 		fmt.Printf("Error: %v", err)
 		os.Exit(1)
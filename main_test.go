@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// newTestModel returns a model showing dir, listed and laid out as on a 120x40 terminal
+func newTestModel(t testing.TB, dir string) model {
+	t.Helper()
+	keys, err := newKeymap(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := initModel(dir, keys, nil)
+	m.width, m.height = 120, 40
+	m.resize()
+	m.listing, err = listObjects(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.listingPath = dir
+	m.applyFilter()
+	return m
+}
+
+// tempDir returns a fresh directory with symlinks resolved, so paths compare equal to those listed
+func tempDir(t testing.TB) string {
+	t.Helper()
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// writeFile creates a file below dir, with the directories it's in, and sets its modification time
+// unless mtime is zero
+func writeFile(t testing.TB, dir, rel, content string, mtime time.Time) string {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !mtime.IsZero() {
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+// readFile returns a file's content, failing the test when it can't be read
+func readFile(t testing.TB, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// assertMissing fails the test when something exists at path
+func assertMissing(t testing.TB, path string) {
+	t.Helper()
+	if _, err := os.Lstat(path); err == nil {
+		t.Errorf("%s exists, it shouldn't", path)
+	}
+}
+
+// markPaths marks objects of the model, as Space does
+func markPaths(m *model, paths ...string) {
+	m.state.selected = map[string]bool{}
+	for _, path := range paths {
+		m.state.selected[path] = true
+	}
+}
+
+// testTrash points the trash at a temporary directory and returns the directory trashed files
+// go to. The test is skipped where the trash isn't the freedesktop.org one.
+func testTrash(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		t.Skip("the trash is the user's own here")
+	}
+	home := tempDir(t)
+	t.Setenv("XDG_DATA_HOME", home)
+	return filepath.Join(home, "Trash", "files")
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// menu is a list of choices drawn in place of the grid, navigated in menu mode
+type menu struct {
+	title     string
+	items     []string
+	cursor    int
+	onSelect  func(m *model, idx int) tea.Cmd // Called with the chosen item's index
+	onDefault func(m *model, idx int) tea.Cmd // Makes the item the default choice; nil if the menu has no defaults
+}
+
+// openMenu shows a menu and switches to menu mode
+func (m *model) openMenu(title string, items []string, onSelect func(m *model, idx int) tea.Cmd) {
+	m.menu = &menu{title: title, items: items, onSelect: onSelect}
+	m.mode = modeMenu
+}
+
+// closeMenu hides the menu and goes back to the grid
+func (m *model) closeMenu() {
+	m.menu = nil
+	m.mode = modeNormal
+}
+
+// handleMenuAction moves the menu cursor and picks or dismisses the menu.
+// It reports whether the action was meant for the menu.
+func (m *model) handleMenuAction(a action) (tea.Cmd, bool) {
+	mn := m.menu
+	switch a {
+	case actionMoveUp:
+		mn.cursor = (mn.cursor + len(mn.items) - 1) % len(mn.items)
+	case actionMoveDown:
+		mn.cursor = (mn.cursor + 1) % len(mn.items)
+	case actionPromptSubmit:
+		m.closeMenu()
+		return mn.onSelect(m, mn.cursor), true
+	case actionMenuDefault:
+		if mn.onDefault == nil {
+			m.status = "this menu has no default to change"
+			return nil, true
+		}
+		m.closeMenu()
+		return mn.onDefault(m, mn.cursor), true
+	case actionPromptCancel:
+		m.closeMenu()
+	default:
+		return nil, false
+	}
+	return nil, true
+}
+
+// render draws the menu as a panel with the cursor's item highlighted.
+// Menus taller than the given height show a window of items that follows the cursor.
+func (mn menu) render(height int) string {
+	// Leave room for the panel border, title and blank line under it
+	visible := max(height-4, 1)
+	first := 0
+	if len(mn.items) > visible {
+		first = min(max(mn.cursor-visible/2, 0), len(mn.items)-visible)
+	}
+
+	var lines []string
+	for i, item := range mn.items[first:min(first+visible, len(mn.items))] {
+		if first+i == mn.cursor {
+			lines = append(lines, styleCursor.Render("> "+item))
+		} else {
+			lines = append(lines, "  "+item)
+		}
+	}
+
+	title := lipgloss.NewStyle().Bold(true).Render(mn.title)
+	return styleOverlay.Render(lipgloss.JoinVertical(lipgloss.Left, title, "", strings.Join(lines, "\n")))
+}
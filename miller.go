@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// millerParent is the listing of the parent directory, shown left of the current one in the
+// Miller columns layout. Only names and types are read: it's there to see where we are.
+type millerParent struct {
+	path    string // Directory listed; empty until it's read, or to have it read again
+	objects []FileSystemObject
+}
+
+// syncMiller reads the parent directory when the Miller columns show a new one
+func (m *model) syncMiller() {
+	if m.layout != layoutMiller {
+		return
+	}
+	parent := filepath.Dir(m.state.currentPath)
+	if m.millerParent.path == parent {
+		return
+	}
+	m.millerParent = millerParent{path: parent}
+
+	switch {
+	case parent == m.state.currentPath:
+		// The root has no parent
+	case m.tree != nil:
+		if !m.tree.atRoot(m.state.currentPath) {
+			m.millerParent.objects, _ = m.tree.list(parent)
+		}
+	case m.virtualList() != nil:
+		// Duplicates and manifests are lists of their own, not a level of a hierarchy
+	default:
+		entries, err := os.ReadDir(parent)
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			m.millerParent.objects = append(m.millerParent.objects, newObject(parent, entry))
+		}
+	}
+}
+
+// leaveDir goes up to the parent directory with the cursor on the directory we were in
+func (m *model) leaveDir() tea.Cmd {
+	left := m.state.currentPath
+	cmd := m.runAction(actionParent)
+	if m.state.currentPath == filepath.Dir(left) && m.state.currentPath != left {
+		m.pendingFocus = filepath.Base(left)
+	}
+	return cmd
+}
+
+// millerRight enters the directory under the cursor; files are left to Enter
+func (m *model) millerRight() tea.Cmd {
+	if idx := m.selectedIndex(); idx >= 0 && idx < len(m.objects) && m.objects[idx].IsDir {
+		return m.handleSelection()
+	}
+	return nil
+}
+
+// renderMiller draws the parent directory with the current one highlighted, then the current
+// directory. The preview pane, drawn by View, is the third column.
+func (m model) renderMiller(width, height int) string {
+	// With two panes, each draws its own preview as the last column
+	previewWidth := 0
+	if m.pane != nil {
+		previewWidth = width * 2 / 5
+		width -= previewWidth
+	}
+	parentWidth := width / 3
+	currentWidth := width - parentWidth - 1
+
+	// The parent column is scrolled to keep the current directory in the middle
+	current := -1
+	for i, obj := range m.millerParent.objects {
+		if obj.Path == m.state.currentPath {
+			current = i
+		}
+	}
+	parentOffset := max(min(current-height/2, len(m.millerParent.objects)-height), 0)
+	parent := m.renderMillerColumn(m.millerParent.objects, current, parentOffset, parentWidth, height, false)
+
+	children := m.renderMillerColumn(m.objects, m.selectedIndex(), m.state.viewportRowOffset, currentWidth, height, true)
+
+	separator := lipgloss.NewStyle().Foreground(borderColor).Render(strings.TrimSuffix(strings.Repeat("│\n", height), "\n"))
+	if previewWidth == 0 {
+		return lipgloss.JoinHorizontal(lipgloss.Top, parent, separator, children)
+	}
+	preview := m.preview
+	if idx := m.selectedIndex(); preview != nil && (idx < 0 || idx >= len(m.objects) || m.objects[idx].Path != preview.path) {
+		preview = nil // The pane was read again or taken elsewhere since it had the focus
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Top, parent, separator, children, preview.render(previewWidth, height))
+}
+
+// renderMillerColumn draws one column of names from offset on, the one at cursor highlighted.
+// The column of the current directory also shows marks and file sizes.
+func (m model) renderMillerColumn(objects []FileSystemObject, cursor, offset, width, height int, current bool) string {
+	var lines []string
+	for idx := offset; idx < len(objects) && len(lines) < height; idx++ {
+		obj := objects[idx]
+		focused := idx == cursor
+
+		gutter := " "
+		switch {
+		case current && m.state.selected[obj.Path]:
+			gutter = "✓"
+		case current && focused:
+			gutter = "›"
+		}
+		size := ""
+		if current && obj.Loaded && !obj.IsDir {
+			size = " " + formatSize(obj.Size)
+		}
+		name := fitCell("["+obj.Marker()+"] "+obj.Name, max(width-1-lipgloss.Width(size), 1), false)
+
+		if focused {
+			lines = append(lines, styleRowSelected.Render(gutter+name+size))
+		} else {
+			lines = append(lines, gutter+m.nameStyle(obj).Render(name)+styleBadge.Render(size))
+		}
+	}
+	return lipgloss.NewStyle().Width(width).MaxWidth(width).Height(height).Render(strings.Join(lines, "\n"))
+}
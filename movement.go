@@ -2,7 +2,11 @@ package main
 
 // MoveLeft moves the cursor one column to the left within the current viewport.
 // If the cursor is already at the leftmost column (index 0), it wraps around to the last column.
-func (s *state) MoveLeft(cols int) {
+// With no objects there is nowhere to go.
+func (s *state) MoveLeft(cols, objectsLen int) {
+	if objectsLen == 0 {
+		return
+	}
 	if s.coordinateIdx[1] > 0 {
 		// Normal move: decrement column index
 		s.coordinateIdx[1] -= 1
@@ -57,7 +61,11 @@ func (s *state) MoveDown(rows, cols, objectsLen int) {
 // MoveUp moves the cursor one row up within the grid.
 // If the cursor is already at the top of the viewport, it scrolls up.
 // If already at the top of the list, it wraps to the last visible object.
+// With no objects there is nowhere to go: wrapping would put the cursor before the start.
 func (s *state) MoveUp(rows, cols, objectsLen int) {
+	if objectsLen == 0 {
+		return
+	}
 	if s.coordinateIdx[0] > 0 {
 		// If not at top row of viewport, move up locally
 		s.coordinateIdx[0] -= 1
@@ -85,3 +93,40 @@ func (s *state) MoveUp(rows, cols, objectsLen int) {
 	s.coordinateIdx[0] = (lastIdx / cols) - s.viewportRowOffset // Final row index, adjusted to viewport
 	s.coordinateIdx[1] = lastIdx % cols                         // Final column index
 }
+
+// MoveTop jumps to the first object and scrolls the viewport back to the start of the list.
+func (s *state) MoveTop() {
+	s.viewportRowOffset = 0
+	s.coordinateIdx = [2]int{0, 0}
+}
+
+// MoveBottom jumps to the last object, scrolling so that its row is the last visible one.
+func (s *state) MoveBottom(rows, cols, objectsLen int) {
+	if objectsLen == 0 {
+		s.MoveTop()
+		return
+	}
+	s.FocusIndex(objectsLen-1, rows, cols)
+}
+
+// FocusIndex places the cursor on the object at the given index in the flat list.
+// The viewport only scrolls if the object's row is currently outside of it.
+func (s *state) FocusIndex(idx, rows, cols int) {
+	if idx < 0 || cols < 1 {
+		return
+	}
+
+	// Translate the flat index into a global row and a column
+	globalRow := idx / cols
+	col := idx % cols
+
+	if globalRow < s.viewportRowOffset {
+		// Row is above the viewport: scroll up until it's the first visible row
+		s.viewportRowOffset = globalRow
+	} else if globalRow >= s.viewportRowOffset+rows {
+		// Row is below the viewport: scroll down until it's the last visible row
+		s.viewportRowOffset = globalRow - rows + 1
+	}
+
+	s.coordinateIdx = [2]int{globalRow - s.viewportRowOffset, col}
+}
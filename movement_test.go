@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestMoveInEmptyListStays(t *testing.T) {
+	var s state
+	s.MoveUp(5, 3, 0)
+	s.MoveLeft(3, 0)
+	if s.coordinateIdx != [2]int{0, 0} || s.viewportRowOffset != 0 {
+		t.Errorf("cursor moved to %v, offset %d", s.coordinateIdx, s.viewportRowOffset)
+	}
+}
+
+func TestMoveUpWrapsToLast(t *testing.T) {
+	var s state
+	s.MoveUp(2, 3, 8) // Three rows of three, two of them on screen
+	if s.viewportRowOffset != 1 || s.coordinateIdx != [2]int{1, 1} {
+		t.Errorf("cursor at %v, offset %d; want the last object, index 7", s.coordinateIdx, s.viewportRowOffset)
+	}
+}
+
+// pressKeys sends keys to the model as the terminal would, one message per key
+func pressKeys(m model, keys ...tea.KeyMsg) model {
+	for _, k := range keys {
+		next, _ := m.Update(k)
+		m = next.(model)
+	}
+	return m
+}
+
+func TestEmptyFilterThenUpDoesNotPanic(t *testing.T) {
+	dir := tempDir(t)
+	for _, name := range []string{"a", "b", "c"} {
+		writeFile(t, dir, name, name, time.Time{})
+	}
+	m := newTestModel(t, dir)
+
+	runes := func(s string) tea.KeyMsg { return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)} }
+	m = pressKeys(m, runes("/"), runes("zzz"))
+	if len(m.objects) != 0 {
+		t.Fatalf("%d objects match zzz", len(m.objects))
+	}
+	m = pressKeys(m, tea.KeyMsg{Type: tea.KeyUp}, tea.KeyMsg{Type: tea.KeyEsc})
+	if len(m.objects) != 3 {
+		t.Fatalf("%d objects after clearing the filter, want 3", len(m.objects))
+	}
+	if idx := m.selectedIndex(); idx < 0 || idx >= len(m.objects) {
+		t.Fatalf("cursor at index %d", idx)
+	}
+	// Enter opens whatever is under the cursor; it must not index before the start
+	m.handleSelection()
+	m.followLink()
+	m.toggleSelected()
+}
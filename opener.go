@@ -0,0 +1,389 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// openerRule says how to open matching files, e.g.
+//
+//	{"name": "Vim", "match": ["text/*", "*.conf"], "command": "vim {path}", "terminal": true}
+//
+// Match patterns are MIME types when they contain a slash ("image/png", "text/*"), extensions
+// when they start with a dot (".md"), and shell globs on the file name otherwise ("Makefile", "*.tar.*").
+// The command is split like a shell would split it; $VARS are expanded first, then the placeholders
+// {path}, {name}, {dir} and {paths} (every target as separate arguments). Without any placeholder,
+// the path is appended.
+type openerRule struct {
+	Name     string   `json:"name"`     // Label in the open-with menu; the command is shown if empty
+	Match    []string `json:"match"`    // Patterns, any of which selects the rule
+	Command  string   `json:"command"`  // Command template
+	Terminal bool     `json:"terminal"` // A terminal app: cdx hands it the screen until it exits
+	Wait     bool     `json:"wait"`     // Wait for a GUI app to exit and report its failure (terminal apps always wait)
+
+	build      func(paths []string) ([]*exec.Cmd, error) // Replaces the template (desktop applications)
+	setDefault func() error                              // Makes the rule the system default for the file type, if possible
+}
+
+// fileKind is what opener rules are matched against
+type fileKind struct {
+	name string // Base name
+	mime string // MIME type without parameters, detected only if a rule asks for it
+	text bool   // Content sniffed as text, so "text/*" also matches JSON, scripts...
+}
+
+// openResultMsg reports how an opener that cdx waited for ended
+type openResultMsg struct {
+	label string
+	err   error
+}
+
+// systemOpenCommand is the platform's "open with the default application" command
+func systemOpenCommand() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "open {path}"
+	case "windows":
+		return "rundll32 url.dll,FileProtocolHandler {path}"
+	default:
+		return "xdg-open {path}"
+	}
+}
+
+// editorCommand is the user's preferred terminal editor
+func editorCommand() string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if editor := os.Getenv(name); editor != "" {
+			return editor
+		}
+	}
+	return "vi"
+}
+
+// defaultOpeners are always available after the user's rules. The system default comes first
+// so Enter keeps handing files to the desktop unless a user rule says otherwise.
+func defaultOpeners() []openerRule {
+	return []openerRule{
+		{Name: "System default", Match: []string{"*"}, Command: systemOpenCommand()},
+		{Name: "Editor", Match: []string{"text/*"}, Command: editorCommand() + " {path}", Terminal: true},
+		{Name: "Pager", Match: []string{"text/*"}, Command: "less {path}", Terminal: true},
+		{Name: "Manual page", Match: []string{"*.[1-9]", "*.[1-9].gz", "*.[1-9]x"}, Command: "man {path}", Terminal: true},
+	}
+}
+
+// label is how the rule appears in the open-with menu
+func (r openerRule) label() string {
+	label := r.Name
+	if label == "" {
+		label = r.Command
+	}
+	if r.Terminal {
+		label += " (terminal)"
+	}
+	return label
+}
+
+// usesMIME reports whether any of the rule's patterns needs the file's MIME type
+func (r openerRule) usesMIME() bool {
+	for _, pattern := range r.Match {
+		if strings.Contains(pattern, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether the rule applies to a file
+func (r openerRule) matches(kind fileKind) bool {
+	name := strings.ToLower(kind.name)
+	for _, pattern := range r.Match {
+		pattern = strings.ToLower(pattern)
+		switch {
+		case strings.Contains(pattern, "/"):
+			if pattern == kind.mime || pattern == "text/*" && kind.text {
+				return true
+			}
+			if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(kind.mime, prefix+"/") {
+				return true
+			}
+		case strings.HasPrefix(pattern, ".") && !strings.ContainsAny(pattern, "*?["):
+			if strings.HasSuffix(name, pattern) {
+				return true
+			}
+		default:
+			if ok, _ := filepath.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// detectKind gathers what rules match on; the content is only sniffed when a rule needs its MIME type
+func detectKind(path string, needMIME bool) fileKind {
+	kind := fileKind{name: filepath.Base(path)}
+	if needMIME {
+		t := detectType(path)
+		kind.mime, kind.text = t.MIME, t.Text
+	}
+	return kind
+}
+
+// needsMIME reports whether any rule matches on MIME types
+func (m model) needsMIME() bool {
+	for _, rule := range m.openers {
+		if rule.usesMIME() {
+			return true
+		}
+	}
+	return false
+}
+
+// detectKinds gathers what rules match on for every path
+func detectKinds(paths []string, needMIME bool) []fileKind {
+	kinds := make([]fileKind, len(paths))
+	for i, path := range paths {
+		kinds[i] = detectKind(path, needMIME)
+	}
+	return kinds
+}
+
+// matchingOpeners lists the rules that apply to every one of the files
+func (m model) matchingOpeners(kinds []fileKind) []openerRule {
+	var rules []openerRule
+	for _, rule := range m.openers {
+		all := true
+		for _, kind := range kinds {
+			all = all && rule.matches(kind)
+		}
+		if all {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// splitCommand splits a command line into arguments, honouring single and double quotes
+// and backslash escapes outside single quotes
+func splitCommand(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\\' && i+1 < len(runes):
+			i++
+			current.WriteRune(runes[i])
+			inArg = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote in command")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// commands builds the processes that open the paths: a single one when the template takes
+// {paths}, one per path otherwise
+func (r openerRule) commands(paths []string) ([]*exec.Cmd, error) {
+	if r.build != nil {
+		return r.build(paths)
+	}
+
+	args, err := splitCommand(os.ExpandEnv(r.Command))
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%s: empty command", r.label())
+	}
+
+	placeholder := false
+	for _, arg := range args {
+		placeholder = placeholder || strings.Contains(arg, "{path}") || strings.Contains(arg, "{name}") ||
+			strings.Contains(arg, "{dir}") || arg == "{paths}"
+	}
+	if !placeholder {
+		args = append(args, "{path}")
+	}
+
+	// expand fills in the placeholders for one invocation
+	expand := func(path string) *exec.Cmd {
+		replacer := strings.NewReplacer("{path}", path, "{name}", filepath.Base(path), "{dir}", filepath.Dir(path))
+		var argv []string
+		for _, arg := range args {
+			if arg == "{paths}" {
+				argv = append(argv, paths...)
+				continue
+			}
+			argv = append(argv, replacer.Replace(arg))
+		}
+		cmd := exec.Command(argv[0], argv[1:]...)
+		cmd.Dir = filepath.Dir(path)
+		return cmd
+	}
+
+	if strings.Contains(r.Command, "{paths}") {
+		return []*exec.Cmd{expand(paths[0])}, nil
+	}
+	cmds := make([]*exec.Cmd, len(paths))
+	for i, path := range paths {
+		cmds[i] = expand(path)
+	}
+	return cmds, nil
+}
+
+// runOpener opens the paths with a rule. Terminal apps take over the screen one after the
+// other; GUI apps are either waited for in the background or started and left alone.
+func (m *model) runOpener(rule openerRule, paths []string) tea.Cmd {
+	cmds, err := rule.commands(paths)
+	if err != nil {
+		m.status = err.Error()
+		return nil
+	}
+	label := rule.label()
+
+	if rule.Terminal {
+		steps := make([]tea.Cmd, len(cmds))
+		for i, cmd := range cmds {
+			steps[i] = tea.ExecProcess(cmd, func(err error) tea.Msg {
+				return openResultMsg{label: label, err: err}
+			})
+		}
+		return tea.Sequence(steps...)
+	}
+
+	if rule.Wait {
+		return func() tea.Msg {
+			for _, cmd := range cmds {
+				if err := cmd.Run(); err != nil {
+					return openResultMsg{label: label, err: err}
+				}
+			}
+			return openResultMsg{label: label}
+		}
+	}
+
+	for _, cmd := range cmds {
+		if err := cmd.Start(); err != nil {
+			m.status = fmt.Sprintf("%s: %v", label, err)
+			return nil
+		}
+		go cmd.Wait() // Reap the process whenever it exits
+	}
+	return nil
+}
+
+// openFile opens a file with the first rule that matches it
+func (m *model) openFile(path string) tea.Cmd {
+	rules := m.matchingOpeners(detectKinds([]string{path}, m.needsMIME()))
+	if len(rules) == 0 {
+		m.status = "no opener for " + filepath.Base(path)
+		return nil
+	}
+	return m.runOpener(rules[0], []string{path})
+}
+
+// openWithMenu lists every rule that can open the targets, followed by the applications
+// registered for their MIME type when they all share one, and runs the chosen one.
+// Registered applications can also be made the default for that type from the menu.
+func (m *model) openWithMenu() {
+	var paths []string
+	for _, obj := range m.targets() {
+		if obj.IsDir || !obj.Mode.IsRegular() && !obj.IsSymlink() {
+			continue // Only files can be opened with applications
+		}
+		paths = append(paths, obj.Path)
+	}
+	if len(paths) == 0 {
+		m.status = "nothing to open"
+		return
+	}
+
+	kinds := detectKinds(paths, true)
+	rules := m.matchingOpeners(kinds)
+	mimeType := kinds[0].mime
+	for _, kind := range kinds {
+		if kind.mime != mimeType {
+			mimeType = ""
+		}
+	}
+	if mimeType != "" {
+		rules = append(rules, desktopOpeners(mimeType)...)
+	}
+	if len(rules) == 0 {
+		m.status = "no opener for these files"
+		return
+	}
+	labels := make([]string, len(rules))
+	for i, rule := range rules {
+		labels[i] = rule.label()
+	}
+
+	title := "Open " + filepath.Base(paths[0]) + " with"
+	if len(paths) > 1 {
+		title = fmt.Sprintf("Open %d files with", len(paths))
+	}
+	m.openMenu(title, labels, func(m *model, idx int) tea.Cmd {
+		return m.runOpener(rules[idx], paths)
+	})
+	m.menu.onDefault = func(m *model, idx int) tea.Cmd {
+		rule := rules[idx]
+		if rule.setDefault == nil {
+			m.status = "only registered applications can be made the default"
+			return nil
+		}
+		if err := rule.setDefault(); err != nil {
+			m.status = err.Error()
+			return nil
+		}
+		m.status = fmt.Sprintf("%s now opens %s", strings.TrimSuffix(rule.Name, " (default)"), mimeType)
+		return nil
+	}
+}
+
+// showOpenResult reports an opener that failed; the listing is refreshed in case it changed files
+func (m *model) showOpenResult(msg openResultMsg) tea.Cmd {
+	if msg.err != nil {
+		m.status = fmt.Sprintf("%s: %v", msg.label, msg.err)
+	}
+	return m.refreshListing()
+}
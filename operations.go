@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// pathError records why an operation failed on one path of a batch
+type pathError struct {
+	path string
+	err  error
+}
+
+// opResultMsg reports the outcome of a batch operation run in the background.
+// Failures on individual paths never abort the batch; they're collected here instead.
+type opResultMsg struct {
+	verb     string      // What was done, e.g. "chmod 644"
+	done     int         // Number of paths changed successfully
+	failures []pathError // Paths that could not be changed, with the reason
+	focus    string      // Name of an object to put the cursor on afterwards, if any
+}
+
+// runBatch runs fn for every path in the background and reports all failures at the end
+func runBatch(verb string, paths []string, fn func(path string) (int, []pathError)) tea.Cmd {
+	return func() tea.Msg {
+		result := opResultMsg{verb: verb}
+		for _, path := range paths {
+			done, failures := fn(path)
+			result.done += done
+			result.failures = append(result.failures, failures...)
+		}
+		return result
+	}
+}
+
+// focusAfter makes the cursor land on the named object once a batch's result comes in
+func focusAfter(cmd tea.Cmd, name string) tea.Cmd {
+	return func() tea.Msg {
+		msg := cmd()
+		if result, ok := msg.(opResultMsg); ok {
+			result.focus = name
+			return result
+		}
+		return msg
+	}
+}
+
+// showOpResult refreshes the listing after an operation and tells the user how it went.
+// A clean run only gets a status line; partial failures open a panel listing every failed path.
+// The returned command brings the refreshed listing in.
+func (m *model) showOpResult(msg opResultMsg) tea.Cmd {
+	cmd := m.refreshListing()
+	if msg.focus != "" {
+		m.revealName(msg.focus)
+	}
+
+	if len(msg.failures) == 0 {
+		m.status = fmt.Sprintf("%s: %d changed", msg.verb, msg.done)
+		return cmd
+	}
+
+	lines := []string{fmt.Sprintf("%d changed, %d failed:", msg.done, len(msg.failures)), ""}
+	for _, f := range msg.failures {
+		lines = append(lines, fmt.Sprintf("%s: %v", f.path, f.err))
+	}
+	m.openOverlay(msg.verb, lines)
+	return cmd
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+
+	lipgloss "github.com/charmbracelet/lipgloss"
+)
+
+// overlay is a read-only panel drawn in place of the grid (help, file info, ...).
+// Any key closes it.
+type overlay struct {
+	title string   // Heading shown on the first line
+	lines []string // Body text, one entry per line
+}
+
+// openOverlay shows a panel with the given title and content
+func (m *model) openOverlay(title string, lines []string) {
+	m.overlay = &overlay{title: title, lines: lines}
+}
+
+// render draws the overlay centered in a box of the given size.
+// Content that is too tall is flowed into extra columns rather than cut off.
+func (o overlay) render(width, height int) string {
+	// Leave room for the panel border, padding, title and blank line under it
+	bodyHeight := height - 4
+	body := columnize(o.lines, bodyHeight)
+	title := lipgloss.NewStyle().Bold(true).Render(o.title)
+
+	panel := styleOverlay.Render(lipgloss.JoinVertical(lipgloss.Left, title, "", body))
+	return lipgloss.Place(width, height, lipgloss.Center, lipgloss.Center, panel)
+}
+
+// keyValueLines formats label/value pairs as aligned "label  value" lines.
+// Pairs with an empty value are left out.
+func keyValueLines(pairs [][2]string) []string {
+	labelWidth := 0
+	for _, p := range pairs {
+		if p[1] != "" && len(p[0]) > labelWidth {
+			labelWidth = len(p[0])
+		}
+	}
+
+	var lines []string
+	for _, p := range pairs {
+		if p[1] == "" {
+			continue
+		}
+		lines = append(lines, p[0]+strings.Repeat(" ", labelWidth-len(p[0])+2)+p[1])
+	}
+	return lines
+}
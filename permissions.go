@@ -0,0 +1,544 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	lipgloss "github.com/charmbracelet/lipgloss"
+)
+
+// chmodSpec computes an object's new mode from its current one.
+// isDir matters for the X permission, which only adds execute to directories
+// and to files that are already executable by someone.
+type chmodSpec func(old fs.FileMode, isDir bool) fs.FileMode
+
+// fromUnixPermBits is the inverse of unixPermBits: it turns 12 classic Unix mode bits
+// into the permission and special bits of a Go FileMode, keeping the type bits of old
+func fromUnixPermBits(old fs.FileMode, bits uint32) fs.FileMode {
+	mode := old.Type() | fs.FileMode(bits&0o777)
+	if bits&0o4000 != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if bits&0o2000 != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if bits&0o1000 != 0 {
+		mode |= fs.ModeSticky
+	}
+	return mode
+}
+
+// parseChmodSpec parses a mode the way chmod(1) does: either octal ("644", "2775")
+// or a comma-separated list of symbolic clauses ("u+x", "go-w", "a=rX", "g=u", "+t")
+func parseChmodSpec(spec string) (chmodSpec, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, errors.New("empty mode")
+	}
+
+	// Octal: up to four digits, replaces the mode entirely
+	if strings.Trim(spec, "01234567") == "" {
+		if len(spec) > 4 {
+			return nil, fmt.Errorf("invalid octal mode %q", spec)
+		}
+		bits, _ := strconv.ParseUint(spec, 8, 32)
+		return func(old fs.FileMode, _ bool) fs.FileMode {
+			return fromUnixPermBits(old, uint32(bits))
+		}, nil
+	}
+
+	// Symbolic: validate every clause up front so a typo doesn't half-apply
+	type change struct {
+		who   uint32 // Mask of the permission bits the clause applies to
+		users string // The who letters, needed for s and t
+		op    byte   // '+', '-' or '='
+		perms string // rwxXst, or a single u/g/o to copy from
+	}
+	var changes []change
+
+	for _, clause := range strings.Split(spec, ",") {
+		i := 0
+		users := ""
+		for i < len(clause) && strings.IndexByte("ugoa", clause[i]) >= 0 {
+			users += string(clause[i])
+			i += 1
+		}
+		if users == "" || strings.Contains(users, "a") {
+			users = "ugo" // No who letters means everyone (we don't apply the umask)
+		}
+
+		var who uint32
+		for _, u := range users {
+			who |= whoMask(byte(u))
+		}
+
+		if i >= len(clause) {
+			return nil, fmt.Errorf("invalid mode clause %q: missing +, - or =", clause)
+		}
+		for i < len(clause) {
+			op := clause[i]
+			if op != '+' && op != '-' && op != '=' {
+				return nil, fmt.Errorf("invalid mode clause %q: unexpected %q", clause, op)
+			}
+			i += 1
+
+			start := i
+			for i < len(clause) && strings.IndexByte("rwxXstugo", clause[i]) >= 0 {
+				i += 1
+			}
+			perms := clause[start:i]
+			if strings.ContainsAny(perms, "ugo") && len(perms) > 1 {
+				return nil, fmt.Errorf("invalid mode clause %q: can't mix %q with other permissions", clause, perms)
+			}
+			changes = append(changes, change{who: who, users: users, op: op, perms: perms})
+		}
+	}
+
+	return func(old fs.FileMode, isDir bool) fs.FileMode {
+		bits := unixPermBits(old)
+		for _, c := range changes {
+			var set uint32
+
+			if len(c.perms) == 1 && strings.Contains("ugo", c.perms) {
+				// Copy another class's rwx bits, e.g. g=u
+				src := (bits & whoMask(c.perms[0]) & 0o777)
+				switch c.perms[0] {
+				case 'u':
+					src >>= 6
+				case 'g':
+					src >>= 3
+				}
+				set = (src | src<<3 | src<<6) & c.who & 0o777
+			} else {
+				for _, p := range c.perms {
+					switch p {
+					case 'r':
+						set |= 0o444 & c.who
+					case 'w':
+						set |= 0o222 & c.who
+					case 'x':
+						set |= 0o111 & c.who
+					case 'X':
+						if isDir || bits&0o111 != 0 {
+							set |= 0o111 & c.who
+						}
+					case 's':
+						set |= (0o4000 | 0o2000) & c.who
+					case 't':
+						set |= 0o1000 & c.who
+					}
+				}
+			}
+
+			switch c.op {
+			case '+':
+				bits |= set
+			case '-':
+				bits &^= set
+			case '=':
+				// Clear the class's rwx bits; setuid/setgid survive on directories like in GNU chmod
+				clear := c.who & 0o777
+				if !isDir {
+					clear |= c.who & 0o6000
+				}
+				bits = bits&^clear | set
+			}
+		}
+		return fromUnixPermBits(old, bits)
+	}, nil
+}
+
+// whoMask returns every mode bit belonging to a chmod class letter
+func whoMask(who byte) uint32 {
+	switch who {
+	case 'u':
+		return 0o700 | 0o4000
+	case 'g':
+		return 0o070 | 0o2000
+	case 'o':
+		return 0o007 | 0o1000
+	}
+	return 0o7777
+}
+
+// parseRecursiveSpec parses the mode for a recursive chmod. "DIRS:FILES" gives directories
+// and files different modes (e.g. "755:644"); a single spec applies to both.
+func parseRecursiveSpec(spec string) (chmodSpec, chmodSpec, error) {
+	dirPart, filePart, split := strings.Cut(spec, ":")
+	dirSpec, err := parseChmodSpec(dirPart)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !split {
+		return dirSpec, dirSpec, nil
+	}
+	fileSpec, err := parseChmodSpec(filePart)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dirSpec, fileSpec, nil
+}
+
+// chmodPath applies a spec to one path, following symlinks like chmod(1) does for named arguments
+func chmodPath(path string, spec chmodSpec) (int, []pathError) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, []pathError{{path, err}}
+	}
+	if err := os.Chmod(path, spec(info.Mode(), info.IsDir())); err != nil {
+		return 0, []pathError{{path, err}}
+	}
+	return 1, nil
+}
+
+// chmodTree applies dirSpec to a directory and everything below it, and fileSpec to the files.
+// Symlinks inside the tree are skipped. A directory whose new mode would stop us from reading
+// it is changed after its contents instead of before.
+func chmodTree(path string, dirSpec, fileSpec chmodSpec) (int, []pathError) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0, []pathError{{path, err}}
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		return 0, nil
+	}
+	if !info.IsDir() {
+		return chmodPath(path, fileSpec)
+	}
+
+	done := 0
+	var failures []pathError
+
+	newMode := dirSpec(info.Mode(), true)
+	early := newMode.Perm()&0o500 == 0o500
+	apply := func() {
+		if err := os.Chmod(path, newMode); err != nil {
+			failures = append(failures, pathError{path, err})
+		} else {
+			done += 1
+		}
+	}
+
+	if early {
+		apply()
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		failures = append(failures, pathError{path, err})
+	}
+	for _, entry := range entries {
+		d, f := chmodTree(path+string(os.PathSeparator)+entry.Name(), dirSpec, fileSpec)
+		done += d
+		failures = append(failures, f...)
+	}
+
+	if !early {
+		apply()
+	}
+	return done, failures
+}
+
+// targetPaths returns the paths of the objects an operation should act on
+func (m model) targetPaths() []string {
+	var paths []string
+	for _, obj := range m.targets() {
+		paths = append(paths, obj.Path)
+	}
+	return paths
+}
+
+// promptChmod asks for a mode (octal or symbolic) and applies it to the targets
+func (m *model) promptChmod() {
+	targets := m.targets()
+	if len(targets) == 0 {
+		return
+	}
+	current := fmt.Sprintf("%04o", unixPermBits(targets[0].Mode))
+
+	m.openPrompt(fmt.Sprintf("chmod %d item(s)", len(targets)), current, func(m *model, value string) tea.Cmd {
+		spec, err := parseChmodSpec(value)
+		if err != nil {
+			m.status = err.Error()
+			return nil
+		}
+		return runBatch("chmod "+value, m.targetPaths(), func(path string) (int, []pathError) {
+			return chmodPath(path, spec)
+		})
+	})
+}
+
+// promptChmodRecursive asks for a "DIRS:FILES" mode and applies it to the targets and everything below them
+func (m *model) promptChmodRecursive() {
+	targets := m.targets()
+	if len(targets) == 0 {
+		return
+	}
+
+	m.openPrompt(fmt.Sprintf("chmod -R %d item(s) (dirs:files)", len(targets)), "u=rwX,go=rX", func(m *model, value string) tea.Cmd {
+		dirSpec, fileSpec, err := parseRecursiveSpec(value)
+		if err != nil {
+			m.status = err.Error()
+			return nil
+		}
+		return runBatch("chmod -R "+value, m.targetPaths(), func(path string) (int, []pathError) {
+			return chmodTree(path, dirSpec, fileSpec)
+		})
+	})
+}
+
+// permGrid is the interactive rwx editor: three rows of r/w/x toggles (user, group, other)
+// and a row for the setuid, setgid and sticky bits
+type permGrid struct {
+	bits      uint32   // Unix mode bits being edited
+	row, col  int      // Cursor position in the grid
+	recursive bool     // Also apply to everything below directories
+	paths     []string // Objects the result will be applied to
+}
+
+// permGridRows labels the grid rows and permGridCols the toggles in each row
+var (
+	permGridRows = []string{"user", "group", "other", "special"}
+	permGridCols = [][3]string{{"r", "w", "x"}, {"r", "w", "x"}, {"r", "w", "x"}, {"setuid", "setgid", "sticky"}}
+)
+
+// bit returns the mode bit behind a grid cell
+func (g permGrid) bit(row, col int) uint32 {
+	if row == 3 {
+		return 0o4000 >> uint(col)
+	}
+	return 1 << uint(8-(row*3+col))
+}
+
+// openPermGrid starts editing the targets' permissions, starting from the first target's mode
+func (m *model) openPermGrid() {
+	targets := m.targets()
+	if len(targets) == 0 {
+		return
+	}
+	m.permGrid = &permGrid{bits: unixPermBits(targets[0].Mode), paths: m.targetPaths()}
+	m.mode = modePerms
+}
+
+// handlePermGridAction moves around and toggles bits in the grid.
+// It reports whether the action belonged to the grid.
+func (m *model) handlePermGridAction(a action) (tea.Cmd, bool) {
+	g := m.permGrid
+	switch a {
+	case actionMoveLeft:
+		g.col = (g.col + 2) % 3
+	case actionMoveRight:
+		g.col = (g.col + 1) % 3
+	case actionMoveUp:
+		g.row = (g.row + len(permGridRows) - 1) % len(permGridRows)
+	case actionMoveDown:
+		g.row = (g.row + 1) % len(permGridRows)
+	case actionPermToggle:
+		g.bits ^= g.bit(g.row, g.col)
+	case actionPermRecursive:
+		g.recursive = !g.recursive
+	case actionPromptSubmit:
+		m.permGrid = nil
+		m.mode = modeNormal
+		return g.apply(), true
+	case actionPromptCancel:
+		m.permGrid = nil
+		m.mode = modeNormal
+	default:
+		return nil, false
+	}
+	return nil, true
+}
+
+// apply sets the edited mode on every path. Recursively, directories get the mode as is, while
+// files only keep the execute bits if they were executable before (like chmod's X).
+func (g permGrid) apply() tea.Cmd {
+	bits := g.bits
+	exact := func(old fs.FileMode, _ bool) fs.FileMode {
+		return fromUnixPermBits(old, bits)
+	}
+	if !g.recursive {
+		return runBatch(fmt.Sprintf("chmod %04o", bits), g.paths, func(path string) (int, []pathError) {
+			return chmodPath(path, exact)
+		})
+	}
+
+	files := func(old fs.FileMode, isDir bool) fs.FileMode {
+		if isDir || old.Perm()&0o111 != 0 {
+			return fromUnixPermBits(old, bits)
+		}
+		return fromUnixPermBits(old, bits&^0o111)
+	}
+	return runBatch(fmt.Sprintf("chmod -R %04o", bits), g.paths, func(path string) (int, []pathError) {
+		return chmodTree(path, exact, files)
+	})
+}
+
+// render draws the grid with the cursor cell highlighted
+func (g permGrid) render() string {
+	var lines []string
+	for row, label := range permGridRows {
+		cells := []string{fmt.Sprintf("%-8s", label)}
+		for col, name := range permGridCols[row] {
+			mark := "[ ]"
+			if g.bits&g.bit(row, col) != 0 {
+				mark = "[x]"
+			}
+			cell := fmt.Sprintf("%s %-6s", mark, name)
+			if row == g.row && col == g.col {
+				cell = styleCursor.Render(cell)
+			}
+			cells = append(cells, cell)
+		}
+		lines = append(lines, strings.Join(cells, " "))
+	}
+
+	recursive := "no"
+	if g.recursive {
+		recursive = "yes (files keep x only if already executable)"
+	}
+	lines = append(lines, "",
+		fmt.Sprintf("mode      %04o  %s", g.bits, symbolicMode(fromUnixPermBits(0, g.bits))[1:]),
+		fmt.Sprintf("recursive %s", recursive),
+		fmt.Sprintf("applies to %d item(s)", len(g.paths)),
+	)
+
+	title := lipgloss.NewStyle().Bold(true).Render("Permissions")
+	return styleOverlay.Render(lipgloss.JoinVertical(lipgloss.Left, title, "", strings.Join(lines, "\n")))
+}
+
+// canChangeOwner reports whether the process may give files away to other users.
+// On Unix that takes root (strictly CAP_CHOWN, which is not worth probing for).
+func canChangeOwner() bool {
+	return os.Geteuid() == 0
+}
+
+// allowedGroups lists the groups the current user can assign, or nil if any group is allowed
+func allowedGroups() []string {
+	if canChangeOwner() {
+		return nil
+	}
+	u, err := user.Current()
+	if err != nil {
+		return []string{}
+	}
+	ids, err := u.GroupIds()
+	if err != nil {
+		return []string{}
+	}
+
+	var names []string
+	for _, id := range ids {
+		if g, err := user.LookupGroupId(id); err == nil {
+			names = append(names, g.Name)
+		} else {
+			names = append(names, id)
+		}
+	}
+	return names
+}
+
+// lookupUID resolves a user name or numeric id
+func lookupUID(name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+// lookupGID resolves a group name or numeric id
+func lookupGID(name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// promptChown asks for a new owner for the targets
+func (m *model) promptChown() {
+	targets := m.targets()
+	if len(targets) == 0 {
+		return
+	}
+	var d fileDetails
+	platformDetails(targets[0].Path, &d)
+
+	m.openPrompt(fmt.Sprintf("chown %d item(s)", len(targets)), d.Owner, func(m *model, value string) tea.Cmd {
+		uid, err := lookupUID(value)
+		if err != nil {
+			m.status = err.Error()
+			return nil
+		}
+		if !canChangeOwner() && uid != os.Geteuid() {
+			m.status = "only root can give files to another user"
+			return nil
+		}
+		return runBatch("chown "+value, m.targetPaths(), func(path string) (int, []pathError) {
+			if err := os.Chown(path, uid, -1); err != nil {
+				return 0, []pathError{{path, err}}
+			}
+			return 1, nil
+		})
+	})
+}
+
+// promptChgrp asks for a new group for the targets, listing the groups the user may choose from
+func (m *model) promptChgrp() {
+	targets := m.targets()
+	if len(targets) == 0 {
+		return
+	}
+	var d fileDetails
+	platformDetails(targets[0].Path, &d)
+
+	allowed := allowedGroups()
+	label := fmt.Sprintf("chgrp %d item(s)", len(targets))
+	if allowed != nil {
+		label += " [" + strings.Join(allowed, " ") + "]"
+	}
+
+	m.openPrompt(label, d.Group, func(m *model, value string) tea.Cmd {
+		gid, err := lookupGID(value)
+		if err != nil {
+			m.status = err.Error()
+			return nil
+		}
+		if allowed != nil && !groupAllowed(allowed, value, gid) {
+			m.status = fmt.Sprintf("you are not a member of group %s", value)
+			return nil
+		}
+		return runBatch("chgrp "+value, m.targetPaths(), func(path string) (int, []pathError) {
+			if err := os.Chown(path, -1, gid); err != nil {
+				return 0, []pathError{{path, err}}
+			}
+			return 1, nil
+		})
+	})
+}
+
+// groupAllowed reports whether a group, given by name or id, is in the allowed list
+func groupAllowed(allowed []string, name string, gid int) bool {
+	for _, g := range allowed {
+		if g == name || g == strconv.Itoa(gid) {
+			return true
+		}
+		if id, err := lookupGID(g); err == nil && id == gid {
+			return true
+		}
+	}
+	return false
+}
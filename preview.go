@@ -0,0 +1,436 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"image"
+	_ "image/gif" // Registered for image.DecodeConfig
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Preview pane
+const (
+	PREVIEW_MIN_WIDTH = 30        // The pane is never narrower than this
+	PREVIEW_MAX_LINES = 200       // Lines gathered for a preview; more than any terminal shows
+	PREVIEW_TEXT_READ = 64 * 1024 // Bytes of a text file read for its preview
+)
+
+// preview is what the preview pane shows for one object
+type preview struct {
+	path    string
+	modTime time.Time
+	title   string   // Object name
+	summary string   // What it is: kind, size, dimensions...
+	lines   []string // Content: text, listing, hex dump...
+}
+
+// previewMsg delivers a preview built in the background
+type previewMsg struct {
+	preview preview
+}
+
+// previewShown reports whether the preview pane is on screen: when it's turned on, and always
+// as the last of the Miller columns. With two panes, only the Miller columns keep it, inside each pane.
+func (m model) previewShown() bool {
+	if m.pane != nil {
+		return m.layout == layoutMiller && !m.treemapOn // The two panes take the whole width
+	}
+	return m.previewOn || m.layout == layoutMiller && !m.treemapOn
+}
+
+// previewWidth is the width taken by the preview pane beside the explorer, 0 when it's hidden
+// or drawn inside the panes
+func (m model) previewWidth() int {
+	if !m.previewShown() || m.pane != nil {
+		return 0
+	}
+	contentWidth := m.width - (2 * BORDER_SIZE)
+	width := max(contentWidth*2/5, PREVIEW_MIN_WIDTH)
+	// Always leave room for at least one column of tiles
+	return max(min(width, contentWidth-(FILE_OBJECT_WIDTH+FILE_OBJECT_HORIZONTAL_PADDING)), 0)
+}
+
+// syncPreview asks for a preview of the object under the cursor when the pane shows something else
+func (m *model) syncPreview() tea.Cmd {
+	if !m.previewShown() {
+		return nil
+	}
+	idx := m.selectedIndex()
+	if idx < 0 || idx >= len(m.objects) || !m.objects[idx].Loaded {
+		return nil
+	}
+	obj := m.objects[idx]
+	if m.previewPath == obj.Path && m.preview != nil && m.preview.modTime.Equal(obj.ModTime) {
+		return nil
+	}
+	if m.previewPath == obj.Path && m.preview == nil {
+		return nil // Already on its way
+	}
+
+	m.previewPath = obj.Path
+	m.preview = nil
+	if m.previewDiff && m.git.repo != nil {
+		workTree, rev := m.git.repo.workTree, ""
+		if m.tree != nil {
+			rev = m.tree.commit.String()
+		}
+		return func() tea.Msg {
+			return previewMsg{preview: buildDiffPreview(workTree, rev, obj)}
+		}
+	}
+	if m.tree != nil {
+		tree, entry := m.tree, m.tree.entries[obj.Path]
+		return func() tea.Msg {
+			return previewMsg{preview: tree.buildPreview(obj, entry)}
+		}
+	}
+	return func() tea.Msg {
+		return previewMsg{preview: buildPreview(obj)}
+	}
+}
+
+// showPreview keeps a finished preview if the cursor is still on its object
+func (m *model) showPreview(msg previewMsg) {
+	if msg.preview.path == m.previewPath {
+		m.preview = &msg.preview
+	}
+}
+
+// togglePreview shows or hides the preview pane; the grid reflows around it
+func (m *model) togglePreview() {
+	m.previewOn = !m.previewOn
+	m.preview, m.previewPath = nil, ""
+	m.keepFocus(true, m.resize)
+	if m.previewOn && m.pane != nil && !m.previewShown() {
+		m.status = "the preview pane returns with a single pane (" + m.keys.keyLabel(modeNormal, actionDualPane) + ")"
+	}
+}
+
+// buildPreview picks a preview according to what the object is and, for files, what the content is
+func buildPreview(obj FileSystemObject) preview {
+	p := preview{path: obj.Path, modTime: obj.ModTime, title: obj.Name}
+
+	switch {
+	case obj.BrokenLink:
+		p.summary = "broken link to " + obj.LinkTarget
+	case obj.IsDir:
+		p.summary, p.lines = previewDir(obj.Path)
+	case !obj.Mode.IsRegular() && !obj.IsSymlink():
+		p.summary = map[string]string{
+			"P": "named pipe", "S": "socket", "B": "block device", "C": "character device",
+		}[obj.Marker()]
+	default:
+		p.summary, p.lines = previewFile(obj.Path)
+	}
+	return p
+}
+
+// previewDir lists a directory's entries, directories first marked with a slash
+func previewDir(path string) (string, []string) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err.Error(), nil
+	}
+	var dirs, files []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs = append(dirs, entry.Name()+"/")
+		} else {
+			files = append(files, entry.Name())
+		}
+	}
+	lines := append(dirs, files...)
+	return fmt.Sprintf("%d entries", len(entries)), lines[:min(len(lines), PREVIEW_MAX_LINES)]
+}
+
+// previewFile chooses how to show a file from its detected type
+func previewFile(path string) (string, []string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err.Error(), nil
+	}
+	t := detectType(path)
+	summary := strings.TrimSpace(t.Description + ", " + formatSize(info.Size()))
+
+	var detail string
+	var lines []string
+	switch {
+	case t.Text:
+		lines, err = previewText(path)
+	case strings.HasPrefix(t.MIME, "image/"):
+		detail, err = previewImage(path)
+	case t.MIME == "application/zip":
+		lines, err = previewZip(path)
+	case t.MIME == "application/x-tar":
+		lines, err = previewTar(path, false)
+	case t.MIME == "application/gzip":
+		detail, lines, err = previewGzip(path)
+	case strings.HasPrefix(t.Description, "ELF"):
+		lines, err = previewELF(path)
+	case t.MIME == "application/vnd.sqlite3":
+		lines, err = previewSQLite(path)
+	default:
+		lines, err = previewHex(path)
+	}
+	if err != nil {
+		lines = append(lines, "", err.Error())
+	}
+	if detail != "" {
+		summary += ", " + detail
+	}
+	return summary, lines
+}
+
+// previewText returns the first lines of a text file, with tabs expanded and control characters dropped
+func previewText(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return textLines(f), nil
+}
+
+// textLines reads the first lines of a text
+func textLines(r io.Reader) []string {
+	var lines []string
+	scanner := bufio.NewScanner(io.LimitReader(r, PREVIEW_TEXT_READ))
+	scanner.Buffer(make([]byte, 0, 4096), PREVIEW_TEXT_READ)
+	for scanner.Scan() && len(lines) < PREVIEW_MAX_LINES {
+		lines = append(lines, cleanLine(scanner.Text()))
+	}
+	return lines
+}
+
+// cleanLine makes a line of arbitrary text safe to draw
+func cleanLine(line string) string {
+	line = strings.ReplaceAll(line, "\t", "    ")
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, line)
+}
+
+// previewImage reports an image's dimensions
+func previewImage(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return "", nil // A format we can't decode: the kind alone will do
+	}
+	return fmt.Sprintf("%d×%d", cfg.Width, cfg.Height), nil
+}
+
+// previewZip lists the entries of a zip archive
+func previewZip(path string) ([]string, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	lines := []string{fmt.Sprintf("%d entries", len(r.File)), ""}
+	for _, f := range r.File[:min(len(r.File), PREVIEW_MAX_LINES)] {
+		lines = append(lines, fmt.Sprintf("%9s  %s", formatSize(int64(f.UncompressedSize64)), f.Name))
+	}
+	return lines, nil
+}
+
+// previewTar lists the entries of a tar archive, gzip compressed if asked
+func previewTar(path string, gzipped bool) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if gzipped {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var lines []string
+	tr := tar.NewReader(r)
+	for len(lines) < PREVIEW_MAX_LINES {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return lines, err
+		}
+		lines = append(lines, fmt.Sprintf("%9s  %s", formatSize(hdr.Size), hdr.Name))
+	}
+	return lines, nil
+}
+
+// previewGzip shows the original name of a gzip file, and the listing if it holds a tarball
+func previewGzip(path string) (string, []string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return "", nil, err
+	}
+	defer gz.Close()
+
+	detail := ""
+	if gz.Name != "" {
+		detail = "of " + gz.Name
+	}
+
+	// A tar header carries "ustar" at offset 257
+	head := make([]byte, 512)
+	if n, _ := io.ReadFull(gz, head); n == len(head) && string(head[257:262]) == "ustar" {
+		lines, err := previewTar(path, true)
+		return "tar " + strings.TrimSpace(detail), lines, err
+	}
+	return detail, nil, nil
+}
+
+// previewELF describes an ELF binary: architecture, type, interpreter and libraries
+func previewELF(path string) ([]string, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pairs := [][2]string{
+		{"Class", f.Class.String()},
+		{"Machine", strings.TrimPrefix(f.Machine.String(), "EM_")},
+		{"Type", strings.TrimPrefix(f.Type.String(), "ET_")},
+		{"OS/ABI", strings.TrimPrefix(f.OSABI.String(), "ELFOSABI_")},
+	}
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_INTERP {
+			interp := make([]byte, prog.Filesz)
+			if _, err := prog.ReadAt(interp, 0); err == nil {
+				pairs = append(pairs, [2]string{"Interpreter", strings.TrimRight(string(interp), "\x00")})
+			}
+		}
+	}
+	if f.Section(".symtab") == nil {
+		pairs = append(pairs, [2]string{"Symbols", "stripped"})
+	}
+	lines := keyValueLines(pairs)
+
+	if libs, err := f.ImportedLibraries(); err == nil && len(libs) > 0 {
+		lines = append(lines, "", "Libraries:")
+		for _, lib := range libs {
+			lines = append(lines, "  "+lib)
+		}
+	}
+	return lines, nil
+}
+
+// previewSQLite reads the database header
+func previewSQLite(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 100)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return nil, err
+	}
+	pageSize := int(binary.BigEndian.Uint16(header[16:]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	encoding := map[uint32]string{1: "UTF-8", 2: "UTF-16le", 3: "UTF-16be"}[binary.BigEndian.Uint32(header[56:])]
+
+	return keyValueLines([][2]string{
+		{"Page size", fmt.Sprint(pageSize)},
+		{"Pages", fmt.Sprint(binary.BigEndian.Uint32(header[28:]))},
+		{"Encoding", encoding},
+		{"Schema", fmt.Sprint(binary.BigEndian.Uint32(header[44:]))},
+		{"Version", fmt.Sprint(binary.BigEndian.Uint32(header[96:]))},
+	}), nil
+}
+
+// previewHex dumps the first bytes of a binary file
+func previewHex(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data := make([]byte, 512)
+	n, _ := io.ReadFull(f, data)
+	return hexLines(data[:n]), nil
+}
+
+// hexLines dumps bytes as offset, hex and printable characters, 8 bytes a line
+func hexLines(data []byte) []string {
+	var lines []string
+	for off := 0; off < len(data); off += 8 {
+		row := data[off:min(off+8, len(data))]
+		ascii := strings.Map(func(r rune) rune {
+			if r < 0x20 || r > 0x7e {
+				return '.'
+			}
+			return r
+		}, string(row))
+		lines = append(lines, fmt.Sprintf("%04x  % -23x  %s", off, row, ascii))
+	}
+	return lines
+}
+
+// render draws the pane: a left border, the object's name and summary, then the content
+func (p *preview) render(width, height int) string {
+	style := lipgloss.NewStyle().
+		Border(lipgloss.NormalBorder(), false, false, false, true).
+		BorderForeground(borderColor).
+		Padding(0, 1).
+		Width(width - 1).
+		Height(height)
+	inner := width - 3 // Border and padding
+
+	if p == nil {
+		return style.Render(styleBadge.Render("…"))
+	}
+
+	lines := []string{
+		lipgloss.NewStyle().Bold(true).Render(truncateCenter(p.title, inner)),
+		styleBadge.Render(truncateCenter(p.summary, inner)),
+		"",
+	}
+	for _, line := range p.lines {
+		if len(lines) >= height {
+			break
+		}
+		lines = append(lines, lipgloss.NewStyle().MaxWidth(inner).Render(line))
+	}
+	return style.Render(strings.Join(lines, "\n"))
+}
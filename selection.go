@@ -0,0 +1,100 @@
+package main
+
+import (
+	"maps"
+	"path/filepath"
+	"slices"
+)
+
+// toggleSelected marks or unmarks the object under the cursor
+func (m *model) toggleSelected() {
+	idx := m.selectedIndex()
+	if idx < 0 || idx >= len(m.objects) {
+		return
+	}
+
+	path := m.objects[idx].Path
+	if m.state.selected[path] {
+		delete(m.state.selected, path)
+		return
+	}
+	if m.state.selected == nil {
+		m.state.selected = map[string]bool{}
+	}
+	m.state.selected[path] = true
+}
+
+// toggleSelectAll marks every visible object, or clears the marks if they're all marked already
+func (m *model) toggleSelectAll() {
+	allSelected := len(m.objects) > 0
+	for _, obj := range m.objects {
+		if !m.state.selected[obj.Path] {
+			allSelected = false
+			break
+		}
+	}
+
+	m.state.selected = map[string]bool{}
+	if allSelected {
+		return
+	}
+	for _, obj := range m.objects {
+		m.state.selected[obj.Path] = true
+	}
+}
+
+// clearSelection unmarks everything
+func (m *model) clearSelection() {
+	m.state.selected = nil
+}
+
+// targets returns the objects an operation should act on:
+// every marked object if there are any, otherwise the one under the cursor.
+// Objects still streaming in are stat'ed on the spot, since operations rely on their modes.
+func (m model) targets() []FileSystemObject {
+	var marked []FileSystemObject
+	for _, obj := range m.markable() {
+		if m.state.selected[obj.Path] && !m.markedAncestor(obj.Path) {
+			marked = append(marked, obj)
+		}
+	}
+	if len(marked) == 0 {
+		if idx := m.selectedIndex(); idx >= 0 && idx < len(m.objects) && !isLoadingNode(m.objects[idx]) {
+			marked = []FileSystemObject{m.objects[idx]}
+		}
+	}
+
+	for i := range marked {
+		if !marked[i].Loaded {
+			marked[i].load()
+		}
+	}
+	return marked
+}
+
+// markable returns every object that can be marked, filtered out or not: the listing, and in the
+// tree layout the contents of expanded directories
+func (m model) markable() []FileSystemObject {
+	if !m.treeShown() {
+		return m.listing
+	}
+	objects := slices.Clip(m.listing)
+	for _, dir := range slices.Sorted(maps.Keys(m.children)) {
+		objects = append(objects, m.children[dir]...)
+	}
+	return objects
+}
+
+// markedAncestor reports whether a directory containing the path is marked in the tree. The
+// directory carries the object along, so operations leave it out.
+func (m model) markedAncestor(path string) bool {
+	if !m.treeShown() {
+		return false
+	}
+	for dir := filepath.Dir(path); len(dir) > len(m.state.currentPath); dir = filepath.Dir(dir) {
+		if m.state.selected[dir] {
+			return true
+		}
+	}
+	return false
+}
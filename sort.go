@@ -0,0 +1,119 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+)
+
+// sortOrder decides the order of the tiles; the listing itself always stays sorted by name
+type sortOrder int
+
+const (
+	sortByName  sortOrder = iota // Alphabetical, the order directories are read in
+	sortBySize                   // Largest first; directories count once measured in disk usage mode
+	sortByTime                   // Most recently modified first
+	sortByMode                   // By type and permissions, as ls -l shows them
+	sortByOwner                  // By owner and group
+	sortByGit                    // Objects with a git status first, grouped by status
+)
+
+// sortLabels name the orders in the top bar
+var sortLabels = map[sortOrder]string{
+	sortByName:  "name",
+	sortBySize:  "size",
+	sortByTime:  "time",
+	sortByMode:  "mode",
+	sortByOwner: "owner",
+	sortByGit:   "git",
+}
+
+// cycleSort switches to the next of the common sort orders, keeping the cursor on the same object.
+// The others are picked from the header of the details layout.
+func (m *model) cycleSort() {
+	next := sortByName
+	switch m.state.sort {
+	case sortByName:
+		next = sortBySize
+	case sortBySize:
+		next = sortByTime
+	}
+	m.state.sort, m.state.sortReverse = next, false
+	m.keepFocus(true, m.applyFilter)
+}
+
+// sortBy switches to an order, or turns it around if it's the current one
+func (m *model) sortBy(order sortOrder) {
+	if m.state.sort == order {
+		m.state.sortReverse = !m.state.sortReverse
+	} else {
+		m.state.sort, m.state.sortReverse = order, false
+	}
+	m.keepFocus(true, m.applyFilter)
+}
+
+// sortObjects puts the visible objects in the chosen order. The listing is left alone, as
+// streaming and refreshing rely on it being sorted by name.
+func (m *model) sortObjects() {
+	m.objects = m.sorted(m.objects)
+}
+
+// sorted returns the objects in the chosen order, leaving the slice given alone
+func (m model) sorted(objects []FileSystemObject) []FileSystemObject {
+	if m.state.sort == sortByName && !m.state.sortReverse {
+		return objects
+	}
+	objects = slices.Clone(objects)
+	slices.SortStableFunc(objects, func(a, b FileSystemObject) int {
+		c := m.compareBySort(a, b)
+		if m.state.sortReverse {
+			return -c
+		}
+		return c
+	})
+	return objects
+}
+
+// compareBySort compares two objects in the current sort order; ties keep the name order
+func (m model) compareBySort(a, b FileSystemObject) int {
+	switch m.state.sort {
+	case sortBySize:
+		return cmp.Compare(m.sortSize(b), m.sortSize(a))
+	case sortByTime:
+		return b.ModTime.Compare(a.ModTime)
+	case sortByMode:
+		return cmp.Compare(symbolicMode(a.Mode), symbolicMode(b.Mode))
+	case sortByOwner:
+		return cmp.Compare(a.Owner, b.Owner)
+	case sortByGit:
+		codeA, codeB := m.gitCode(a), m.gitCode(b)
+		if (codeA == "") != (codeB == "") {
+			return cmp.Compare(codeB, codeA) // Clean objects last
+		}
+		return cmp.Compare(codeA, codeB)
+	}
+	return compareObjects(a, b)
+}
+
+// sortSize is the size an object is sorted by; directories not measured come last
+func (m model) sortSize(obj FileSystemObject) int64 {
+	if !obj.IsDir {
+		return obj.Size
+	}
+	if size, ok := m.dirSize(obj); ok {
+		return size.bytes
+	}
+	return -1
+}
+
+// sortLabel is the top bar note naming the sort order, if it's not the default.
+// The arrow points down for the order's natural direction and up when it's turned around.
+func (m model) sortLabel() string {
+	if m.state.sort == sortByName && !m.state.sortReverse {
+		return ""
+	}
+	arrow := "↓"
+	if m.state.sortReverse {
+		arrow = "↑"
+	}
+	return arrow + sortLabels[m.state.sort] + " "
+}
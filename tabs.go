@@ -0,0 +1,138 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// tab is a directory kept open alongside the one on screen, with its own cursor, sort, filter
+// and marks. The tab on screen lives in the model's own fields; its entry here is only brought
+// up to date when switching away from it.
+type tab struct {
+	state    state
+	listing  []FileSystemObject            // Objects as last read, shown again at once; nil to read the directory afresh
+	objects  []FileSystemObject            // Objects as listed from it, which the other pane of the dual-pane view draws
+	parent   millerParent                  // Parent directory of the other pane, for the Miller columns
+	children map[string][]FileSystemObject // Listings of its expanded directories, as last read
+	tree     *treeBrowser                  // Views shown in place of the directory, as in the model
+	dupes    *dupeView
+	verify   *verifyView
+	preview  *preview // Preview of the object under the cursor, which the other pane's Miller columns draw
+}
+
+// tabActions switch to the tabs by number
+var tabActions = []action{actionTab1, actionTab2, actionTab3, actionTab4, actionTab5, actionTab6, actionTab7, actionTab8, actionTab9}
+
+// currentTab captures what's on screen as a tab
+func (m model) currentTab() tab {
+	t := tab{state: m.state, tree: m.tree, dupes: m.dupes, verify: m.verify, preview: m.preview}
+	if !m.loading() && m.virtualList() == nil {
+		t.listing, t.objects, t.children = m.listing, m.objects, m.children // A partly read directory is read again in full
+	}
+	return t
+}
+
+// showTab puts a tab on screen. A directory read before is shown as it was, cursor included,
+// and read again in the background in case it changed meanwhile.
+func (m *model) showTab(t tab) tea.Cmd {
+	m.state = t.state
+	m.tree, m.dupes, m.verify = t.tree, t.dupes, t.verify
+	m.preview, m.previewPath = nil, ""
+	m.dropListing()
+
+	if t.listing == nil {
+		return nil // syncLoader reads it
+	}
+	m.listing = t.listing
+	m.listingPath = m.state.currentPath
+	m.children = maps.Clone(t.children)
+	m.reloadChildren()
+	m.applyFilter()
+	return refreshCmd(m.state.currentPath)
+}
+
+// loadTab shows the tab at index i
+func (m *model) loadTab(i int) tea.Cmd {
+	m.tab = i
+	cmd := m.showTab(m.tabs[i])
+	m.status = "tab " + strconv.Itoa(i+1) + ": " + tabTitle(m.state.currentPath)
+	return cmd
+}
+
+// switchTab goes to the tab at index i
+func (m *model) switchTab(i int) tea.Cmd {
+	if i >= len(m.tabs) {
+		m.status = "no tab " + strconv.Itoa(i+1)
+		return nil
+	}
+	if i == m.tab {
+		return nil
+	}
+	m.tabs[m.tab] = m.currentTab()
+	return m.loadTab(i)
+}
+
+// cycleTab goes to the next tab, or the previous one with a negative delta
+func (m *model) cycleTab(delta int) tea.Cmd {
+	n := len(m.tabs)
+	return m.switchTab(((m.tab+delta)%n + n) % n)
+}
+
+// newTab opens a tab at the directory under the cursor, or at the current one when the cursor
+// is on a file. The new tab starts out sorted like this one.
+func (m *model) newTab() tea.Cmd {
+	path := m.state.currentPath
+	if _, obj, ok := m.nodeUnderCursor(); ok && obj.IsDir && m.virtualList() == nil {
+		path = obj.Path
+	}
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		m.status = path + " is not a directory on disk"
+		return nil
+	}
+
+	m.tabs[m.tab] = m.currentTab()
+	m.tabs = slices.Insert(m.tabs, m.tab+1, tab{state: state{
+		currentPath: path,
+		sort:        m.state.sort,
+		sortReverse: m.state.sortReverse,
+		expanded:    maps.Clone(m.state.expanded),
+	}})
+	return m.loadTab(m.tab + 1)
+}
+
+// closeTab closes the current tab and shows the one that took its place. The last tab stays.
+func (m *model) closeTab() tea.Cmd {
+	if len(m.tabs) == 1 {
+		m.status = "this is the last tab"
+		return nil
+	}
+	m.tabs = slices.Delete(m.tabs, m.tab, m.tab+1)
+	return m.loadTab(min(m.tab, len(m.tabs)-1))
+}
+
+// tabTitle names a tab after the last segment of its directory
+func tabTitle(path string) string {
+	return filepath.Base(path) // "/" for the root
+}
+
+// tabsLabel lists the tabs for the top bar, the current one highlighted; empty with a single tab
+func (m model) tabsLabel() string {
+	if len(m.tabs) < 2 {
+		return ""
+	}
+	var labels []string
+	for i, t := range m.tabs {
+		if i == m.tab {
+			labels = append(labels, styleTabActive.Render(strconv.Itoa(i+1)+" "+tabTitle(m.state.currentPath)))
+		} else {
+			labels = append(labels, styleBadge.Render(strconv.Itoa(i+1)+" "+tabTitle(t.state.currentPath)))
+		}
+	}
+	return "   " + strings.Join(labels, "  ")
+}
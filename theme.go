@@ -0,0 +1,408 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	lipgloss "github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// theme is a named palette for every colored part of the UI.
+// Unset colors fall back to the terminal's default foreground.
+type theme struct {
+	Border        lipgloss.TerminalColor // Screen, bar and tile borders
+	Selected      lipgloss.TerminalColor // Border and text of the tile under the cursor
+	Directory     lipgloss.TerminalColor // Directory names
+	File          lipgloss.TerminalColor // Regular file names
+	Executable    lipgloss.TerminalColor // Executable file names
+	Symlink       lipgloss.TerminalColor // Symbolic link names
+	BrokenLink    lipgloss.TerminalColor // Names of links whose target is missing
+	BarForeground lipgloss.TerminalColor // Text of the top and bottom bars
+	BarBackground lipgloss.TerminalColor // Background of the top and bottom bars
+	BorderStyle   string                 // One of the keys of borderStyles
+}
+
+// borderStyles maps the border names accepted in themes to lipgloss borders
+var borderStyles = map[string]lipgloss.Border{
+	"normal":  lipgloss.NormalBorder(),
+	"rounded": lipgloss.RoundedBorder(),
+	"double":  lipgloss.DoubleBorder(),
+	"thick":   lipgloss.ThickBorder(),
+}
+
+// bundledThemes are always available by name. Each color carries hand-picked
+// 256-color and 16-color fallbacks so palettes stay recognisable on older terminals.
+var bundledThemes = map[string]theme{
+	// The original look, after the terminals in Silo
+	"silo": {
+		Border:        lipgloss.CompleteColor{TrueColor: "#2abbae", ANSI256: "37", ANSI: "6"},
+		Selected:      lipgloss.CompleteColor{TrueColor: "#dadb83", ANSI256: "186", ANSI: "11"},
+		Directory:     lipgloss.CompleteColor{TrueColor: "#8ee3da", ANSI256: "116", ANSI: "14"},
+		File:          lipgloss.NoColor{},
+		Executable:    lipgloss.CompleteColor{TrueColor: "#9fd36a", ANSI256: "149", ANSI: "10"},
+		Symlink:       lipgloss.CompleteColor{TrueColor: "#6fb6e8", ANSI256: "74", ANSI: "12"},
+		BrokenLink:    lipgloss.CompleteColor{TrueColor: "#e06c75", ANSI256: "168", ANSI: "9"},
+		BarForeground: lipgloss.NoColor{},
+		BarBackground: lipgloss.NoColor{},
+		BorderStyle:   "normal",
+	},
+	// Amber phosphor CRT
+	"amber": {
+		Border:        lipgloss.CompleteColor{TrueColor: "#ffb000", ANSI256: "214", ANSI: "3"},
+		Selected:      lipgloss.CompleteColor{TrueColor: "#ffe0a0", ANSI256: "223", ANSI: "15"},
+		Directory:     lipgloss.CompleteColor{TrueColor: "#ffcc66", ANSI256: "221", ANSI: "11"},
+		File:          lipgloss.CompleteColor{TrueColor: "#e69a00", ANSI256: "172", ANSI: "3"},
+		Executable:    lipgloss.CompleteColor{TrueColor: "#ff8c1a", ANSI256: "208", ANSI: "11"},
+		Symlink:       lipgloss.CompleteColor{TrueColor: "#d9a441", ANSI256: "179", ANSI: "3"},
+		BrokenLink:    lipgloss.CompleteColor{TrueColor: "#ff5f00", ANSI256: "202", ANSI: "1"},
+		BarForeground: lipgloss.CompleteColor{TrueColor: "#ffb000", ANSI256: "214", ANSI: "3"},
+		BarBackground: lipgloss.NoColor{},
+		BorderStyle:   "rounded",
+	},
+	// Green phosphor CRT
+	"green": {
+		Border:        lipgloss.CompleteColor{TrueColor: "#33ff33", ANSI256: "83", ANSI: "2"},
+		Selected:      lipgloss.CompleteColor{TrueColor: "#ccffcc", ANSI256: "194", ANSI: "15"},
+		Directory:     lipgloss.CompleteColor{TrueColor: "#7dff7d", ANSI256: "120", ANSI: "10"},
+		File:          lipgloss.CompleteColor{TrueColor: "#29cc29", ANSI256: "40", ANSI: "2"},
+		Executable:    lipgloss.CompleteColor{TrueColor: "#00ff9c", ANSI256: "48", ANSI: "10"},
+		Symlink:       lipgloss.CompleteColor{TrueColor: "#a6ffa6", ANSI256: "157", ANSI: "10"},
+		BrokenLink:    lipgloss.CompleteColor{TrueColor: "#ff5555", ANSI256: "203", ANSI: "9"},
+		BarForeground: lipgloss.CompleteColor{TrueColor: "#33ff33", ANSI256: "83", ANSI: "2"},
+		BarBackground: lipgloss.NoColor{},
+		BorderStyle:   "thick",
+	},
+}
+
+// themeConfig is a user-defined theme from the config file. Colors are hex ("#ffb000")
+// or ANSI numbers ("214"); anything left empty is inherited from the theme named in Base.
+type themeConfig struct {
+	Base          string `json:"base"`
+	Border        string `json:"border"`
+	Selected      string `json:"selected"`
+	Directory     string `json:"directory"`
+	File          string `json:"file"`
+	Executable    string `json:"executable"`
+	Symlink       string `json:"symlink"`
+	BrokenLink    string `json:"broken_link"`
+	BarForeground string `json:"bar_foreground"`
+	BarBackground string `json:"bar_background"`
+	BorderStyle   string `json:"border_style"`
+}
+
+// Active theme and the optional LS_COLORS table used to color tiles
+var (
+	activeTheme = bundledThemes["silo"]
+	lsColors    *lsColorTable
+)
+
+// resolveTheme finds a theme by name among the user's themes and the bundled ones
+func resolveTheme(name string, custom map[string]themeConfig) (theme, error) {
+	return resolveThemeDepth(name, custom, 0)
+}
+
+// resolveThemeDepth implements resolveTheme, guarding against themes that inherit from themselves
+func resolveThemeDepth(name string, custom map[string]themeConfig, depth int) (theme, error) {
+	if depth > len(custom) {
+		return theme{}, fmt.Errorf("theme %q inherits from itself", name)
+	}
+
+	tc, ok := custom[name]
+	if !ok {
+		if t, ok := bundledThemes[name]; ok {
+			return t, nil
+		}
+		return theme{}, fmt.Errorf("unknown theme %q (available: %s)", name, strings.Join(themeNames(custom), ", "))
+	}
+
+	// Start from the base theme and override whatever the user set
+	base := tc.Base
+	if base == "" || base == name {
+		base = "silo"
+	}
+	t, err := resolveThemeDepth(base, custom, depth+1)
+	if err != nil {
+		return theme{}, err
+	}
+
+	overrides := []struct {
+		value  string
+		target *lipgloss.TerminalColor
+	}{
+		{tc.Border, &t.Border},
+		{tc.Selected, &t.Selected},
+		{tc.Directory, &t.Directory},
+		{tc.File, &t.File},
+		{tc.Executable, &t.Executable},
+		{tc.Symlink, &t.Symlink},
+		{tc.BrokenLink, &t.BrokenLink},
+		{tc.BarForeground, &t.BarForeground},
+		{tc.BarBackground, &t.BarBackground},
+	}
+	for _, o := range overrides {
+		if o.value != "" {
+			*o.target = lipgloss.Color(o.value) // lipgloss degrades plain colors to the terminal's profile
+		}
+	}
+
+	if tc.BorderStyle != "" {
+		if _, ok := borderStyles[tc.BorderStyle]; !ok {
+			return theme{}, fmt.Errorf("theme %q: unknown border style %q", name, tc.BorderStyle)
+		}
+		t.BorderStyle = tc.BorderStyle
+	}
+	return t, nil
+}
+
+// themeNames lists every selectable theme name, sorted
+func themeNames(custom map[string]themeConfig) []string {
+	var names []string
+	for name := range bundledThemes {
+		names = append(names, name)
+	}
+	for name := range custom {
+		if _, bundled := bundledThemes[name]; !bundled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyTheme rebuilds the global styles from a theme.
+// On terminals without color support the selected tile is set apart by a double, bold border instead,
+// and the selected row of the row layouts by reverse video.
+func applyTheme(t theme) {
+	activeTheme = t
+	border := borderStyles[t.BorderStyle]
+
+	borderColor = t.Border
+	selectedColor = t.Selected
+
+	styleScreen = styleScreen.BorderStyle(border).BorderForeground(borderColor)
+	styleTile = styleTile.BorderStyle(border).BorderForeground(borderColor)
+	styleTopBar = styleTopBar.BorderStyle(border).BorderForeground(borderColor).
+		Foreground(t.BarForeground).Background(t.BarBackground)
+	styleBottomBar = styleBottomBar.BorderStyle(border).BorderForeground(borderColor).
+		Foreground(t.BarForeground).Background(t.BarBackground)
+	styleOverlay = styleOverlay.BorderStyle(border).BorderForeground(selectedColor)
+
+	styleTileSelected = styleTile.BorderForeground(selectedColor).Foreground(selectedColor)
+	styleDetailsHeader = styleDetailsHeader.Foreground(borderColor)
+	styleRowSelected = styleRowSelected.Foreground(selectedColor)
+	styleTabActive = styleTabActive.Foreground(selectedColor)
+	if lipgloss.ColorProfile() == termenv.Ascii {
+		styleTileSelected = styleTileSelected.BorderStyle(lipgloss.DoubleBorder()).Bold(true)
+		styleRowSelected = styleRowSelected.Reverse(true)
+		styleTabActive = styleTabActive.Reverse(true)
+	}
+}
+
+// objectStyle returns the style for an object's name on an unselected tile.
+// LS_COLORS wins when enabled and it has an entry for the object; the theme decides otherwise.
+func objectStyle(obj FileSystemObject) lipgloss.Style {
+	if lsColors != nil {
+		if style, ok := lsColors.lookup(obj); ok {
+			return style
+		}
+	}
+
+	var color lipgloss.TerminalColor
+	switch {
+	case obj.BrokenLink:
+		color = activeTheme.BrokenLink
+	case obj.IsSymlink():
+		color = activeTheme.Symlink
+	case obj.IsDir:
+		color = activeTheme.Directory
+	case obj.IsExecutable():
+		color = activeTheme.Executable
+	default:
+		color = activeTheme.File
+	}
+	return lipgloss.NewStyle().Foreground(color)
+}
+
+// lsColorTable holds the parsed contents of the LS_COLORS environment variable
+type lsColorTable struct {
+	types    map[string]lipgloss.Style // Two-letter file type keys: di, fi, ln, ex, ...
+	suffixes []lsColorSuffix           // "*.ext" patterns, longest first
+
+	linkAsTarget bool // "ln=target": color links like the object they point to
+}
+
+// lsColorSuffix is one filename pattern entry of LS_COLORS
+type lsColorSuffix struct {
+	suffix string
+	style  lipgloss.Style
+}
+
+// parseLSColors parses a GNU LS_COLORS value such as "di=01;34:*.tar=01;31".
+// Unknown or malformed entries are skipped, matching the forgiving behaviour of ls itself.
+func parseLSColors(value string) *lsColorTable {
+	table := &lsColorTable{types: map[string]lipgloss.Style{}}
+
+	for _, entry := range strings.Split(value, ":") {
+		key, codes, ok := strings.Cut(entry, "=")
+		if !ok || key == "" {
+			continue
+		}
+		if key == "ln" && codes == "target" {
+			table.linkAsTarget = true
+			continue
+		}
+		style := parseSGR(codes)
+
+		if strings.HasPrefix(key, "*") {
+			table.suffixes = append(table.suffixes, lsColorSuffix{strings.ToLower(key[1:]), style})
+		} else {
+			table.types[key] = style
+		}
+	}
+
+	// Longest suffix first so "*.tar.gz" beats "*.gz"
+	sort.SliceStable(table.suffixes, func(i, j int) bool {
+		return len(table.suffixes[i].suffix) > len(table.suffixes[j].suffix)
+	})
+	return table
+}
+
+// lookup returns the LS_COLORS style for an object, if the table has one
+func (t *lsColorTable) lookup(obj FileSystemObject) (lipgloss.Style, bool) {
+	key := lsColorKey(obj)
+
+	// "ln=target" means links take the color of whatever they point to
+	if key == "ln" && t.linkAsTarget {
+		key = "fi"
+		if obj.IsDir {
+			key = "di"
+		}
+	}
+
+	// Filename patterns only apply to regular files, like in ls
+	if key == "fi" || key == "ex" {
+		name := strings.ToLower(filepath.Base(obj.Name))
+		for _, s := range t.suffixes {
+			if strings.HasSuffix(name, s.suffix) {
+				return s.style, true
+			}
+		}
+	}
+
+	style, ok := t.types[key]
+	return style, ok
+}
+
+// lsColorKey returns the LS_COLORS type key for an object (di, ln, or, ex, pi, ...)
+func lsColorKey(obj FileSystemObject) string {
+	mode := obj.Mode
+	switch {
+	case obj.BrokenLink:
+		return "or"
+	case obj.IsSymlink():
+		return "ln"
+	case mode.IsDir():
+		switch {
+		case mode&fs.ModeSticky != 0 && mode.Perm()&0o002 != 0:
+			return "tw"
+		case mode&fs.ModeSticky != 0:
+			return "st"
+		case mode.Perm()&0o002 != 0:
+			return "ow"
+		}
+		return "di"
+	case mode&fs.ModeNamedPipe != 0:
+		return "pi"
+	case mode&fs.ModeSocket != 0:
+		return "so"
+	case mode&fs.ModeCharDevice != 0:
+		return "cd"
+	case mode&fs.ModeDevice != 0:
+		return "bd"
+	case mode&fs.ModeSetuid != 0:
+		return "su"
+	case mode&fs.ModeSetgid != 0:
+		return "sg"
+	case obj.IsExecutable():
+		return "ex"
+	}
+	return "fi"
+}
+
+// parseSGR converts a list of ANSI SGR parameters ("01;38;5;208") into a lipgloss style
+func parseSGR(codes string) lipgloss.Style {
+	style := lipgloss.NewStyle()
+
+	var params []int
+	for _, p := range strings.Split(codes, ";") {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			continue
+		}
+		params = append(params, n)
+	}
+
+	for i := 0; i < len(params); i++ {
+		switch n := params[i]; {
+		case n == 1:
+			style = style.Bold(true)
+		case n == 2:
+			style = style.Faint(true)
+		case n == 3:
+			style = style.Italic(true)
+		case n == 4:
+			style = style.Underline(true)
+		case n == 5:
+			style = style.Blink(true)
+		case n == 7:
+			style = style.Reverse(true)
+		case n == 9:
+			style = style.Strikethrough(true)
+		case n >= 30 && n <= 37:
+			style = style.Foreground(lipgloss.Color(strconv.Itoa(n - 30)))
+		case n >= 90 && n <= 97:
+			style = style.Foreground(lipgloss.Color(strconv.Itoa(n - 90 + 8)))
+		case n >= 40 && n <= 47:
+			style = style.Background(lipgloss.Color(strconv.Itoa(n - 40)))
+		case n >= 100 && n <= 107:
+			style = style.Background(lipgloss.Color(strconv.Itoa(n - 100 + 8)))
+		case n == 38 || n == 48:
+			// Extended color: 38;5;N (256 colors) or 38;2;R;G;B (true color)
+			color, used := parseExtendedColor(params[i+1:])
+			i += used
+			if color == nil {
+				continue
+			}
+			if n == 38 {
+				style = style.Foreground(color)
+			} else {
+				style = style.Background(color)
+			}
+		}
+	}
+	return style
+}
+
+// parseExtendedColor reads the arguments of an extended SGR color and reports how many it consumed
+func parseExtendedColor(args []int) (lipgloss.TerminalColor, int) {
+	if len(args) >= 2 && args[0] == 5 {
+		return lipgloss.Color(strconv.Itoa(args[1])), 2
+	}
+	if len(args) >= 4 && args[0] == 2 {
+		return lipgloss.Color(fmt.Sprintf("#%02x%02x%02x", args[1]&0xff, args[2]&0xff, args[3]&0xff)), 4
+	}
+	return nil, len(args)
+}
+
+// loadLSColors enables LS_COLORS tile coloring if the variable is set
+func loadLSColors() {
+	if value := os.Getenv("LS_COLORS"); value != "" {
+		lsColors = parseLSColors(value)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// transferPair is one object to copy or move, and the path it ends up at
+type transferPair struct {
+	from, to string
+}
+
+// promptTransfer asks where to copy or move the targets. The other pane's directory is offered
+// in the dual-pane view, Norton Commander style; the current directory otherwise.
+func (m *model) promptTransfer(move bool) {
+	sources := m.targetPaths()
+	if len(sources) == 0 {
+		return
+	}
+
+	dest := m.state.currentPath
+	if m.pane != nil {
+		dest = m.pane.state.currentPath
+	}
+	verb := "Copy"
+	if move {
+		verb = "Move"
+	}
+	label := fmt.Sprintf("%s %d item(s) to", verb, len(sources))
+	if len(sources) == 1 {
+		label = verb + " " + filepath.Base(sources[0]) + " to"
+	}
+
+	m.openPrompt(label, dest+string(filepath.Separator), func(m *model, value string) tea.Cmd {
+		if value == "" {
+			return nil
+		}
+		return m.startTransfer(sources, m.absPath(value), move)
+	})
+}
+
+// startTransfer works out where every source goes, and asks what to do about objects already there
+func (m *model) startTransfer(sources []string, dest string, move bool) tea.Cmd {
+	pairs, err := transferPairs(sources, dest, move)
+	if err != nil {
+		m.status = err.Error()
+		return nil
+	}
+
+	var fresh []transferPair
+	for _, p := range pairs {
+		// A name differing only in case is the object itself on some file systems: nothing is in the way
+		if _, err := os.Lstat(p.to); errors.Is(err, fs.ErrNotExist) || sameObject(p.from, p.to) {
+			fresh = append(fresh, p)
+		}
+	}
+	if len(fresh) == len(pairs) {
+		return runTransfer(pairs, move)
+	}
+
+	existing := len(pairs) - len(fresh)
+	title := fmt.Sprintf("%d already exist in %s", existing, filepath.Base(filepath.Dir(pairs[0].to)))
+	if existing == 1 && len(pairs) == 1 {
+		title = filepath.Base(pairs[0].to) + " already exists"
+	}
+	m.openMenu(title, []string{"Cancel", "Skip them", "Replace them, merging directories"}, func(m *model, idx int) tea.Cmd {
+		switch idx {
+		case 1:
+			if len(fresh) == 0 {
+				m.status = "nothing left to do"
+				return nil
+			}
+			return runTransfer(fresh, move)
+		case 2:
+			return runTransfer(pairs, move)
+		}
+		return nil
+	})
+	return nil
+}
+
+// transferPairs decides where each source goes. Into dest if it's a directory; a single source
+// may also be given a new name, as with cp and mv.
+func transferPairs(sources []string, dest string, move bool) ([]transferPair, error) {
+	var pairs []transferPair
+	info, err := os.Stat(dest)
+	switch {
+	case err == nil && info.IsDir():
+		for _, from := range sources {
+			pairs = append(pairs, transferPair{from, filepath.Join(dest, filepath.Base(from))})
+		}
+	case len(sources) > 1:
+		return nil, fmt.Errorf("%s is not a directory", dest)
+	case err == nil || errors.Is(err, fs.ErrNotExist):
+		if parent, err := os.Stat(filepath.Dir(dest)); err != nil || !parent.IsDir() {
+			return nil, fmt.Errorf("%s is not a directory", filepath.Dir(dest))
+		}
+		pairs = append(pairs, transferPair{sources[0], dest})
+	default:
+		return nil, err
+	}
+
+	// An object can't take its own place, nor go inside itself. It can be moved to another name
+	// for itself, to change the case of its name.
+	for _, p := range pairs {
+		if p.from == p.to || !move && sameObject(p.from, p.to) {
+			return nil, fmt.Errorf("%s is already there", filepath.Base(p.from))
+		}
+		if rel, err := filepath.Rel(p.from, p.to); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("%s can't go inside itself", filepath.Base(p.from))
+		}
+	}
+	return pairs, nil
+}
+
+// runTransfer copies or moves every pair in the background. Objects already at a destination
+// are replaced, except directories, which are merged.
+func runTransfer(pairs []transferPair, move bool) tea.Cmd {
+	verb := "copy"
+	if move {
+		verb = "move"
+	}
+	dests := map[string]string{}
+	var sources []string
+	for _, p := range pairs {
+		dests[p.from] = p.to
+		sources = append(sources, p.from)
+	}
+
+	return runBatch(verb, sources, func(from string) (int, []pathError) {
+		var failures []pathError
+		if move {
+			failures = moveObject(from, dests[from])
+		} else {
+			failures = copyObject(from, dests[from])
+		}
+		if len(failures) > 0 {
+			return 0, failures
+		}
+		return 1, nil
+	})
+}
+
+// moveObject renames an object into place, replacing a file there. Across file systems, onto
+// a directory to merge with, or over an object of another kind, it's copied instead, and the
+// original removed once every part of it made it. Nothing is removed before the rename was tried.
+func moveObject(from, to string) []pathError {
+	if sameObject(from, to) {
+		// Only the name changes, as in a.txt to A.txt where case doesn't matter
+		if err := os.Rename(from, to); err != nil {
+			return []pathError{{from, err}}
+		}
+		return nil
+	}
+	if err := os.Rename(from, to); err == nil {
+		return nil
+	}
+	if failures := copyObject(from, to); len(failures) > 0 {
+		return failures
+	}
+	if err := os.RemoveAll(from); err != nil {
+		return []pathError{{from, err}}
+	}
+	return nil
+}
+
+// copyObject copies a file, link or whole directory, keeping permissions and modification times.
+// Links are copied as links. A directory is merged into one already at the destination.
+func copyObject(from, to string) []pathError {
+	info, err := os.Lstat(from)
+	if err != nil {
+		return []pathError{{from, err}}
+	}
+	if err := clearDestination(from, to); err != nil {
+		return []pathError{{to, err}}
+	}
+
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(from)
+		if err == nil {
+			err = os.Symlink(target, to)
+		}
+		if err != nil {
+			return []pathError{{from, err}}
+		}
+
+	case info.IsDir():
+		if err := os.Mkdir(to, 0o700); err != nil && !errors.Is(err, fs.ErrExist) {
+			return []pathError{{to, err}}
+		}
+		var failures []pathError
+		entries, err := os.ReadDir(from)
+		if err != nil {
+			failures = append(failures, pathError{from, err})
+		}
+		for _, entry := range entries {
+			failures = append(failures, copyObject(filepath.Join(from, entry.Name()), filepath.Join(to, entry.Name()))...)
+		}
+
+		// Permissions and time go last, so a read-only directory can be filled in first
+		if err := os.Chmod(to, info.Mode().Perm()); err != nil {
+			failures = append(failures, pathError{to, err})
+		}
+		_ = os.Chtimes(to, time.Time{}, info.ModTime())
+		return failures
+
+	case info.Mode().IsRegular():
+		if err := copyFile(from, to, info); err != nil {
+			return []pathError{{from, err}}
+		}
+
+	default:
+		return []pathError{{from, errors.New("not a regular file")}}
+	}
+	return nil
+}
+
+// clearDestination removes what's at to, unless both it and from are directories, to be merged.
+// It refuses when to is from under another name, which removing would destroy.
+func clearDestination(from, to string) error {
+	existing, err := os.Lstat(to)
+	if err != nil {
+		return nil // Nothing there
+	}
+	info, err := os.Lstat(from)
+	if err != nil {
+		return err
+	}
+	if os.SameFile(info, existing) {
+		return fmt.Errorf("%s is %s under another name", filepath.Base(to), filepath.Base(from))
+	}
+	if existing.IsDir() && info.IsDir() {
+		return nil
+	}
+	return os.RemoveAll(to)
+}
+
+// sameObject reports whether two paths lead to the same object on disk: the same name in
+// another case on a case-insensitive file system, or hard links to one file
+func sameObject(a, b string) bool {
+	infoA, errA := os.Lstat(a)
+	infoB, errB := os.Lstat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
+
+// copyFile copies a regular file's content, permissions and modification time.
+// A failed copy is removed rather than left half written.
+func copyFile(from, to string, info fs.FileInfo) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(to, info.Mode().Perm())
+	}
+	if err != nil {
+		os.Remove(to)
+		return err
+	}
+	return os.Chtimes(to, time.Time{}, info.ModTime())
+}
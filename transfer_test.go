@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// transferTestTime is the modification time of the objects transferred
+var transferTestTime = time.Date(2021, 5, 6, 7, 8, 10, 0, time.UTC)
+
+// replaceAll starts a transfer with the model, choosing to replace what's in the way
+func replaceAll(t *testing.T, sources []string, dest string, move bool) opResultMsg {
+	t.Helper()
+	m := newTestModel(t, filepath.Dir(sources[0]))
+	cmd := m.startTransfer(sources, dest, move)
+	if cmd == nil {
+		if m.menu == nil {
+			t.Fatalf("nothing to run: %s", m.status)
+		}
+		cmd = m.menu.onSelect(&m, 2)
+	}
+	return runOp(t, cmd)
+}
+
+func TestTransferReplacesAndMerges(t *testing.T) {
+	for _, move := range []bool{false, true} {
+		name := "copy"
+		if move {
+			name = "move"
+		}
+		t.Run(name, func(t *testing.T) {
+			dir := tempDir(t)
+			src := filepath.Join(dir, "src")
+			dest := filepath.Join(dir, "dest")
+			writeFile(t, src, "file", "new file", transferTestTime)
+			writeFile(t, src, "d/both", "new both", transferTestTime)
+			writeFile(t, src, "d/theirs", "theirs", transferTestTime)
+			writeFile(t, dest, "file", "old file", time.Time{})
+			writeFile(t, dest, "d/both", "old both", time.Time{})
+			writeFile(t, dest, "d/mine", "mine", time.Time{})
+
+			result := replaceAll(t, []string{filepath.Join(src, "file"), filepath.Join(src, "d")}, dest, move)
+			if result.done != 2 {
+				t.Errorf("%d transferred, want 2", result.done)
+			}
+			for rel, want := range map[string]string{"file": "new file", "d/both": "new both", "d/theirs": "theirs", "d/mine": "mine"} {
+				if got := readFile(t, filepath.Join(dest, rel)); got != want {
+					t.Errorf("%s: %q, want %q", rel, got, want)
+				}
+			}
+			if info, err := os.Stat(filepath.Join(dest, "file")); err != nil || !info.ModTime().Equal(transferTestTime) {
+				t.Errorf("modification time not kept: %v", err)
+			}
+			if move {
+				assertMissing(t, filepath.Join(src, "file"))
+				assertMissing(t, filepath.Join(src, "d"))
+			} else if got := readFile(t, filepath.Join(src, "d/both")); got != "new both" {
+				t.Errorf("the source changed: %q", got)
+			}
+		})
+	}
+}
+
+func TestMoveOverObjectOfAnotherKind(t *testing.T) {
+	dir := tempDir(t)
+	from := writeFile(t, dir, "src/thing", "a file", time.Time{})
+	writeFile(t, dir, "dest/thing/inside", "a directory", time.Time{})
+
+	if failures := moveObject(from, filepath.Join(dir, "dest", "thing")); len(failures) > 0 {
+		t.Fatal(failures)
+	}
+	if got := readFile(t, filepath.Join(dir, "dest", "thing")); got != "a file" {
+		t.Errorf("destination holds %q", got)
+	}
+	assertMissing(t, from)
+}
+
+// Two names for one file stand in for a name in another case on a case-insensitive file system
+func TestTransferToAnotherNameForItself(t *testing.T) {
+	dir := tempDir(t)
+	from := writeFile(t, dir, "a.txt", "precious", time.Time{})
+	to := filepath.Join(dir, "A.txt")
+	if err := os.Link(from, to); err != nil {
+		t.Skip("no hard links here:", err)
+	}
+
+	if _, err := transferPairs([]string{from}, to, false); err == nil {
+		t.Error("copying a file onto itself should be refused")
+	}
+	if failures := copyObject(from, to); len(failures) == 0 {
+		t.Error("copyObject cleared the file it was copying")
+	}
+	if _, err := transferPairs([]string{from}, to, true); err != nil {
+		t.Errorf("moving to another name for itself: %v", err)
+	}
+
+	m := newTestModel(t, dir)
+	cmd := m.startTransfer([]string{from}, to, true)
+	if cmd == nil {
+		t.Fatalf("a move to another name for itself asked first: %v", m.menu != nil)
+	}
+	runOp(t, cmd)
+	if got := readFile(t, to); got != "precious" {
+		t.Errorf("content lost: %q", got)
+	}
+}
+
+func TestTransferPairsInsideItself(t *testing.T) {
+	dir := tempDir(t)
+	from := filepath.Join(dir, "x")
+	writeFile(t, from, "..hidden/file", "", time.Time{})
+	writeFile(t, dir, "..x/file", "", time.Time{})
+
+	if _, err := transferPairs([]string{from}, filepath.Join(from, "..hidden"), true); err == nil || !strings.Contains(err.Error(), "inside itself") {
+		t.Errorf("moving x into x/..hidden: %v", err)
+	}
+	if _, err := transferPairs([]string{from}, filepath.Join(dir, "..x"), true); err != nil {
+		t.Errorf("moving x into the sibling ..x: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// moveToTrash moves a file to the user's trash so it can be restored from the desktop's file
+// manager: the freedesktop.org home trash with its .trashinfo record, or ~/.Trash on macOS.
+// Files on another filesystem than the trash can't be moved there and are left alone.
+func moveToTrash(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	if runtime.GOOS == "darwin" {
+		dir := filepath.Join(getHomeDir(), ".Trash")
+		dest, err := uniqueTrashName(dir, "", filepath.Base(abs))
+		if err != nil {
+			return err
+		}
+		return trashRename(abs, filepath.Join(dir, dest))
+	}
+	if runtime.GOOS == "windows" {
+		return errors.New("the recycle bin isn't supported")
+	}
+
+	home := os.Getenv("XDG_DATA_HOME")
+	if home == "" {
+		home = filepath.Join(getHomeDir(), ".local", "share")
+	}
+	files, info := filepath.Join(home, "Trash", "files"), filepath.Join(home, "Trash", "info")
+	if err := os.MkdirAll(files, 0o700); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(info, 0o700); err != nil {
+		return err
+	}
+
+	// The info file is created first and exclusively: it reserves the name in the trash
+	name, err := uniqueTrashName(files, info, filepath.Base(abs))
+	if err != nil {
+		return err
+	}
+	infoPath := filepath.Join(info, name+".trashinfo")
+	record := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: abs}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+	if err := os.WriteFile(infoPath, []byte(record), 0o600); err != nil {
+		os.Remove(infoPath)
+		return err
+	}
+	if err := trashRename(abs, filepath.Join(files, name)); err != nil {
+		os.Remove(infoPath)
+		return err
+	}
+	return nil
+}
+
+// uniqueTrashName picks a name that's free in the trash's files directory, adding " 2", " 3"...
+// before the extension until one is. With an info directory, the name is also reserved there by
+// creating its .trashinfo record exclusively. A name taken in either directory is passed over:
+// a stale entry may have lost its record, or its file.
+func uniqueTrashName(files, info, base string) (string, error) {
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	for n := 1; ; n++ {
+		name := base
+		if n > 1 {
+			name = fmt.Sprintf("%s %d%s", stem, n, ext)
+		}
+		// The rename into the trash must not overwrite anything
+		if _, err := os.Lstat(filepath.Join(files, name)); err == nil {
+			continue
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		if info == "" {
+			return name, nil
+		}
+		f, err := os.OpenFile(filepath.Join(info, name+".trashinfo"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err == nil {
+			f.Close()
+			return name, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", err
+		}
+	}
+}
+
+// trashRename moves a file into the trash, explaining the one failure users will meet
+func trashRename(from, to string) error {
+	err := os.Rename(from, to)
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) && errors.Is(linkErr.Err, syscall.EXDEV) {
+		return errors.New("on another filesystem than the trash")
+	}
+	return err
+}
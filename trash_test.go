@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMoveToTrashPassesOverStaleEntries(t *testing.T) {
+	files := testTrash(t)
+	info := filepath.Join(filepath.Dir(files), "info")
+	dir := tempDir(t)
+
+	// A file left without its record, and a record left without its file
+	stale := writeFile(t, files, "notes.txt", "stale", time.Time{})
+	writeFile(t, info, "notes 2.txt.trashinfo", "", time.Time{})
+
+	path := writeFile(t, dir, "notes.txt", "fresh", time.Time{})
+	if err := moveToTrash(path); err != nil {
+		t.Fatal(err)
+	}
+	assertMissing(t, path)
+	if got := readFile(t, stale); got != "stale" {
+		t.Errorf("the stale file in the trash was overwritten: %q", got)
+	}
+	assertMissing(t, filepath.Join(files, "notes 2.txt"))
+	if got := readFile(t, filepath.Join(files, "notes 3.txt")); got != "fresh" {
+		t.Errorf("trashed file holds %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(info, "notes 3.txt.trashinfo")); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(filepath.Join(info, "notes.txt.trashinfo")); err == nil {
+		t.Error("a record was made for the stale file's name")
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Treemap colors by kind of content; the fallback is for anything else
+var (
+	treemapColors = map[string]lipgloss.Color{
+		"directory":  lipgloss.Color("4"),
+		"image":      lipgloss.Color("5"),
+		"video":      lipgloss.Color("1"),
+		"audio":      lipgloss.Color("6"),
+		"archive":    lipgloss.Color("3"),
+		"text":       lipgloss.Color("2"),
+		"executable": lipgloss.Color("9"),
+	}
+	treemapFallback = lipgloss.Color("8")
+	treemapText     = lipgloss.Color("0") // Names are written over the fill
+)
+
+// treemapRect is the area of the screen given to one object, in cells
+type treemapRect struct {
+	idx        int // Index in m.objects
+	x, y, w, h int
+}
+
+// toggleTreemap switches between the grid and the treemap. The treemap needs directory sizes,
+// so it turns disk usage mode on.
+func (m *model) toggleTreemap() {
+	m.treemapOn = !m.treemapOn
+	if m.treemapOn && !m.du.on {
+		m.toggleDu()
+	}
+	if m.layout == layoutTree {
+		m.keepFocus(true, m.applyFilter) // The contents of expanded directories have no place in the treemap
+		m.syncPaneObjects()
+	}
+}
+
+// treemapLayout splits the explorer area between the visible objects in proportion to their size.
+// Objects of no known size, and those too small to get a whole cell, have no rectangle.
+func (m model) treemapLayout() []treemapRect {
+	width, height := m.explorerSize()
+	if width < 1 || height < 1 {
+		return nil
+	}
+
+	// Biggest first: the squarified layout needs it and the big ones end up top left
+	var order []int
+	for i, obj := range m.objects {
+		if m.sortSize(obj) > 0 {
+			order = append(order, i)
+		}
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(m.sortSize(m.objects[b]), m.sortSize(m.objects[a]))
+	})
+	weights := make([]float64, len(order))
+	for i, idx := range order {
+		weights[i] = float64(m.sortSize(m.objects[idx]))
+	}
+
+	// Cells are about twice as tall as wide: lay out in a space where they're square
+	areas := squarify(weights, 0, 0, float64(width), float64(height*2))
+
+	rects := make([]treemapRect, 0, len(order))
+	for i, a := range areas {
+		x0, x1 := int(math.Round(a[0])), int(math.Round(a[0]+a[2]))
+		y0, y1 := int(math.Round(a[1]/2)), int(math.Round((a[1]+a[3])/2))
+		if x1 > x0 && y1 > y0 {
+			rects = append(rects, treemapRect{idx: order[i], x: x0, y: y0, w: x1 - x0, h: y1 - y0})
+		}
+	}
+	return rects
+}
+
+// squarify lays weights out in a rectangle as {x, y, w, h} areas, keeping them as close to
+// squares as it can (Bruls, Huizing and van Wijk). Weights must be sorted biggest first.
+func squarify(weights []float64, x, y, w, h float64) [][4]float64 {
+	areas := make([][4]float64, len(weights))
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+	}
+	if total <= 0 {
+		return areas
+	}
+	scale := w * h / total
+
+	// worst is the most elongated aspect ratio in a row of the given total area along a side
+	worst := func(sum, smallest, biggest, side float64) float64 {
+		return max(side*side*biggest/(sum*sum), sum*sum/(side*side*smallest))
+	}
+
+	for i := 0; i < len(weights); {
+		side := min(w, h)
+
+		// Grow the row while that makes its rectangles squarer
+		j, sum := i+1, weights[i]*scale
+		for j < len(weights) {
+			next := sum + weights[j]*scale
+			if worst(next, weights[j]*scale, weights[i]*scale, side) > worst(sum, weights[j-1]*scale, weights[i]*scale, side) {
+				break
+			}
+			sum = next
+			j++
+		}
+
+		// Lay the row along the short side and carry on in what's left
+		thickness := sum / side
+		pos := 0.0
+		for k := i; k < j; k++ {
+			length := weights[k] * scale / thickness
+			if w >= h {
+				areas[k] = [4]float64{x, y + pos, thickness, length}
+			} else {
+				areas[k] = [4]float64{x + pos, y, length, thickness}
+			}
+			pos += length
+		}
+		if w >= h {
+			x, w = x+thickness, w-thickness
+		} else {
+			y, h = y+thickness, h-thickness
+		}
+		i = j
+	}
+	return areas
+}
+
+// moveTreemap moves the cursor to the nearest rectangle in a direction. Rectangles lined up with
+// the current one win; failing that, the closest one on that side does.
+func (m *model) moveTreemap(dx, dy int) {
+	rects := m.treemapLayout()
+	if len(rects) == 0 {
+		return
+	}
+	current := slices.IndexFunc(rects, func(r treemapRect) bool { return r.idx == m.selectedIndex() })
+	if current < 0 {
+		m.state.FocusIndex(rects[0].idx, m.rows, m.cols)
+		return
+	}
+	cur := rects[current]
+
+	best, bestAligned, bestScore := -1, false, math.Inf(1)
+	for i, r := range rects {
+		var gap int      // Distance to travel in the direction
+		var aligned bool // Overlaps the current rectangle across the direction
+		switch {
+		case dx > 0:
+			gap, aligned = r.x-(cur.x+cur.w), r.y < cur.y+cur.h && cur.y < r.y+r.h
+		case dx < 0:
+			gap, aligned = cur.x-(r.x+r.w), r.y < cur.y+cur.h && cur.y < r.y+r.h
+		case dy > 0:
+			gap, aligned = r.y-(cur.y+cur.h), r.x < cur.x+cur.w && cur.x < r.x+r.w
+		default:
+			gap, aligned = cur.y-(r.y+r.h), r.x < cur.x+cur.w && cur.x < r.x+r.w
+		}
+		if i == current || gap < 0 {
+			continue
+		}
+
+		// Distance between centers, in square units, decides among candidates of the same kind
+		cx := float64(r.x+r.w/2) - float64(cur.x+cur.w/2)
+		cy := 2 * (float64(r.y+r.h/2) - float64(cur.y+cur.h/2))
+		score := math.Hypot(cx, cy)
+		if aligned {
+			score = float64(gap)*100 + math.Abs(cx*float64(dy)) + math.Abs(cy*float64(dx))
+		}
+		if best < 0 || aligned && !bestAligned || aligned == bestAligned && score < bestScore {
+			best, bestAligned, bestScore = i, aligned, score
+		}
+	}
+	if best >= 0 {
+		m.state.FocusIndex(rects[best].idx, m.rows, m.cols)
+	}
+}
+
+// syncTreemap puts the cursor on the biggest rectangle when its object has none, e.g. after
+// zooming in or when a size comes in and the layout changes
+func (m *model) syncTreemap() {
+	if !m.treemapOn {
+		return
+	}
+	rects := m.treemapLayout()
+	if len(rects) == 0 {
+		return
+	}
+	if !slices.ContainsFunc(rects, func(r treemapRect) bool { return r.idx == m.selectedIndex() }) {
+		m.state.FocusIndex(rects[0].idx, m.rows, m.cols)
+	}
+}
+
+// treemapKind names the kind of content that decides an object's color
+func treemapKind(obj FileSystemObject) string {
+	if obj.IsDir {
+		return "directory"
+	}
+	if t, ok := objectType(obj); ok {
+		switch {
+		case strings.HasPrefix(t.MIME, "image/"):
+			return "image"
+		case strings.HasPrefix(t.MIME, "video/"):
+			return "video"
+		case strings.HasPrefix(t.MIME, "audio/"):
+			return "audio"
+		case strings.HasSuffix(t.Description, "archive"):
+			return "archive"
+		case t.Text:
+			return "text"
+		}
+	}
+	if obj.IsExecutable() {
+		return "executable"
+	}
+	return ""
+}
+
+// renderTreemap draws the treemap: every rectangle filled with its kind's color and labeled with
+// the name and size when there is room; the object under the cursor takes the selection color
+func (m model) renderTreemap(width, height int) string {
+	rects := m.treemapLayout()
+	if len(rects) == 0 {
+		msg := "Nothing to show"
+		if m.du.scanning() || m.loading() {
+			msg = "Measuring…"
+		}
+		return lipgloss.Place(width, height, lipgloss.Center, lipgloss.Center, styleBadge.Render(msg))
+	}
+
+	// Paint cell by cell, then emit runs of cells sharing a style
+	cells := make([][]rune, height)
+	owner := make([][]int, height) // Index in rects of the rectangle covering each cell, -1 for none
+	for y := range cells {
+		cells[y] = []rune(strings.Repeat(" ", width))
+		owner[y] = slices.Repeat([]int{-1}, width)
+	}
+	styles := make([]lipgloss.Style, len(rects))
+	for i, r := range rects {
+		obj := m.objects[r.idx]
+		color, ok := treemapColors[treemapKind(obj)]
+		if !ok {
+			color = treemapFallback
+		}
+		styles[i] = lipgloss.NewStyle().Background(color).Foreground(treemapText)
+		if r.idx == m.selectedIndex() {
+			styles[i] = lipgloss.NewStyle().Background(selectedColor).Foreground(treemapText).Bold(true)
+		}
+
+		// A one-cell gap on the right and bottom keeps neighbours of the same color apart
+		w, h := r.w, r.h
+		if w > 2 {
+			w--
+		}
+		if h > 1 {
+			h--
+		}
+		for y := r.y; y < r.y+h && y < height; y++ {
+			for x := r.x; x < r.x+w && x < width; x++ {
+				owner[y][x] = i
+			}
+		}
+
+		// Name on the first line, size on the second
+		labels := []string{obj.Name, formatSize(m.sortSize(obj))}
+		for line, label := range labels[:min(len(labels), h)] {
+			text := []rune(truncateCenter(label, w))
+			copy(cells[r.y+line][r.x:r.x+w], text)
+		}
+	}
+
+	lines := make([]string, height)
+	for y := range cells {
+		var b strings.Builder
+		for x := 0; x < width; {
+			end := x + 1
+			for end < width && owner[y][end] == owner[y][x] {
+				end++
+			}
+			run := string(cells[y][x:end])
+			if owner[y][x] >= 0 {
+				run = styles[owner[y][x]].Render(run)
+			}
+			b.WriteString(run)
+			x = end
+		}
+		lines[y] = b.String()
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"io/fs"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Expanded directories of the tree layout
+const (
+	TREE_MAX_NODES    = 20000      // Caps how many objects expanding to a depth reads, so a deep tree stays usable
+	TREE_LOADING_NAME = "\x00load" // Name of the node shown in a directory still being read; no file can have it
+)
+
+// childrenMsg delivers expanded directories of the tree read in the background
+type childrenMsg struct {
+	root     string                        // Directory the tree was showing
+	children map[string][]FileSystemObject // Listings by directory
+	expand   bool                          // Expand them too, as expandToDepth does
+	status   string                        // What to tell the user, if anything
+}
+
+// treeShown reports whether the objects are listed as a tree. Duplicate groups and manifests
+// are flat lists, and the treemap has no room for what's inside directories.
+func (m model) treeShown() bool {
+	return m.layout == layoutTree && !m.treemapOn && m.dupes == nil && m.verify == nil
+}
+
+// inTree reports whether the tree layout is shown, telling the user when it isn't
+func (m *model) inTree() bool {
+	if !m.treeShown() {
+		m.status = "only in the tree layout"
+		return false
+	}
+	return true
+}
+
+// nodeDepth is how far below the current directory an object of the tree is: 0 for its own entries
+func (m model) nodeDepth(obj FileSystemObject) int {
+	if !m.treeShown() {
+		return 0
+	}
+	rel, err := filepath.Rel(m.state.currentPath, obj.Path)
+	if err != nil {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator))
+}
+
+// treeLevel lists objects of one level of the tree in the chosen order, each expanded directory
+// followed by its own level. With a filter, directories stay when something below them matches.
+func (m *model) treeLevel(objects []FileSystemObject, depth int) []FileSystemObject {
+	needle := strings.ToLower(m.state.filter)
+	var level []FileSystemObject
+	for _, obj := range m.sorted(objects) {
+		var below []FileSystemObject
+		if obj.IsDir && m.state.expanded[obj.Path] {
+			if children, ok := m.childrenOf(obj.Path); ok {
+				below = m.treeLevel(children, depth+1)
+			} else {
+				below = []FileSystemObject{loadingNode(obj.Path)}
+			}
+		}
+		if len(below) > 0 || strings.Contains(strings.ToLower(obj.Name), needle) {
+			level = append(level, obj)
+			level = append(level, below...)
+		}
+	}
+	return level
+}
+
+// childrenOf returns the listing of an expanded directory. One that wasn't read yet is read in
+// the background by syncChildren; until it comes in, ok is false. A commit's directories come
+// from its tree, which is read at once like the commit's top directory.
+func (m *model) childrenOf(path string) ([]FileSystemObject, bool) {
+	if listing, ok := m.children[path]; ok {
+		return listing, true
+	}
+	if m.tree != nil {
+		listing, err := m.tree.list(path)
+		if err != nil {
+			m.status = err.Error()
+		}
+		m.storeChildren(map[string][]FileSystemObject{path: listing})
+		return listing, true
+	}
+	if _, ok := m.childLoads[path]; !ok {
+		if m.childLoads == nil {
+			m.childLoads = map[string]bool{}
+		}
+		m.childLoads[path] = false
+	}
+	return nil, false
+}
+
+// storeChildren keeps the listings of expanded directories
+func (m *model) storeChildren(children map[string][]FileSystemObject) {
+	if m.children == nil {
+		m.children = map[string][]FileSystemObject{}
+	}
+	maps.Copy(m.children, children)
+}
+
+// reloadChildren has the expanded directories read again in the background. Their listings stay
+// on screen until the new ones come in.
+func (m *model) reloadChildren() {
+	for path := range m.children {
+		if _, ok := m.childLoads[path]; !ok {
+			if m.childLoads == nil {
+				m.childLoads = map[string]bool{}
+			}
+			m.childLoads[path] = false
+		}
+	}
+}
+
+// syncChildren starts reading the expanded directories the tree waits for, all in one command
+func (m *model) syncChildren() tea.Cmd {
+	var paths []string
+	for path, started := range m.childLoads {
+		if !started {
+			m.childLoads[path] = true
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	root := m.state.currentPath
+	return func() tea.Msg {
+		msg := childrenMsg{root: root, children: make(map[string][]FileSystemObject, len(paths))}
+		for _, path := range paths {
+			listing, err := listObjects(path)
+			if err != nil && msg.status == "" {
+				msg.status = err.Error()
+			}
+			msg.children[path] = listing
+		}
+		return msg
+	}
+}
+
+// showChildren puts expanded directories read in the background in the tree, if it still shows
+// the directory they were read for
+func (m *model) showChildren(msg childrenMsg) {
+	if msg.root != m.state.currentPath {
+		return
+	}
+	if msg.expand && m.state.expanded == nil {
+		m.state.expanded = map[string]bool{}
+	}
+	for path := range msg.children {
+		if !msg.expand {
+			if _, wanted := m.childLoads[path]; !wanted {
+				delete(msg.children, path) // Read for a tree since dropped
+				continue
+			}
+		}
+		if m.childLoads[path] {
+			delete(m.childLoads, path) // Unless it was asked for again meanwhile
+		}
+		if msg.expand {
+			m.state.expanded[path] = true
+		}
+	}
+	m.storeChildren(msg.children)
+	if msg.status != "" {
+		m.status = msg.status
+	}
+	m.keepFocus(true, m.applyFilter)
+}
+
+// readExpanded reads the expanded directories among objects, and those expanded below them, as
+// the tree shows them. It stops once TREE_MAX_NODES objects were read.
+func readExpanded(objects []FileSystemObject, expanded map[string]bool) map[string][]FileSystemObject {
+	children := map[string][]FileSystemObject{}
+	nodes := len(objects)
+	for len(objects) > 0 && nodes < TREE_MAX_NODES {
+		var next []FileSystemObject
+		for _, obj := range objects {
+			if obj.IsDir && expanded[obj.Path] {
+				listing, _ := listObjects(obj.Path)
+				children[obj.Path] = listing
+				next = append(next, listing...)
+				nodes += len(listing)
+			}
+		}
+		objects = next
+	}
+	return children
+}
+
+// loadingNode stands in the tree for the contents of a directory still being read
+func loadingNode(dir string) FileSystemObject {
+	return FileSystemObject{Name: "loading…", Path: filepath.Join(dir, TREE_LOADING_NAME)}
+}
+
+// isLoadingNode reports whether an object is the stand-in of a directory being read
+func isLoadingNode(obj FileSystemObject) bool {
+	return filepath.Base(obj.Path) == TREE_LOADING_NAME
+}
+
+// setExpanded expands or collapses a directory, keeping the cursor on the same object
+func (m *model) setExpanded(path string, expanded bool) {
+	if m.state.expanded == nil {
+		m.state.expanded = map[string]bool{}
+	}
+	if expanded {
+		m.state.expanded[path] = true
+	} else {
+		delete(m.state.expanded, path)
+	}
+	m.keepFocus(true, m.applyFilter)
+}
+
+// nodeUnderCursor returns the object under the cursor, stat'ed so links to directories are known
+func (m *model) nodeUnderCursor() (int, FileSystemObject, bool) {
+	idx := m.selectedIndex()
+	if idx < 0 || idx >= len(m.objects) {
+		return idx, FileSystemObject{}, false
+	}
+	obj := m.objects[idx]
+	if isLoadingNode(obj) {
+		return idx, FileSystemObject{}, false
+	}
+	if !obj.Loaded {
+		obj.load()
+	}
+	return idx, obj, true
+}
+
+// focusParentNode moves the cursor from a nested object to the directory it's in
+func (m *model) focusParentNode(idx int) bool {
+	parent := filepath.Dir(m.objects[idx].Path)
+	for i := idx - 1; i >= 0; i-- {
+		if m.objects[i].Path == parent {
+			m.state.FocusIndex(i, m.rows, m.cols)
+			return true
+		}
+	}
+	return false
+}
+
+// treeRight expands the directory under the cursor, or steps into it if it's expanded already
+func (m *model) treeRight() {
+	idx, obj, ok := m.nodeUnderCursor()
+	switch {
+	case !ok || !obj.IsDir:
+		// Files have nothing to expand; Enter opens them
+	case !m.state.expanded[obj.Path]:
+		m.setExpanded(obj.Path, true)
+	case idx+1 < len(m.objects) && m.nodeDepth(m.objects[idx+1]) > m.nodeDepth(obj):
+		m.state.FocusIndex(idx+1, m.rows, m.cols)
+	}
+}
+
+// treeLeft collapses the directory under the cursor, or goes to the directory the object is in:
+// its node in the tree, or the parent directory from the top level
+func (m *model) treeLeft() tea.Cmd {
+	idx, obj, ok := m.nodeUnderCursor()
+	switch {
+	case ok && obj.IsDir && m.state.expanded[obj.Path]:
+		m.setExpanded(obj.Path, false)
+	case ok && m.nodeDepth(obj) > 0:
+		m.focusParentNode(idx)
+	default:
+		return m.leaveDir()
+	}
+	return nil
+}
+
+// toggleNode expands or collapses the directory under the cursor. On a file, the directory it's
+// in is collapsed, like za closes the fold around the cursor in vim.
+func (m *model) toggleNode() {
+	if !m.inTree() {
+		return
+	}
+	idx, obj, ok := m.nodeUnderCursor()
+	switch {
+	case !ok:
+	case obj.IsDir:
+		m.setExpanded(obj.Path, !m.state.expanded[obj.Path])
+	case m.nodeDepth(obj) > 0 && m.focusParentNode(idx):
+		m.setExpanded(filepath.Dir(obj.Path), false)
+	}
+}
+
+// trashNode moves the object under the cursor to the trash once confirmed: nested as deep as it
+// is in the tree, regardless of the marks
+func (m *model) trashNode() {
+	if !m.inTree() {
+		return
+	}
+	_, obj, ok := m.nodeUnderCursor()
+	if !ok {
+		return
+	}
+	title := "Move " + obj.Name + " to the trash?"
+	if obj.IsDir && obj.Mode&fs.ModeSymlink == 0 {
+		title = "Move " + obj.Name + " and everything in it to the trash?"
+	}
+	m.openMenu(title, []string{"Keep it", "Move to the trash"}, func(m *model, idx int) tea.Cmd {
+		if idx != 1 {
+			return nil
+		}
+		return runBatch("trash", []string{obj.Path}, func(path string) (int, []pathError) {
+			if err := moveToTrash(path); err != nil {
+				return 0, []pathError{{path, err}}
+			}
+			return 1, nil
+		})
+	})
+}
+
+// promptExpandAll asks how deep to expand the tree
+func (m *model) promptExpandAll() {
+	if !m.inTree() {
+		return
+	}
+	m.openPrompt("Expand to depth", "2", func(m *model, value string) tea.Cmd {
+		depth, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || depth < 0 {
+			m.status = "not a depth: " + value
+			return nil
+		}
+		return m.expandToDepth(depth)
+	})
+}
+
+// expandToDepth expands every directory under the current one down to depth levels, and
+// collapses those below. The levels are read in the background by the returned command, except
+// a commit's, which are read at once.
+func (m *model) expandToDepth(depth int) tea.Cmd {
+	for path := range m.state.expanded {
+		if rel, err := filepath.Rel(m.state.currentPath, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			delete(m.state.expanded, path)
+		}
+	}
+	if m.state.expanded == nil {
+		m.state.expanded = map[string]bool{}
+	}
+
+	root, listing := m.state.currentPath, slices.Clone(m.listing) // Stats may still stream into the listing
+	if m.tree != nil {
+		m.showChildren(readLevels(root, listing, depth, m.tree.list))
+		return nil
+	}
+	m.keepFocus(true, m.applyFilter)
+	m.status = "expanding to depth " + strconv.Itoa(depth) + "…"
+	return func() tea.Msg {
+		return readLevels(root, listing, depth, listObjects)
+	}
+}
+
+// readLevels reads the directories below root down to depth levels, for expandToDepth. Levels are
+// read one at a time, so hitting TREE_MAX_NODES leaves the tree evenly expanded. Links aren't
+// followed, as they could go round in circles.
+func readLevels(root string, listing []FileSystemObject, depth int, list func(path string) ([]FileSystemObject, error)) childrenMsg {
+	msg := childrenMsg{root: root, children: map[string][]FileSystemObject{}, expand: true}
+	nodes := len(listing)
+	level := listing
+	for d := 0; d < depth && len(level) > 0 && nodes < TREE_MAX_NODES; d++ {
+		var next []FileSystemObject
+		for _, obj := range level {
+			if !obj.IsDir || obj.IsSymlink() {
+				continue
+			}
+			children, err := list(obj.Path)
+			if err != nil && msg.status == "" {
+				msg.status = err.Error()
+			}
+			msg.children[obj.Path] = children
+			next = append(next, children...)
+			if nodes += len(children); nodes >= TREE_MAX_NODES {
+				msg.status = "stopped expanding at " + strconv.Itoa(nodes) + " objects"
+				break
+			}
+		}
+		level = next
+	}
+	if msg.status == "" {
+		msg.status = "expanded to depth " + strconv.Itoa(depth)
+	}
+	return msg
+}
+
+// treeGuides draws the indentation of every object: a line down each level that has more
+// objects to come, and a branch to the object itself
+func (m model) treeGuides() []string {
+	guides := make([]string, len(m.objects))
+	var more []bool // Whether an object follows at each depth, before the tree goes back up past it
+
+	// Walking up from the bottom, what follows each object is known when it's reached
+	for i := len(m.objects) - 1; i >= 0; i-- {
+		depth := m.nodeDepth(m.objects[i])
+		for len(more) <= depth {
+			more = append(more, false)
+		}
+
+		var b strings.Builder
+		for level := 1; level < depth; level++ {
+			if more[level] {
+				b.WriteString("│  ")
+			} else {
+				b.WriteString("   ")
+			}
+		}
+		if depth > 0 {
+			if more[depth] {
+				b.WriteString("├─ ")
+			} else {
+				b.WriteString("└─ ")
+			}
+		}
+		guides[i] = b.String()
+
+		more[depth] = true
+		for level := depth + 1; level < len(more); level++ {
+			more[level] = false
+		}
+	}
+	return guides
+}
+
+// renderTree draws one row per visible object, indented under the directory it's in
+func (m model) renderTree(width, height int) string {
+	guides := m.treeGuides()
+	total := m.duTotal()
+	guideStyle := lipgloss.NewStyle().Foreground(borderColor)
+
+	var lines []string
+	for row := 0; row < m.rows && row < height; row++ {
+		idx := m.state.viewportRowOffset + row
+		if idx >= len(m.objects) {
+			break
+		}
+		obj := m.objects[idx]
+		focused := row == m.state.coordinateIdx[0]
+
+		gutter := " "
+		switch {
+		case m.state.selected[obj.Path]:
+			gutter = "✓"
+		case focused:
+			gutter = "›"
+		}
+		if isLoadingNode(obj) {
+			lines = append(lines, gutter+"   "+guideStyle.Render(guides[idx])+styleBadge.Render(obj.Name))
+			continue
+		}
+		git := m.gitCode(obj)
+		gitCell := string(git) + strings.Repeat(" ", max(2-lipgloss.Width(string(git)), 0))
+
+		// Directories show whether they're expanded
+		twisty := "  "
+		if obj.IsDir {
+			twisty = "▸ "
+			if m.state.expanded[obj.Path] {
+				twisty = "▾ "
+			}
+		}
+
+		// Files show their size, directories theirs once disk usage mode measured them
+		size := ""
+		if obj.Loaded && !obj.IsDir {
+			size = " " + formatSize(obj.Size)
+		} else if dirSize, _ := m.duTileInfo(obj, total, FILE_OBJECT_WIDTH-2); dirSize != "" {
+			size = " " + dirSize
+		}
+		used := lipgloss.Width(gutter) + 3 + lipgloss.Width(guides[idx]) + lipgloss.Width(twisty) + lipgloss.Width(size)
+		name := fitCell("["+obj.Marker()+"] "+obj.Name, max(width-used, 1), false)
+
+		if focused {
+			lines = append(lines, styleRowSelected.Render(gutter+" "+gitCell+guides[idx]+twisty+name+size))
+			continue
+		}
+		lines = append(lines, gutter+" "+renderGitBadge(git)+gitCell[len(git):]+
+			guideStyle.Render(guides[idx])+twisty+m.nameStyle(obj).Render(name)+styleBadge.Render(size))
+	}
+
+	return lipgloss.NewStyle().
+		Width(width).
+		MaxWidth(width).
+		Height(height).
+		Render(strings.Join(lines, "\n"))
+}
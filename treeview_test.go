@@ -0,0 +1,179 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// treeTestModel shows dir in the tree layout with the given directories expanded
+func treeTestModel(t *testing.T, dir string, expanded ...string) model {
+	t.Helper()
+	m := newTestModel(t, dir)
+	m.layout = layoutTree
+	m.resize()
+	for _, path := range expanded {
+		m.setExpanded(path, true)
+		loadChildren(t, &m)
+	}
+	return m
+}
+
+// loadChildren reads the expanded directories the tree waits for, as Update has it done in the background
+func loadChildren(t *testing.T, m *model) {
+	t.Helper()
+	for cmd := m.syncChildren(); cmd != nil; cmd = m.syncChildren() {
+		msg, ok := cmd().(childrenMsg)
+		if !ok {
+			t.Fatal("expanded directories weren't read")
+		}
+		m.showChildren(msg)
+	}
+}
+
+// focusPath puts the cursor on the object at path, failing the test if it isn't listed
+func focusPath(t *testing.T, m *model, path string) {
+	t.Helper()
+	for i, obj := range m.objects {
+		if obj.Path == path {
+			m.state.FocusIndex(i, m.rows, m.cols)
+			return
+		}
+	}
+	t.Fatalf("%s isn't listed", path)
+}
+
+func TestTrashNode(t *testing.T) {
+	trash := testTrash(t)
+	dir := tempDir(t)
+	victim := writeFile(t, dir, "sub/inner/victim", "victim", time.Time{})
+	sibling := writeFile(t, dir, "sub/inner/sibling", "sibling", time.Time{})
+	marked := writeFile(t, dir, "marked", "marked", time.Time{})
+	m := treeTestModel(t, dir, filepath.Join(dir, "sub"), filepath.Join(dir, "sub", "inner"))
+	markPaths(&m, marked) // Marks don't matter: the node under the cursor goes
+	focusPath(t, &m, victim)
+
+	runes := func(s string) tea.KeyMsg { return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)} }
+	m = pressKeys(m, runes("z"), runes("d"))
+	if m.menu == nil {
+		t.Fatalf("no confirmation asked: %s", m.status)
+	}
+	if cmd := m.menu.onSelect(&m, 0); cmd != nil {
+		t.Error("keeping the node shouldn't run anything")
+	}
+	readFile(t, victim)
+
+	m = pressKeys(m, runes("z"), runes("d"))
+	result := runOp(t, m.menu.onSelect(&m, 1))
+	if result.done != 1 {
+		t.Errorf("%d trashed, want 1", result.done)
+	}
+	assertMissing(t, victim)
+	if got := readFile(t, filepath.Join(trash, "victim")); got != "victim" {
+		t.Errorf("trashed file holds %q", got)
+	}
+	readFile(t, sibling)
+	readFile(t, marked)
+}
+
+func TestTrashNodeOnlyInTree(t *testing.T) {
+	dir := tempDir(t)
+	writeFile(t, dir, "file", "", time.Time{})
+	m := newTestModel(t, dir)
+	m.trashNode()
+	if m.menu != nil || m.status != "only in the tree layout" {
+		t.Errorf("menu %v, status %q", m.menu != nil, m.status)
+	}
+}
+
+func TestExpandToDepthCollapsesNamesStartingWithDots(t *testing.T) {
+	dir := tempDir(t)
+	writeFile(t, dir, "..sub/file", "", time.Time{})
+	writeFile(t, dir, "sub/file", "", time.Time{})
+	outside := filepath.Join(filepath.Dir(dir), "elsewhere")
+	m := treeTestModel(t, dir, filepath.Join(dir, "..sub"), filepath.Join(dir, "sub"))
+	m.state.expanded[outside] = true
+
+	m.expandToDepth(0)
+	for path, expanded := range m.state.expanded {
+		if expanded && path != outside {
+			t.Errorf("%s is still expanded", path)
+		}
+	}
+	if !m.state.expanded[outside] {
+		t.Error("a directory outside the current one was collapsed")
+	}
+}
+
+func TestExpandReadsInBackground(t *testing.T) {
+	dir := tempDir(t)
+	writeFile(t, dir, "sub/file", "", time.Time{})
+	m := treeTestModel(t, dir)
+	sub := filepath.Join(dir, "sub")
+	focusPath(t, &m, sub)
+	m.setExpanded(sub, true)
+
+	// Until the directory is read, a placeholder stands in for its contents and can't be acted on
+	if len(m.objects) != 2 || !isLoadingNode(m.objects[1]) {
+		t.Fatalf("objects while loading: %v", m.objects)
+	}
+	m.state.FocusIndex(1, m.rows, m.cols)
+	if _, _, ok := m.nodeUnderCursor(); ok || len(m.targets()) != 0 {
+		t.Error("the placeholder can be acted on")
+	}
+	if m.handleSelection() != nil {
+		t.Error("the placeholder can be opened")
+	}
+
+	loadChildren(t, &m)
+	focusPath(t, &m, filepath.Join(sub, "file"))
+
+	// A refresh keeps the listing on screen while it's read again
+	writeFile(t, dir, "sub/new", "", time.Time{})
+	m.refreshListing()
+	focusPath(t, &m, filepath.Join(sub, "file"))
+	loadChildren(t, &m)
+	focusPath(t, &m, filepath.Join(sub, "new"))
+}
+
+func TestExpandToDepthReadsInBackground(t *testing.T) {
+	dir := tempDir(t)
+	writeFile(t, dir, "a/b/c/file", "", time.Time{})
+	m := treeTestModel(t, dir)
+	cmd := m.expandToDepth(2)
+	if cmd == nil || len(m.children) != 0 {
+		t.Fatal("the levels were read in Update")
+	}
+
+	msg := cmd().(childrenMsg)
+	m.showChildren(msg)
+	focusPath(t, &m, filepath.Join(dir, "a", "b", "c"))
+	if m.state.expanded[filepath.Join(dir, "a", "b", "c")] {
+		t.Error("expanded past the depth asked for")
+	}
+
+	// Read for a directory since left, it's dropped
+	m.state.currentPath = filepath.Join(dir, "a")
+	m.openCurrentPath()
+	m.showChildren(msg)
+	if len(m.children) != 0 {
+		t.Error("levels read for another directory were kept")
+	}
+}
+
+func TestPaneTreeReadsInBackground(t *testing.T) {
+	dir := tempDir(t)
+	writeFile(t, dir, "sub/file", "", time.Time{})
+	m := treeTestModel(t, dir, filepath.Join(dir, "sub"))
+	cmd := m.toggleDualPane()
+	writeFile(t, dir, "sub/new", "", time.Time{})
+	m.showPaneListing(cmd().(listingRefreshedMsg), false)
+
+	want := []string{"sub", "file", "new"}
+	if got := paneNames(m); !slices.Equal(got, want) {
+		t.Errorf("the other pane shows %v, want %v", got, want)
+	}
+}
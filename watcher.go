@@ -0,0 +1,207 @@
+package main
+
+import (
+	"hash/fnv"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Timing of change notifications
+const (
+	WATCH_DEBOUNCE      = 150 * time.Millisecond // Quiet period after the last event before refreshing
+	WATCH_MAX_DELAY     = 1 * time.Second        // Refresh at least this often during a steady stream of events
+	WATCH_POLL_INTERVAL = 2 * time.Second        // How often the polling fallback looks at the directory
+	WATCH_POLL_MAX_STAT = 5000                   // Above this many entries, polling only checks the directory's own mtime
+)
+
+// dirWatcher reports changes to one directory. Raw events from the OS (or the poller)
+// are debounced into at most one pending notification on the changes channel.
+type dirWatcher struct {
+	path    string
+	changes chan struct{} // Debounced notifications; closed when the watcher stops
+	raw     chan struct{} // Undebounced events from the backend
+	done    chan struct{} // Closed by stop to shut down the goroutines
+	once    sync.Once
+	close   func() // Releases backend resources (inotify descriptor...)
+}
+
+// dirChangedMsg tells the model that the watched directory changed on disk
+type dirChangedMsg struct {
+	watcher *dirWatcher
+}
+
+// newDirWatcher starts watching a directory, using the native backend when the platform has one
+// and polling otherwise
+func newDirWatcher(path string) *dirWatcher {
+	w := &dirWatcher{
+		path:    path,
+		changes: make(chan struct{}, 1),
+		raw:     make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	if err := startNativeWatch(w); err != nil {
+		go w.poll()
+	}
+	go w.debounce()
+	return w
+}
+
+// stop shuts the watcher down; its pending wait command returns without a message
+func (w *dirWatcher) stop() {
+	w.once.Do(func() {
+		close(w.done)
+		if w.close != nil {
+			w.close()
+		}
+	})
+}
+
+// notify records a raw event without ever blocking the backend
+func (w *dirWatcher) notify() {
+	select {
+	case w.raw <- struct{}{}:
+	default: // An event is already pending; they're all the same to us
+	}
+}
+
+// debounce turns bursts of raw events into single notifications: it waits for a quiet period,
+// but never holds a notification back longer than WATCH_MAX_DELAY
+func (w *dirWatcher) debounce() {
+	defer close(w.changes)
+
+	for {
+		// Wait for the first event of a burst
+		select {
+		case <-w.done:
+			return
+		case <-w.raw:
+		}
+
+		deadline := time.After(WATCH_MAX_DELAY)
+		quiet := time.NewTimer(WATCH_DEBOUNCE)
+	burst:
+		for {
+			select {
+			case <-w.done:
+				quiet.Stop()
+				return
+			case <-w.raw:
+				quiet.Reset(WATCH_DEBOUNCE)
+			case <-quiet.C:
+				break burst
+			case <-deadline:
+				quiet.Stop()
+				break burst
+			}
+		}
+
+		select {
+		case w.changes <- struct{}{}:
+		default: // The model hasn't picked up the previous notification yet
+		}
+	}
+}
+
+// wait returns a command that delivers the next change notification
+func (w *dirWatcher) wait() tea.Cmd {
+	return func() tea.Msg {
+		if _, ok := <-w.changes; !ok {
+			return nil // Watcher stopped
+		}
+		return dirChangedMsg{watcher: w}
+	}
+}
+
+// poll is the portable fallback: it fingerprints the directory at a fixed interval
+func (w *dirWatcher) poll() {
+	ticker := time.NewTicker(WATCH_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	last := dirFingerprint(w.path)
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			if current := dirFingerprint(w.path); current != last {
+				last = current
+				w.notify()
+			}
+		}
+	}
+}
+
+// dirFingerprint hashes what a listing shows (names, sizes, times, modes) so that any visible
+// change alters it. Huge directories fall back to the directory's own mtime, which still
+// catches files being added, removed or renamed.
+func dirFingerprint(path string) uint64 {
+	h := fnv.New64a()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0 // Gone: compares unequal to any existing directory's fingerprint
+	}
+	h.Write([]byte(info.ModTime().String()))
+
+	entries, err := os.ReadDir(path)
+	if err != nil || len(entries) > WATCH_POLL_MAX_STAT {
+		return h.Sum64()
+	}
+	for _, entry := range entries {
+		h.Write([]byte(entry.Name()))
+		if info, err := entry.Info(); err == nil {
+			h.Write([]byte(info.ModTime().String()))
+			h.Write([]byte(info.Mode().String()))
+			h.Write(strconv.AppendInt(nil, info.Size(), 10))
+		}
+	}
+	return h.Sum64()
+}
+
+// syncWatcher makes sure the watcher follows the current directory.
+// It returns the command waiting for the first change when a new watcher was started.
+func (m *model) syncWatcher() tea.Cmd {
+	if m.virtualList() != nil {
+		// The current directory isn't what's shown
+		if m.watcher != nil {
+			m.watcher.stop()
+			m.watcher = nil
+		}
+		return nil
+	}
+	if m.watcher != nil && m.watcher.path == m.state.currentPath {
+		return nil
+	}
+	if m.watcher != nil {
+		m.watcher.stop()
+	}
+	m.watcher = newDirWatcher(m.state.currentPath)
+	return m.watcher.wait()
+}
+
+// syncPaneWatcher makes sure a watcher follows the other pane's directory in the dual-pane view,
+// and that none is left once there is no other pane.
+// It returns the command waiting for the first change when a new watcher was started.
+func (m *model) syncPaneWatcher() tea.Cmd {
+	path := ""
+	if m.pane != nil && m.paneModel().virtualList() == nil {
+		path = m.pane.state.currentPath
+	}
+	if m.paneWatcher != nil && m.paneWatcher.path == path {
+		return nil
+	}
+	if m.paneWatcher != nil {
+		m.paneWatcher.stop()
+		m.paneWatcher = nil
+	}
+	if path == "" {
+		return nil
+	}
+	m.paneWatcher = newDirWatcher(path)
+	return m.paneWatcher.wait()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyMask selects every event that can change what the grid shows
+const inotifyMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO |
+	unix.IN_MODIFY | unix.IN_ATTRIB | unix.IN_CLOSE_WRITE | unix.IN_DELETE_SELF | unix.IN_MOVE_SELF
+
+// startNativeWatch watches the directory with inotify. The descriptor is non-blocking so
+// os.NewFile hands it to Go's poller, which lets stop interrupt the pending read by closing it.
+func startNativeWatch(w *dirWatcher) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return err
+	}
+	if _, err := unix.InotifyAddWatch(fd, w.path, inotifyMask); err != nil {
+		unix.Close(fd)
+		return err
+	}
+
+	f := os.NewFile(uintptr(fd), "inotify")
+	w.close = func() { f.Close() }
+
+	go func() {
+		// We don't care which file changed, only that something did, so events aren't decoded
+		buf := make([]byte, 64*1024)
+		for {
+			if _, err := f.Read(buf); err != nil {
+				return // Closed by stop, or the watch is gone
+			}
+			w.notify()
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// startNativeWatch has no native backend on this platform, so the poller takes over
+func startNativeWatch(w *dirWatcher) error {
+	return errors.New("no native directory watcher on this platform")
+}